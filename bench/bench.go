@@ -0,0 +1,249 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lovoo/goka"
+)
+
+const (
+	defaultMessages  = 10000
+	defaultKeys      = 100
+	defaultValueSize = 100
+	defaultTimeout   = time.Minute
+)
+
+// Config configures the synthetic load generated by the bench.
+type Config struct {
+	// Messages is the total number of messages to emit.
+	Messages int
+	// Rate limits the number of messages emitted per second. Zero means unlimited.
+	Rate int
+	// Keys is the number of distinct keys used for the messages (key cardinality).
+	Keys int
+	// ValueSize is the size in bytes of the generated values.
+	ValueSize int
+	// Value creates the value to emit for a key. It defaults to a []byte of ValueSize bytes,
+	// which requires the input to use codec.Bytes.
+	Value func(key string, size int) interface{}
+	// Timeout is the time to wait for all messages to be processed after emitting.
+	Timeout time.Duration
+}
+
+// Report contains the results of a bench run.
+type Report struct {
+	Emitted   int
+	Processed int
+	Duration  time.Duration
+
+	// Throughput is the number of processed messages per second
+	Throughput float64
+	P50        time.Duration
+	P99        time.Duration
+
+	// storage writes of the processor's group table during the run
+	StorageWrites     uint
+	StorageWriteBytes int
+	// StorageWriteRate is the number of storage writes per second
+	StorageWriteRate float64
+}
+
+// String formats the report for human readers
+func (r *Report) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "processed %d/%d messages in %s (%.1f msg/s)\n", r.Processed, r.Emitted, r.Duration, r.Throughput)
+	fmt.Fprintf(&sb, "latency p50=%s p99=%s\n", r.P50, r.P99)
+	fmt.Fprintf(&sb, "storage writes %d (%d bytes, %.1f writes/s)", r.StorageWrites, r.StorageWriteBytes, r.StorageWriteRate)
+	return sb.String()
+}
+
+// Bench generates load and tracks the processing latency of a processor.
+type Bench struct {
+	cfg Config
+
+	m         sync.Mutex
+	pending   map[string][]time.Time
+	latencies []time.Duration
+	processed chan struct{}
+}
+
+// New creates a new bench using passed config. Unset values are replaced by defaults.
+func New(cfg Config) *Bench {
+	if cfg.Messages <= 0 {
+		cfg.Messages = defaultMessages
+	}
+	if cfg.Keys <= 0 {
+		cfg.Keys = defaultKeys
+	}
+	if cfg.ValueSize <= 0 {
+		cfg.ValueSize = defaultValueSize
+	}
+	if cfg.Value == nil {
+		cfg.Value = func(key string, size int) interface{} {
+			return make([]byte, size)
+		}
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	return &Bench{
+		cfg:       cfg,
+		pending:   make(map[string][]time.Time),
+		processed: make(chan struct{}, cfg.Messages),
+	}
+}
+
+// Wrap returns a callback that calls cb and tracks the latency of the message.
+// Messages of one key are processed in order, so the latency is calculated against
+// the oldest pending emit of the message's key.
+func (b *Bench) Wrap(cb goka.ProcessCallback) goka.ProcessCallback {
+	return func(ctx goka.Context, msg interface{}) {
+		cb(ctx, msg)
+
+		b.m.Lock()
+		defer b.m.Unlock()
+		sent := b.pending[ctx.Key()]
+		if len(sent) == 0 {
+			// not emitted by the bench
+			return
+		}
+		b.latencies = append(b.latencies, time.Since(sent[0]))
+		b.pending[ctx.Key()] = sent[1:]
+
+		select {
+		case b.processed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run emits the configured messages via emitter and waits for them to be processed.
+// If proc is not nil, the bench waits for the processor to be ready before emitting
+// and includes the storage writes of its group table in the report.
+func (b *Bench) Run(ctx context.Context, emitter *goka.Emitter, proc *goka.Processor) (*Report, error) {
+	if emitter == nil {
+		return nil, errors.New("cannot run bench without emitter")
+	}
+
+	if proc != nil {
+		proc.WaitForReady()
+	}
+	writesBefore, bytesBefore := storageWrites(proc)
+
+	var (
+		report  = new(Report)
+		emitErr error
+		errM    sync.Mutex
+		ticker  *time.Ticker
+		start   = time.Now()
+	)
+	if b.cfg.Rate > 0 {
+		ticker = time.NewTicker(time.Second / time.Duration(b.cfg.Rate))
+		defer ticker.Stop()
+	}
+
+	for i := 0; i < b.cfg.Messages; i++ {
+		if ticker != nil {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		key := fmt.Sprintf("key-%d", i%b.cfg.Keys)
+		b.m.Lock()
+		b.pending[key] = append(b.pending[key], time.Now())
+		b.m.Unlock()
+
+		promise, err := emitter.Emit(key, b.cfg.Value(key, b.cfg.ValueSize))
+		if err != nil {
+			return nil, fmt.Errorf("error emitting message %d: %v", i, err)
+		}
+		promise.Then(func(err error) {
+			if err != nil {
+				errM.Lock()
+				defer errM.Unlock()
+				emitErr = err
+			}
+		})
+		report.Emitted++
+	}
+
+	timeout := time.NewTimer(b.cfg.Timeout)
+	defer timeout.Stop()
+WaitLoop:
+	for report.Processed < report.Emitted {
+		select {
+		case <-b.processed:
+			report.Processed++
+		case <-timeout.C:
+			break WaitLoop
+		case <-ctx.Done():
+			break WaitLoop
+		}
+	}
+	report.Duration = time.Since(start)
+
+	errM.Lock()
+	defer errM.Unlock()
+	if emitErr != nil {
+		return nil, fmt.Errorf("error emitting messages: %v", emitErr)
+	}
+
+	writesAfter, bytesAfter := storageWrites(proc)
+	report.StorageWrites = writesAfter - writesBefore
+	report.StorageWriteBytes = bytesAfter - bytesBefore
+
+	seconds := report.Duration.Seconds()
+	if seconds > 0 {
+		report.Throughput = float64(report.Processed) / seconds
+		report.StorageWriteRate = float64(report.StorageWrites) / seconds
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+	report.P50 = percentile(b.latencies, 0.5)
+	report.P99 = percentile(b.latencies, 0.99)
+
+	if report.Processed < report.Emitted {
+		return report, fmt.Errorf("only %d of %d messages were processed", report.Processed, report.Emitted)
+	}
+	return report, nil
+}
+
+// storageWrites sums up the table writes of all partitions of the processor
+func storageWrites(proc *goka.Processor) (uint, int) {
+	if proc == nil {
+		return 0, 0
+	}
+	var (
+		count uint
+		bytes int
+	)
+	for _, part := range proc.Stats().Group {
+		if part == nil || part.TableStats == nil {
+			continue
+		}
+		count += part.TableStats.Writes.Count
+		bytes += part.TableStats.Writes.Bytes
+	}
+	return count, bytes
+}
+
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(latencies))
+	copy(sorted, latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
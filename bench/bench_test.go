@@ -0,0 +1,52 @@
+package bench
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/tester"
+)
+
+func TestBench(t *testing.T) {
+	var (
+		gkt = tester.New(t)
+		b   = New(Config{
+			Messages:  50,
+			Keys:      5,
+			ValueSize: 10,
+			Timeout:   10 * time.Second,
+		})
+	)
+
+	proc, err := goka.NewProcessor(nil, goka.DefineGroup("bench",
+		goka.Input("input", new(codec.Bytes), b.Wrap(func(ctx goka.Context, msg interface{}) {
+			ctx.SetValue(msg)
+		})),
+		goka.Persist(new(codec.Bytes)),
+	), goka.WithTester(gkt))
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		test.AssertNil(t, proc.Run(ctx))
+	}()
+
+	emitter, err := goka.NewEmitter(nil, "input", new(codec.Bytes), goka.WithEmitterTester(gkt))
+	test.AssertNil(t, err)
+
+	report, err := b.Run(ctx, emitter, proc)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, report.Emitted, 50)
+	test.AssertEqual(t, report.Processed, 50)
+	test.AssertTrue(t, report.P99 >= report.P50)
+
+	test.AssertNil(t, emitter.Finish())
+	cancel()
+	<-done
+}
@@ -0,0 +1,30 @@
+/*
+Package bench provides a harness to measure the throughput and latency of goka processors
+using synthetic load.
+
+# Usage
+
+Wrap the callback of the input edge under test with the bench, so it can track when
+messages are processed. Then run the bench with an emitter for the input topic:
+
+	b := bench.New(bench.Config{
+		Messages:  100000,
+		Rate:      5000,
+		Keys:      1000,
+		ValueSize: 256,
+	})
+
+	proc, _ := goka.NewProcessor(brokers, goka.DefineGroup("group",
+		goka.Input("input", new(codec.Bytes), b.Wrap(consume)),
+		goka.Persist(new(codec.Bytes)),
+	))
+	go proc.Run(ctx)
+
+	emitter, _ := goka.NewEmitter(brokers, "input", new(codec.Bytes))
+	report, err := b.Run(ctx, emitter, proc)
+	fmt.Println(report)
+
+The bench works against a real cluster as well as the tester package
+(using goka.WithTester and goka.WithEmitterTester).
+*/
+package bench
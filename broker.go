@@ -7,5 +7,7 @@ type Broker interface {
 	Addr() string
 	Connected() (bool, error)
 	CreateTopics(request *sarama.CreateTopicsRequest) (*sarama.CreateTopicsResponse, error)
+	DescribeConfigs(request *sarama.DescribeConfigsRequest) (*sarama.DescribeConfigsResponse, error)
+	AlterConfigs(request *sarama.AlterConfigsRequest) (*sarama.AlterConfigsResponse, error)
 	Open(conf *sarama.Config) error
 }
@@ -27,6 +27,42 @@ func ProducerBuilderWithConfig(config *sarama.Config) ProducerBuilder {
 	}
 }
 
+// producerFlush configures the batching of a producer (sarama's Producer.Flush).
+// Zero values keep the setting of the config.
+type producerFlush struct {
+	frequency time.Duration
+	bytes     int
+	messages  int
+}
+
+func (f producerFlush) isSet() bool {
+	return f != producerFlush{}
+}
+
+func (f producerFlush) apply(config *sarama.Config) {
+	if f.frequency > 0 {
+		config.Producer.Flush.Frequency = f.frequency
+	}
+	if f.bytes > 0 {
+		config.Producer.Flush.Bytes = f.bytes
+	}
+	if f.messages > 0 {
+		config.Producer.Flush.Messages = f.messages
+	}
+}
+
+// producerBuilderWithFlush creates a Kafka producer like DefaultProducerBuilder
+// with the passed flush settings.
+func producerBuilderWithFlush(flush producerFlush) ProducerBuilder {
+	return func(brokers []string, clientID string, hasher func() hash.Hash32) (Producer, error) {
+		config := globalConfig
+		config.ClientID = clientID
+		config.Producer.Partitioner = sarama.NewCustomHashPartitioner(hasher)
+		flush.apply(&config)
+		return NewProducer(brokers, &config)
+	}
+}
+
 // TopicManagerBuilder creates a TopicManager to check partition counts and
 // create tables.
 type TopicManagerBuilder func(brokers []string) (TopicManager, error)
@@ -72,6 +108,17 @@ func ConsumerGroupBuilderWithConfig(config *sarama.Config) ConsumerGroupBuilder
 	}
 }
 
+// consumerGroupBuilderWithStrategy creates a Kafka consumer group like
+// DefaultConsumerGroupBuilder with the passed rebalance strategy.
+func consumerGroupBuilderWithStrategy(strategy sarama.BalanceStrategy) ConsumerGroupBuilder {
+	return func(brokers []string, group, clientID string) (sarama.ConsumerGroup, error) {
+		config := globalConfig
+		config.ClientID = clientID
+		config.Consumer.Group.Rebalance.Strategy = strategy
+		return sarama.NewConsumerGroup(brokers, group, &config)
+	}
+}
+
 // SaramaConsumerBuilder creates a `sarama.Consumer`
 type SaramaConsumerBuilder func(brokers []string, clientID string) (sarama.Consumer, error)
 
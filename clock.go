@@ -0,0 +1,30 @@
+package goka
+
+import "time"
+
+// Clock provides the time to a processor (see WithClock), so time-dependent
+// logic can be tested with a controllable clock like the tester's.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After waits for the duration to elapse and then sends the current time
+	// on the returned channel.
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the clock using the system time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// DefaultClock returns the clock processors use by default, which uses the
+// system time.
+func DefaultClock() Clock {
+	return systemClock{}
+}
@@ -5,3 +5,13 @@ type Codec interface {
 	Encode(value interface{}) (data []byte, err error)
 	Decode(data []byte) (value interface{}, err error)
 }
+
+// CompatibilityChecker is implemented by codecs that can verify that the
+// schema they encode with is compatible with the schema registered for a
+// topic, e.g. codecs backed by a schema registry that apply the registry's
+// compatibility setting. NewProcessor checks the codecs of all edges of the
+// group graph implementing it and fails on an incompatible codec, before any
+// record is written.
+type CompatibilityChecker interface {
+	CheckCompatibility(topic string) error
+}
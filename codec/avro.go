@@ -0,0 +1,156 @@
+package codec
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/hamba/avro/v2"
+	"github.com/hamba/avro/v2/registry"
+)
+
+// avroMagicByte starts every value in the wire format of the Confluent Schema Registry.
+const avroMagicByte = 0
+
+// Avro encodes and decodes values with an Avro schema registered in a Confluent
+// Schema Registry. The values are in the registry's wire format: the magic byte
+// 0, the id of the schema in the registry (4 bytes, big endian) and the Avro
+// binary encoding of the value.
+//
+// Encode registers the schema under the subject on first use (the registry
+// returns the id of an identical schema that is already registered). Decode
+// fetches the schema a value was written with by its id and resolves it against
+// the codec's schema, so values written with an older or newer compatible schema
+// are decoded as well. The schemas are cached by id.
+type Avro struct {
+	registry registry.Registry
+	subject  string
+	schema   avro.Schema
+	typ      reflect.Type
+
+	m  sync.Mutex
+	id int
+	// reader schemas by the id of the writer schema
+	readers map[int]avro.Schema
+}
+
+// NewAvro creates an Avro codec for the schema registry at registryURL.
+// The subject names the schema in the registry, e.g. "<topic>-value" for the
+// values of a topic. Encode accepts values of the type of value (or pointers to
+// it), Decode returns pointers to new values of that type, e.g. NewAvro(url,
+// "users-value", schema, User{}) decodes to *User. The fields are mapped to
+// the schema's fields by their avro struct tags.
+func NewAvro(registryURL string, subject string, schema string, value interface{}) (*Avro, error) {
+	if subject == "" {
+		return nil, fmt.Errorf("Avro: subject must not be empty")
+	}
+	if value == nil {
+		return nil, fmt.Errorf("Avro: value must not be nil")
+	}
+	parsed, err := avro.Parse(schema)
+	if err != nil {
+		return nil, fmt.Errorf("Avro: error parsing schema: %v", err)
+	}
+
+	client, err := registry.NewClient(registryURL)
+	if err != nil {
+		return nil, fmt.Errorf("Avro: error creating schema registry client: %v", err)
+	}
+
+	typ := reflect.TypeOf(value)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	return &Avro{
+		registry: client,
+		subject:  subject,
+		schema:   parsed,
+		typ:      typ,
+		readers:  make(map[int]avro.Schema),
+	}, nil
+}
+
+// Encode encodes the value with the codec's schema in the registry's wire format.
+func (c *Avro) Encode(value interface{}) ([]byte, error) {
+	id, err := c.schemaID()
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := avro.Marshal(c.schema, value)
+	if err != nil {
+		return nil, fmt.Errorf("Avro: error encoding value of type %T: %v", value, err)
+	}
+
+	data := make([]byte, 5, 5+len(encoded))
+	data[0] = avroMagicByte
+	binary.BigEndian.PutUint32(data[1:5], uint32(id))
+	return append(data, encoded...), nil
+}
+
+// Decode decodes a value in the registry's wire format into a new value of the
+// codec's type.
+func (c *Avro) Decode(data []byte) (interface{}, error) {
+	if len(data) < 5 {
+		return nil, fmt.Errorf("Avro: data too short (%d bytes)", len(data))
+	}
+	if data[0] != avroMagicByte {
+		return nil, fmt.Errorf("Avro: unknown magic byte %d", data[0])
+	}
+
+	reader, err := c.readerSchema(int(binary.BigEndian.Uint32(data[1:5])))
+	if err != nil {
+		return nil, err
+	}
+
+	value := reflect.New(c.typ)
+	if err := avro.Unmarshal(reader, data[5:], value.Interface()); err != nil {
+		return nil, fmt.Errorf("Avro: error decoding value: %v", err)
+	}
+	return value.Interface(), nil
+}
+
+// schemaID registers the codec's schema if not done yet and returns its id.
+func (c *Avro) schemaID() (int, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.id != 0 {
+		return c.id, nil
+	}
+	id, _, err := c.registry.CreateSchema(context.Background(), c.subject, c.schema.String())
+	if err != nil {
+		return 0, fmt.Errorf("Avro: error registering schema for subject %s: %v", c.subject, err)
+	}
+	c.id = id
+	return id, nil
+}
+
+// readerSchema returns the schema decoding the values written with the schema
+// with the id.
+func (c *Avro) readerSchema(id int) (avro.Schema, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if reader, ok := c.readers[id]; ok {
+		return reader, nil
+	}
+
+	writer, err := c.registry.GetSchema(context.Background(), id)
+	if err != nil {
+		return nil, fmt.Errorf("Avro: error fetching schema %d: %v", id, err)
+	}
+
+	reader := c.schema
+	if writer.Fingerprint() != c.schema.Fingerprint() {
+		reader, err = avro.NewSchemaCompatibility().Resolve(c.schema, writer)
+		if err != nil {
+			return nil, fmt.Errorf("Avro: schema %d is incompatible: %v", id, err)
+		}
+	}
+	c.readers[id] = reader
+	return reader, nil
+}
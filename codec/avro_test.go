@@ -0,0 +1,167 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+// schemaRegistry serves the endpoints of a Confluent Schema Registry used by
+// the Avro codec.
+type schemaRegistry struct {
+	m       sync.Mutex
+	schemas []string
+	fetches int
+}
+
+func (r *schemaRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	switch {
+	case req.Method == http.MethodPost && strings.HasPrefix(req.URL.Path, "/subjects/"):
+		var payload struct {
+			Schema string `json:"schema"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]int{"id": r.register(payload.Schema)})
+	case req.Method == http.MethodGet && strings.HasPrefix(req.URL.Path, "/schemas/ids/"):
+		var id int
+		fmt.Sscanf(strings.TrimPrefix(req.URL.Path, "/schemas/ids/"), "%d", &id)
+		if id < 1 || id > len(r.schemas) {
+			http.Error(w, `{"error_code":40403,"message":"Schema not found"}`, http.StatusNotFound)
+			return
+		}
+		r.fetches++
+		json.NewEncoder(w).Encode(map[string]string{"schema": r.schemas[id-1]})
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// register returns the id of the schema, registering it if it's new. Must be
+// called with the lock held.
+func (r *schemaRegistry) register(schema string) int {
+	for i, s := range r.schemas {
+		if s == schema {
+			return i + 1
+		}
+	}
+	r.schemas = append(r.schemas, schema)
+	return len(r.schemas)
+}
+
+const (
+	userSchemaV1 = `{"type":"record","name":"User","fields":[{"name":"name","type":"string"}]}`
+	userSchemaV2 = `{"type":"record","name":"User","fields":[{"name":"name","type":"string"},{"name":"age","type":"int","default":42}]}`
+)
+
+type userV1 struct {
+	Name string `avro:"name"`
+}
+
+type userV2 struct {
+	Name string `avro:"name"`
+	Age  int    `avro:"age"`
+}
+
+func TestAvro(t *testing.T) {
+	reg := new(schemaRegistry)
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+
+	t.Run("succeed_roundtrip", func(t *testing.T) {
+		c, err := NewAvro(srv.URL, "users-value", userSchemaV2, userV2{})
+		test.AssertNil(t, err)
+
+		data, err := c.Encode(userV2{Name: "alice", Age: 3})
+		test.AssertNil(t, err)
+
+		// magic byte, id of the first registered schema
+		test.AssertEqual(t, data[:5], []byte{0, 0, 0, 0, 1})
+
+		value, err := c.Decode(data)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, value, &userV2{Name: "alice", Age: 3})
+
+		// pointers are encoded as well
+		data, err = c.Encode(&userV2{Name: "bob"})
+		test.AssertNil(t, err)
+		value, err = c.Decode(data)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, value, &userV2{Name: "bob"})
+	})
+
+	t.Run("succeed_evolved", func(t *testing.T) {
+		older, err := NewAvro(srv.URL, "users-value", userSchemaV1, userV1{})
+		test.AssertNil(t, err)
+		newer, err := NewAvro(srv.URL, "users-value", userSchemaV2, new(userV2))
+		test.AssertNil(t, err)
+
+		data, err := older.Encode(userV1{Name: "carol"})
+		test.AssertNil(t, err)
+
+		// the writer schema is fetched once and the missing field gets its default
+		reg.m.Lock()
+		fetches := reg.fetches
+		reg.m.Unlock()
+		for i := 0; i < 2; i++ {
+			value, err := newer.Decode(data)
+			test.AssertNil(t, err)
+			test.AssertEqual(t, value, &userV2{Name: "carol", Age: 42})
+		}
+		reg.m.Lock()
+		test.AssertEqual(t, reg.fetches, fetches+1)
+		reg.m.Unlock()
+
+		// the added field is ignored by the older schema
+		data, err = newer.Encode(userV2{Name: "dave", Age: 7})
+		test.AssertNil(t, err)
+		value, err := older.Decode(data)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, value, &userV1{Name: "dave"})
+	})
+
+	t.Run("fail_decode", func(t *testing.T) {
+		c, err := NewAvro(srv.URL, "users-value", userSchemaV1, userV1{})
+		test.AssertNil(t, err)
+
+		_, err = c.Decode([]byte{0, 0})
+		test.AssertNotNil(t, err)
+		_, err = c.Decode([]byte{1, 0, 0, 0, 1, 0})
+		test.AssertNotNil(t, err)
+		// unknown schema id
+		_, err = c.Decode([]byte{0, 0, 0, 1, 0, 0})
+		test.AssertNotNil(t, err)
+	})
+
+	t.Run("fail_incompatible", func(t *testing.T) {
+		c, err := NewAvro(srv.URL, "other-value", `"long"`, int64(0))
+		test.AssertNil(t, err)
+		data, err := c.Encode(int64(1))
+		test.AssertNil(t, err)
+
+		users, err := NewAvro(srv.URL, "users-value", userSchemaV1, userV1{})
+		test.AssertNil(t, err)
+		_, err = users.Decode(data)
+		test.AssertNotNil(t, err)
+	})
+
+	t.Run("fail_create", func(t *testing.T) {
+		_, err := NewAvro(srv.URL, "", userSchemaV1, userV1{})
+		test.AssertNotNil(t, err)
+		_, err = NewAvro(srv.URL, "users-value", `{"type":"unknown"}`, userV1{})
+		test.AssertNotNil(t, err)
+		_, err = NewAvro(srv.URL, "users-value", userSchemaV1, nil)
+		test.AssertNotNil(t, err)
+	})
+}
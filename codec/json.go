@@ -0,0 +1,57 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// JSONCodec encodes and decodes values as JSON, see JSON.
+type JSONCodec struct {
+	typ reflect.Type
+}
+
+// JSON returns a codec for values of the type of prototype, e.g. JSON(User{})
+// decodes to User and JSON(new(User)) decodes to *User. If prototype is nil,
+// values are decoded like by json.Unmarshal into an interface{}.
+// Empty data (e.g. a deleted key) is decoded to nil.
+func JSON(prototype interface{}) *JSONCodec {
+	return &JSONCodec{typ: reflect.TypeOf(prototype)}
+}
+
+// Encode marshals the value to JSON
+func (c *JSONCodec) Encode(value interface{}) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("JSON: error encoding value of type %T: %v", value, err)
+	}
+	return data, nil
+}
+
+// Decode unmarshals JSON into a new value of the codec's type
+func (c *JSONCodec) Decode(data []byte) (interface{}, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	if c.typ == nil {
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, fmt.Errorf("JSON: error decoding value: %v", err)
+		}
+		return value, nil
+	}
+
+	typ := c.typ
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	value := reflect.New(typ)
+	if err := json.Unmarshal(data, value.Interface()); err != nil {
+		return nil, fmt.Errorf("JSON: error decoding value of type %v: %v", c.typ, err)
+	}
+	if c.typ.Kind() == reflect.Ptr {
+		return value.Interface(), nil
+	}
+	return value.Elem().Interface(), nil
+}
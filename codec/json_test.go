@@ -0,0 +1,60 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+type jsonUser struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func TestJSON(t *testing.T) {
+	t.Run("succeed_value", func(t *testing.T) {
+		c := JSON(jsonUser{})
+		data, err := c.Encode(jsonUser{Name: "alice", Age: 3})
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(data), `{"name":"alice","age":3}`)
+
+		value, err := c.Decode(data)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, value.(jsonUser), jsonUser{Name: "alice", Age: 3})
+	})
+
+	t.Run("succeed_pointer", func(t *testing.T) {
+		c := JSON(new(jsonUser))
+		data, err := c.Encode(&jsonUser{Name: "bob"})
+		test.AssertNil(t, err)
+
+		value, err := c.Decode(data)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, value.(*jsonUser), &jsonUser{Name: "bob"})
+	})
+
+	t.Run("succeed_untyped", func(t *testing.T) {
+		c := JSON(nil)
+		value, err := c.Decode([]byte(`{"name":"carol"}`))
+		test.AssertNil(t, err)
+		test.AssertEqual(t, value, map[string]interface{}{"name": "carol"})
+	})
+
+	t.Run("succeed_empty", func(t *testing.T) {
+		for _, data := range [][]byte{nil, {}} {
+			value, err := JSON(jsonUser{}).Decode(data)
+			test.AssertNil(t, err)
+			test.AssertNil(t, value)
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		c := JSON(jsonUser{})
+		_, err := c.Encode(func() {})
+		test.AssertNotNil(t, err)
+		_, err = c.Decode([]byte(`{"name":`))
+		test.AssertNotNil(t, err)
+		_, err = c.Decode([]byte(`"alice"`))
+		test.AssertNotNil(t, err)
+	})
+}
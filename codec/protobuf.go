@@ -0,0 +1,41 @@
+package codec
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtobufCodec encodes and decodes protobuf messages, see Protobuf.
+type ProtobufCodec struct {
+	newMessage func() proto.Message
+}
+
+// Protobuf returns a codec for the protobuf messages created by newMessage,
+// e.g. codec.Protobuf(func() proto.Message { return new(pb.User) }).
+// Decode unmarshals into a new message created by newMessage.
+func Protobuf(newMessage func() proto.Message) *ProtobufCodec {
+	return &ProtobufCodec{newMessage: newMessage}
+}
+
+// Encode marshals a proto.Message
+func (c *ProtobufCodec) Encode(value interface{}) ([]byte, error) {
+	msg, isMessage := value.(proto.Message)
+	if !isMessage {
+		return nil, fmt.Errorf("Protobuf: value to encode is not a proto.Message but %T", value)
+	}
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("Protobuf: error encoding %T: %v", value, err)
+	}
+	return data, nil
+}
+
+// Decode unmarshals into a new message
+func (c *ProtobufCodec) Decode(data []byte) (interface{}, error) {
+	msg := c.newMessage()
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("Protobuf: error decoding %T: %v", msg, err)
+	}
+	return msg, nil
+}
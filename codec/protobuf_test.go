@@ -0,0 +1,41 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestProtobuf(t *testing.T) {
+	c := Protobuf(func() proto.Message { return new(wrapperspb.StringValue) })
+
+	t.Run("succeed", func(t *testing.T) {
+		data, err := c.Encode(wrapperspb.String("value"))
+		test.AssertNil(t, err)
+
+		decoded, err := c.Decode(data)
+		test.AssertNil(t, err)
+		msg, ok := decoded.(*wrapperspb.StringValue)
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, msg.GetValue(), "value")
+
+		// every decode creates a new message
+		other, err := c.Decode(data)
+		test.AssertNil(t, err)
+		test.AssertTrue(t, other != decoded)
+	})
+
+	t.Run("fail_encode", func(t *testing.T) {
+		_, err := c.Encode("value")
+		test.AssertNotNil(t, err)
+		_, err = c.Encode(nil)
+		test.AssertNotNil(t, err)
+	})
+
+	t.Run("fail_decode", func(t *testing.T) {
+		_, err := c.Decode([]byte{0xff})
+		test.AssertNotNil(t, err)
+	})
+}
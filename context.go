@@ -11,7 +11,7 @@ import (
 	"github.com/lovoo/goka/multierr"
 )
 
-type emitter func(topic string, key string, value []byte) *Promise
+type emitter func(topic string, key string, value []byte, headers map[string][]byte) *Promise
 
 // Context provides access to the processor's table and emit capabilities to
 // arbitrary topics in kafka.
@@ -19,7 +19,7 @@ type emitter func(topic string, key string, value []byte) *Promise
 // ConsumeCallback is invoked with a context object along with the input message.
 // The context is only valid within the callback, do not store it or pass it to other goroutines.
 //
-// Error handling
+// # Error handling
 //
 // Most methods of the context can fail due to different reasons, which are handled in different ways:
 // Synchronous errors like
@@ -70,6 +70,53 @@ type Context interface {
 	// the processor might deadlock.
 	SetValue(value interface{})
 
+	// SetValueForKey updates the value of an arbitrary key in the group table.
+	// If key belongs to the partition of the input message, the value is stored
+	// locally like with SetValue. Otherwise the update is only emitted into the
+	// Kafka topic representing the group table, like Emit, which routes it to
+	// the key's partition.
+	//
+	// Consistency: an update of a key of another partition is never visible in
+	// the local storage of the processor owning that partition, i.e. via Value()
+	// or Processor.Get, and that processor may overwrite it with SetValue at any
+	// time. The next table write of that processor moves the stored offset of the
+	// partition past the update, so recovering the partition does not load it
+	// either. Views on the group table receive the update as usual. Only use it
+	// for keys that are not written by SetValue.
+	//
+	// This method might panic to initiate an immediate shutdown of the processor
+	// to maintain data integrity. Do not recover from that panic or
+	// the processor might deadlock.
+	SetValueForKey(key string, value interface{})
+
+	// ValueRaw returns the value of the key in the group table without decoding
+	// it with the table codec. Together with SetValueRaw, it allows to store
+	// values with different encodings in the group table, e.g. depending on the
+	// key.
+	//
+	// This method might panic to initiate an immediate shutdown of the processor
+	// to maintain data integrity. Do not recover from that panic or
+	// the processor might deadlock.
+	ValueRaw() []byte
+
+	// SetValueRaw updates the value of the key in the group table like SetValue
+	// but without encoding it with the table codec. Note that views and lookups
+	// on the group table still decode the values with the table codec.
+	//
+	// This method might panic to initiate an immediate shutdown of the processor
+	// to maintain data integrity. Do not recover from that panic or
+	// the processor might deadlock.
+	SetValueRaw(value []byte)
+
+	// WithKeyLock calls fn while holding a lock for the message's key, which
+	// serializes fn with all other calls of WithKeyLock for the same key in this
+	// processor instance, across all partitions and input topics.
+	// This allows to protect side effects on external systems per key, e.g. if
+	// multiple inputs use keys that are not copartitioned.
+	// The lock is not shared between processor instances and it is not reentrant,
+	// so calling WithKeyLock inside of fn deadlocks.
+	WithKeyLock(fn func())
+
 	// Delete deletes a value from the group table. IMPORTANT: this deletes the
 	// value associated with the key from both the local cache and the persisted
 	// table in Kafka.
@@ -83,14 +130,23 @@ type Context interface {
 	// invalid, a zero time will be returned.
 	Timestamp() time.Time
 
-	// Join returns the value of key in the copartitioned table.
+	// Now returns the current time of the processor's clock (see WithClock).
+	// Use it instead of time.Now() to test time-dependent logic with the
+	// tester's clock.
+	Now() time.Time
+
+	// Join returns the value of key in the copartitioned table. A missing value
+	// is handled according to the processor's join miss policy (see
+	// WithJoinMissPolicy), by default Join returns nil.
 	//
 	// This method might panic to initiate an immediate shutdown of the processor
 	// to maintain data integrity. Do not recover from that panic or
 	// the processor might deadlock.
 	Join(topic Table) interface{}
 
-	// Lookup returns the value of key in the view of table.
+	// Lookup returns the value of key in the view of table. A missing value
+	// is handled according to the processor's join miss policy (see
+	// WithJoinMissPolicy), by default Lookup returns nil.
 	//
 	// This method might panic to initiate an immediate shutdown of the processor
 	// to maintain data integrity. Do not recover from that panic or
@@ -104,9 +160,46 @@ type Context interface {
 	// the processor might deadlock.
 	Emit(topic Stream, key string, value interface{})
 
+	// EmitToGroupTable asynchronously writes a value for key into the table of
+	// another group, e.g. to prime the state of a downstream processor. The value
+	// is encoded with codec, which must be the codec of the other group's table.
+	// Passing a nil value deletes the key from the table.
+	//
+	// The message is partitioned with the processor's hasher, so both groups must
+	// use the same hasher (the default one, unless configured otherwise) and their
+	// table topics must have the same number of partitions. The value is never
+	// visible in the local storage of the other group's processor, i.e. via its
+	// Value() or Processor.Get. The next table write of that processor moves the
+	// stored offset of the partition past the value, so recovering the partition
+	// does not load it either. Views on the table receive the update as usual.
+	// Use SetValue to write into the processor's own table.
+	//
+	// This method might panic to initiate an immediate shutdown of the processor
+	// to maintain data integrity. Do not recover from that panic or
+	// the processor might deadlock.
+	EmitToGroupTable(group Group, key string, value interface{}, codec Codec)
+
+	// EmitDelayed asynchronously writes a message into the delay topic of the
+	// group (see DelayOutput), from which a delay scheduler emits it into topic
+	// once delay has elapsed. The value is encoded with the codec of topic,
+	// which has to be defined as output of the group.
+	//
+	// This method might panic to initiate an immediate shutdown of the processor
+	// to maintain data integrity. Do not recover from that panic or
+	// the processor might deadlock.
+	EmitDelayed(topic Stream, key string, value interface{}, delay time.Duration)
+
 	// Loopback asynchronously sends a message to another key of the group
 	// table. Value passed to loopback is encoded via the codec given in the
-	// Loop subscription.
+	// Loop subscription. A nil value is sent as nil message.
+	//
+	// The message is written into the group's loop topic and routed to the
+	// partition of key. If that is the current partition, it is processed after
+	// the current message, otherwise possibly while the current message is still
+	// being processed. Its order relative to messages of key from the input
+	// topics is undefined. Messages looped back to the same key from one
+	// partition are processed in the order they were sent. The current message
+	// is only committed once the loopback message is written.
 	//
 	// This method might panic to initiate an immediate shutdown of the processor
 	// to maintain data integrity. Do not recover from that panic or
@@ -133,6 +226,11 @@ type cbContext struct {
 	asyncFailer func(err error)
 	syncFailer  func(err error)
 
+	// handles Join and Lookup without value, nil returns nil
+	joinMissPolicy *JoinMissPolicy
+	// creates the spans of table accesses and emits, nil if no tracer is configured
+	tracing *tracing
+
 	// Headers as passed from sarama. Note that this field will be filled
 	// lazily after the first call to Headers
 	headers map[string][]byte
@@ -142,10 +240,24 @@ type cbContext struct {
 	pviews map[string]*PartitionTable
 	// lookup tables
 	views map[string]*View
+	// returns the partition of a key, nil if the partition can't be computed
+	partitionOf func(key string) (int32, error)
+
+	// per key locks shared by all partition processors of the processor
+	keyLocks *keyMutex
+	// limits the in-flight emits per topic, nil if unlimited
+	emitLimiter *emitLimiter
+	// tracks the keys set in the group table, nil if the keys don't expire
+	keyTTL *keyTTL
+	// the processor's clock, the system time if nil
+	clock Clock
 
 	// helper function that is provided by the partition processor to allow
 	// tracking statistics for the output topic
 	trackOutputStats func(ctx context.Context, topic string, size int)
+	// helper function that is provided by the partition processor to handle
+	// failed writes to the table's storage according to the write error policy
+	writeStorage func(ctx context.Context, key string, write func() error) error
 
 	msg      *sarama.ConsumerMessage
 	done     bool
@@ -191,6 +303,30 @@ func (ctx *cbContext) Emit(topic Stream, key string, value interface{}) {
 	ctx.emit(string(topic), key, data)
 }
 
+// EmitToGroupTable sends a value to the table of another group.
+func (ctx *cbContext) EmitToGroupTable(group Group, key string, value interface{}, codec Codec) {
+	if group == "" {
+		ctx.Fail(errors.New("cannot emit to the table of an empty group"))
+	}
+	if group == ctx.graph.Group() {
+		ctx.Fail(errors.New("cannot emit to the processor's own table (use SetValue instead)"))
+	}
+	if codec == nil {
+		ctx.Fail(fmt.Errorf("no codec for the table of group %s", group))
+	}
+
+	var data []byte
+	if value != nil {
+		var err error
+		data, err = codec.Encode(value)
+		if err != nil {
+			ctx.Fail(fmt.Errorf("error encoding value for the table of group %s: %v", group, err))
+		}
+	}
+
+	ctx.emit(tableName(group), key, data)
+}
+
 // Loopback sends a message to another key of the processor.
 func (ctx *cbContext) Loopback(key string, value interface{}) {
 	l := ctx.graph.LoopStream()
@@ -198,17 +334,28 @@ func (ctx *cbContext) Loopback(key string, value interface{}) {
 		ctx.Fail(errors.New("no loop topic configured"))
 	}
 
-	data, err := l.Codec().Encode(value)
-	if err != nil {
-		ctx.Fail(fmt.Errorf("error encoding message for key %s: %v", key, err))
+	var data []byte
+	if value != nil {
+		var err error
+		data, err = l.Codec().Encode(value)
+		if err != nil {
+			ctx.Fail(fmt.Errorf("error encoding message for key %s: %v", key, err))
+		}
 	}
 
 	ctx.emit(l.Topic(), key, data)
 }
 
 func (ctx *cbContext) emit(topic string, key string, value []byte) {
+	release, err := ctx.emitLimiter.acquire(ctx.ctx, topic)
+	if err != nil {
+		ctx.Fail(err)
+	}
 	ctx.counters.emits++
-	ctx.emitter(topic, key, value).Then(func(err error) {
+	headers, end := ctx.tracing.startEmit(ctx.ctx, topic)
+	ctx.emitter(topic, key, value, headers).Then(func(err error) {
+		release()
+		end(err)
 		if err != nil {
 			err = fmt.Errorf("error emitting to %s: %v", topic, err)
 		}
@@ -239,11 +386,83 @@ func (ctx *cbContext) SetValue(value interface{}) {
 	}
 }
 
+// ValueRaw returns the undecoded value of the key in the group table.
+func (ctx *cbContext) ValueRaw() []byte {
+	data, err := ctx.rawValueForKey(ctx.Key())
+	if err != nil {
+		ctx.Fail(err)
+	}
+	return data
+}
+
+// SetValueRaw updates the value of the key in the group table without encoding it.
+func (ctx *cbContext) SetValueRaw(value []byte) {
+	if value == nil {
+		ctx.Fail(fmt.Errorf("cannot set nil as value"))
+	}
+	if err := ctx.setRawValueForKey(ctx.Key(), value); err != nil {
+		ctx.Fail(err)
+	}
+}
+
+// WithKeyLock calls fn while holding the lock of the message's key.
+func (ctx *cbContext) WithKeyLock(fn func()) {
+	unlock := ctx.keyLocks.lock(ctx.Key())
+	defer unlock()
+	fn()
+}
+
+// SetValueForKey updates the value of an arbitrary key in the group table.
+func (ctx *cbContext) SetValueForKey(key string, value interface{}) {
+	if key == ctx.Key() {
+		ctx.SetValue(value)
+		return
+	}
+
+	local, err := ctx.isLocalKey(key)
+	if err != nil {
+		ctx.Fail(err)
+	}
+	if local {
+		err = ctx.setValueForKey(key, value)
+	} else {
+		err = ctx.emitValueForKey(key, value)
+	}
+	if err != nil {
+		ctx.Fail(err)
+	}
+}
+
+// isLocalKey returns whether key belongs to the partition of the group table
+// the context is processing.
+func (ctx *cbContext) isLocalKey(key string) (bool, error) {
+	if ctx.partitionOf == nil || ctx.table == nil {
+		return false, nil
+	}
+	partition, err := ctx.partitionOf(key)
+	if err != nil {
+		return false, fmt.Errorf("error computing the partition of key %s: %v", key, err)
+	}
+	return partition == ctx.table.partition, nil
+}
+
 // Timestamp returns the timestamp of the input message.
 func (ctx *cbContext) Timestamp() time.Time {
 	return ctx.msg.Timestamp
 }
 
+// Now returns the current time of the processor's clock.
+func (ctx *cbContext) Now() time.Time {
+	return ctx.getClock().Now()
+}
+
+func (ctx *cbContext) getClock() Clock {
+	if ctx.clock == nil {
+		return DefaultClock()
+	}
+	return ctx.clock
+}
+
 func (ctx *cbContext) Key() string {
 	return string(ctx.msg.Key)
 }
@@ -279,11 +498,13 @@ func (ctx *cbContext) Join(topic Table) interface{} {
 	if !ok {
 		ctx.Fail(fmt.Errorf("table %s not subscribed", topic))
 	}
+	end := ctx.tracing.startTable(ctx.ctx, spanTableGet, string(topic))
 	data, err := v.st.Get(ctx.Key())
+	end(err)
 	if err != nil {
 		ctx.Fail(fmt.Errorf("error getting key %s of table %s: %v", ctx.Key(), topic, err))
 	} else if data == nil {
-		return nil
+		return ctx.joinMiss(topic, ctx.Key())
 	}
 
 	value, err := ctx.graph.codec(string(topic)).Decode(data)
@@ -301,31 +522,44 @@ func (ctx *cbContext) Lookup(topic Table, key string) interface{} {
 	if !ok {
 		ctx.Fail(fmt.Errorf("topic %s not subscribed", topic))
 	}
+	end := ctx.tracing.startTable(ctx.ctx, spanTableGet, string(topic))
 	val, err := v.Get(key)
+	end(err)
 	if err != nil {
 		ctx.Fail(fmt.Errorf("error getting key %s of table %s: %v", key, topic, err))
+	} else if val == nil {
+		return ctx.joinMiss(topic, key)
 	}
 	return val
 }
 
 // valueForKey returns the value of key in the processor state.
 func (ctx *cbContext) valueForKey(key string) (interface{}, error) {
+	data, err := ctx.rawValueForKey(key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	value, err := ctx.graph.GroupTable().Codec().Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding value: %v", err)
+	}
+	return value, nil
+}
+
+// rawValueForKey returns the encoded value of key in the processor state.
+func (ctx *cbContext) rawValueForKey(key string) ([]byte, error) {
 	if ctx.table == nil {
 		return nil, fmt.Errorf("Cannot access state in stateless processor")
 	}
 
+	end := ctx.tracing.startTable(ctx.ctx, spanTableGet, ctx.graph.GroupTable().Topic())
 	data, err := ctx.table.Get(key)
+	end(err)
 	if err != nil {
 		return nil, fmt.Errorf("error reading value: %v", err)
-	} else if data == nil {
-		return nil, nil
 	}
-
-	value, err := ctx.graph.GroupTable().Codec().Decode(data)
-	if err != nil {
-		return nil, fmt.Errorf("error decoding value: %v", err)
-	}
-	return value, nil
+	return data, nil
 }
 
 func (ctx *cbContext) deleteKey(key string) error {
@@ -333,19 +567,32 @@ func (ctx *cbContext) deleteKey(key string) error {
 		return fmt.Errorf("Cannot access state in stateless processor")
 	}
 
+	table := ctx.graph.GroupTable().Topic()
 	ctx.counters.stores++
-	if err := ctx.table.Delete(key); err != nil {
+	end := ctx.tracing.startTable(ctx.ctx, spanTableSet, table)
+	err := ctx.write(key, func() error { return ctx.table.Delete(key) })
+	end(err)
+	if err != nil {
 		return fmt.Errorf("error deleting key (%s) from storage: %v", key, err)
 	}
+	ctx.keyTTL.forget(key)
 
 	ctx.counters.emits++
-	ctx.emitter(ctx.graph.GroupTable().Topic(), key, nil).Then(func(err error) {
+	ctx.emitter(table, key, nil, nil).Then(func(err error) {
 		ctx.emitDone(err)
 	})
 
 	return nil
 }
 
+// write performs a write to the table's storage.
+func (ctx *cbContext) write(key string, write func() error) error {
+	if ctx.writeStorage == nil {
+		return write()
+	}
+	return ctx.writeStorage(ctx.ctx, key, write)
+}
+
 // setValueForKey sets a value for a key in the processor state.
 func (ctx *cbContext) setValueForKey(key string, value interface{}) error {
 	if ctx.graph.GroupTable() == nil {
@@ -361,14 +608,28 @@ func (ctx *cbContext) setValueForKey(key string, value interface{}) error {
 		return fmt.Errorf("error encoding value: %v", err)
 	}
 
+	return ctx.setRawValueForKey(key, encodedValue)
+}
+
+// setRawValueForKey stores an encoded value for a key in the processor state
+// and sends it to the group table topic.
+func (ctx *cbContext) setRawValueForKey(key string, encodedValue []byte) error {
+	if ctx.graph.GroupTable() == nil {
+		return fmt.Errorf("Cannot access state in stateless processor")
+	}
+
+	table := ctx.graph.GroupTable().Topic()
 	ctx.counters.stores++
-	if err = ctx.table.Set(key, encodedValue); err != nil {
+	end := ctx.tracing.startTable(ctx.ctx, spanTableSet, table)
+	err := ctx.write(key, func() error { return ctx.table.Set(key, encodedValue) })
+	end(err)
+	if err != nil {
 		return fmt.Errorf("error storing value: %v", err)
 	}
+	ctx.keyTTL.touch(key)
 
-	table := ctx.graph.GroupTable().Topic()
 	ctx.counters.emits++
-	ctx.emitter(table, key, encodedValue).ThenWithMessage(func(msg *sarama.ProducerMessage, err error) {
+	ctx.emitter(table, key, encodedValue, nil).ThenWithMessage(func(msg *sarama.ProducerMessage, err error) {
 		if err == nil && msg != nil {
 			err = ctx.table.storeNewestOffset(msg.Offset)
 		}
@@ -382,6 +643,26 @@ func (ctx *cbContext) setValueForKey(key string, value interface{}) error {
 	return nil
 }
 
+// emitValueForKey sends a value for a key of another partition to the group
+// table topic without storing it locally.
+func (ctx *cbContext) emitValueForKey(key string, value interface{}) error {
+	if ctx.graph.GroupTable() == nil {
+		return fmt.Errorf("Cannot access state in stateless processor")
+	}
+
+	if value == nil {
+		return fmt.Errorf("cannot set nil as value")
+	}
+
+	encodedValue, err := ctx.graph.GroupTable().Codec().Encode(value)
+	if err != nil {
+		return fmt.Errorf("error encoding value: %v", err)
+	}
+
+	ctx.emit(ctx.graph.GroupTable().Topic(), key, encodedValue)
+	return nil
+}
+
 func (ctx *cbContext) emitDone(err error) {
 	ctx.m.Lock()
 	defer ctx.m.Unlock()
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -15,10 +16,11 @@ import (
 	"github.com/lovoo/goka/codec"
 	"github.com/lovoo/goka/internal/test"
 	"github.com/lovoo/goka/logger"
+	"github.com/lovoo/goka/storage"
 )
 
 func newEmitter(err error, done func(err error)) emitter {
-	return func(topic string, key string, value []byte) *Promise {
+	return func(topic string, key string, value []byte, headers map[string][]byte) *Promise {
 		p := NewPromise()
 		if done != nil {
 			p.Then(done)
@@ -28,7 +30,7 @@ func newEmitter(err error, done func(err error)) emitter {
 }
 
 func newEmitterW(wg *sync.WaitGroup, err error, done func(err error)) emitter {
-	return func(topic string, key string, value []byte) *Promise {
+	return func(topic string, key string, value []byte, headers map[string][]byte) *Promise {
 		wg.Add(1)
 		p := NewPromise()
 		if done != nil {
@@ -71,6 +73,67 @@ func TestContext_Emit(t *testing.T) {
 	test.AssertEqual(t, ack, 1)
 }
 
+func TestContext_EmitConcurrencyPerTopic(t *testing.T) {
+	var (
+		promises = make(chan *Promise, 10)
+		limiter  = newEmitLimiter(map[Stream]int{"slow-topic": 1})
+	)
+
+	newCtx := func(ctx context.Context) *cbContext {
+		c := &cbContext{
+			ctx:              ctx,
+			graph:            DefineGroup("some-group"),
+			commit:           func() {},
+			wg:               &sync.WaitGroup{},
+			trackOutputStats: func(ctx context.Context, topic string, size int) {},
+			emitLimiter:      limiter,
+			syncFailer:       func(err error) { panic(err) },
+			emitter: func(topic string, key string, value []byte, headers map[string][]byte) *Promise {
+				p := NewPromise()
+				promises <- p
+				return p
+			},
+		}
+		c.start()
+		return c
+	}
+
+	ctx := newCtx(context.Background())
+	ctx.emit("slow-topic", "key", nil)
+	test.AssertEqual(t, limiter.inFlight(), map[string]int{"slow-topic": 1})
+	first := <-promises
+
+	// other topics are not limited
+	ctx.emit("other-topic", "key", nil)
+	(<-promises).Finish(nil, nil)
+
+	// the second emit to the slow topic blocks until the first one finished
+	emitted := make(chan struct{})
+	go func() {
+		defer close(emitted)
+		ctx.emit("slow-topic", "key", nil)
+	}()
+	select {
+	case <-emitted:
+		t.Fatalf("emit did not block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	first.Finish(nil, nil)
+	<-emitted
+	(<-promises).Finish(nil, nil)
+	test.AssertEqual(t, limiter.inFlight(), map[string]int{"slow-topic": 0})
+
+	// a blocked emit fails when the context is done
+	ctx.emit("slow-topic", "key", nil)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	func() {
+		defer test.PanicAssertStringContains(t, "context done")
+		newCtx(cancelled).emit("slow-topic", "key", nil)
+	}()
+	(<-promises).Finish(nil, nil)
+}
+
 func TestContext_Timestamp(t *testing.T) {
 	ts := time.Now()
 
@@ -125,6 +188,187 @@ func TestContext_EmitError(t *testing.T) {
 
 }
 
+func TestContext_EmitToGroupTable(t *testing.T) {
+	var (
+		ack           = 0
+		group   Group = "some-group"
+		emitted []string
+	)
+
+	ctx := &cbContext{
+		graph:            DefineGroup(group, Persist(c)),
+		commit:           func() { ack++ },
+		wg:               &sync.WaitGroup{},
+		trackOutputStats: func(ctx context.Context, topic string, size int) {},
+		syncFailer:       func(err error) { panic(err) },
+		emitter: func(topic string, key string, value []byte, headers map[string][]byte) *Promise {
+			emitted = append(emitted, fmt.Sprintf("%s/%s/%s", topic, key, value))
+			return NewPromise().Finish(nil, nil)
+		},
+	}
+
+	ctx.start()
+	ctx.EmitToGroupTable("other-group", "key", "value", new(codec.String))
+	ctx.finish(nil)
+	ctx.wg.Wait()
+
+	test.AssertEqual(t, emitted, []string{"other-group-table/key/value"})
+	test.AssertEqual(t, ack, 1)
+
+	func() {
+		defer test.PanicAssertEqual(t, errors.New("cannot emit to the processor's own table (use SetValue instead)"))
+		ctx.EmitToGroupTable(group, "key", "value", new(codec.String))
+	}()
+	func() {
+		defer test.PanicAssertEqual(t, errors.New("cannot emit to the table of an empty group"))
+		ctx.EmitToGroupTable("", "key", "value", new(codec.String))
+	}()
+}
+
+// TestContext_EmitToGroupTable_ownerRecovery documents that the owning processor
+// doesn't load a value emitted into its table once it wrote the partition itself.
+func TestContext_EmitToGroupTable_ownerRecovery(t *testing.T) {
+	var (
+		owner     Group = "owner"
+		topic           = tableName(owner)
+		partition int32
+		records   []*sarama.ConsumerMessage
+		consumer  = defaultSaramaAutoConsumerMock(t)
+		st        = storage.NewMemory()
+	)
+
+	// the emitter appends the messages to the table topic
+	emitter := func(tp string, key string, value []byte, headers map[string][]byte) *Promise {
+		test.AssertEqual(t, tp, topic)
+		offset := int64(len(records))
+		records = append(records, &sarama.ConsumerMessage{
+			Topic:     tp,
+			Partition: partition,
+			Key:       []byte(key),
+			Value:     value,
+			Offset:    offset,
+		})
+		return NewPromise().Finish(&sarama.ProducerMessage{Topic: tp, Offset: offset}, nil)
+	}
+	newCtx := func(group Group, key string, table *PartitionTable) *cbContext {
+		return &cbContext{
+			ctx:              context.Background(),
+			graph:            DefineGroup(group, Persist(new(codec.String))),
+			commit:           func() {},
+			wg:               new(sync.WaitGroup),
+			trackOutputStats: func(ctx context.Context, topic string, size int) {},
+			syncFailer:       func(err error) { panic(err) },
+			msg:              &sarama.ConsumerMessage{Key: []byte(key), Partition: partition},
+			table:            table,
+			emitter:          emitter,
+		}
+	}
+	process := func(ctx *cbContext, cb func()) {
+		ctx.start()
+		cb()
+		ctx.finish(nil)
+		ctx.wg.Wait()
+	}
+	// starts the owner's partition table on the storage and recovers the topic
+	startOwner := func() *PartitionTable {
+		pt, bm, ctrl := defaultPT(t, topic, partition, consumer, DefaultUpdate)
+		t.Cleanup(ctrl.Finish)
+		bm.st = st
+
+		hwm := int64(len(records))
+		bm.tmgr.EXPECT().GetOffset(topic, partition, sarama.OffsetOldest).Return(int64(0), nil)
+		bm.tmgr.EXPECT().GetOffset(topic, partition, sarama.OffsetNewest).Return(hwm, nil)
+		stored, err := st.GetOffset(offsetNotStored)
+		test.AssertNil(t, err)
+		start := stored + 1
+		if stored == offsetNotStored {
+			start = 0
+		}
+		if start < hwm {
+			pc := consumer.ExpectConsumePartition(topic, partition, start)
+			pc.ExpectMessagesDrainedOnClose()
+			for _, msg := range records[start:hwm] {
+				pc.YieldMessage(msg)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		test.AssertNil(t, pt.SetupAndRecover(ctx, false))
+		return pt
+	}
+	get := func(pt *PartitionTable, key string) string {
+		value, err := pt.Get(key)
+		test.AssertNil(t, err)
+		return string(value)
+	}
+
+	// the owner recovers its initial state
+	emitter(topic, "some-key", []byte("initial"), nil)
+	pt := startOwner()
+	test.AssertEqual(t, get(pt, "some-key"), "initial")
+
+	// another group emits into the owner's table
+	foreignCtx := newCtx("foreign", "input-key", nil)
+	process(foreignCtx, func() {
+		foreignCtx.EmitToGroupTable(owner, "key", "foreign", new(codec.String))
+	})
+
+	// the owner writes its table, which stores the offset of the write
+	ownerCtx := newCtx(owner, "owner-key", pt)
+	process(ownerCtx, func() { ownerCtx.SetValue("owner") })
+	offset, err := st.GetOffset(offsetNotStored)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, offset, int64(2))
+
+	// after a restart, the owner recovers after its own write, so it never
+	// loads the emitted value
+	test.AssertNil(t, pt.Close())
+	pt = startOwner()
+	test.AssertEqual(t, get(pt, "owner-key"), "owner")
+	test.AssertEqual(t, get(pt, "key"), "")
+}
+
+func TestContext_EmitDelayed(t *testing.T) {
+	var emitted []*delayedMessage
+	ctx := &cbContext{
+		graph:            DefineGroup("some-group", Output("target", c), DelayOutput("delays")),
+		commit:           func() {},
+		wg:               &sync.WaitGroup{},
+		trackOutputStats: func(ctx context.Context, topic string, size int) {},
+		syncFailer:       func(err error) { panic(err) },
+		emitter: func(topic string, key string, value []byte, headers map[string][]byte) *Promise {
+			test.AssertEqual(t, topic, "delays")
+			msg, err := new(delayedMessageCodec).Decode(value)
+			test.AssertNil(t, err)
+			emitted = append(emitted, msg.(*delayedMessage))
+			return NewPromise().Finish(nil, nil)
+		},
+	}
+
+	ctx.start()
+	before := time.Now()
+	ctx.EmitDelayed("target", "key", "value", time.Minute)
+	ctx.finish(nil)
+	ctx.wg.Wait()
+
+	test.AssertEqual(t, len(emitted), 1)
+	test.AssertEqual(t, emitted[0].Topic, "target")
+	test.AssertEqual(t, emitted[0].Key, "key")
+	test.AssertEqual(t, emitted[0].Value, []byte("value"))
+	test.AssertFalse(t, emitted[0].Due.Before(before.Add(time.Minute)))
+
+	func() {
+		defer test.PanicAssertStringContains(t, "not configured for output")
+		ctx.EmitDelayed("other-topic", "key", "value", time.Minute)
+	}()
+	func() {
+		ctx.graph = DefineGroup("some-group", Output("target", c))
+		defer test.PanicAssertStringContains(t, "no delay topic configured")
+		ctx.EmitDelayed("target", "key", "value", time.Minute)
+	}()
+}
+
 func TestContext_EmitToStateTopic(t *testing.T) {
 	var (
 		group Group = "some-group"
@@ -343,7 +587,7 @@ func TestContext_GetSetStateful(t *testing.T) {
 		graph:            graph,
 		trackOutputStats: func(ctx context.Context, topic string, size int) {},
 		msg:              &sarama.ConsumerMessage{Key: []byte(key), Offset: offset},
-		emitter: func(tp string, k string, v []byte) *Promise {
+		emitter: func(tp string, k string, v []byte, h map[string][]byte) *Promise {
 			wg.Add(1)
 			test.AssertEqual(t, tp, graph.GroupTable().Topic())
 			test.AssertEqual(t, string(k), key)
@@ -362,6 +606,63 @@ func TestContext_GetSetStateful(t *testing.T) {
 	test.AssertEqual(t, val, value)
 }
 
+func TestContext_GetSetRaw(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		group  Group = "some-group"
+		key          = "key"
+		value        = []byte("not an int64")
+		offset       = int64(123)
+		wg           = new(sync.WaitGroup)
+		st           = NewMockStorage(ctrl)
+		pt           = &PartitionTable{
+			st: &storageProxy{
+				Storage: st,
+			},
+			state:       newPartitionTableState().SetState(State(PartitionRunning)),
+			stats:       newTableStats(),
+			updateStats: make(chan func(), 10),
+		}
+	)
+
+	gomock.InOrder(
+		st.EXPECT().Get(key).Return(nil, nil),
+		st.EXPECT().Set(key, value).Return(nil),
+		// the offset of the table message is stored like for SetValue
+		st.EXPECT().GetOffset(offsetNotStored).Return(int64(10), nil),
+		st.EXPECT().SetOffset(int64(11)).Return(nil),
+		st.EXPECT().Get(key).Return(value, nil),
+	)
+
+	// the table codec cannot encode or decode the raw value
+	graph := DefineGroup(group, Persist(new(codec.Int64)))
+	ctx := &cbContext{
+		table:            pt,
+		wg:               wg,
+		graph:            graph,
+		trackOutputStats: func(ctx context.Context, topic string, size int) {},
+		msg:              &sarama.ConsumerMessage{Key: []byte(key), Offset: offset},
+		emitter: func(tp string, k string, v []byte, h map[string][]byte) *Promise {
+			wg.Add(1)
+			test.AssertEqual(t, tp, graph.GroupTable().Topic())
+			test.AssertEqual(t, string(k), key)
+			test.AssertEqual(t, v, value)
+			return NewPromise().Finish(&sarama.ProducerMessage{Offset: 11}, nil)
+		},
+		ctx: context.Background(),
+	}
+
+	test.AssertTrue(t, ctx.ValueRaw() == nil)
+
+	ctx.SetValueRaw(value)
+	test.AssertEqual(t, ctx.counters.stores, 1)
+	test.AssertEqual(t, ctx.counters.emits, 1)
+
+	test.AssertEqual(t, ctx.ValueRaw(), value)
+}
+
 func TestContext_SetErrors(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -448,7 +749,7 @@ func TestContext_Loopback(t *testing.T) {
 		graph:            graph,
 		msg:              &sarama.ConsumerMessage{},
 		trackOutputStats: func(ctx context.Context, topic string, size int) {},
-		emitter: func(tp string, k string, v []byte) *Promise {
+		emitter: func(tp string, k string, v []byte, h map[string][]byte) *Promise {
 			cnt++
 			test.AssertEqual(t, tp, graph.LoopStream().Topic())
 			test.AssertEqual(t, string(k), key)
@@ -459,6 +760,11 @@ func TestContext_Loopback(t *testing.T) {
 
 	ctx.Loopback(key, value)
 	test.AssertTrue(t, cnt == 1)
+
+	// nil is not encoded
+	value = ""
+	ctx.Loopback(key, nil)
+	test.AssertTrue(t, cnt == 2)
 }
 
 func TestContext_Join(t *testing.T) {
@@ -607,3 +913,96 @@ func TestContext_Fail(t *testing.T) {
 	// this must not be executed. ctx.Fail should stop execution
 	test.AssertTrue(t, false)
 }
+
+func TestContext_SetValueForKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		key            = "key"
+		localKey       = "local-key"
+		otherKey       = "other-key"
+		value          = "value"
+		group    Group = "some-group"
+		ack            = 0
+		st             = NewMockStorage(ctrl)
+		pt             = &PartitionTable{
+			partition: 0,
+			st: &storageProxy{
+				Storage: st,
+			},
+			stats:       newTableStats(),
+			updateStats: make(chan func(), 10),
+		}
+		emitted []string
+	)
+
+	graph := DefineGroup(group, Persist(new(codec.String)))
+	ctx := &cbContext{
+		graph:            graph,
+		wg:               new(sync.WaitGroup),
+		commit:           func() { ack++ },
+		trackOutputStats: func(ctx context.Context, topic string, size int) {},
+		msg:              &sarama.ConsumerMessage{Key: []byte(key)},
+		table:            pt,
+		ctx:              context.Background(),
+		partitionOf: func(k string) (int32, error) {
+			if k == otherKey {
+				return 1, nil
+			}
+			return 0, nil
+		},
+		emitter: func(tp string, k string, v []byte, h map[string][]byte) *Promise {
+			test.AssertEqual(t, tp, graph.GroupTable().Topic())
+			test.AssertEqual(t, string(v), value)
+			emitted = append(emitted, k)
+			return NewPromise().Finish(nil, nil)
+		},
+	}
+
+	// only the keys of the input message's partition are stored locally
+	st.EXPECT().Set(localKey, []byte(value)).Return(nil)
+	st.EXPECT().Set(key, []byte(value)).Return(nil)
+
+	ctx.start()
+	ctx.SetValueForKey(otherKey, value)
+	ctx.SetValueForKey(localKey, value)
+	ctx.SetValueForKey(key, value)
+	ctx.finish(nil)
+	ctx.wg.Wait()
+
+	test.AssertEqual(t, emitted, []string{otherKey, localKey, key})
+	test.AssertEqual(t, ctx.counters.stores, 2)
+	test.AssertEqual(t, ack, 1)
+}
+
+func TestContext_WithKeyLock(t *testing.T) {
+	var (
+		keyLocks = newKeyMutex()
+		active   int32
+		calls    int32
+		wg       sync.WaitGroup
+	)
+
+	for i := 0; i < 10; i++ {
+		ctx := &cbContext{
+			keyLocks: keyLocks,
+			msg:      &sarama.ConsumerMessage{Key: []byte("key")},
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx.WithKeyLock(func() {
+				test.AssertEqual(t, atomic.AddInt32(&active, 1), int32(1))
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&calls, 1)
+				atomic.AddInt32(&active, -1)
+			})
+		}()
+	}
+	wg.Wait()
+
+	test.AssertEqual(t, calls, int32(10))
+	// unused locks are removed
+	test.AssertEqual(t, len(keyLocks.locks), 0)
+}
@@ -1,6 +1,7 @@
 package goka
 
 import (
+	"encoding/binary"
 	"fmt"
 	"math"
 	"sort"
@@ -22,6 +23,30 @@ func (s *copartitioningStrategy) Name() string {
 
 // Plan implements BalanceStrategy.
 func (s *copartitioningStrategy) Plan(members map[string]sarama.ConsumerGroupMemberMetadata, topics map[string][]int32) (sarama.BalanceStrategyPlan, error) {
+	allPartitions, allTopics, allMembers, err := s.collect(members, topics)
+	if err != nil {
+		return nil, err
+	}
+
+	// (4) create a plan and assign the same set of partitions to the members
+	// in a range-like configuration (like `sarama.BalanceStrategyRange`)
+	plan := make(sarama.BalanceStrategyPlan, len(allMembers))
+	step := float64(len(allPartitions)) / float64(len(allMembers))
+	for idx, memberID := range allMembers {
+		pos := float64(idx)
+		min := int(math.Floor(pos*step + 0.5))
+		max := int(math.Floor((pos+1)*step + 0.5))
+		for _, topic := range allTopics {
+			plan.Add(memberID, topic, allPartitions[min:max]...)
+		}
+	}
+
+	return plan, nil
+}
+
+// collect returns the sorted partitions, topics and members and checks that
+// the topics are copartitioned and all members consume the same topics.
+func (s *copartitioningStrategy) collect(members map[string]sarama.ConsumerGroupMemberMetadata, topics map[string][]int32) ([]int32, []string, []string, error) {
 	var (
 		allPartitions []int32
 		allTopics     []string
@@ -34,7 +59,7 @@ func (s *copartitioningStrategy) Plan(members map[string]sarama.ConsumerGroupMem
 			allPartitions = topicPartitions
 		} else {
 			if !s.partitionsEqual(allPartitions, topicPartitions) {
-				return nil, fmt.Errorf("Error balancing. Not all topics are copartitioned. For goka, all topics need to have the same number of partitions: %#v", topics)
+				return nil, nil, nil, fmt.Errorf("Error balancing. Not all topics are copartitioned. For goka, all topics need to have the same number of partitions: %#v", topics)
 			}
 		}
 	}
@@ -42,7 +67,7 @@ func (s *copartitioningStrategy) Plan(members map[string]sarama.ConsumerGroupMem
 	// (2) collect all members and check they consume the same topics
 	for memberID, meta := range members {
 		if !s.topicsEqual(allTopics, meta.Topics) {
-			return nil, fmt.Errorf("Error balancing. Not all members request the same list of topics. A group-name clash might be the reason: %#v", members)
+			return nil, nil, nil, fmt.Errorf("Error balancing. Not all members request the same list of topics. A group-name clash might be the reason: %#v", members)
 		}
 		allMembers = append(allMembers, memberID)
 	}
@@ -52,20 +77,7 @@ func (s *copartitioningStrategy) Plan(members map[string]sarama.ConsumerGroupMem
 	sort.Strings(allTopics)
 	sort.Sort(partitionSlice(allPartitions))
 
-	// (4) create a plan and assign the same set of partitions to the members
-	// in a range-like configuration (like `sarama.BalanceStrategyRange`)
-	plan := make(sarama.BalanceStrategyPlan, len(allMembers))
-	step := float64(len(allPartitions)) / float64(len(allMembers))
-	for idx, memberID := range allMembers {
-		pos := float64(idx)
-		min := int(math.Floor(pos*step + 0.5))
-		max := int(math.Floor((pos+1)*step + 0.5))
-		for _, topic := range allTopics {
-			plan.Add(memberID, topic, allPartitions[min:max]...)
-		}
-	}
-
-	return plan, nil
+	return allPartitions, allTopics, allMembers, nil
 }
 
 // AssignmentData copartitioning strategy does not require data
@@ -104,6 +116,134 @@ func (s *copartitioningStrategy) topicsEqual(a, b []string) bool {
 	return true
 }
 
+// CopartitioningStickyStrategy is a copartitioning rebalance strategy that keeps
+// the partitions with their previous owners where possible, while distributing
+// them evenly. Partitions that stay with their owner only catch up their tables
+// from the local storage after a rebalance, so this reduces the recovery of
+// processors with large tables when instances join or leave the group.
+// Note that Kafka's cooperative (incremental) rebalance protocol is not supported
+// by the Kafka client, so all partitions are still revoked during a rebalance.
+// All instances of a group must use the same strategy, e.g. by
+//
+//  config := goka.DefaultConfig()
+//  config.Consumer.Group.Rebalance.Strategy = goka.CopartitioningStickyStrategy
+//  goka.ReplaceGlobalConfig(config)
+var CopartitioningStickyStrategy = new(copartitioningStickyStrategy)
+
+type copartitioningStickyStrategy struct {
+	copartitioningStrategy
+}
+
+// Name implements BalanceStrategy.
+func (s *copartitioningStickyStrategy) Name() string {
+	return "copartition-sticky"
+}
+
+// Plan implements BalanceStrategy.
+func (s *copartitioningStickyStrategy) Plan(members map[string]sarama.ConsumerGroupMemberMetadata, topics map[string][]int32) (sarama.BalanceStrategyPlan, error) {
+	allPartitions, allTopics, allMembers, err := s.collect(members, topics)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		valid    = make(map[int32]bool, len(allPartitions))
+		previous = make(map[string][]int32, len(allMembers))
+	)
+	for _, partition := range allPartitions {
+		valid[partition] = true
+	}
+	for _, memberID := range allMembers {
+		// members that cannot tell their previous partitions simply get new ones
+		previous[memberID], _ = decodeStickyPartitions(members[memberID].UserData)
+	}
+
+	// every member gets the same number of partitions, members that owned more
+	// partitions before get the remaining ones.
+	sort.SliceStable(allMembers, func(i, j int) bool {
+		return len(previous[allMembers[i]]) > len(previous[allMembers[j]])
+	})
+	quota := make(map[string]int, len(allMembers))
+	for idx, memberID := range allMembers {
+		quota[memberID] = len(allPartitions) / len(allMembers)
+		if idx < len(allPartitions)%len(allMembers) {
+			quota[memberID]++
+		}
+	}
+
+	var (
+		assigned = make(map[string][]int32, len(allMembers))
+		taken    = make(map[int32]bool, len(allPartitions))
+	)
+	// (4) keep the previous partitions up to the quota
+	for _, memberID := range allMembers {
+		for _, partition := range previous[memberID] {
+			if len(assigned[memberID]) >= quota[memberID] {
+				break
+			}
+			if !valid[partition] || taken[partition] {
+				continue
+			}
+			assigned[memberID] = append(assigned[memberID], partition)
+			taken[partition] = true
+		}
+	}
+
+	// (5) distribute the remaining partitions
+	sort.Strings(allMembers)
+	remaining := allPartitions
+	for _, memberID := range allMembers {
+		for len(assigned[memberID]) < quota[memberID] && len(remaining) > 0 {
+			partition := remaining[0]
+			remaining = remaining[1:]
+			if taken[partition] {
+				continue
+			}
+			assigned[memberID] = append(assigned[memberID], partition)
+			taken[partition] = true
+		}
+	}
+
+	plan := make(sarama.BalanceStrategyPlan, len(allMembers))
+	for _, memberID := range allMembers {
+		partitions := assigned[memberID]
+		sort.Sort(partitionSlice(partitions))
+		for _, topic := range allTopics {
+			plan.Add(memberID, topic, partitions...)
+		}
+	}
+	return plan, nil
+}
+
+// AssignmentData stores the assigned partitions, so the member sends them
+// when joining the group during the next rebalance.
+func (s *copartitioningStickyStrategy) AssignmentData(memberID string, topics map[string][]int32, generationID int32) ([]byte, error) {
+	// all topics have the same partitions
+	for _, partitions := range topics {
+		return encodeStickyPartitions(partitions), nil
+	}
+	return nil, nil
+}
+
+func encodeStickyPartitions(partitions []int32) []byte {
+	data := make([]byte, 4*len(partitions))
+	for i, partition := range partitions {
+		binary.BigEndian.PutUint32(data[4*i:], uint32(partition))
+	}
+	return data
+}
+
+func decodeStickyPartitions(data []byte) ([]int32, error) {
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("invalid sticky partitions of length %d", len(data))
+	}
+	partitions := make([]int32, 0, len(data)/4)
+	for i := 0; i < len(data); i += 4 {
+		partitions = append(partitions, int32(binary.BigEndian.Uint32(data[i:])))
+	}
+	return partitions, nil
+}
+
 type partitionSlice []int32
 
 func (p partitionSlice) Len() int           { return len(p) }
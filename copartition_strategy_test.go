@@ -131,3 +131,92 @@ func TestCopartitioningStrategy(t *testing.T) {
 		})
 	}
 }
+
+func TestCopartitioningStickyStrategy(t *testing.T) {
+	t.Run("name", func(t *testing.T) {
+		test.AssertEqual(t, CopartitioningStickyStrategy.Name(), "copartition-sticky")
+	})
+	t.Run("assignment-data", func(t *testing.T) {
+		data, err := CopartitioningStickyStrategy.AssignmentData("M1", map[string][]int32{
+			"T1": []int32{1, 4},
+			"T2": []int32{1, 4},
+		}, 1)
+		test.AssertNil(t, err)
+		partitions, err := decodeStickyPartitions(data)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, partitions, []int32{1, 4})
+	})
+
+	member := func(partitions ...int32) sarama.ConsumerGroupMemberMetadata {
+		return sarama.ConsumerGroupMemberMetadata{
+			Topics:   []string{"T1", "T2"},
+			UserData: encodeStickyPartitions(partitions),
+		}
+	}
+	topics := map[string][]int32{
+		"T1": []int32{0, 1, 2, 3, 4, 5},
+		"T2": []int32{0, 1, 2, 3, 4, 5},
+	}
+	assignment := func(partitions ...int32) map[string][]int32 {
+		return map[string][]int32{"T1": partitions, "T2": partitions}
+	}
+
+	for _, ttest := range []struct {
+		name     string
+		members  map[string]sarama.ConsumerGroupMemberMetadata
+		expected sarama.BalanceStrategyPlan
+	}{
+		{
+			name: "new-group",
+			members: map[string]sarama.ConsumerGroupMemberMetadata{
+				"M1": member(),
+				"M2": member(),
+			},
+			expected: sarama.BalanceStrategyPlan{
+				"M1": assignment(0, 1, 2),
+				"M2": assignment(3, 4, 5),
+			},
+		},
+		{
+			name: "member-joins",
+			members: map[string]sarama.ConsumerGroupMemberMetadata{
+				"M1": member(3, 4, 5),
+				"M2": member(0, 1, 2),
+				"M3": member(),
+			},
+			expected: sarama.BalanceStrategyPlan{
+				"M1": assignment(3, 4),
+				"M2": assignment(0, 1),
+				"M3": assignment(2, 5),
+			},
+		},
+		{
+			name: "member-leaves",
+			members: map[string]sarama.ConsumerGroupMemberMetadata{
+				"M1": member(3, 4),
+				"M3": member(2, 5),
+			},
+			expected: sarama.BalanceStrategyPlan{
+				"M1": assignment(0, 3, 4),
+				"M3": assignment(1, 2, 5),
+			},
+		},
+		{
+			name: "conflicting-previous-owners",
+			members: map[string]sarama.ConsumerGroupMemberMetadata{
+				"M1": member(0, 1, 2),
+				"M2": member(2, 3, 4, 5),
+			},
+			expected: sarama.BalanceStrategyPlan{
+				"M1": assignment(0, 1, 5),
+				"M2": assignment(2, 3, 4),
+			},
+		},
+	} {
+		t.Run(ttest.name, func(t *testing.T) {
+			plan, err := CopartitioningStickyStrategy.Plan(ttest.members, topics)
+			test.AssertNil(t, err)
+			test.AssertTrue(t, reflect.DeepEqual(ttest.expected, plan), "expected", ttest.expected, "actual", plan)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/logger"
+)
+
+// Headers added to the messages forwarded to the dead letter topic, see WithDeadLetter.
+const (
+	// DeadLetterHeaderError holds the error of the last failed attempt.
+	DeadLetterHeaderError = "goka-dead-letter-error"
+	// DeadLetterHeaderTopic holds the topic the message was consumed from.
+	DeadLetterHeaderTopic = "goka-dead-letter-topic"
+	// DeadLetterHeaderPartition holds the partition the message was consumed from.
+	DeadLetterHeaderPartition = "goka-dead-letter-partition"
+	// DeadLetterHeaderOffset holds the offset of the message.
+	DeadLetterHeaderOffset = "goka-dead-letter-offset"
+	// DeadLetterHeaderAttempts holds the number of failed attempts.
+	DeadLetterHeaderAttempts = "goka-dead-letter-attempts"
+)
+
+type deadLetter struct {
+	topic       Stream
+	maxAttempts int
+}
+
+// processDeadLettering processes the message up to the configured number of attempts
+// and forwards it to the dead letter topic if all attempts failed.
+func (pp *PartitionProcessor) processDeadLettering(ctx context.Context, wg *sync.WaitGroup, msg *sarama.ConsumerMessage, asyncFailer func(err error)) error {
+	dl := pp.opts.deadLetter
+
+	var err error
+	for attempt := 1; attempt <= dl.maxAttempts; attempt++ {
+		if err = pp.tryProcessMessage(ctx, wg, msg, asyncFailer); err == nil {
+			return nil
+		}
+		// the partition is stopping, the message is processed again by the next owner
+		if ctx.Err() != nil {
+			return err
+		}
+		logger.Warnf(pp.messageLog(msg), "processing message (key %s) from %s/%d@%d failed (attempt %d of %d): %v",
+			string(msg.Key), msg.Topic, msg.Partition, msg.Offset, attempt, dl.maxAttempts, err)
+	}
+
+	headers := make(map[string][]byte, len(msg.Headers)+5)
+	for _, header := range msg.Headers {
+		headers[string(header.Key)] = header.Value
+	}
+	headers[DeadLetterHeaderError] = []byte(err.Error())
+	headers[DeadLetterHeaderTopic] = []byte(msg.Topic)
+	headers[DeadLetterHeaderPartition] = []byte(strconv.FormatInt(int64(msg.Partition), 10))
+	headers[DeadLetterHeaderOffset] = []byte(strconv.FormatInt(msg.Offset, 10))
+	headers[DeadLetterHeaderAttempts] = []byte(strconv.Itoa(dl.maxAttempts))
+
+	wg.Add(1)
+	pp.producer.EmitWithHeaders(string(dl.topic), string(msg.Key), msg.Value, headers).Then(func(err error) {
+		defer wg.Done()
+		if err != nil {
+			asyncFailer(fmt.Errorf("error forwarding failed message to %s: %v", dl.topic, err))
+			return
+		}
+		pp.markMessage(msg)
+	})
+	return nil
+}
+
+// tryProcessMessage processes the message and returns the failure of the
+// callback as error instead of panicking.
+func (pp *PartitionProcessor) tryProcessMessage(ctx context.Context, wg *sync.WaitGroup, msg *sarama.ConsumerMessage, asyncFailer func(err error)) (rerr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if err, ok := r.(error); ok {
+				rerr = err
+				return
+			}
+			rerr = fmt.Errorf("%v", r)
+		}
+	}()
+
+	return pp.processMessage(ctx, wg, msg, func(err error) { panic(err) }, asyncFailer)
+}
@@ -0,0 +1,240 @@
+package goka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lovoo/goka/logger"
+)
+
+// delayedMessage is a message in a delay topic that is emitted into its target
+// topic by the delay scheduler once it is due.
+type delayedMessage struct {
+	Topic string    `json:"topic"`
+	Key   string    `json:"key"`
+	Value []byte    `json:"value"`
+	Due   time.Time `json:"due"`
+}
+
+// delayedMessageCodec encodes the messages of delay topics.
+type delayedMessageCodec struct{}
+
+func (c *delayedMessageCodec) Encode(value interface{}) ([]byte, error) {
+	msg, ok := value.(*delayedMessage)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T for delayed message", value)
+	}
+	return json.Marshal(msg)
+}
+
+func (c *delayedMessageCodec) Decode(data []byte) (interface{}, error) {
+	msg := new(delayedMessage)
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("error decoding delayed message: %v", err)
+	}
+	return msg, nil
+}
+
+type delayOutput outputStream
+
+// DelayOutput represents the edge of the delay topic the group writes into
+// with Context.EmitDelayed. A delay scheduler (see NewDelayScheduler) consumes
+// the topic and emits the messages into their target topics once they are due,
+// so delayed messages survive restarts and can be delivered to any stage of
+// the pipeline.
+func DelayOutput(topic Stream) Edge {
+	return &delayOutput{&topicDef{string(topic), new(delayedMessageCodec)}}
+}
+
+const (
+	// defaultDelayTickInterval is the interval in which the delay scheduler emits
+	// the due messages by default.
+	defaultDelayTickInterval = time.Second
+	// delayTickKey is the prefix of the keys of the ticks, which get a suffix
+	// (".<n>") that makes them hash to the partition.
+	delayTickKey = "goka-delay-tick"
+)
+
+// delayTickValue is a delayed message without target topic. It makes the delay
+// scheduler emit the due messages of the partition.
+var delayTickValue = []byte("{}")
+
+// NewDelayScheduler creates a processor in group that consumes the delay topic
+// and emits each message into its target topic once it is due. Messages that
+// are not yet due are persisted in the group table of the scheduler, so they
+// survive restarts and rebalances, and the input message is committed right
+// away. The partition processors emit ticks into the delay topic (see
+// WithDelayTickInterval, default one second), on which the due messages of the
+// partition are emitted in the order of their due time. So a message is
+// delivered up to one tick interval after it is due, or later if the scheduler
+// is stopped or lagging. Since the emits and the table updates of a tick are
+// not atomic, a message may be delivered more than once after a failure.
+func NewDelayScheduler(brokers []string, group Group, delayTopic Stream, options ...ProcessorOption) (*Processor, error) {
+	options = append([]ProcessorOption{
+		WithDelayTickInterval(defaultDelayTickInterval),
+		withDelayTicks(delayTopic),
+	}, options...)
+	return NewProcessor(brokers, DefineGroup(group,
+		Input(delayTopic, new(delayedMessageCodec), scheduleDelayed),
+		Persist(new(delayedMessageCodec)),
+	), options...)
+}
+
+// withDelayTicks makes the partition processors emit ticks into the delay topic.
+func withDelayTicks(delayTopic Stream) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.delayTickTopic = string(delayTopic)
+	}
+}
+
+// runDelayTicks emits a tick into the delay topic in the configured interval.
+// Failed ticks are only logged, the next tick emits the messages.
+func (pp *PartitionProcessor) runDelayTicks(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-pp.opts.clock.After(pp.opts.delayTickInterval):
+			pp.producer.Emit(pp.opts.delayTickTopic, pp.delayTickKey, delayTickValue).Then(func(err error) {
+				if err != nil {
+					logger.Errorf(pp.log, "error emitting delay tick: %v", err)
+				}
+			})
+		}
+	}
+}
+
+// scheduleDelayed emits the delayed message if it is due and stores it in the
+// group table otherwise. On a tick, it emits the due messages of the table.
+func scheduleDelayed(ctx Context, msg interface{}) {
+	cbCtx, ok := ctx.(*cbContext)
+	if !ok {
+		ctx.Fail(fmt.Errorf("delay scheduler requires the processor's context, got %T", ctx))
+	}
+	delayed, ok := msg.(*delayedMessage)
+	if !ok || delayed == nil {
+		ctx.Fail(fmt.Errorf("unexpected delayed message %#v", msg))
+	}
+
+	now := cbCtx.Now()
+	switch {
+	case delayed.Topic == "":
+		if err := cbCtx.emitDueDelayed(now); err != nil {
+			ctx.Fail(err)
+		}
+	case !delayed.Due.After(now):
+		cbCtx.emit(delayed.Topic, delayed.Key, delayed.Value)
+	default:
+		key, err := cbCtx.delayedKey(delayed.Due)
+		if err != nil {
+			ctx.Fail(err)
+		}
+		if err := cbCtx.setValueForKey(key, delayed); err != nil {
+			ctx.Fail(err)
+		}
+	}
+}
+
+// delayedKey returns the key storing a delayed message in the scheduler's
+// table. It starts with the due time, so the keys sort by it, and hashes to
+// the partition of the input message by appending a counter.
+func (ctx *cbContext) delayedKey(due time.Time) (string, error) {
+	for i := 0; i < 100000; i++ {
+		key := fmt.Sprintf("%020d.%d.%d", due.UnixNano(), ctx.Offset(), i)
+		local, err := ctx.isLocalKey(key)
+		if err != nil {
+			return "", err
+		}
+		if local {
+			return key, nil
+		}
+	}
+	return "", fmt.Errorf("no key found for delayed message in partition %d", ctx.Partition())
+}
+
+// emitDueDelayed emits the messages of the scheduler's table that are due at
+// now and deletes them from the table.
+func (ctx *cbContext) emitDueDelayed(now time.Time) error {
+	if ctx.table == nil {
+		return fmt.Errorf("delay scheduler requires a group table")
+	}
+	// the keys due at now sort before the next nanosecond
+	limit := []byte(fmt.Sprintf("%020d", now.UnixNano()+1))
+	iter, err := ctx.table.st.IteratorWithRange(nil, limit)
+	if err != nil {
+		return fmt.Errorf("error iterating delayed messages: %v", err)
+	}
+
+	var (
+		keys []string
+		due  = make(map[string]*delayedMessage)
+	)
+	for iter.Next() {
+		data, err := iter.Value()
+		if err != nil {
+			iter.Release()
+			return fmt.Errorf("error reading delayed message: %v", err)
+		}
+		msg, err := ctx.graph.GroupTable().Codec().Decode(data)
+		if err != nil {
+			iter.Release()
+			return err
+		}
+		key := string(iter.Key())
+		keys = append(keys, key)
+		due[key] = msg.(*delayedMessage)
+	}
+	err = iter.Err()
+	iter.Release()
+	if err != nil {
+		return fmt.Errorf("error iterating delayed messages: %v", err)
+	}
+
+	// not all storages iterate in order
+	sort.Strings(keys)
+	for _, key := range keys {
+		msg := due[key]
+		ctx.emit(msg.Topic, msg.Key, msg.Value)
+		if err := ctx.deleteKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EmitDelayed asynchronously writes a message into the delay topic of the
+// group, which is emitted into topic after delay.
+func (ctx *cbContext) EmitDelayed(topic Stream, key string, value interface{}, delay time.Duration) {
+	d := ctx.graph.DelayStream()
+	if d == nil {
+		ctx.Fail(errors.New("no delay topic configured. Did you specify goka.DelayOutput(..) when defining the processor?"))
+	}
+	if !ctx.graph.isOutputTopic(topic) {
+		ctx.Fail(fmt.Errorf("topic %s is not configured for output. Did you specify goka.Output(..) when defining the processor?", topic))
+	}
+
+	var data []byte
+	if value != nil {
+		var err error
+		data, err = ctx.graph.codec(string(topic)).Encode(value)
+		if err != nil {
+			ctx.Fail(fmt.Errorf("error encoding message for topic %s: %v", topic, err))
+		}
+	}
+
+	delayed, err := d.Codec().Encode(&delayedMessage{
+		Topic: string(topic),
+		Key:   key,
+		Value: data,
+		Due:   ctx.Now().Add(delay),
+	})
+	if err != nil {
+		ctx.Fail(fmt.Errorf("error encoding delayed message for topic %s: %v", topic, err))
+	}
+
+	ctx.emit(d.Topic(), key, delayed)
+}
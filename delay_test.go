@@ -0,0 +1,78 @@
+package goka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
+)
+
+func TestDelayScheduler_persistTimers(t *testing.T) {
+	var (
+		st      = storage.NewMemory()
+		graph   = DefineGroup("scheduler", Input("delays", new(delayedMessageCodec), scheduleDelayed), Persist(new(delayedMessageCodec)))
+		emitted []string
+	)
+
+	// schedule calls the scheduler's callback like the partition processor does
+	schedule := func(msg *delayedMessage) {
+		data, err := new(delayedMessageCodec).Encode(msg)
+		test.AssertNil(t, err)
+		ctx := &cbContext{
+			graph:            graph,
+			wg:               new(sync.WaitGroup),
+			commit:           func() {},
+			syncFailer:       func(err error) { panic(err) },
+			trackOutputStats: func(ctx context.Context, topic string, size int) {},
+			msg:              &sarama.ConsumerMessage{Key: []byte("key"), Value: data, Offset: int64(len(emitted))},
+			ctx:              context.Background(),
+			table: &PartitionTable{
+				st:          &storageProxy{Storage: st},
+				stats:       newTableStats(),
+				updateStats: make(chan func(), 10),
+			},
+			partitionOf: func(key string) (int32, error) { return 0, nil },
+			emitter: func(topic string, key string, value []byte, headers map[string][]byte) *Promise {
+				if topic != graph.GroupTable().Topic() {
+					emitted = append(emitted, string(value))
+				}
+				return NewPromise().Finish(nil, nil)
+			},
+		}
+		decoded, err := new(delayedMessageCodec).Decode(data)
+		test.AssertNil(t, err)
+		ctx.start()
+		scheduleDelayed(ctx, decoded)
+		ctx.finish(nil)
+		ctx.wg.Wait()
+	}
+	tick := &delayedMessage{}
+
+	// a due message is emitted right away
+	schedule(&delayedMessage{Topic: "target", Key: "key", Value: []byte("due"), Due: time.Now()})
+	test.AssertEqual(t, emitted, []string{"due"})
+
+	// pending messages are stored in the table and emitted on the first tick after they are due
+	now := time.Now()
+	schedule(&delayedMessage{Topic: "target", Key: "key", Value: []byte("later"), Due: now.Add(100 * time.Millisecond)})
+	schedule(&delayedMessage{Topic: "target", Key: "key", Value: []byte("soon"), Due: now.Add(50 * time.Millisecond)})
+	schedule(tick)
+	test.AssertEqual(t, emitted, []string{"due"})
+
+	// the timers are read from the storage, so they survive restarts
+	time.Sleep(150 * time.Millisecond)
+	schedule(tick)
+	test.AssertEqual(t, emitted, []string{"due", "soon", "later"})
+
+	// the emitted messages were deleted from the table
+	schedule(tick)
+	test.AssertEqual(t, emitted, []string{"due", "soon", "later"})
+	iter, err := st.Iterator()
+	test.AssertNil(t, err)
+	defer iter.Release()
+	test.AssertFalse(t, iter.Next())
+}
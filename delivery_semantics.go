@@ -0,0 +1,13 @@
+package goka
+
+// DeliverySemantics defines when the processor commits an input message.
+type DeliverySemantics int
+
+const (
+	// AtLeastOnce commits a message after the callback returned and all its emits
+	// succeeded. Messages are processed again after failures.
+	AtLeastOnce DeliverySemantics = 0 + iota
+	// AtMostOnce commits a message before the callback is called. Messages are
+	// lost if the callback or its emits fail.
+	AtMostOnce
+)
@@ -0,0 +1,76 @@
+package goka
+
+import "sync"
+
+// durableOffsets advances the stored offset of a partition table only up to
+// the last message whose side effects and those of all previous messages were
+// confirmed durable by the DurableUpdateCallback.
+type durableOffsets struct {
+	m       sync.Mutex
+	pending []*pendingOffset
+	commit  func(offset int64) error
+	err     error
+}
+
+type pendingOffset struct {
+	offset  int64
+	durable bool
+}
+
+func newDurableOffsets(commit func(offset int64) error) *durableOffsets {
+	return &durableOffsets{
+		commit: commit,
+	}
+}
+
+// add adds the offset of a message and returns the function confirming that
+// the message's side effects are durable.
+func (d *durableOffsets) add(offset int64) func() {
+	d.m.Lock()
+	defer d.m.Unlock()
+	po := &pendingOffset{offset: offset}
+	d.pending = append(d.pending, po)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { d.confirm(po) })
+	}
+}
+
+func (d *durableOffsets) confirm(po *pendingOffset) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	po.durable = true
+
+	var (
+		advance bool
+		offset  int64
+	)
+	for len(d.pending) > 0 && d.pending[0].durable {
+		offset = d.pending[0].offset
+		advance = true
+		d.pending = d.pending[1:]
+	}
+	if !advance {
+		return
+	}
+	if err := d.commit(offset); err != nil && d.err == nil {
+		d.err = err
+	}
+}
+
+// error returns the first error committing an offset.
+func (d *durableOffsets) error() error {
+	d.m.Lock()
+	defer d.m.Unlock()
+	return d.err
+}
+
+// reset drops the pending offsets when the partition table starts loading
+// after the stored offset again, so later confirmations of the dropped
+// offsets have no effect.
+func (d *durableOffsets) reset() {
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.pending = nil
+}
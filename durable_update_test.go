@@ -0,0 +1,82 @@
+package goka
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
+)
+
+func TestDurableOffsets(t *testing.T) {
+	t.Run("advance_in_order", func(t *testing.T) {
+		var commits []int64
+		d := newDurableOffsets(func(offset int64) error {
+			commits = append(commits, offset)
+			return nil
+		})
+
+		durable1 := d.add(1)
+		durable2 := d.add(2)
+		durable3 := d.add(3)
+
+		// offset 2 must wait for offset 1
+		durable2()
+		test.AssertEqual(t, len(commits), 0)
+		durable1()
+		test.AssertEqual(t, commits, []int64{2})
+
+		// confirming twice has no effect
+		durable1()
+		durable3()
+		durable3()
+		test.AssertEqual(t, commits, []int64{2, 3})
+		test.AssertNil(t, d.error())
+	})
+	t.Run("reset", func(t *testing.T) {
+		var commits []int64
+		d := newDurableOffsets(func(offset int64) error {
+			commits = append(commits, offset)
+			return nil
+		})
+
+		durable := d.add(1)
+		d.reset()
+		durable()
+		test.AssertEqual(t, len(commits), 0)
+	})
+	t.Run("fail", func(t *testing.T) {
+		d := newDurableOffsets(func(offset int64) error {
+			return errors.New("some-error")
+		})
+		d.add(1)()
+		test.AssertNotNil(t, d.error())
+	})
+}
+
+func TestPT_storeDurableEvent(t *testing.T) {
+	var confirm func()
+	st := storage.NewMemory()
+	pt := &PartitionTable{
+		st: &storageProxy{Storage: st},
+		durableUpdate: func(s storage.Storage, partition int32, key string, value []byte, durable func()) error {
+			confirm = durable
+			return s.Set(key, value)
+		},
+	}
+	pt.durableOffsets = newDurableOffsets(pt.st.SetOffset)
+
+	test.AssertNil(t, pt.storeEvent("key", []byte("value"), 5))
+	value, err := st.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, value, []byte("value"))
+
+	// the offset is stored once the update is durable
+	offset, err := st.GetOffset(offsetNotStored)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, offset, offsetNotStored)
+	confirm()
+	offset, err = st.GetOffset(offsetNotStored)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, offset, int64(5))
+}
@@ -0,0 +1,56 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+)
+
+// emitLimiter limits the in-flight emits per topic.
+// A nil limiter does not limit any emits.
+type emitLimiter struct {
+	slots map[string]chan struct{}
+}
+
+func newEmitLimiter(limits map[Stream]int) *emitLimiter {
+	if len(limits) == 0 {
+		return nil
+	}
+	l := &emitLimiter{
+		slots: make(map[string]chan struct{}, len(limits)),
+	}
+	for topic, limit := range limits {
+		l.slots[string(topic)] = make(chan struct{}, limit)
+	}
+	return l
+}
+
+// acquire blocks until there is a free slot for an emit to the topic or the
+// context is done. It returns the function to release the slot once the emit
+// finished.
+func (l *emitLimiter) acquire(ctx context.Context, topic string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	slots, ok := l.slots[topic]
+	if !ok {
+		return func() {}, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("context done while waiting for emit slot of topic %s: %v", topic, ctx.Err())
+	}
+}
+
+// inFlight returns the number of in-flight emits of the limited topics.
+func (l *emitLimiter) inFlight() map[string]int {
+	if l == nil {
+		return nil
+	}
+	counts := make(map[string]int, len(l.slots))
+	for topic, slots := range l.slots {
+		counts[topic] = len(slots)
+	}
+	return counts
+}
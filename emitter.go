@@ -3,14 +3,65 @@ package goka
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
 var (
 	// ErrEmitterAlreadyClosed is returned when Emit is called after the emitter has been finished.
 	ErrEmitterAlreadyClosed error = errors.New("emitter already closed")
+	// ErrEmitSyncTimeout is returned by EmitSync if the message was not acknowledged
+	// within the timeout set by WithEmitterSyncTimeout.
+	ErrEmitSyncTimeout error = errors.New("timeout waiting for the message to be acknowledged")
 )
 
+// EmitEntry is a single message sent by Emitter.EmitBatch.
+type EmitEntry struct {
+	Key     string
+	Value   interface{}
+	Headers map[string][]byte
+}
+
+// BatchError is the error of a batch promise if some of its entries failed.
+type BatchError struct {
+	// Entries are all entries of the batch.
+	Entries []EmitEntry
+	// Errors maps the index of each failed entry to its error.
+	Errors map[int]error
+}
+
+// Failed returns the entries that failed.
+func (e *BatchError) Failed() []EmitEntry {
+	idxs := e.failedIndexes()
+
+	failed := make([]EmitEntry, 0, len(idxs))
+	for _, i := range idxs {
+		failed = append(failed, e.Entries[i])
+	}
+	return failed
+}
+
+func (e *BatchError) failedIndexes() []int {
+	idxs := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		idxs = append(idxs, i)
+	}
+	sort.Ints(idxs)
+	return idxs
+}
+
+func (e *BatchError) Error() string {
+	idxs := e.failedIndexes()
+
+	var errs []string
+	for _, i := range idxs {
+		errs = append(errs, fmt.Sprintf("entry %d (key %s): %v", i, e.Entries[i].Key, e.Errors[i]))
+	}
+	return fmt.Sprintf("%d of %d batch entries failed: %s", len(idxs), len(e.Entries), strings.Join(errs, ", "))
+}
+
 // Emitter emits messages into a specific Kafka topic, first encoding the message with the given codec.
 type Emitter struct {
 	codec    Codec
@@ -18,6 +69,10 @@ type Emitter struct {
 
 	topic string
 
+	hold *emitHold
+
+	syncTimeout time.Duration
+
 	wg   sync.WaitGroup
 	done chan struct{}
 }
@@ -47,7 +102,10 @@ func NewEmitter(brokers []string, topic Stream, codec Codec, options ...EmitterO
 		codec:    codec,
 		producer: prod,
 		topic:    string(topic),
+		hold:     newEmitHold(opts.holdBufferSize, opts.holdTimeout),
 		done:     make(chan struct{}),
+
+		syncTimeout: opts.syncTimeout,
 	}, nil
 }
 
@@ -59,28 +117,86 @@ func (e *Emitter) EmitWithHeaders(key string, msg interface{}, headers map[strin
 	default:
 	}
 
-	var (
-		err  error
-		data []byte
-	)
+	data, err := e.encode(key, msg)
+	if err != nil {
+		return nil, err
+	}
+	return e.emit(key, data, headers), nil
+}
+
+func (e *Emitter) encode(key string, msg interface{}) ([]byte, error) {
+	if msg == nil {
+		return nil, nil
+	}
+	data, err := e.codec.Encode(msg)
+	if err != nil {
+		return nil, fmt.Errorf("Error encoding value for key %s in topic %s: %v", key, e.topic, err)
+	}
+	return data, nil
+}
+
+func (e *Emitter) emit(key string, data []byte, headers map[string][]byte) *Promise {
+	e.wg.Add(1)
+	return e.hold.emit(func() *Promise {
+		if headers == nil {
+			return e.producer.Emit(e.topic, key, data)
+		}
+		return e.producer.EmitWithHeaders(e.topic, key, data, headers)
+	}).Then(func(err error) {
+		e.wg.Done()
+	})
+}
+
+// EmitBatch sends all entries using the emitter's codec. The returned promise
+// finishes once every entry is acknowledged by Kafka or failed. If some entries
+// failed, the promise's error is a *BatchError holding the failed entries.
+// If an entry cannot be encoded, the error is returned and nothing is sent.
+func (e *Emitter) EmitBatch(entries []EmitEntry) (*Promise, error) {
+	select {
+	case <-e.done:
+		return NewPromise().Finish(nil, ErrEmitterAlreadyClosed), nil
+	default:
+	}
 
-	if msg != nil {
-		data, err = e.codec.Encode(msg)
+	data := make([][]byte, len(entries))
+	for i, entry := range entries {
+		var err error
+		data[i], err = e.encode(entry.Key, entry.Value)
 		if err != nil {
-			return nil, fmt.Errorf("Error encoding value for key %s in topic %s: %v", key, e.topic, err)
+			return nil, fmt.Errorf("Error encoding batch entry %d: %v", i, err)
 		}
 	}
-	e.wg.Add(1)
-	if headers == nil {
-		return e.producer.Emit(e.topic, key, data).Then(func(err error) {
-			e.wg.Done()
-		}), nil
-	} else {
-		return e.producer.EmitWithHeaders(e.topic, key, data, headers).Then(func(err error) {
-			e.wg.Done()
-		}), nil
+
+	batch := NewPromise()
+	if len(entries) == 0 {
+		return batch.Finish(nil, nil), nil
 	}
 
+	var (
+		m       sync.Mutex
+		pending = len(entries)
+		errs    = make(map[int]error)
+	)
+	for i, entry := range entries {
+		i := i
+		e.emit(entry.Key, data[i], entry.Headers).Then(func(err error) {
+			m.Lock()
+			defer m.Unlock()
+			if err != nil {
+				errs[i] = err
+			}
+			pending--
+			if pending > 0 {
+				return
+			}
+			if len(errs) > 0 {
+				batch.Finish(nil, &BatchError{Entries: entries, Errors: errs})
+				return
+			}
+			batch.Finish(nil, nil)
+		})
+	}
+	return batch, nil
 }
 
 // Emit sends a message for passed key using the emitter's codec.
@@ -88,35 +204,88 @@ func (e *Emitter) Emit(key string, msg interface{}) (*Promise, error) {
 	return e.EmitWithHeaders(key, msg, nil)
 }
 
+// EmitCallback sends a message for passed key using the emitter's codec and calls
+// cb asynchronously once the message is acknowledged by Kafka or failed.
+// It does not block, so it can be used to implement custom flow control, e.g.
+// by releasing a semaphore in cb.
+// If the message cannot be encoded, the error is returned and cb is not called.
+func (e *Emitter) EmitCallback(key string, msg interface{}, cb func(err error)) error {
+	promise, err := e.Emit(key, msg)
+	if err != nil {
+		return err
+	}
+	promise.Then(cb)
+	return nil
+}
+
 // EmitSyncWithHeaders sends a message with the given headers to passed topic and key.
+// It blocks until the message is acknowledged by Kafka or failed, or the timeout set by
+// WithEmitterSyncTimeout expires.
 func (e *Emitter) EmitSyncWithHeaders(key string, msg interface{}, headers map[string][]byte) error {
-	var (
-		err     error
-		promise *Promise
-	)
-	promise, err = e.EmitWithHeaders(key, msg, headers)
-
+	promise, err := e.EmitWithHeaders(key, msg, headers)
 	if err != nil {
 		return err
 	}
 
-	done := make(chan struct{})
+	done := make(chan error, 1)
 	promise.Then(func(asyncErr error) {
-		err = asyncErr
-		close(done)
+		done <- asyncErr
 	})
-	<-done
-	return err
+
+	if e.syncTimeout <= 0 {
+		return <-done
+	}
+
+	timer := time.NewTimer(e.syncTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return ErrEmitSyncTimeout
+	}
 }
 
 // EmitSync sends a message to passed topic and key.
+// It blocks until the message is acknowledged by Kafka or failed, or the timeout set by
+// WithEmitterSyncTimeout expires.
 func (e *Emitter) EmitSync(key string, msg interface{}) error {
 	return e.EmitSyncWithHeaders(key, msg, nil)
 }
 
+// QueueDepth returns the number of messages buffered in the emitter's producer
+// awaiting the broker's acknowledgement. A growing queue depth indicates that
+// messages are emitted faster than the broker accepts them. It is 0 if the
+// producer does not implement QueueDepthReporter.
+func (e *Emitter) QueueDepth() int {
+	return producerQueueDepth(e.producer)
+}
+
+// Hold pauses emitting, e.g. during the maintenance of a downstream system.
+// Messages emitted while held are buffered and sent on Release in the order they
+// were emitted. Their promises finish once they are actually sent.
+// If the buffer is full (see WithEmitterHoldBuffer), Emit blocks until there is
+// space again or the configured timeout expires, in which case the message is
+// dropped and its promise fails with ErrHoldBufferFull.
+func (e *Emitter) Hold() {
+	e.hold.hold()
+}
+
+// Release sends all messages buffered since Hold and resumes emitting.
+func (e *Emitter) Release() {
+	e.hold.release()
+}
+
 // Finish waits until the emitter is finished producing all pending messages.
+// A held emitter is released before.
 func (e *Emitter) Finish() error {
+	e.stop()
+	return e.producer.Close()
+}
+
+// stop releases the emitter and waits for all pending messages.
+func (e *Emitter) stop() {
+	e.hold.release()
 	close(e.done)
 	e.wg.Wait()
-	return e.producer.Close()
 }
@@ -174,8 +174,136 @@ func TestEmitter_EmitSync(t *testing.T) {
 		err := emitter.EmitSync(key, intVal)
 		test.AssertNotNil(t, err)
 	})
+	t.Run("succeed_timeout", func(t *testing.T) {
+		emitter, bm, ctrl := createEmitter(t, WithEmitterSyncTimeout(time.Second))
+		defer ctrl.Finish()
+
+		var (
+			key           = "some-key"
+			intVal int64  = 1312
+			data   []byte = []byte(strconv.FormatInt(intVal, 10))
+		)
+
+		bm.producer.EXPECT().Emit(emitter.topic, key, data).Return(NewPromise().Finish(nil, nil))
+		err := emitter.EmitSync(key, intVal)
+		test.AssertNil(t, err)
+	})
+	t.Run("fail_timeout", func(t *testing.T) {
+		emitter, bm, ctrl := createEmitter(t, WithEmitterSyncTimeout(10*time.Millisecond))
+		defer ctrl.Finish()
+
+		var (
+			key           = "some-key"
+			intVal int64  = 1312
+			data   []byte = []byte(strconv.FormatInt(intVal, 10))
+		)
+
+		// the promise is never finished
+		bm.producer.EXPECT().Emit(emitter.topic, key, data).Return(NewPromise())
+		err := emitter.EmitSync(key, intVal)
+		test.AssertEqual(t, err, ErrEmitSyncTimeout)
+	})
+}
+
+func TestEmitter_EmitCallback(t *testing.T) {
+	t.Run("succeed", func(t *testing.T) {
+		emitter, bm, ctrl := createEmitter(t)
+		defer ctrl.Finish()
+
+		var (
+			key           = "some-key"
+			intVal int64  = 1312
+			data   []byte = []byte(strconv.FormatInt(intVal, 10))
+			retErr error  = errors.New("some-error")
+			acks   []error
+		)
+
+		promise := NewPromise()
+		bm.producer.EXPECT().Emit(emitter.topic, key, data).Return(promise)
+		err := emitter.EmitCallback(key, intVal, func(err error) {
+			acks = append(acks, err)
+		})
+		test.AssertNil(t, err)
+		test.AssertEqual(t, len(acks), 0)
+
+		promise.Finish(nil, retErr)
+		test.AssertEqual(t, acks, []error{retErr})
+	})
+	t.Run("fail_encode", func(t *testing.T) {
+		emitter, _, _ := createEmitter(t)
+
+		err := emitter.EmitCallback("some-key", "1312", func(err error) {
+			t.Errorf("callback must not be called")
+		})
+		test.AssertNotNil(t, err)
+	})
 }
 
+func TestEmitter_EmitBatch(t *testing.T) {
+	t.Run("succeed", func(t *testing.T) {
+		emitter, bm, ctrl := createEmitter(t)
+		defer ctrl.Finish()
+
+		var (
+			headers  = map[string][]byte{"header": []byte("value")}
+			promises = []*Promise{NewPromise(), NewPromise()}
+			done     bool
+		)
+
+		bm.producer.EXPECT().Emit(emitter.topic, "a", []byte("1")).Return(promises[0])
+		bm.producer.EXPECT().EmitWithHeaders(emitter.topic, "b", []byte("2"), headers).Return(promises[1])
+		promise, err := emitter.EmitBatch([]EmitEntry{
+			{Key: "a", Value: int64(1)},
+			{Key: "b", Value: int64(2), Headers: headers},
+		})
+		test.AssertNil(t, err)
+		promise.Then(func(err error) {
+			test.AssertNil(t, err)
+			done = true
+		})
+
+		promises[0].Finish(nil, nil)
+		test.AssertFalse(t, done)
+		promises[1].Finish(nil, nil)
+		test.AssertTrue(t, done)
+	})
+	t.Run("succeed_empty", func(t *testing.T) {
+		emitter, _, ctrl := createEmitter(t)
+		defer ctrl.Finish()
+
+		promise, err := emitter.EmitBatch(nil)
+		test.AssertNil(t, err)
+		test.AssertNil(t, promise.err)
+	})
+	t.Run("fail_partial", func(t *testing.T) {
+		emitter, bm, ctrl := createEmitter(t)
+		defer ctrl.Finish()
+
+		retErr := errors.New("some-error")
+		bm.producer.EXPECT().Emit(emitter.topic, "a", []byte("1")).Return(NewPromise().Finish(nil, nil))
+		bm.producer.EXPECT().Emit(emitter.topic, "b", []byte("2")).Return(NewPromise().Finish(nil, retErr))
+		promise, err := emitter.EmitBatch([]EmitEntry{
+			{Key: "a", Value: int64(1)},
+			{Key: "b", Value: int64(2)},
+		})
+		test.AssertNil(t, err)
+
+		batchErr, ok := promise.err.(*BatchError)
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, batchErr.Errors, map[int]error{1: retErr})
+		test.AssertEqual(t, batchErr.Failed(), []EmitEntry{{Key: "b", Value: int64(2)}})
+	})
+	t.Run("fail_encode", func(t *testing.T) {
+		emitter, _, ctrl := createEmitter(t)
+		defer ctrl.Finish()
+
+		_, err := emitter.EmitBatch([]EmitEntry{
+			{Key: "a", Value: int64(1)},
+			{Key: "b", Value: "2"},
+		})
+		test.AssertNotNil(t, err)
+	})
+}
 func TestEmitter_Finish(t *testing.T) {
 	t.Run("succeed", func(t *testing.T) {
 		emitter, bm, ctrl := createEmitter(t)
@@ -204,3 +332,74 @@ func TestEmitter_Finish(t *testing.T) {
 		test.AssertNil(t, err)
 	})
 }
+
+func TestEmitter_Hold(t *testing.T) {
+	t.Run("succeed", func(t *testing.T) {
+		emitter, bm, ctrl := createEmitter(t)
+		defer ctrl.Finish()
+
+		var (
+			key           = "some-key"
+			intVal int64  = 1312
+			data   []byte = []byte(strconv.FormatInt(intVal, 10))
+		)
+
+		emitter.Hold()
+
+		var emitted bool
+		promise, err := emitter.Emit(key, intVal)
+		test.AssertNil(t, err)
+		promise.Then(func(err error) {
+			test.AssertNil(t, err)
+			emitted = true
+		})
+		// nothing is emitted while held
+		test.AssertFalse(t, emitted)
+
+		bm.producer.EXPECT().Emit(emitter.topic, key, data).Return(NewPromise().Finish(nil, nil))
+		emitter.Release()
+		test.AssertTrue(t, emitted)
+	})
+	t.Run("fail_buffer_full", func(t *testing.T) {
+		emitter, bm, ctrl := createEmitter(t, WithEmitterHoldBuffer(1, time.Millisecond))
+		defer ctrl.Finish()
+
+		var (
+			key           = "some-key"
+			intVal int64  = 1312
+			data   []byte = []byte(strconv.FormatInt(intVal, 10))
+		)
+
+		emitter.Hold()
+
+		_, err := emitter.Emit(key, intVal)
+		test.AssertNil(t, err)
+
+		err = emitter.EmitSync(key, intVal)
+		test.AssertEqual(t, err, ErrHoldBufferFull)
+
+		bm.producer.EXPECT().Emit(emitter.topic, key, data).Return(NewPromise().Finish(nil, nil))
+		bm.producer.EXPECT().Close().Return(nil)
+		test.AssertNil(t, emitter.Finish())
+	})
+}
+
+type queueDepthProducer struct {
+	*MockProducer
+	depth int
+}
+
+func (p *queueDepthProducer) QueueDepth() int {
+	return p.depth
+}
+
+func TestEmitter_QueueDepth(t *testing.T) {
+	emitter, bm, ctrl := createEmitter(t)
+	defer ctrl.Finish()
+
+	// the mock producer does not report its queue depth
+	test.AssertEqual(t, emitter.QueueDepth(), 0)
+
+	emitter.producer = &queueDepthProducer{MockProducer: bm.producer, depth: 3}
+	test.AssertEqual(t, emitter.QueueDepth(), 3)
+}
@@ -0,0 +1,82 @@
+package goka
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/logger"
+)
+
+// EventTimePolicy defines how the processor handles messages whose timestamp is
+// out of the bounds configured with WithEventTimeBounds.
+type EventTimePolicy struct {
+	log bool
+	dlq Stream
+}
+
+var (
+	// EventTimeDrop drops messages with out-of-bounds timestamps.
+	EventTimeDrop = EventTimePolicy{}
+	// EventTimeLog drops messages with out-of-bounds timestamps and logs them.
+	EventTimeLog = EventTimePolicy{log: true}
+)
+
+// EventTimeDLQ forwards messages with out-of-bounds timestamps unmodified to
+// passed topic (a dead letter queue). The input message is committed once the
+// forwarded message is written.
+func EventTimeDLQ(topic Stream) EventTimePolicy {
+	return EventTimePolicy{dlq: topic}
+}
+
+type eventTimeBounds struct {
+	maxLateness time.Duration
+	maxFuture   time.Duration
+	policy      EventTimePolicy
+}
+
+// inBounds returns whether the timestamp is within the bounds relative to now.
+// Messages without timestamp are always in bounds.
+func (b *eventTimeBounds) inBounds(timestamp time.Time, now time.Time) bool {
+	if timestamp.IsZero() {
+		return true
+	}
+	if b.maxLateness > 0 && timestamp.Before(now.Add(-b.maxLateness)) {
+		return false
+	}
+	if b.maxFuture > 0 && timestamp.After(now.Add(b.maxFuture)) {
+		return false
+	}
+	return true
+}
+
+// rejectOutOfBounds handles the message according to the event time policy if its
+// timestamp is out of the configured bounds. It returns whether the message was rejected.
+func (pp *PartitionProcessor) rejectOutOfBounds(wg *sync.WaitGroup, msg *sarama.ConsumerMessage, asyncFailer func(err error)) bool {
+	bounds := pp.opts.eventTimeBounds
+	if bounds == nil || bounds.inBounds(msg.Timestamp, pp.opts.clock.Now()) {
+		return false
+	}
+
+	if bounds.policy.log {
+		logger.Warnf(pp.messageLog(msg), "dropping message (key %s) from %s/%d@%d with out-of-bounds timestamp %v",
+			string(msg.Key), msg.Topic, msg.Partition, msg.Offset, msg.Timestamp)
+	}
+
+	if bounds.policy.dlq == "" {
+		pp.markMessage(msg)
+		return true
+	}
+
+	wg.Add(1)
+	pp.producer.Emit(string(bounds.policy.dlq), string(msg.Key), msg.Value).Then(func(err error) {
+		defer wg.Done()
+		if err != nil {
+			asyncFailer(fmt.Errorf("error forwarding message with out-of-bounds timestamp to %s: %v", bounds.policy.dlq, err))
+			return
+		}
+		pp.markMessage(msg)
+	})
+	return true
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/lovoo/goka/multierr"
 )
 
 var (
@@ -38,7 +40,9 @@ type GroupGraph struct {
 	inputStreams  []Edge
 	outputStreams []Edge
 	loopStream    []Edge
+	delayStream   []Edge
 	groupTable    []Edge
+	tableChanges  []Edge
 
 	codecs    map[string]Codec
 	callbacks map[string]ProcessCallback
@@ -77,6 +81,15 @@ func (gg *GroupGraph) LoopStream() Edge {
 	return nil
 }
 
+// DelayStream returns the delay topic edge of the group.
+func (gg *GroupGraph) DelayStream() Edge {
+	// only 1 delay stream is valid
+	if len(gg.delayStream) > 0 {
+		return gg.delayStream[0]
+	}
+	return nil
+}
+
 // GroupTable returns the group table edge of the group.
 func (gg *GroupGraph) GroupTable() Edge {
 	// only 1 group table is valid
@@ -86,6 +99,14 @@ func (gg *GroupGraph) GroupTable() Edge {
 	return nil
 }
 
+// TableChangeStream returns the edge consuming the changes of the group table, if any.
+func (gg *GroupGraph) TableChangeStream() Edge {
+	if len(gg.tableChanges) > 0 {
+		return gg.tableChanges[0]
+	}
+	return nil
+}
+
 // OutputStreams returns the output stream edges of the group.
 func (gg *GroupGraph) OutputStreams() Edges {
 	return gg.outputStreams
@@ -153,6 +174,11 @@ func DefineGroup(group Group, edges ...Edge) *GroupGraph {
 			gg.codecs[e.Topic()] = e.Codec()
 			gg.outputStreams = append(gg.outputStreams, e)
 			gg.outputStreamTopics[Stream(e.Topic())] = struct{}{}
+		case *delayOutput:
+			gg.codecs[e.Topic()] = e.Codec()
+			gg.outputStreams = append(gg.outputStreams, e)
+			gg.outputStreamTopics[Stream(e.Topic())] = struct{}{}
+			gg.delayStream = append(gg.delayStream, e)
 		case *inputTable:
 			gg.codecs[e.Topic()] = e.Codec()
 			gg.inputTables = append(gg.inputTables, e)
@@ -164,6 +190,17 @@ func DefineGroup(group Group, edges ...Edge) *GroupGraph {
 			e.setGroup(group)
 			gg.codecs[e.Topic()] = e.Codec()
 			gg.groupTable = append(gg.groupTable, e)
+		case *tableChanges:
+			e.setGroup(group)
+			gg.callbacks[e.Topic()] = e.cb
+			gg.tableChanges = append(gg.tableChanges, e)
+		}
+	}
+
+	// table changes are decoded with the codec of the group table
+	if gt := gg.GroupTable(); gt != nil {
+		for _, tc := range gg.tableChanges {
+			tc.(*tableChanges).codec = gt.Codec()
 		}
 	}
 
@@ -185,6 +222,7 @@ func (gg *GroupGraph) validateInputTopic(topic string) {
 // - at most one loopback stream edge is allowed
 // - at most one group table edge is allowed
 // - at least one input stream is required
+// - at most one table changes edge is allowed, requiring a group table
 // - table and loopback topics cannot be used in any other edge.
 func (gg *GroupGraph) Validate() error {
 	if len(gg.loopStream) > 1 {
@@ -193,9 +231,18 @@ func (gg *GroupGraph) Validate() error {
 	if len(gg.groupTable) > 1 {
 		return errors.New("more than one group table in group graph")
 	}
+	if len(gg.delayStream) > 1 {
+		return errors.New("more than one delay stream in group graph")
+	}
 	if len(gg.inputStreams) == 0 {
 		return errors.New("no input stream in group graph")
 	}
+	if len(gg.tableChanges) > 1 {
+		return errors.New("more than one table changes edge in group graph")
+	}
+	if len(gg.tableChanges) > 0 && len(gg.groupTable) == 0 {
+		return errors.New("table changes edge requires a group table")
+	}
 	for _, t := range append(gg.outputStreams,
 		append(gg.inputStreams, append(gg.inputTables, gg.crossTables...)...)...) {
 		if t.Topic() == loopName(gg.Group()) {
@@ -208,6 +255,29 @@ func (gg *GroupGraph) Validate() error {
 	return nil
 }
 
+// checkCompatibility checks the codecs of all edges implementing
+// CompatibilityChecker against the schemas registered for their topics.
+func (gg *GroupGraph) checkCompatibility() error {
+	var (
+		errs    = new(multierr.Errors)
+		checked = make(map[string]bool)
+	)
+	for _, edges := range [][]Edge{gg.inputStreams, gg.inputTables, gg.crossTables,
+		gg.outputStreams, gg.loopStream, gg.groupTable, gg.tableChanges} {
+		for _, e := range edges {
+			checker, ok := e.Codec().(CompatibilityChecker)
+			if !ok || checked[e.Topic()] {
+				continue
+			}
+			checked[e.Topic()] = true
+			if err := checker.CheckCompatibility(e.Topic()); err != nil {
+				errs.Collect(fmt.Errorf("codec of topic %s is incompatible: %v", e.Topic(), err))
+			}
+		}
+	}
+	return errs.NilOrError()
+}
+
 // Edge represents a topic in Kafka and the corresponding codec to encode and
 // decode the messages of that topic.
 type Edge interface {
@@ -364,6 +434,35 @@ func (t *groupTable) setGroup(group Group) {
 	t.topicDef.name = string(GroupTable(group))
 }
 
+type tableChanges struct {
+	*topicDef
+	cb ProcessCallback
+}
+
+// TableChanges represents an edge consuming the group table topic like an input
+// stream. The callback is invoked for every update of the group table, including
+// updates written by other producers (e.g. migration tools), which allows the
+// processor to observe and react to table changes it did not originate.
+// The messages are decoded with the codec of the group table, so the graph
+// requires a Persist edge.
+//
+// Note that the callback also receives the processor's own writes and that
+// the local table is not modified by the received updates. ctx.Value()
+// returns the locally stored value, so out-of-band edits can be detected by
+// comparing it to the message. Calling ctx.SetValue in the callback writes to
+// the group table again, which in turn triggers the callback.
+// Deletes (nil messages) are only passed to the callback when the processor
+// uses NilProcess.
+//
+// The group starts reading the topic from the newest offset.
+func TableChanges(cb ProcessCallback) Edge {
+	return &tableChanges{&topicDef{}, cb}
+}
+
+func (t *tableChanges) setGroup(group Group) {
+	t.topicDef.name = string(GroupTable(group))
+}
+
 type outputStream struct {
 	*topicDef
 }
@@ -0,0 +1,129 @@
+package goka
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/lovoo/goka/codec"
+)
+
+// CodecRegistry maps codec names to codecs, so codecs can be referenced by name
+// in a GraphSpec.
+type CodecRegistry map[string]Codec
+
+// NewCodecRegistry creates a registry containing the codecs of the codec package
+// ("bytes", "string", "int64").
+func NewCodecRegistry() CodecRegistry {
+	return CodecRegistry{
+		"bytes":  new(codec.Bytes),
+		"string": new(codec.String),
+		"int64":  new(codec.Int64),
+	}
+}
+
+// Register adds a codec to the registry, replacing an existing one with the same name.
+func (r CodecRegistry) Register(name string, c Codec) {
+	r[name] = c
+}
+
+func (r CodecRegistry) get(name string) (Codec, error) {
+	c, ok := r[name]
+	if !ok {
+		return nil, fmt.Errorf("codec %s is not registered", name)
+	}
+	return c, nil
+}
+
+// TopicSpec declares a topic and the name of its codec.
+type TopicSpec struct {
+	Topic string `json:"topic" yaml:"topic"`
+	Codec string `json:"codec" yaml:"codec"`
+}
+
+// GraphSpec declares the edges of a group graph, referencing codecs by name.
+// This allows to define the topics and codecs of a pipeline in one shared file
+// that is used by multiple services, each building its graph from the parts it needs.
+//
+// Example (JSON):
+//
+//	{
+//	  "inputs":  [{"topic": "clicks", "codec": "string"}],
+//	  "outputs": [{"topic": "alerts", "codec": "string"}],
+//	  "joins":   [{"topic": "users-table", "codec": "user"}],
+//	  "persist": "int64"
+//	}
+type GraphSpec struct {
+	Inputs  []TopicSpec `json:"inputs" yaml:"inputs"`
+	Outputs []TopicSpec `json:"outputs" yaml:"outputs"`
+	Joins   []TopicSpec `json:"joins" yaml:"joins"`
+	Lookups []TopicSpec `json:"lookups" yaml:"lookups"`
+	// Persist is the codec name of the group table, if any
+	Persist string `json:"persist" yaml:"persist"`
+}
+
+// LoadGraphSpec reads a JSON encoded GraphSpec.
+func LoadGraphSpec(r io.Reader) (*GraphSpec, error) {
+	spec := new(GraphSpec)
+	if err := json.NewDecoder(r).Decode(spec); err != nil {
+		return nil, fmt.Errorf("error decoding graph spec: %v", err)
+	}
+	return spec, nil
+}
+
+// Edges builds the edges declared by the spec, resolving the codecs in the registry.
+// Every input stream requires a callback in callbacks, keyed by the input topic.
+// The edges can be passed to DefineGroup, possibly combined with other edges
+// such as a Loop:
+//
+//	edges, err := spec.Edges(registry, map[goka.Stream]goka.ProcessCallback{"clicks": process})
+//	graph := goka.DefineGroup("group", append(edges, goka.Loop(c, cb))...)
+func (s *GraphSpec) Edges(registry CodecRegistry, callbacks map[Stream]ProcessCallback) (Edges, error) {
+	var edges Edges
+
+	for _, input := range s.Inputs {
+		c, err := registry.get(input.Codec)
+		if err != nil {
+			return nil, fmt.Errorf("error building input %s: %v", input.Topic, err)
+		}
+		cb, ok := callbacks[Stream(input.Topic)]
+		if !ok {
+			return nil, fmt.Errorf("error building input %s: no callback defined", input.Topic)
+		}
+		edges = append(edges, Input(Stream(input.Topic), c, cb))
+	}
+
+	for _, output := range s.Outputs {
+		c, err := registry.get(output.Codec)
+		if err != nil {
+			return nil, fmt.Errorf("error building output %s: %v", output.Topic, err)
+		}
+		edges = append(edges, Output(Stream(output.Topic), c))
+	}
+
+	for _, join := range s.Joins {
+		c, err := registry.get(join.Codec)
+		if err != nil {
+			return nil, fmt.Errorf("error building join %s: %v", join.Topic, err)
+		}
+		edges = append(edges, Join(Table(join.Topic), c))
+	}
+
+	for _, lookup := range s.Lookups {
+		c, err := registry.get(lookup.Codec)
+		if err != nil {
+			return nil, fmt.Errorf("error building lookup %s: %v", lookup.Topic, err)
+		}
+		edges = append(edges, Lookup(Table(lookup.Topic), c))
+	}
+
+	if s.Persist != "" {
+		c, err := registry.get(s.Persist)
+		if err != nil {
+			return nil, fmt.Errorf("error building group table: %v", err)
+		}
+		edges = append(edges, Persist(c))
+	}
+
+	return edges, nil
+}
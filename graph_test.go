@@ -1,6 +1,7 @@
 package goka
 
 import (
+	"errors"
 	"reflect"
 	"strings"
 	"testing"
@@ -75,6 +76,20 @@ func TestGroupGraph_Validate(t *testing.T) {
 	err = g.Validate()
 	test.AssertStringContains(t, err.Error(), "loop stream")
 
+	g = DefineGroup("group",
+		Input("input-topic", c, cb),
+		TableChanges(cb),
+	)
+	err = g.Validate()
+	test.AssertStringContains(t, err.Error(), "requires a group table")
+
+	g = DefineGroup("group",
+		Input("input-topic", c, cb),
+		TableChanges(cb),
+		Persist(c),
+	)
+	err = g.Validate()
+	test.AssertNil(t, err)
 }
 
 func TestGroupGraph_codec(t *testing.T) {
@@ -90,6 +105,45 @@ func TestGroupGraph_codec(t *testing.T) {
 
 }
 
+type compatibilityCodec struct {
+	codec.String
+	incompatible map[string]bool
+	checked      []string
+}
+
+func (c *compatibilityCodec) CheckCompatibility(topic string) error {
+	c.checked = append(c.checked, topic)
+	if c.incompatible[topic] {
+		return errors.New("incompatible schema")
+	}
+	return nil
+}
+
+func TestGroupGraph_checkCompatibility(t *testing.T) {
+	t.Run("succeed", func(t *testing.T) {
+		checker := new(compatibilityCodec)
+		g := DefineGroup("group",
+			Input("input-topic", checker, cb),
+			Output("output-topic", checker),
+			Lookup("lookup-table", c),
+			Persist(checker),
+			TableChanges(cb),
+		)
+		test.AssertNil(t, g.checkCompatibility())
+		test.AssertEqual(t, checker.checked, []string{"input-topic", "output-topic", "group-table"})
+	})
+	t.Run("fail", func(t *testing.T) {
+		checker := &compatibilityCodec{incompatible: map[string]bool{"output-topic": true}}
+		g := DefineGroup("group",
+			Input("input-topic", checker, cb),
+			Output("output-topic", checker),
+		)
+		err := g.checkCompatibility()
+		test.AssertNotNil(t, err)
+		test.AssertStringContains(t, err.Error(), "output-topic")
+	})
+}
+
 func TestGroupGraph_callback(t *testing.T) {
 	g := DefineGroup("group",
 		Input("input-topic", c, cb),
@@ -149,6 +203,17 @@ func TestGroupGraph_getters(t *testing.T) {
 	test.AssertTrue(t, len(g.JointTables()) == 4)
 	test.AssertTrue(t, len(g.LookupTables()) == 2)
 	test.AssertEqual(t, g.GroupTable().Topic(), tableName("group"))
+	test.AssertTrue(t, g.TableChangeStream() == nil)
+
+	g = DefineGroup("group",
+		Input("t1", c, cb),
+		TableChanges(cb),
+		Persist(c),
+	)
+	test.AssertEqual(t, g.TableChangeStream().Topic(), tableName("group"))
+	test.AssertEqual(t, g.TableChangeStream().Codec(), Codec(c))
+	test.AssertEqual(t, g.codec(tableName("group")), Codec(c))
+	test.AssertTrue(t, g.callback(tableName("group")) != nil)
 }
 
 func TestGroupGraph_Inputs(t *testing.T) {
@@ -180,3 +245,36 @@ func ExampleStringsToStreams() {
 	)
 	_ = graph
 }
+
+func TestGraphSpec_Edges(t *testing.T) {
+	spec, err := LoadGraphSpec(strings.NewReader(`{
+		"inputs":  [{"topic": "input", "codec": "string"}],
+		"outputs": [{"topic": "output", "codec": "int64"}],
+		"joins":   [{"topic": "join-table", "codec": "custom"}],
+		"lookups": [{"topic": "lookup-table", "codec": "bytes"}],
+		"persist": "string"
+	}`))
+	test.AssertNil(t, err)
+
+	registry := NewCodecRegistry()
+
+	_, err = spec.Edges(registry, map[Stream]ProcessCallback{"input": cb})
+	test.AssertStringContains(t, err.Error(), "custom is not registered")
+
+	custom := new(codec.String)
+	registry.Register("custom", custom)
+
+	_, err = spec.Edges(registry, nil)
+	test.AssertStringContains(t, err.Error(), "no callback")
+
+	edges, err := spec.Edges(registry, map[Stream]ProcessCallback{"input": cb})
+	test.AssertNil(t, err)
+
+	g := DefineGroup("group", edges...)
+	test.AssertNil(t, g.Validate())
+	test.AssertEqual(t, g.InputStreams().Topics(), []string{"input"})
+	test.AssertEqual(t, g.OutputStreams().Topics(), []string{"output"})
+	test.AssertEqual(t, g.JointTables()[0].Codec(), Codec(custom))
+	test.AssertEqual(t, g.LookupTables().Topics(), []string{"lookup-table"})
+	test.AssertEqual(t, g.GroupTable().Topic(), tableName("group"))
+}
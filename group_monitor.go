@@ -0,0 +1,110 @@
+package goka
+
+import (
+	"fmt"
+
+	"github.com/Shopify/sarama"
+)
+
+// PartitionLag is the lag of a consumer group in one partition.
+type PartitionLag struct {
+	// Committed is the offset committed by the group
+	Committed int64
+	// Hwm is the high watermark of the partition
+	Hwm int64
+	// Lag is the number of messages between the committed offset and the high watermark
+	Lag int64
+}
+
+// GroupLag is the lag of all partitions a consumer group has committed offsets for.
+type GroupLag struct {
+	Group Group
+	// Total is the sum of the lag of all partitions
+	Total int64
+	// Partitions contains the lag per topic and partition
+	Partitions map[string]map[int32]PartitionLag
+}
+
+// GroupMonitor reads the committed offsets of a consumer group from Kafka to
+// calculate the group's lag, independently of which instance consumes which
+// partition. This allows to monitor a whole group from one place.
+type GroupMonitor struct {
+	group  Group
+	client sarama.Client
+	admin  sarama.ClusterAdmin
+}
+
+// NewGroupMonitor creates a monitor for the consumer group using the global config
+// (see ReplaceGlobalConfig). The monitor must be closed after use.
+func NewGroupMonitor(brokers []string, group Group) (*GroupMonitor, error) {
+	config := globalConfig
+	client, err := sarama.NewClient(brokers, &config)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating the kafka client: %v", err)
+	}
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("Error creating the kafka cluster admin: %v", err)
+	}
+
+	return &GroupMonitor{
+		group:  group,
+		client: client,
+		admin:  admin,
+	}, nil
+}
+
+// Lag fetches the committed offsets and high watermarks of all partitions the
+// group has committed offsets for and returns the group's lag.
+// Partitions the group never committed an offset for are not included.
+func (gm *GroupMonitor) Lag() (*GroupLag, error) {
+	offsets, err := gm.admin.ListConsumerGroupOffsets(string(gm.group), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching offsets of group %s: %v", gm.group, err)
+	}
+	if offsets.Err != sarama.ErrNoError {
+		return nil, fmt.Errorf("Error fetching offsets of group %s: %v", gm.group, offsets.Err)
+	}
+
+	lag := &GroupLag{
+		Group:      gm.group,
+		Partitions: make(map[string]map[int32]PartitionLag),
+	}
+	for topic, partitions := range offsets.Blocks {
+		for partition, block := range partitions {
+			if block.Err != sarama.ErrNoError {
+				return nil, fmt.Errorf("Error fetching offset of group %s for %s/%d: %v", gm.group, topic, partition, block.Err)
+			}
+			// no offset committed
+			if block.Offset < 0 {
+				continue
+			}
+
+			hwm, err := gm.client.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return nil, fmt.Errorf("Error fetching high watermark for %s/%d: %v", topic, partition, err)
+			}
+
+			partLag := PartitionLag{
+				Committed: block.Offset,
+				Hwm:       hwm,
+			}
+			if hwm > block.Offset {
+				partLag.Lag = hwm - block.Offset
+			}
+
+			if lag.Partitions[topic] == nil {
+				lag.Partitions[topic] = make(map[int32]PartitionLag)
+			}
+			lag.Partitions[topic][partition] = partLag
+			lag.Total += partLag.Lag
+		}
+	}
+	return lag, nil
+}
+
+// Close closes the monitor's connections to Kafka.
+func (gm *GroupMonitor) Close() error {
+	return gm.admin.Close()
+}
@@ -0,0 +1,100 @@
+package goka
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/golang/mock/gomock"
+	"github.com/lovoo/goka/internal/test"
+)
+
+// offsetsAdmin is a cluster admin returning fixed consumer group offsets.
+type offsetsAdmin struct {
+	sarama.ClusterAdmin
+	group   string
+	offsets *sarama.OffsetFetchResponse
+	err     error
+}
+
+func (a *offsetsAdmin) ListConsumerGroupOffsets(group string, topicPartitions map[string][]int32) (*sarama.OffsetFetchResponse, error) {
+	a.group = group
+	return a.offsets, a.err
+}
+
+func newOffsetsResponse(offsets map[string]map[int32]int64) *sarama.OffsetFetchResponse {
+	resp := &sarama.OffsetFetchResponse{
+		Blocks: make(map[string]map[int32]*sarama.OffsetFetchResponseBlock),
+	}
+	for topic, partitions := range offsets {
+		resp.Blocks[topic] = make(map[int32]*sarama.OffsetFetchResponseBlock)
+		for partition, offset := range partitions {
+			resp.Blocks[topic][partition] = &sarama.OffsetFetchResponseBlock{Offset: offset}
+		}
+	}
+	return resp
+}
+
+func TestGroupMonitor_Lag(t *testing.T) {
+	t.Run("succeed", func(t *testing.T) {
+		ctrl := NewMockController(t)
+		defer ctrl.Finish()
+		client := NewMockClient(ctrl)
+		admin := &offsetsAdmin{
+			offsets: newOffsetsResponse(map[string]map[int32]int64{
+				"input": {
+					0: 5,
+					// no offset committed
+					1: -1,
+					2: 8,
+				},
+				"other": {0: 3},
+			}),
+		}
+		client.EXPECT().GetOffset("input", int32(0), sarama.OffsetNewest).Return(int64(10), nil)
+		client.EXPECT().GetOffset("input", int32(2), sarama.OffsetNewest).Return(int64(8), nil)
+		client.EXPECT().GetOffset("other", int32(0), sarama.OffsetNewest).Return(int64(7), nil)
+
+		gm := &GroupMonitor{group: "group", client: client, admin: admin}
+		lag, err := gm.Lag()
+		test.AssertNil(t, err)
+		test.AssertEqual(t, admin.group, "group")
+		test.AssertEqual(t, lag.Group, Group("group"))
+		test.AssertEqual(t, lag.Partitions, map[string]map[int32]PartitionLag{
+			"input": {
+				0: {Committed: 5, Hwm: 10, Lag: 5},
+				2: {Committed: 8, Hwm: 8, Lag: 0},
+			},
+			"other": {
+				0: {Committed: 3, Hwm: 7, Lag: 4},
+			},
+		})
+		test.AssertEqual(t, lag.Total, int64(9))
+	})
+	t.Run("fail_offsets", func(t *testing.T) {
+		gm := &GroupMonitor{group: "group", admin: &offsetsAdmin{err: errors.New("no coordinator")}}
+		_, err := gm.Lag()
+		test.AssertNotNil(t, err)
+	})
+	t.Run("fail_block", func(t *testing.T) {
+		offsets := newOffsetsResponse(map[string]map[int32]int64{"input": {0: 5}})
+		offsets.Blocks["input"][0].Err = sarama.ErrUnknownTopicOrPartition
+		gm := &GroupMonitor{group: "group", admin: &offsetsAdmin{offsets: offsets}}
+		_, err := gm.Lag()
+		test.AssertNotNil(t, err)
+	})
+	t.Run("fail_hwm", func(t *testing.T) {
+		ctrl := NewMockController(t)
+		defer ctrl.Finish()
+		client := NewMockClient(ctrl)
+		client.EXPECT().GetOffset("input", int32(0), gomock.Any()).Return(int64(0), errors.New("broker down"))
+
+		gm := &GroupMonitor{
+			group:  "group",
+			client: client,
+			admin:  &offsetsAdmin{offsets: newOffsetsResponse(map[string]map[int32]int64{"input": {0: 5}})},
+		}
+		_, err := gm.Lag()
+		test.AssertNotNil(t, err)
+	})
+}
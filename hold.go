@@ -0,0 +1,123 @@
+package goka
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// ErrHoldBufferFull is returned by emits that could not be buffered while
+// emitting is on hold, because the buffer stayed full for the configured
+// timeout.
+var ErrHoldBufferFull = errors.New("hold buffer full")
+
+// emitHold buffers emits while being held and flushes them on release.
+type emitHold struct {
+	m    sync.Mutex
+	held bool
+	// emits are sent directly while suspended, even if held
+	suspended bool
+	queue     []func()
+	slots     chan struct{}
+	timeout   time.Duration
+}
+
+func newEmitHold(size int, timeout time.Duration) *emitHold {
+	return &emitHold{
+		slots:   make(chan struct{}, size),
+		timeout: timeout,
+	}
+}
+
+// hold starts buffering emits.
+func (h *emitHold) hold() {
+	h.m.Lock()
+	defer h.m.Unlock()
+	h.held = true
+}
+
+// release flushes all buffered emits in order and stops buffering.
+func (h *emitHold) release() {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.held = false
+	h.flush()
+}
+
+// suspend flushes all buffered emits in order and sends all emits directly
+// until resume is called, without releasing the hold. The processor suspends
+// the hold while its partitions are revoked, so the pending messages can be
+// committed before the partitions are handed over.
+func (h *emitHold) suspend() {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.suspended = true
+	h.flush()
+}
+
+// resume buffers the emits again if held.
+func (h *emitHold) resume() {
+	h.m.Lock()
+	defer h.m.Unlock()
+	h.suspended = false
+}
+
+// flush sends the buffered emits. The caller must hold the lock.
+func (h *emitHold) flush() {
+	for _, emit := range h.queue {
+		emit()
+		<-h.slots
+	}
+	h.queue = nil
+}
+
+// isHeld returns whether emits are currently buffered.
+func (h *emitHold) isHeld() bool {
+	h.m.Lock()
+	defer h.m.Unlock()
+	return h.buffering()
+}
+
+// buffering returns whether emits are buffered. The caller must hold the lock.
+func (h *emitHold) buffering() bool {
+	return h.held && !h.suspended
+}
+
+// emit calls produce directly if not held. Otherwise it buffers the call and
+// returns a promise that finishes when the buffered emit finishes after release.
+// If the buffer is full, emit blocks until there is space or the timeout expires.
+func (h *emitHold) emit(produce func() *Promise) *Promise {
+	if !h.isHeld() {
+		return produce()
+	}
+
+	// wait for space in the buffer
+	timer := time.NewTimer(h.timeout)
+	defer timer.Stop()
+	select {
+	case h.slots <- struct{}{}:
+	case <-timer.C:
+		return NewPromise().Finish(nil, ErrHoldBufferFull)
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	// released while waiting for space, the buffer is already flushed
+	if !h.buffering() {
+		<-h.slots
+		return produce()
+	}
+
+	promise := NewPromise()
+	h.queue = append(h.queue, func() {
+		produce().ThenWithMessage(func(msg *sarama.ProducerMessage, err error) {
+			promise.Finish(msg, err)
+		})
+	})
+	return promise
+}
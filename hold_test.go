@@ -0,0 +1,39 @@
+package goka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestEmitHold_Suspend(t *testing.T) {
+	var (
+		hold    = newEmitHold(10, time.Second)
+		emitted []string
+	)
+	emit := func(value string) *Promise {
+		return hold.emit(func() *Promise {
+			emitted = append(emitted, value)
+			return NewPromise().Finish(nil, nil)
+		})
+	}
+
+	hold.hold()
+	emit("buffered")
+	test.AssertEqual(t, len(emitted), 0)
+
+	// suspending sends the buffered emits and all following ones
+	hold.suspend()
+	test.AssertEqual(t, emitted, []string{"buffered"})
+	emit("suspended")
+	test.AssertEqual(t, emitted, []string{"buffered", "suspended"})
+
+	// the hold applies again after resuming
+	hold.resume()
+	emit("held")
+	test.AssertEqual(t, emitted, []string{"buffered", "suspended"})
+
+	hold.release()
+	test.AssertEqual(t, emitted, []string{"buffered", "suspended", "held"})
+}
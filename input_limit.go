@@ -0,0 +1,15 @@
+package goka
+
+import "golang.org/x/time/rate"
+
+// inputRateLimit configures the rate limiting of the input messages, see
+// WithInputRateLimit.
+type inputRateLimit struct {
+	limit        rate.Limit
+	burst        int
+	perPartition bool
+}
+
+func (l *inputRateLimit) newLimiter() *rate.Limiter {
+	return rate.NewLimiter(l.limit, l.burst)
+}
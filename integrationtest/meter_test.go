@@ -0,0 +1,44 @@
+package integrationtest
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// recordingMeter sums up the values added to its counters.
+type recordingMeter struct {
+	noop.Meter
+
+	m      sync.Mutex
+	counts map[string]int64
+}
+
+func newRecordingMeter() *recordingMeter {
+	return &recordingMeter{counts: make(map[string]int64)}
+}
+
+func (r *recordingMeter) Int64Counter(name string, _ ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return &recordingCounter{meter: r, name: name}, nil
+}
+
+func (r *recordingMeter) count(name string) int64 {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.counts[name]
+}
+
+type recordingCounter struct {
+	noop.Int64Counter
+
+	meter *recordingMeter
+	name  string
+}
+
+func (c *recordingCounter) Add(ctx context.Context, incr int64, _ ...metric.AddOption) {
+	c.meter.m.Lock()
+	defer c.meter.m.Unlock()
+	c.meter.counts[c.name] += incr
+}
@@ -0,0 +1,1105 @@
+package integrationtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/multierr"
+	"github.com/lovoo/goka/tester"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+func TestProcessor_PartitionRestart(t *testing.T) {
+	gkt := tester.New(t)
+
+	var calls int
+	consume := func(ctx goka.Context, msg interface{}) {
+		calls++
+		if calls == 1 {
+			panic("first call fails")
+		}
+		ctx.SetValue(msg.(string) + "-" + ctx.Join("joined").(string))
+	}
+
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), consume),
+			goka.Join("joined", new(codec.String)),
+			goka.Persist(new(codec.String)),
+		),
+		goka.WithTester(gkt),
+		goka.WithPartitionRestart(goka.PartitionRestartPolicy{
+			MaxRestarts: 1,
+			Backoff: func() (goka.Backoff, error) {
+				return goka.NewSimpleBackoff(time.Millisecond), nil
+			},
+		}),
+	)
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	var procErr error
+	go func() {
+		defer close(done)
+		procErr = proc.Run(ctx)
+	}()
+
+	gkt.SetTableValue("joined", "key", "join-value")
+	gkt.Consume("input", "key", "value")
+
+	// the failed message was retried after the restart, which recovered the join again
+	test.AssertEqual(t, calls, 2)
+	test.AssertEqual(t, gkt.TableValue(goka.GroupTable("test"), "key"), "value-join-value")
+
+	var restarts uint
+	for _, pstats := range proc.Stats().Group {
+		restarts += pstats.Restarts
+	}
+	test.AssertEqual(t, restarts, uint(1))
+
+	cancel()
+	<-done
+	test.AssertNil(t, procErr)
+}
+
+func TestProcessor_TableChanges(t *testing.T) {
+	gkt := tester.New(t)
+
+	type change struct {
+		local   interface{}
+		updated interface{}
+	}
+	changes := make(chan change, 10)
+
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				ctx.SetValue(msg)
+			}),
+			goka.TableChanges(func(ctx goka.Context, msg interface{}) {
+				changes <- change{local: ctx.Value(), updated: msg}
+			}),
+			goka.Persist(new(codec.String)),
+		),
+		goka.WithTester(gkt),
+	)
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		test.AssertNil(t, proc.Run(ctx))
+	}()
+
+	// the processor's own write is observed as a table change
+	gkt.Consume("input", "key", "value")
+	test.AssertEqual(t, <-changes, change{local: "value", updated: "value"})
+
+	// an out-of-band write differs from the locally stored value
+	gkt.Consume(string(goka.GroupTable("test")), "key", "edited")
+	test.AssertEqual(t, <-changes, change{local: "value", updated: "edited"})
+
+	cancel()
+	<-done
+}
+
+func TestProcessor_CommitObserver(t *testing.T) {
+	gkt := tester.New(t)
+
+	commits := make(chan int64, 10)
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {}),
+		),
+		goka.WithTester(gkt),
+		goka.WithCommitObserver(func(topic string, partition int32, offset int64) {
+			test.AssertEqual(t, topic, "input")
+			commits <- offset
+		}),
+	)
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		test.AssertNil(t, proc.Run(ctx))
+	}()
+
+	gkt.Consume("input", "key", "a")
+	gkt.Consume("input", "key", "b")
+
+	first, second := <-commits, <-commits
+	test.AssertEqual(t, second, first+1)
+
+	cancel()
+	<-done
+}
+
+func TestProcessor_CommitOnRevoke(t *testing.T) {
+	gkt := tester.New(t)
+
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				ctx.SetValue(msg)
+			}),
+			goka.Persist(new(codec.String)),
+		),
+		goka.WithTester(gkt),
+		goka.WithCommitOnRevoke(true),
+	)
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	var procErr error
+	go func() {
+		defer close(done)
+		procErr = proc.Run(ctx)
+	}()
+
+	gkt.Consume("input", "key", "value")
+	test.AssertEqual(t, gkt.TableValue(goka.GroupTable("test"), "key"), "value")
+	test.AssertEqual(t, proc.NumAssignedPartitions(), 1)
+
+	// shutting down revokes the partitions and commits
+	cancel()
+	<-done
+	test.AssertNil(t, procErr)
+	test.AssertEqual(t, proc.NumAssignedPartitions(), 0)
+}
+
+func TestProcessor_TableHeartbeat(t *testing.T) {
+	gkt := tester.New(t)
+
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {}),
+			goka.Persist(new(codec.String)),
+		),
+		goka.WithTester(gkt),
+		goka.WithTableHeartbeat("heartbeat", 10*time.Millisecond),
+	)
+	test.AssertNil(t, err)
+
+	tracker := gkt.NewQueueTracker(string(goka.GroupTable("test")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		test.AssertNil(t, proc.Run(ctx))
+	}()
+	proc.WaitForReady()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		key, value, ok := tracker.NextRaw()
+		if ok {
+			// the tester has only one partition
+			test.AssertEqual(t, key, "heartbeat.0")
+			test.AssertNil(t, value)
+			break
+		}
+		test.AssertTrue(t, time.Now().Before(deadline))
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+}
+
+func TestProcessor_TableKeyTTL(t *testing.T) {
+	gkt := tester.New(t)
+
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				ctx.SetValue(msg)
+			}),
+			goka.Persist(new(codec.String)),
+		),
+		goka.WithTester(gkt),
+		goka.WithTableKeyTTL(50*time.Millisecond),
+	)
+	test.AssertNil(t, err)
+
+	tracker := gkt.NewQueueTracker(string(goka.GroupTable("test")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		test.AssertNil(t, proc.Run(ctx))
+	}()
+
+	gkt.Consume("input", "key", "value")
+	key, value, ok := tracker.NextRaw()
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, key, "key")
+	test.AssertEqual(t, string(value), "value")
+
+	// the key expires and a tombstone is emitted
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		key, value, ok := tracker.NextRaw()
+		if ok {
+			test.AssertEqual(t, key, "key")
+			test.AssertNil(t, value)
+			break
+		}
+		test.AssertTrue(t, time.Now().Before(deadline))
+		time.Sleep(10 * time.Millisecond)
+	}
+	test.AssertNil(t, gkt.TableValue(goka.GroupTable("test"), "key"))
+
+	cancel()
+	<-done
+}
+
+func TestProcessor_AtMostOnce(t *testing.T) {
+	gkt := tester.New(t)
+
+	var (
+		commits = make(chan int64, 10)
+		calls   int64
+	)
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				n := atomic.AddInt64(&calls, 1)
+				// the message is committed before the callback
+				test.AssertEqual(t, int64(len(commits)), n)
+				if msg == "fail" {
+					panic("failing callback")
+				}
+			}),
+		),
+		goka.WithTester(gkt),
+		goka.WithDeliverySemantics(goka.AtMostOnce),
+		goka.WithCommitObserver(func(topic string, partition int32, offset int64) {
+			commits <- offset
+		}),
+		goka.WithPartitionRestart(goka.PartitionRestartPolicy{
+			Backoff: func() (goka.Backoff, error) {
+				return goka.NewSimpleBackoff(time.Millisecond), nil
+			},
+		}),
+	)
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		test.AssertNil(t, proc.Run(ctx))
+	}()
+
+	gkt.Consume("input", "key", "fail")
+	gkt.Consume("input", "key", "value")
+
+	// the failed message is not retried after the restart
+	test.AssertEqual(t, atomic.LoadInt64(&calls), int64(2))
+
+	cancel()
+	<-done
+}
+
+func TestProcessor_JoinAndLookup(t *testing.T) {
+	gkt := tester.New(t)
+
+	type result struct {
+		join   interface{}
+		lookup interface{}
+	}
+	results := make(chan result, 10)
+
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				results <- result{
+					join:   ctx.Join("join-table"),
+					lookup: ctx.Lookup("lookup-table", msg.(string)),
+				}
+			}),
+			goka.Join("join-table", new(codec.String)),
+			goka.Lookup("lookup-table", new(codec.String)),
+		),
+		goka.WithTester(gkt),
+	)
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		test.AssertNil(t, proc.Run(ctx))
+	}()
+
+	// the join is read at the message's key, the lookup at any key
+	gkt.SetTableValue("join-table", "key", "joined")
+	gkt.SetTableValue("lookup-table", "other-key", "looked-up")
+	gkt.Consume("input", "key", "other-key")
+	test.AssertEqual(t, <-results, result{join: "joined", lookup: "looked-up"})
+
+	// missing values
+	gkt.DeleteTableValue("join-table", "key")
+	gkt.Consume("input", "key", "missing-key")
+	test.AssertEqual(t, <-results, result{})
+
+	cancel()
+	<-done
+}
+
+func TestProcessor_EmitDelayed(t *testing.T) {
+	gkt := tester.New(t)
+
+	delay := 50 * time.Millisecond
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				ctx.EmitDelayed("target", ctx.Key(), msg, delay)
+			}),
+			goka.Input("poll", new(codec.String), func(ctx goka.Context, msg interface{}) {}),
+			goka.Output("target", new(codec.String)),
+			goka.DelayOutput("delays"),
+		),
+		goka.WithTester(gkt),
+	)
+	test.AssertNil(t, err)
+	scheduler, err := goka.NewDelayScheduler(nil, "scheduler", "delays",
+		goka.WithTester(gkt),
+		goka.WithDelayTickInterval(10*time.Millisecond),
+	)
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errg, ctx := multierr.NewErrGroup(ctx)
+	errg.Go(func() error { return proc.Run(ctx) })
+	errg.Go(func() error { return scheduler.Run(ctx) })
+	proc.WaitForReady()
+	scheduler.WaitForReady()
+
+	tracker := gkt.NewQueueTracker("target")
+	start := time.Now()
+	gkt.Consume("input", "key", "value")
+
+	var (
+		key   string
+		value interface{}
+		ok    bool
+	)
+	for deadline := time.Now().Add(10 * time.Second); !ok && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		// the tester delivers the scheduler's ticks only while consuming
+		gkt.Consume("poll", "key", "")
+		key, value, ok = tracker.Next()
+	}
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, key, "key")
+	test.AssertEqual(t, value, "value")
+	test.AssertTrue(t, time.Since(start) >= delay)
+
+	cancel()
+	test.AssertNil(t, errg.Wait().NilOrError())
+}
+
+func TestProcessor_Headers(t *testing.T) {
+	gkt := tester.New(t)
+
+	headers := make(chan map[string][]byte, 10)
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				headers <- ctx.Headers()
+			}),
+		),
+		goka.WithTester(gkt),
+	)
+	test.AssertNil(t, err)
+	emitter, err := goka.NewEmitter(nil, "input", new(codec.String), goka.WithEmitterTester(gkt))
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		test.AssertNil(t, proc.Run(ctx))
+	}()
+	proc.WaitForReady()
+	tracker := gkt.NewQueueTracker("input")
+
+	// headers set by the emitter reach the processor
+	_, err = emitter.EmitWithHeaders("key", "value", map[string][]byte{"traceparent": []byte("trace")})
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string((<-headers)["traceparent"]), "trace")
+
+	gkt.ConsumeWithHeaders("input", "key", "value", map[string][]byte{"schema": []byte("1")})
+	test.AssertEqual(t, string((<-headers)["schema"]), "1")
+
+	// the queue tracker returns the headers of the messages
+	key, value, msgHeaders, ok := tracker.NextWithHeaders()
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, key, "key")
+	test.AssertEqual(t, value, "value")
+	test.AssertEqual(t, msgHeaders, map[string][]byte{"traceparent": []byte("trace")})
+	_, rawValue, msgHeaders, ok := tracker.NextRawWithHeaders()
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, string(rawValue), "value")
+	test.AssertEqual(t, msgHeaders, map[string][]byte{"schema": []byte("1")})
+	_, _, _, ok = tracker.NextRawWithHeaders()
+	test.AssertFalse(t, ok)
+
+	test.AssertNil(t, emitter.Finish())
+	cancel()
+	<-done
+}
+
+func TestProcessor_Clock(t *testing.T) {
+	gkt := tester.New(t)
+	clock := gkt.Clock()
+
+	delay := time.Hour
+	now := make(chan time.Time, 1)
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				ctx.EmitDelayed("target", ctx.Key(), msg, delay)
+				now <- ctx.Now()
+			}),
+			goka.Output("target", new(codec.String)),
+			goka.DelayOutput("delays"),
+		),
+		goka.WithTester(gkt),
+		goka.WithClock(clock),
+	)
+	test.AssertNil(t, err)
+	scheduler, err := goka.NewDelayScheduler(nil, "scheduler", "delays", goka.WithTester(gkt), goka.WithClock(clock))
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errg, ctx := multierr.NewErrGroup(ctx)
+	errg.Go(func() error { return proc.Run(ctx) })
+	errg.Go(func() error { return scheduler.Run(ctx) })
+
+	start := clock.Now()
+	tracker := gkt.NewQueueTracker("target")
+	// consuming waits for the delay scheduler, which waits for the clock
+	consumed := make(chan struct{})
+	go func() {
+		defer close(consumed)
+		gkt.Consume("input", "key", "value")
+	}()
+	test.AssertEqual(t, <-now, start)
+
+	gkt.AdvanceTime(delay / 2)
+	_, _, ok := tracker.Next()
+	test.AssertFalse(t, ok)
+
+	gkt.AdvanceTime(delay / 2)
+	<-consumed
+	key, value, ok := tracker.Next()
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, key, "key")
+	test.AssertEqual(t, value, "value")
+	test.AssertEqual(t, clock.Now(), start.Add(delay))
+
+	cancel()
+	test.AssertNil(t, errg.Wait().NilOrError())
+}
+
+func TestProcessor_StorageFaults(t *testing.T) {
+	gkt := tester.New(t)
+	errFault := errors.New("storage fault")
+
+	failed := make(chan string, 10)
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				ctx.SetValue(msg)
+			}),
+			goka.Persist(new(codec.String)),
+		),
+		goka.WithTester(gkt),
+		goka.WithStorageWriteErrorPolicy(goka.StorageWriteDropAndContinue, func(partition int32, key string, err error) {
+			test.AssertTrue(t, errors.Is(err, errFault))
+			failed <- key
+		}),
+	)
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		test.AssertNil(t, proc.Run(ctx))
+	}()
+	proc.WaitForReady()
+
+	table := goka.GroupTable("test")
+
+	// the first Set fails, the second one succeeds
+	gkt.FailStorageSet(table, 1, errFault)
+	gkt.Consume("input", "key-1", "value-1")
+	test.AssertEqual(t, <-failed, "key-1")
+	test.AssertTrue(t, gkt.TableValue(table, "key-1") == nil)
+	gkt.Consume("input", "key-1", "value-2")
+	test.AssertEqual(t, gkt.TableValue(table, "key-1"), "value-2")
+
+	// all Sets of the key fail until the faults are cleared
+	gkt.FailStorageKey(table, "key-2", errFault)
+	gkt.Consume("input", "key-2", "value-1")
+	gkt.Consume("input", "key-2", "value-2")
+	test.AssertEqual(t, <-failed, "key-2")
+	test.AssertEqual(t, <-failed, "key-2")
+	gkt.ClearStorageFaults()
+	gkt.Consume("input", "key-2", "value-3")
+	test.AssertEqual(t, gkt.TableValue(table, "key-2"), "value-3")
+
+	// Gets fail likewise
+	st, err := gkt.StorageBuilder()(string(table), 0)
+	test.AssertNil(t, err)
+	gkt.FailStorageGet(table, 2, errFault)
+	_, err = st.Get("key-1")
+	test.AssertNil(t, err)
+	_, err = st.Get("key-1")
+	test.AssertTrue(t, errors.Is(err, errFault))
+	value, err := st.Get("key-1")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "value-2")
+
+	cancel()
+	<-done
+}
+
+func TestProcessor_Timestamp(t *testing.T) {
+	gkt := tester.New(t)
+
+	timestamps := make(chan time.Time, 10)
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				timestamps <- ctx.Timestamp()
+			}),
+		),
+		goka.WithTester(gkt),
+	)
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		test.AssertNil(t, proc.Run(ctx))
+	}()
+
+	before := time.Now()
+	gkt.Consume("input", "key", "value")
+
+	// the tester stamps messages when they are pushed
+	ts := <-timestamps
+	test.AssertFalse(t, ts.Before(before))
+	test.AssertFalse(t, ts.After(time.Now()))
+
+	cancel()
+	<-done
+}
+
+func TestProcessor_DeadLetter(t *testing.T) {
+	gkt := tester.New(t)
+
+	var (
+		calls       = make(map[string]int)
+		deadLetters = make(chan goka.Context, 10)
+	)
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				calls[msg.(string)]++
+				if msg == "poison" {
+					panic("failing callback")
+				}
+				ctx.SetValue(msg)
+			}),
+			goka.Input("dlq", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				deadLetters <- ctx
+			}),
+			goka.Persist(new(codec.String)),
+		),
+		goka.WithTester(gkt),
+		goka.WithDeadLetter("dlq", 2),
+	)
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		test.AssertNil(t, proc.Run(ctx))
+	}()
+
+	gkt.Consume("input", "key", "poison")
+	gkt.Consume("input", "key", "value")
+
+	// the poison message was attempted twice and forwarded, processing continued
+	test.AssertEqual(t, calls, map[string]int{"poison": 2, "value": 1})
+	test.AssertEqual(t, gkt.TableValue(goka.GroupTable("test"), "key"), "value")
+
+	deadLetter := <-deadLetters
+	test.AssertEqual(t, deadLetter.Key(), "key")
+	headers := deadLetter.Headers()
+	test.AssertEqual(t, string(headers[goka.DeadLetterHeaderTopic]), "input")
+	test.AssertEqual(t, string(headers[goka.DeadLetterHeaderAttempts]), "2")
+	test.AssertEqual(t, string(headers[goka.DeadLetterHeaderError]), "failing callback")
+
+	cancel()
+	<-done
+}
+
+func TestProcessor_Loopback(t *testing.T) {
+	gkt := tester.New(t)
+
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				// fan in by the message's value
+				ctx.Loopback(msg.(string), ctx.Key())
+			}),
+			goka.Loop(new(codec.String), func(ctx goka.Context, msg interface{}) {
+				var keys string
+				if val := ctx.Value(); val != nil {
+					keys = val.(string) + ","
+				}
+				ctx.SetValue(keys + msg.(string))
+			}),
+			goka.Persist(new(codec.String)),
+		),
+		goka.WithTester(gkt),
+	)
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		test.AssertNil(t, proc.Run(ctx))
+	}()
+
+	gkt.Consume("input", "a", "group")
+	gkt.Consume("input", "b", "group")
+	gkt.Consume("input", "c", "other")
+
+	test.AssertEqual(t, gkt.TableValue(goka.GroupTable("test"), "group"), "a,b")
+	test.AssertEqual(t, gkt.TableValue(goka.GroupTable("test"), "other"), "c")
+
+	cancel()
+	<-done
+}
+
+func TestProcessor_Visit(t *testing.T) {
+	gkt := tester.New(t)
+
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				ctx.SetValue(msg)
+			}),
+			goka.Persist(new(codec.String)),
+		),
+		goka.WithTester(gkt),
+	)
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		test.AssertNil(t, proc.Run(ctx))
+	}()
+
+	gkt.Consume("input", "a", "1")
+	gkt.Consume("input", "b", "2")
+
+	// migrate all values
+	visited, err := proc.VisitAllWithStats(ctx, "migrate", func(ctx goka.Context) {
+		test.AssertEqual(t, ctx.Topic(), goka.Stream("migrate"))
+		ctx.SetValue("v" + ctx.Value().(string))
+	})
+	test.AssertNil(t, err)
+	test.AssertEqual(t, visited, int64(2))
+	test.AssertEqual(t, gkt.TableValue(goka.GroupTable("test"), "a"), "v1")
+	test.AssertEqual(t, gkt.TableValue(goka.GroupTable("test"), "b"), "v2")
+
+	cancel()
+	<-done
+
+	// the partitions are revoked
+	visited, err = proc.VisitAllWithStats(context.Background(), "migrate", func(ctx goka.Context) {})
+	test.AssertNil(t, err)
+	test.AssertEqual(t, visited, int64(0))
+}
+
+func TestProcessor_JoinMissPolicy(t *testing.T) {
+	run := func(t *testing.T, policy goka.JoinMissPolicy) (*tester.Tester, chan interface{}, func()) {
+		gkt := tester.New(t)
+
+		results := make(chan interface{}, 10)
+		proc, err := goka.NewProcessor(nil,
+			goka.DefineGroup("test",
+				goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+					results <- ctx.Join("join-table")
+				}),
+				goka.Join("join-table", new(codec.String)),
+			),
+			goka.WithTester(gkt),
+			goka.WithJoinMissPolicy(policy),
+		)
+		test.AssertNil(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			test.AssertNil(t, proc.Run(ctx))
+		}()
+		return gkt, results, func() {
+			cancel()
+			<-done
+		}
+	}
+
+	t.Run("drop", func(t *testing.T) {
+		gkt, results, stop := run(t, goka.JoinMissDrop)
+		defer stop()
+
+		gkt.Consume("input", "key", "missing")
+		gkt.SetTableValue("join-table", "key", "joined")
+		gkt.Consume("input", "key", "found")
+		test.AssertEqual(t, <-results, "joined")
+		test.AssertEqual(t, len(results), 0)
+	})
+	t.Run("dlq", func(t *testing.T) {
+		gkt, results, stop := run(t, goka.JoinMissDLQ("dlq"))
+		defer stop()
+
+		tracker := gkt.NewQueueTracker("dlq")
+		gkt.Consume("input", "key", "missing")
+		key, value, ok := tracker.NextRaw()
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, key, "key")
+		test.AssertEqual(t, string(value), "missing")
+		test.AssertEqual(t, len(results), 0)
+	})
+	t.Run("func", func(t *testing.T) {
+		gkt, results, stop := run(t, goka.JoinMissFunc(func(ctx goka.Context, table goka.Table, key string) interface{} {
+			return string(table) + "/" + key
+		}))
+		defer stop()
+
+		gkt.Consume("input", "key", "missing")
+		test.AssertEqual(t, <-results, "join-table/key")
+	})
+}
+
+func TestProcessor_OtelMeter(t *testing.T) {
+	gkt := tester.New(t)
+
+	meter := newRecordingMeter()
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				ctx.SetValue(msg)
+			}),
+			goka.Persist(new(codec.String)),
+		),
+		goka.WithTester(gkt),
+		goka.WithOtelMeter(meter),
+	)
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		test.AssertNil(t, proc.Run(ctx))
+	}()
+
+	gkt.Consume("input", "a", "1")
+	gkt.Consume("input", "b", "2")
+
+	test.AssertEqual(t, meter.count("goka.messages.consumed"), int64(2))
+	test.AssertEqual(t, meter.count("goka.offsets.committed"), int64(2))
+
+	cancel()
+	<-done
+}
+
+func TestProcessor_Tracer(t *testing.T) {
+	gkt := tester.New(t)
+
+	tracer := new(recordingTracer)
+	first, err := goka.NewProcessor(nil,
+		goka.DefineGroup("first",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				ctx.SetValue(msg)
+				ctx.Emit("output", ctx.Key(), msg)
+			}),
+			goka.Output("output", new(codec.String)),
+			goka.Persist(new(codec.String)),
+		),
+		goka.WithTester(gkt),
+		goka.WithTracer(tracer),
+	)
+	test.AssertNil(t, err)
+
+	spans := make(chan trace.Span, 1)
+	second, err := goka.NewProcessor(nil,
+		goka.DefineGroup("second",
+			goka.Input("output", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				spans <- trace.SpanFromContext(ctx.Context())
+			}),
+		),
+		goka.WithTester(gkt),
+		goka.WithTracer(tracer),
+	)
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errg, ctx := multierr.NewErrGroup(ctx)
+	errg.Go(func() error { return first.Run(ctx) })
+	errg.Go(func() error { return second.Run(ctx) })
+
+	gkt.ConsumeWithHeaders("input", "key", "value", map[string][]byte{
+		"traceparent": []byte("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"),
+	})
+
+	processed := tracer.named("goka.process")
+	test.AssertEqual(t, len(processed), 2)
+	firstSpan, secondSpan := processed[0], processed[1]
+
+	// the span of the first processor continues the incoming trace
+	test.AssertEqual(t, firstSpan.parent.TraceID().String(), "0af7651916cd43dd8448eb211c80319c")
+	test.AssertEqual(t, firstSpan.parent.SpanID().String(), "b7ad6b7169203331")
+	test.AssertEqual(t, firstSpan.attr("goka.group").AsString(), "first")
+	test.AssertEqual(t, firstSpan.attr("goka.topic").AsString(), "input")
+	test.AssertEqual(t, firstSpan.attr("goka.partition").AsInt64(), int64(0))
+	test.AssertEqual(t, firstSpan.attr("goka.offset").AsInt64(), int64(0))
+
+	sets := tracer.named("goka.table.set")
+	test.AssertEqual(t, len(sets), 1)
+	test.AssertEqual(t, sets[0].parent, firstSpan.sc)
+	test.AssertEqual(t, sets[0].attr("goka.table").AsString(), "first-table")
+
+	emits := tracer.named("goka.emit")
+	test.AssertEqual(t, len(emits), 1)
+	test.AssertEqual(t, emits[0].parent, firstSpan.sc)
+
+	// the span of the second processor is the child of the emit, the callback's
+	// context carries it
+	test.AssertEqual(t, secondSpan.parent.TraceID(), emits[0].sc.TraceID())
+	test.AssertEqual(t, secondSpan.parent.SpanID(), emits[0].sc.SpanID())
+	test.AssertEqual(t, secondSpan.attr("goka.group").AsString(), "second")
+	test.AssertEqual(t, (<-spans).SpanContext(), secondSpan.sc)
+
+	cancel()
+	test.AssertNil(t, errg.Wait().NilOrError())
+}
+
+func TestProcessor_InputRateLimit(t *testing.T) {
+	gkt := tester.New(t)
+
+	var processed int
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				processed++
+			}),
+		),
+		goka.WithTester(gkt),
+		goka.WithInputRateLimit(rate.Every(50*time.Millisecond), 1),
+	)
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		test.AssertNil(t, proc.Run(ctx))
+	}()
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		gkt.Consume("input", fmt.Sprintf("key-%d", i), "value")
+	}
+	// the first message uses the burst, the others wait for the limiter
+	test.AssertTrue(t, time.Since(start) >= 150*time.Millisecond)
+	test.AssertEqual(t, processed, 5)
+
+	cancel()
+	<-done
+
+	_, err = goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {}),
+		),
+		goka.WithTester(gkt),
+		goka.WithInputRateLimitPerPartition(10, 0),
+	)
+	test.AssertNotNil(t, err)
+}
+
+func TestProcessor_RebalanceObserver(t *testing.T) {
+	gkt := tester.New(t)
+
+	var (
+		m      sync.Mutex
+		events []goka.RebalanceEvent
+	)
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				m.Lock()
+				defer m.Unlock()
+				// the partition is assigned before consuming it
+				test.AssertEqual(t, len(events), 1)
+				ctx.SetValue(msg)
+			}),
+			goka.Persist(new(codec.String)),
+		),
+		goka.WithTester(gkt),
+		goka.WithRebalanceObserver(func(ev goka.RebalanceEvent) {
+			m.Lock()
+			defer m.Unlock()
+			events = append(events, ev)
+		}),
+	)
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		test.AssertNil(t, proc.Run(ctx))
+	}()
+
+	gkt.Consume("input", "key", "value")
+
+	cancel()
+	<-done
+
+	test.AssertEqual(t, len(events), 2)
+	test.AssertEqual(t, events[0].Assigned, []int32{0})
+	test.AssertEqual(t, len(events[0].Revoked), 0)
+	test.AssertEqual(t, len(events[1].Assigned), 0)
+	test.AssertEqual(t, events[1].Revoked, []int32{0})
+	test.AssertEqual(t, events[1].GenerationID, events[0].GenerationID)
+}
+
+// blockingProducer holds back the emits until release is closed.
+type blockingProducer struct {
+	release chan struct{}
+}
+
+func (p *blockingProducer) Emit(topic string, key string, value []byte) *goka.Promise {
+	return p.EmitWithHeaders(topic, key, value, nil)
+}
+
+func (p *blockingProducer) EmitWithHeaders(topic string, key string, value []byte, headers map[string][]byte) *goka.Promise {
+	promise := goka.NewPromise()
+	go func() {
+		<-p.release
+		promise.Finish(nil, nil)
+	}()
+	return promise
+}
+
+func (p *blockingProducer) Close() error {
+	return nil
+}
+
+func TestProcessor_ShutdownDrainTimeout(t *testing.T) {
+	run := func(t *testing.T, release chan struct{}) (error, []int64) {
+		gkt := tester.New(t)
+		producer := &blockingProducer{release: release}
+
+		var (
+			m         sync.Mutex
+			commits   []int64
+			processed = make(chan struct{}, 1)
+		)
+		proc, err := goka.NewProcessor(nil,
+			goka.DefineGroup("test",
+				goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+					ctx.Emit("output", ctx.Key(), msg)
+					processed <- struct{}{}
+				}),
+				goka.Output("output", new(codec.String)),
+			),
+			goka.WithTester(gkt),
+			goka.WithProducerBuilder(func(brokers []string, clientID string, hasher func() hash.Hash32) (goka.Producer, error) {
+				return producer, nil
+			}),
+			goka.WithShutdownDrainTimeout(100*time.Millisecond),
+			goka.WithCommitObserver(func(topic string, partition int32, offset int64) {
+				m.Lock()
+				defer m.Unlock()
+				commits = append(commits, offset)
+			}),
+		)
+		test.AssertNil(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- proc.Run(ctx)
+		}()
+
+		// the tester waits for the message to be committed, which needs the
+		// emit to finish, so the processor is stopped while consuming
+		consumed := make(chan struct{})
+		go func() {
+			defer close(consumed)
+			gkt.Consume("input", "key", "value")
+		}()
+		<-processed
+		cancel()
+		err = <-done
+		<-consumed
+
+		m.Lock()
+		defer m.Unlock()
+		return err, commits
+	}
+
+	t.Run("drained", func(t *testing.T) {
+		release := make(chan struct{})
+		time.AfterFunc(10*time.Millisecond, func() { close(release) })
+
+		err, commits := run(t, release)
+		test.AssertNil(t, err)
+		// the message was committed once its emit finished
+		test.AssertEqual(t, commits, []int64{1})
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+
+		err, commits := run(t, release)
+		test.AssertTrue(t, errors.Is(err, goka.ErrShutdownDrainTimeout))
+		test.AssertEqual(t, len(commits), 0)
+	})
+}
@@ -0,0 +1,87 @@
+package integrationtest
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordingTracer records the started spans. The spans of a trace share its
+// trace ID, the span IDs are numbered consecutively.
+type recordingTracer struct {
+	m      sync.Mutex
+	lastID uint64
+	spans  []*recordingSpan
+}
+
+func (r *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	parent := trace.SpanContextFromContext(ctx)
+	traceID := parent.TraceID()
+	if !traceID.IsValid() {
+		traceID = trace.TraceID{1}
+	}
+	r.lastID++
+	var spanID trace.SpanID
+	binary.BigEndian.PutUint64(spanID[:], r.lastID)
+
+	config := trace.NewSpanStartConfig(opts...)
+	span := &recordingSpan{
+		Span:   trace.SpanFromContext(context.Background()),
+		name:   name,
+		parent: parent,
+		sc: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     spanID,
+			TraceFlags: trace.FlagsSampled,
+		}),
+		attrs: config.Attributes(),
+	}
+	r.spans = append(r.spans, span)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+// named returns the recorded spans with the name.
+func (r *recordingTracer) named(name string) []*recordingSpan {
+	r.m.Lock()
+	defer r.m.Unlock()
+	var spans []*recordingSpan
+	for _, span := range r.spans {
+		if span.name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+type recordingSpan struct {
+	trace.Span
+
+	name   string
+	parent trace.SpanContext
+	sc     trace.SpanContext
+	attrs  []attribute.KeyValue
+}
+
+func (s *recordingSpan) SpanContext() trace.SpanContext {
+	return s.sc
+}
+
+func (s *recordingSpan) IsRecording() bool {
+	return true
+}
+
+// attr returns the value of the span's attribute with the key.
+func (s *recordingSpan) attr(key string) attribute.Value {
+	for _, attr := range s.attrs {
+		if string(attr.Key) == key {
+			return attr.Value
+		}
+	}
+	return attribute.Value{}
+}
@@ -51,5 +51,209 @@ func TestView(t *testing.T) {
 		cancel()
 		<-done
 	})
+	t.Run("otel_meter", func(t *testing.T) {
+		gkt := tester.New(t)
+
+		meter := newRecordingMeter()
+		view, err := goka.NewView(nil, "test", new(codec.String), goka.WithViewTester(gkt), goka.WithViewOtelMeter(meter))
+		test.AssertNil(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			test.AssertNil(t, view.Run(ctx))
+		}()
+		<-view.WaitRunning()
+
+		// updates are written through the update callback
+		gkt.Consume("test", "a", "1")
+		gkt.Consume("test", "b", "2")
+		test.AssertEqual(t, meter.count("goka.table.writes"), int64(2))
+
+		cancel()
+		<-done
+	})
+	t.Run("recovery_aggregator", func(t *testing.T) {
+		gkt := tester.New(t)
+
+		// count the keys of the table
+		countKeys := func(agg interface{}, key string, oldValue, newValue interface{}) interface{} {
+			count := agg.(int)
+			if oldValue == nil && newValue != nil {
+				count++
+			}
+			if oldValue != nil && newValue == nil {
+				count--
+			}
+			return count
+		}
+		view, err := goka.NewView(nil, "test", new(codec.String),
+			goka.WithViewTester(gkt),
+			goka.WithViewRecoveryAggregator(func() interface{} { return 0 }, countKeys),
+		)
+		test.AssertNil(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if err := view.Run(ctx); err != nil {
+				panic(err)
+			}
+		}()
+
+		// updates are consumed from the table topic (SetTableValue bypasses the update path)
+		gkt.Consume("test", "key-1", "a")
+		gkt.Consume("test", "key-2", "b")
+		gkt.Consume("test", "key-1", "c")
+
+		agg, err := view.Aggregate(0)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, agg, 2)
+
+		_, err = view.Aggregate(1)
+		test.AssertNotNil(t, err)
+
+		cancel()
+		<-done
+	})
+	t.Run("recover_from", func(t *testing.T) {
+		gkt := tester.New(t)
+
+		view, err := goka.NewView(nil, "test", new(codec.String),
+			goka.WithViewTester(gkt),
+			goka.WithViewRecoverFrom("test-mirror"),
+		)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, view.Topic(), "test")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if err := view.Run(ctx); err != nil {
+				panic(err)
+			}
+		}()
+
+		gkt.Consume("test-mirror", "key", "mirrored")
+
+		val, err := view.Get("key")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, val, "mirrored")
+
+		cancel()
+		<-done
+	})
+	t.Run("recover_concurrency", func(t *testing.T) {
+		gkt := tester.New(t)
+
+		view, err := goka.NewView(nil, "test", new(codec.String),
+			goka.WithViewTester(gkt),
+			goka.WithViewRecoverConcurrency(1),
+		)
+		test.AssertNil(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if err := view.Run(ctx); err != nil {
+				panic(err)
+			}
+		}()
+
+		<-view.WaitRunning()
+		test.AssertTrue(t, view.Recovered())
+		gkt.SetTableValue("test", "key", "value")
+		val, err := view.Get("key")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, val, "value")
+
+		cancel()
+		<-done
+	})
+	t.Run("subscribe", func(t *testing.T) {
+		gkt := tester.New(t)
+
+		view, err := goka.NewView(nil, "test", new(codec.String), goka.WithViewTester(gkt))
+		test.AssertNil(t, err)
+
+		subCtx, unsubscribe := context.WithCancel(context.Background())
+		updates, err := view.Subscribe(subCtx)
+		test.AssertNil(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if err := view.Run(ctx); err != nil {
+				panic(err)
+			}
+		}()
+		<-view.WaitRunning()
+
+		gkt.Consume("test", "key", "value")
+		test.AssertEqual(t, <-updates, goka.Update{Key: "key", Value: "value"})
+		gkt.Consume("test", "key", nil)
+		test.AssertEqual(t, <-updates, goka.Update{Key: "key"})
+
+		// the channel is closed after unsubscribing
+		unsubscribe()
+		_, ok := <-updates
+		test.AssertFalse(t, ok)
+
+		// and when the view stops
+		updates, err = view.Subscribe(context.Background())
+		test.AssertNil(t, err)
+		cancel()
+		<-done
+		_, ok = <-updates
+		test.AssertFalse(t, ok)
+	})
+}
+
+func TestRepartitionTable(t *testing.T) {
+	gkt := tester.New(t)
+
+	view, err := goka.NewView(nil, "source", new(codec.String), goka.WithViewTester(gkt))
+	test.AssertNil(t, err)
+	emitter, err := goka.NewEmitter(nil, "target", new(codec.String), goka.WithEmitterTester(gkt))
+	test.AssertNil(t, err)
+	defer emitter.Finish()
+	tm, err := gkt.TopicManagerBuilder()(nil)
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		test.AssertNil(t, view.Run(ctx))
+	}()
+
+	gkt.SetTableValue("source", "key-1", "a")
+	gkt.SetTableValue("source", "key-2", "b")
+
+	// the number of partitions must be positive
+	_, err = goka.RepartitionTable(ctx, view, emitter, tm, 0)
+	test.AssertNotNil(t, err)
+
+	tracker := gkt.NewQueueTracker("target")
+	copied, err := goka.RepartitionTable(ctx, view, emitter, tm, 1)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, copied, 2)
+
+	values := make(map[string]interface{})
+	for {
+		key, value, ok := tracker.Next()
+		if !ok {
+			break
+		}
+		values[key] = value
+	}
+	test.AssertEqual(t, values, map[string]interface{}{"key-1": "a", "key-2": "b"})
 
+	cancel()
+	<-done
 }
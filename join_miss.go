@@ -0,0 +1,92 @@
+package goka
+
+import "fmt"
+
+// JoinMissPolicy defines how the processor handles Join and Lookup calls of a
+// callback that find no value for the key, see WithJoinMissPolicy.
+type JoinMissPolicy struct {
+	drop     bool
+	dlq      Stream
+	fallback func(ctx Context, table Table, key string) interface{}
+}
+
+var (
+	// JoinMissIgnore returns nil for missing values, which is the default.
+	JoinMissIgnore = JoinMissPolicy{}
+	// JoinMissDrop stops the callback and commits the input message. Emits and
+	// table writes of the callback before the miss are not rolled back.
+	JoinMissDrop = JoinMissPolicy{drop: true}
+)
+
+// JoinMissDLQ stops the callback like JoinMissDrop and forwards the input message
+// unmodified to passed topic (a dead letter queue). The input message is committed
+// once the forwarded message is written.
+func JoinMissDLQ(topic Stream) JoinMissPolicy {
+	return JoinMissPolicy{drop: true, dlq: topic}
+}
+
+// JoinMissFunc calls fallback for missing values and returns its result, e.g.
+// a default value. The callback may also call ctx.Fail.
+func JoinMissFunc(fallback func(ctx Context, table Table, key string) interface{}) JoinMissPolicy {
+	return JoinMissPolicy{fallback: fallback}
+}
+
+// joinMissed is panicked by a Join or Lookup without value to stop the callback
+// if the join miss policy drops the message.
+type joinMissed struct {
+	table Table
+	key   string
+}
+
+// joinMiss handles a Join or Lookup without value according to the join miss policy.
+func (ctx *cbContext) joinMiss(table Table, key string) interface{} {
+	policy := ctx.joinMissPolicy
+	switch {
+	case policy == nil:
+		return nil
+	case policy.fallback != nil:
+		return policy.fallback(ctx, table, key)
+	case policy.drop:
+		panic(&joinMissed{table: table, key: key})
+	}
+	return nil
+}
+
+// callback calls cb and handles a message dropped by the join miss policy.
+func (pp *PartitionProcessor) callback(cb ProcessCallback, msgContext *cbContext, m interface{}) {
+	if policy := pp.opts.joinMissPolicy; policy != nil && policy.drop {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			miss, ok := r.(*joinMissed)
+			if !ok {
+				panic(r)
+			}
+
+			msg := msgContext.msg
+			pp.log.Debugf("dropping message (key %s) from %s/%d@%d, key %s missing in table %s",
+				string(msg.Key), msg.Topic, msg.Partition, msg.Offset, miss.key, miss.table)
+			if policy.dlq == "" {
+				return
+			}
+
+			// forward the message once the emits of the callback are done
+			commit := msgContext.commit
+			msgContext.commit = func() {
+				msgContext.wg.Add(1)
+				pp.producer.Emit(string(policy.dlq), string(msg.Key), msg.Value).Then(func(err error) {
+					defer msgContext.wg.Done()
+					if err != nil {
+						msgContext.asyncFailer(fmt.Errorf("error forwarding message with join miss to %s: %v", policy.dlq, err))
+						return
+					}
+					commit()
+				})
+			}
+		}()
+	}
+
+	cb(msgContext, m)
+}
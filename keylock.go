@@ -0,0 +1,45 @@
+package goka
+
+import "sync"
+
+// keyMutex provides a mutex per key. Mutexes are created on demand and removed
+// once they are not used anymore.
+type keyMutex struct {
+	m     sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newKeyMutex() *keyMutex {
+	return &keyMutex{
+		locks: make(map[string]*keyLock),
+	}
+}
+
+// lock locks the mutex of the key and returns the function to unlock it.
+func (km *keyMutex) lock(key string) func() {
+	km.m.Lock()
+	l, ok := km.locks[key]
+	if !ok {
+		l = new(keyLock)
+		km.locks[key] = l
+	}
+	l.refs++
+	km.m.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		km.m.Lock()
+		defer km.m.Unlock()
+		l.refs--
+		if l.refs == 0 {
+			delete(km.locks, key)
+		}
+	}
+}
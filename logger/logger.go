@@ -9,7 +9,7 @@ import (
 )
 
 var (
-	defaultLogger = &std{}
+	defaultLogger = &std{level: LevelInfo}
 )
 
 // Logger is the interface Goka and its subpackages use for logging.
@@ -38,26 +38,119 @@ type Logger interface {
 	Prefix(string) Logger
 }
 
+// Level is the severity of a log message.
+type Level int
+
+const (
+	// LevelDebug is used for debugging messages, e.g. the progress of the recovery.
+	LevelDebug Level = iota
+	// LevelInfo is used for informational messages.
+	LevelInfo
+	// LevelWarn is used for problems goka handles itself, e.g. by retrying.
+	LevelWarn
+	// LevelError is used for errors, e.g. failing partitions.
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(l))
+	}
+}
+
+// LevelLogger is implemented by loggers supporting the warn and error levels.
+// Goka logs warnings and errors with Warnf and Errorf, which fall back to
+// Printf for loggers not implementing it.
+type LevelLogger interface {
+	// Warnf is used for problems goka handles itself, e.g. by retrying.
+	Warnf(string, ...interface{})
+
+	// Errorf is used for errors, e.g. failing partitions.
+	Errorf(string, ...interface{})
+}
+
+// Warnf logs a warning if the logger is a LevelLogger, otherwise an
+// informational message.
+func Warnf(l Logger, msg string, args ...interface{}) {
+	if ll, ok := l.(LevelLogger); ok {
+		ll.Warnf(msg, args...)
+		return
+	}
+	l.Printf(msg, args...)
+}
+
+// Errorf logs an error if the logger is a LevelLogger, otherwise an
+// informational message.
+func Errorf(l Logger, msg string, args ...interface{}) {
+	if ll, ok := l.(LevelLogger); ok {
+		ll.Errorf(msg, args...)
+		return
+	}
+	l.Printf(msg, args...)
+}
+
+// FieldLogger is implemented by structured loggers that can add fields to the
+// messages of a sub-logger (see With).
+type FieldLogger interface {
+	// With returns a logger adding the key-value pairs to all messages
+	With(keysAndValues ...interface{}) Logger
+}
+
+// With returns a logger adding the key-value pairs (e.g. "topic", "my-topic")
+// to all messages if the logger is a FieldLogger. Other loggers are returned
+// unchanged, as the prefixes already give their messages context.
+func With(l Logger, keysAndValues ...interface{}) Logger {
+	if fl, ok := l.(FieldLogger); ok {
+		return fl.With(keysAndValues...)
+	}
+	return l
+}
+
 // std bridges the logger calls to the standard library log.
 type std struct {
-	debug      bool
+	level      Level
 	prefixPath []string
 	prefix     string
 }
 
 func (s *std) Print(msgs ...interface{}) {
-	log.Print(msgs...)
+	if s.level <= LevelInfo {
+		log.Print(msgs...)
+	}
 }
 func (s *std) Println(msgs ...interface{}) {
-	log.Print(msgs...)
+	if s.level <= LevelInfo {
+		log.Print(msgs...)
+	}
 }
 
 func (s *std) Printf(msg string, args ...interface{}) {
-	log.Printf(fmt.Sprintf("%s%s", s.prefix, msg), args...)
+	s.logf(LevelInfo, msg, args...)
 }
 
 func (s *std) Debugf(msg string, args ...interface{}) {
-	if s.debug {
+	s.logf(LevelDebug, msg, args...)
+}
+
+func (s *std) Warnf(msg string, args ...interface{}) {
+	s.logf(LevelWarn, msg, args...)
+}
+
+func (s *std) Errorf(msg string, args ...interface{}) {
+	s.logf(LevelError, msg, args...)
+}
+
+func (s *std) logf(level Level, msg string, args ...interface{}) {
+	if s.level <= level {
 		log.Printf(fmt.Sprintf("%s%s", s.prefix, msg), args...)
 	}
 }
@@ -75,11 +168,21 @@ func Default() Logger {
 	return defaultLogger
 }
 
+// New returns a logger writing to the standard library log, which drops the
+// messages below the level.
+func New(level Level) Logger {
+	return &std{level: level}
+}
+
 // Debug enables or disables debug logging using the global logger.
 func Debug(gokaDebug, saramaDebug bool) {
-	defaultLogger.debug = gokaDebug
+	if gokaDebug {
+		defaultLogger.level = LevelDebug
+	} else {
+		defaultLogger.level = LevelInfo
+	}
 	if saramaDebug {
-		SetSaramaLogger((&std{debug: true}).Prefix("Sarama"))
+		SetSaramaLogger(New(LevelDebug).Prefix("Sarama"))
 	}
 }
 
@@ -89,7 +192,7 @@ func SetSaramaLogger(logger Logger) {
 
 // EmptyPrefixer encapsulates a prefixer that is initially without a prefix
 func EmptyPrefixer() Prefixer {
-	return &std{}
+	return &std{level: LevelInfo}
 }
 
 // Prefixer abstracts the functionality of stacking the prefix for a custom logger implementation
@@ -120,6 +223,6 @@ func (s *std) StackPrefix(prefix string) Prefixer {
 	return &std{
 		prefixPath: prefPath,
 		prefix:     newPrefix,
-		debug:      s.debug,
+		level:      s.level,
 	}
 }
@@ -0,0 +1,118 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+	"github.com/rs/zerolog"
+)
+
+type sugaredEntry struct {
+	level         string
+	msg           string
+	keysAndValues []interface{}
+}
+
+type recordingSugaredLogger struct {
+	entries []sugaredEntry
+}
+
+func (r *recordingSugaredLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	r.entries = append(r.entries, sugaredEntry{"debug", msg, keysAndValues})
+}
+
+func (r *recordingSugaredLogger) Infow(msg string, keysAndValues ...interface{}) {
+	r.entries = append(r.entries, sugaredEntry{"info", msg, keysAndValues})
+}
+
+func (r *recordingSugaredLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	r.entries = append(r.entries, sugaredEntry{"warn", msg, keysAndValues})
+}
+
+func (r *recordingSugaredLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	r.entries = append(r.entries, sugaredEntry{"error", msg, keysAndValues})
+}
+
+func (r *recordingSugaredLogger) Panicw(msg string, keysAndValues ...interface{}) {
+	r.entries = append(r.entries, sugaredEntry{"panic", msg, keysAndValues})
+}
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	flags := log.Flags()
+	log.SetFlags(0)
+	defer log.SetFlags(flags)
+
+	l := New(LevelWarn).Prefix("Processor")
+	l.Debugf("debug")
+	l.Printf("info")
+	Warnf(l, "warn %d", 1)
+	Errorf(l, "error %d", 2)
+
+	test.AssertEqual(t, strings.Split(strings.TrimSpace(buf.String()), "\n"), []string{
+		"[Processor] warn 1",
+		"[Processor] error 2",
+	})
+}
+
+func TestWarnf_fallback(t *testing.T) {
+	// loggers without levels log warnings with Printf
+	rec := new(recordingSugaredLogger)
+	Warnf(&printfLogger{Zap(rec)}, "warn")
+	test.AssertEqual(t, rec.entries, []sugaredEntry{{"info", "warn", nil}})
+}
+
+// printfLogger hides the level methods of the wrapped logger.
+type printfLogger struct {
+	Logger
+}
+
+func TestWith(t *testing.T) {
+	// loggers without fields are returned unchanged
+	l := Default()
+	test.AssertTrue(t, With(l, "topic", "test") == l)
+}
+
+func TestZap(t *testing.T) {
+	rec := new(recordingSugaredLogger)
+	l := Zap(rec)
+
+	l.Printf("hello %s", "world")
+	sub := With(l.Prefix("Processor").Prefix("Partition"), "partition", int32(1))
+	sub.Debugf("debug %d", 1)
+	With(sub, "offset", int64(2)).Printf("message")
+	Errorf(l, "failed: %v", "error")
+
+	test.AssertEqual(t, rec.entries, []sugaredEntry{
+		{"info", "hello world", nil},
+		{"debug", "debug 1", []interface{}{"component", "Processor > Partition", "partition", int32(1)}},
+		{"info", "message", []interface{}{"component", "Processor > Partition", "partition", int32(1), "offset", int64(2)}},
+		{"error", "failed: error", nil},
+	})
+}
+
+func TestZerolog(t *testing.T) {
+	var buf bytes.Buffer
+	l := Zerolog(zerolog.New(&buf).Level(zerolog.InfoLevel))
+
+	sub := With(l.Prefix("Processor").Prefix("Partition"), "partition", 1)
+	sub.Printf("hello %s", "world")
+	// debug messages are filtered by the level
+	sub.Debugf("debug")
+
+	var entry map[string]interface{}
+	test.AssertNil(t, json.Unmarshal(buf.Bytes(), &entry))
+	test.AssertEqual(t, entry, map[string]interface{}{
+		"level":     "info",
+		"message":   "hello world",
+		"component": "Processor > Partition",
+		"partition": float64(1),
+	})
+}
@@ -0,0 +1,102 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SugaredLogger is the part of zap's *zap.SugaredLogger used by Zap, so the
+// logger package does not depend on zap.
+type SugaredLogger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+	Panicw(msg string, keysAndValues ...interface{})
+}
+
+// Zap returns a Logger writing structured messages to the sugared zap logger.
+// Prefixes are added to the messages as the field "component" (stacked like
+// the prefixes of the default logger) and fields added by With are passed
+// along with every message. Debug messages are filtered by the level of the
+// zap logger.
+//
+//	goka.NewProcessor(brokers, graph, goka.WithLogger(logger.Zap(zapLogger.Sugar())))
+func Zap(l SugaredLogger) Logger {
+	return &zapLogger{l: l}
+}
+
+type zapLogger struct {
+	l          SugaredLogger
+	prefixPath []string
+	fields     []interface{}
+}
+
+func (z *zapLogger) Print(msgs ...interface{}) {
+	z.l.Infow(fmt.Sprint(msgs...), z.keysAndValues()...)
+}
+
+func (z *zapLogger) Println(msgs ...interface{}) {
+	z.l.Infow(fmt.Sprint(msgs...), z.keysAndValues()...)
+}
+
+func (z *zapLogger) Printf(msg string, args ...interface{}) {
+	z.l.Infow(fmt.Sprintf(msg, args...), z.keysAndValues()...)
+}
+
+func (z *zapLogger) Debugf(msg string, args ...interface{}) {
+	z.l.Debugw(fmt.Sprintf(msg, args...), z.keysAndValues()...)
+}
+
+func (z *zapLogger) Warnf(msg string, args ...interface{}) {
+	z.l.Warnw(fmt.Sprintf(msg, args...), z.keysAndValues()...)
+}
+
+func (z *zapLogger) Errorf(msg string, args ...interface{}) {
+	z.l.Errorw(fmt.Sprintf(msg, args...), z.keysAndValues()...)
+}
+
+func (z *zapLogger) Panicf(msg string, args ...interface{}) {
+	z.l.Panicw(fmt.Sprintf(msg, args...), z.keysAndValues()...)
+}
+
+func (z *zapLogger) Prefix(prefix string) Logger {
+	return &zapLogger{
+		l:          z.l,
+		prefixPath: stackPrefixPath(z.prefixPath, prefix),
+		fields:     z.fields,
+	}
+}
+
+func (z *zapLogger) With(keysAndValues ...interface{}) Logger {
+	fields := make([]interface{}, 0, len(z.fields)+len(keysAndValues))
+	fields = append(fields, z.fields...)
+	fields = append(fields, keysAndValues...)
+	return &zapLogger{
+		l:          z.l,
+		prefixPath: z.prefixPath,
+		fields:     fields,
+	}
+}
+
+func (z *zapLogger) keysAndValues() []interface{} {
+	if len(z.prefixPath) == 0 {
+		return z.fields
+	}
+	kvs := make([]interface{}, 0, len(z.fields)+2)
+	kvs = append(kvs, componentField, strings.Join(z.prefixPath, " > "))
+	return append(kvs, z.fields...)
+}
+
+// componentField is the field of the structured loggers containing the prefixes.
+const componentField = "component"
+
+// stackPrefixPath returns a copy of the path with prefix appended if not empty.
+func stackPrefixPath(path []string, prefix string) []string {
+	newPath := make([]string, 0, len(path)+1)
+	newPath = append(newPath, path...)
+	if prefix != "" {
+		newPath = append(newPath, prefix)
+	}
+	return newPath
+}
@@ -0,0 +1,74 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// Zerolog returns a Logger writing structured messages to the zerolog logger.
+// Prefixes are added to the messages as the field "component" (stacked like
+// the prefixes of the default logger) and fields added by With become fields of
+// the zerolog sub-logger. Debug messages are filtered by the level of the
+// zerolog logger.
+//
+//	goka.NewProcessor(brokers, graph, goka.WithLogger(logger.Zerolog(zerolog.New(os.Stderr))))
+func Zerolog(l zerolog.Logger) Logger {
+	return &zerologLogger{l: l}
+}
+
+type zerologLogger struct {
+	l          zerolog.Logger
+	prefixPath []string
+}
+
+func (z *zerologLogger) Print(msgs ...interface{}) {
+	z.event(z.l.Info()).Msg(fmt.Sprint(msgs...))
+}
+
+func (z *zerologLogger) Println(msgs ...interface{}) {
+	z.event(z.l.Info()).Msg(fmt.Sprint(msgs...))
+}
+
+func (z *zerologLogger) Printf(msg string, args ...interface{}) {
+	z.event(z.l.Info()).Msgf(msg, args...)
+}
+
+func (z *zerologLogger) Debugf(msg string, args ...interface{}) {
+	z.event(z.l.Debug()).Msgf(msg, args...)
+}
+
+func (z *zerologLogger) Warnf(msg string, args ...interface{}) {
+	z.event(z.l.Warn()).Msgf(msg, args...)
+}
+
+func (z *zerologLogger) Errorf(msg string, args ...interface{}) {
+	z.event(z.l.Error()).Msgf(msg, args...)
+}
+
+func (z *zerologLogger) Panicf(msg string, args ...interface{}) {
+	z.event(z.l.Panic()).Msgf(msg, args...)
+}
+
+func (z *zerologLogger) Prefix(prefix string) Logger {
+	return &zerologLogger{
+		l:          z.l,
+		prefixPath: stackPrefixPath(z.prefixPath, prefix),
+	}
+}
+
+func (z *zerologLogger) With(keysAndValues ...interface{}) Logger {
+	return &zerologLogger{
+		l:          z.l.With().Fields(keysAndValues).Logger(),
+		prefixPath: z.prefixPath,
+	}
+}
+
+// event adds the prefixes to the event, which is nil if its level is disabled.
+func (z *zerologLogger) event(e *zerolog.Event) *zerolog.Event {
+	if len(z.prefixPath) == 0 {
+		return e
+	}
+	return e.Str(componentField, strings.Join(z.prefixPath, " > "))
+}
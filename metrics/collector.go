@@ -0,0 +1,222 @@
+// Package metrics exports the state and stats of goka views and processors
+// as prometheus metrics.
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/lovoo/goka"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace = "goka"
+
+	// maximum time to fetch the stats of a view or processor on Collect
+	collectTimeout = 5 * time.Second
+)
+
+// tableDescs describe the metrics of the partitions of a table.
+type tableDescs struct {
+	status   *prometheus.Desc
+	offset   *prometheus.Desc
+	hwm      *prometheus.Desc
+	lag      *prometheus.Desc
+	consumed *prometheus.Desc
+}
+
+func newTableDescs(subsystem string, labels []string, constLabels prometheus.Labels) *tableDescs {
+	return &tableDescs{
+		status: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "partition_status"),
+			"Status of the table partition (0=stopped, 1=initializing, 2=connecting, 3=recovering, 4=preparing, 5=running).",
+			labels, constLabels),
+		offset: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "partition_offset"),
+			"Last offset recovered or consumed by the table partition.",
+			labels, constLabels),
+		hwm: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "partition_hwm"),
+			"High water mark of the table partition, i.e. the next offset to be written.",
+			labels, constLabels),
+		lag: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "partition_lag"),
+			"Number of messages between the consumed offset and the high water mark of the table partition.",
+			labels, constLabels),
+		consumed: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "partition_messages_consumed_total"),
+			"Number of messages consumed by the table partition after recovery.",
+			labels, constLabels),
+	}
+}
+
+func (d *tableDescs) describe(ch chan<- *prometheus.Desc) {
+	ch <- d.status
+	ch <- d.offset
+	ch <- d.hwm
+	ch <- d.lag
+	ch <- d.consumed
+}
+
+// collect sends the metrics of a table partition. Stats of partitions that did
+// not respond in time are nil and skipped.
+func (d *tableDescs) collect(ch chan<- prometheus.Metric, stats *goka.TableStats, labels ...string) {
+	if stats == nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(d.status, prometheus.GaugeValue, float64(stats.Status), labels...)
+	if stats.Recovery != nil {
+		ch <- prometheus.MustNewConstMetric(d.offset, prometheus.GaugeValue, float64(stats.Recovery.Offset), labels...)
+		ch <- prometheus.MustNewConstMetric(d.hwm, prometheus.GaugeValue, float64(stats.Recovery.Hwm), labels...)
+	}
+	if stats.Input != nil {
+		ch <- prometheus.MustNewConstMetric(d.lag, prometheus.GaugeValue, float64(stats.Input.OffsetLag), labels...)
+		ch <- prometheus.MustNewConstMetric(d.consumed, prometheus.CounterValue, float64(stats.Input.Count), labels...)
+	}
+}
+
+// ViewCollector is a prometheus.Collector exporting the state of a view and the
+// stats of its partitions. All metrics carry the view's topic as label "table".
+type ViewCollector struct {
+	view *goka.View
+
+	state *prometheus.Desc
+	table *tableDescs
+}
+
+// NewViewCollector creates a collector for the view.
+func NewViewCollector(view *goka.View) *ViewCollector {
+	constLabels := prometheus.Labels{"table": view.Topic()}
+	return &ViewCollector{
+		view: view,
+		state: prometheus.NewDesc(prometheus.BuildFQName(namespace, "view", "state"),
+			"State of the view (0=idle, 1=initializing, 2=connecting, 3=catching up, 4=running).",
+			nil, constLabels),
+		table: newTableDescs("view", []string{"partition"}, constLabels),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *ViewCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.state
+	c.table.describe(ch)
+}
+
+// Collect implements prometheus.Collector. It fetches the current stats from
+// the view's partitions, which answer in between recovering or consuming
+// messages.
+func (c *ViewCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue, float64(c.view.CurrentState()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+	for partition, stats := range c.view.Stats(ctx).Partitions {
+		c.table.collect(ch, stats, partitionLabel(partition))
+	}
+}
+
+// ProcessorCollector is a prometheus.Collector exporting the state of a processor
+// and the stats of its partitions, including its group table, joined tables and
+// lookup tables. All metrics carry the processor's group as label "group".
+type ProcessorCollector struct {
+	proc *goka.Processor
+
+	state    *prometheus.Desc
+	restarts *prometheus.Desc
+	offset   *prometheus.Desc
+	lag      *prometheus.Desc
+	consumed *prometheus.Desc
+	emitted  *prometheus.Desc
+	table    *tableDescs
+}
+
+// NewProcessorCollector creates a collector for the processor.
+func NewProcessorCollector(proc *goka.Processor) *ProcessorCollector {
+	var (
+		constLabels = prometheus.Labels{"group": string(proc.Graph().Group())}
+		topicLabels = []string{"topic", "partition"}
+	)
+	return &ProcessorCollector{
+		proc: proc,
+		state: prometheus.NewDesc(prometheus.BuildFQName(namespace, "processor", "state"),
+			"State of the processor (0=idle, 1=starting, 2=setup, 3=running, 4=stopping).",
+			nil, constLabels),
+		restarts: prometheus.NewDesc(prometheus.BuildFQName(namespace, "processor", "partition_restarts_total"),
+			"Number of restarts of the partition processor after a failure.",
+			[]string{"partition"}, constLabels),
+		offset: prometheus.NewDesc(prometheus.BuildFQName(namespace, "processor", "input_offset"),
+			"Last offset consumed from the input topic.",
+			topicLabels, constLabels),
+		lag: prometheus.NewDesc(prometheus.BuildFQName(namespace, "processor", "input_lag"),
+			"Number of messages between the consumed offset and the high water mark of the input topic.",
+			topicLabels, constLabels),
+		consumed: prometheus.NewDesc(prometheus.BuildFQName(namespace, "processor", "messages_consumed_total"),
+			"Number of messages consumed from the input topic.",
+			topicLabels, constLabels),
+		emitted: prometheus.NewDesc(prometheus.BuildFQName(namespace, "processor", "messages_emitted_total"),
+			"Number of messages emitted into the output topic.",
+			topicLabels, constLabels),
+		table: newTableDescs("processor_table", []string{"table", "partition"}, constLabels),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *ProcessorCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.state
+	ch <- c.restarts
+	ch <- c.offset
+	ch <- c.lag
+	ch <- c.consumed
+	ch <- c.emitted
+	c.table.describe(ch)
+}
+
+// Collect implements prometheus.Collector. It fetches the current stats from
+// the processor's partitions, which answer in between recovering or processing
+// messages.
+func (c *ProcessorCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue, float64(c.proc.CurrentState()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+	stats := c.proc.StatsWithContext(ctx)
+
+	var groupTable string
+	if gt := c.proc.Graph().GroupTable(); gt != nil {
+		groupTable = gt.Topic()
+	}
+
+	for partition, pstats := range stats.Group {
+		if pstats == nil {
+			continue
+		}
+		part := partitionLabel(partition)
+		ch <- prometheus.MustNewConstMetric(c.restarts, prometheus.CounterValue, float64(pstats.Restarts), part)
+
+		for topic, input := range pstats.Input {
+			ch <- prometheus.MustNewConstMetric(c.offset, prometheus.GaugeValue, float64(input.LastOffset), topic, part)
+			ch <- prometheus.MustNewConstMetric(c.lag, prometheus.GaugeValue, float64(input.OffsetLag), topic, part)
+			ch <- prometheus.MustNewConstMetric(c.consumed, prometheus.CounterValue, float64(input.Count), topic, part)
+		}
+		for topic, output := range pstats.Output {
+			ch <- prometheus.MustNewConstMetric(c.emitted, prometheus.CounterValue, float64(output.Count), topic, part)
+		}
+
+		if groupTable != "" {
+			c.table.collect(ch, pstats.TableStats, groupTable, part)
+		}
+		for topic, joined := range pstats.Joined {
+			c.table.collect(ch, joined, topic, part)
+		}
+	}
+
+	for topic, lookup := range stats.Lookup {
+		if lookup == nil {
+			continue
+		}
+		for partition, tstats := range lookup.Partitions {
+			c.table.collect(ch, tstats, topic, partitionLabel(partition))
+		}
+	}
+}
+
+func partitionLabel(partition int32) string {
+	return strconv.FormatInt(int64(partition), 10)
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/tester"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gather sums up the values of all metrics named name in the registry having
+// the passed label pairs.
+func gather(t *testing.T, reg *prometheus.Registry, name string, labels ...string) float64 {
+	families, err := reg.Gather()
+	test.AssertNil(t, err)
+
+	var sum float64
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if !hasLabels(m.GetLabel(), labels) {
+				continue
+			}
+			switch {
+			case m.GetGauge() != nil:
+				sum += m.GetGauge().GetValue()
+			case m.GetCounter() != nil:
+				sum += m.GetCounter().GetValue()
+			}
+		}
+	}
+	return sum
+}
+
+func hasLabels(pairs []*dto.LabelPair, labels []string) bool {
+	for i := 0; i+1 < len(labels); i += 2 {
+		var found bool
+		for _, pair := range pairs {
+			if pair.GetName() == labels[i] && pair.GetValue() == labels[i+1] {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCollector(t *testing.T) {
+	gkt := tester.New(t)
+
+	proc, err := goka.NewProcessor(nil,
+		goka.DefineGroup("test",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				ctx.SetValue(msg)
+				ctx.Emit("output", ctx.Key(), msg)
+			}),
+			goka.Output("output", new(codec.String)),
+			goka.Persist(new(codec.String)),
+		),
+		goka.WithTester(gkt),
+	)
+	test.AssertNil(t, err)
+
+	view, err := goka.NewView(nil, "other-table", new(codec.String), goka.WithViewTester(gkt))
+	test.AssertNil(t, err)
+
+	reg := prometheus.NewRegistry()
+	test.AssertNil(t, reg.Register(NewProcessorCollector(proc)))
+	test.AssertNil(t, reg.Register(NewViewCollector(view)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		errs := make(chan error, 2)
+		go func() { errs <- proc.Run(ctx) }()
+		go func() { errs <- view.Run(ctx) }()
+		test.AssertNil(t, <-errs)
+		test.AssertNil(t, <-errs)
+	}()
+
+	gkt.Consume("input", "a", "1")
+	gkt.Consume("input", "b", "2")
+	gkt.Consume("other-table", "c", "3")
+
+	test.AssertEqual(t, gather(t, reg, "goka_processor_state"), float64(goka.ProcStateRunning))
+	test.AssertEqual(t, gather(t, reg, "goka_processor_messages_consumed_total"), float64(2))
+	test.AssertEqual(t, gather(t, reg, "goka_processor_messages_emitted_total", "topic", "output"), float64(2))
+	// updates of the group table count as emitted messages
+	test.AssertEqual(t, gather(t, reg, "goka_processor_messages_emitted_total", "topic", "test-table"), float64(2))
+	test.AssertEqual(t, gather(t, reg, "goka_processor_table_partition_status"), float64(goka.PartitionRunning))
+
+	test.AssertEqual(t, gather(t, reg, "goka_view_state"), float64(goka.ViewStateRunning))
+	test.AssertEqual(t, gather(t, reg, "goka_view_partition_status"), float64(goka.PartitionRunning))
+	test.AssertEqual(t, gather(t, reg, "goka_view_partition_messages_consumed_total"), float64(1))
+
+	cancel()
+	<-done
+}
@@ -55,7 +55,9 @@ func NewMockAutoConsumer(t *testing.T, config *sarama.Config) *MockAutoConsumer
 
 // ConsumePartition implements the ConsumePartition method from the sarama.Consumer interface.
 // Before you can start consuming a partition, you have to set expectations on it using
-// ExpectConsumePartition. You can only consume a partition once per consumer.
+// ExpectConsumePartition. You can only consume a partition once at a time, but it
+// can be consumed again after it was closed, e.g. when a partition table
+// reconnects after an error yielded by YieldError.
 func (c *MockAutoConsumer) ConsumePartition(topic string, partition int32, offset int64) (sarama.PartitionConsumer, error) {
 	c.l.Lock()
 	defer c.l.Unlock()
@@ -70,7 +72,8 @@ func (c *MockAutoConsumer) ConsumePartition(topic string, partition int32, offse
 		return nil, sarama.ConfigurationError("The topic/partition is already being consumed")
 	}
 
-	if pc.offset != anyOffset && pc.offset != offset {
+	// the offset of a reconnect depends on the consumed messages
+	if reopened := pc.reopen(); !reopened && pc.offset != anyOffset && pc.offset != offset {
 		c.t.Errorf("Unexpected offset when calling ConsumePartition for %s/%d. Expected %d, got %d.", topic, partition, pc.offset, offset)
 	}
 
@@ -172,12 +175,13 @@ func (c *MockAutoConsumer) ExpectConsumePartition(topic string, partition int32,
 
 	if c.partitionConsumers[topic][partition] == nil {
 		c.partitionConsumers[topic][partition] = &MockAutoPartitionConsumer{
-			t:         c.t,
-			topic:     topic,
-			partition: partition,
-			offset:    offset,
-			messages:  make(chan *sarama.ConsumerMessage, c.config.ChannelBufferSize),
-			errors:    make(chan *sarama.ConsumerError, c.config.ChannelBufferSize),
+			t:           c.t,
+			topic:       topic,
+			partition:   partition,
+			offset:      offset,
+			messages:    make(chan *sarama.ConsumerMessage, c.config.ChannelBufferSize),
+			errors:      make(chan *sarama.ConsumerError, c.config.ChannelBufferSize),
+			singleClose: new(sync.Once),
 		}
 	}
 
@@ -202,10 +206,16 @@ type MockAutoPartitionConsumer struct {
 	offset                  int64
 	messages                chan *sarama.ConsumerMessage
 	errors                  chan *sarama.ConsumerError
-	singleClose             sync.Once
+	singleClose             *sync.Once
 	consumed                bool
 	errorsShouldBeDrained   bool
 	messagesShouldBeDrained bool
+
+	// whether the channels are closed. Messages and errors yielded while closed
+	// are pending until the partition is consumed again.
+	closed          bool
+	pendingMessages []*sarama.ConsumerMessage
+	pendingErrors   []*sarama.ConsumerError
 }
 
 ///////////////////////////////////////////////////
@@ -214,13 +224,42 @@ type MockAutoPartitionConsumer struct {
 
 // AsyncClose implements the AsyncClose method from the sarama.PartitionConsumer interface.
 func (pc *MockAutoPartitionConsumer) AsyncClose() {
+	pc.l.Lock()
+	defer pc.l.Unlock()
 	pc.singleClose.Do(func() {
 		close(pc.messages)
 		close(pc.errors)
 		pc.consumed = false
+		pc.closed = true
 	})
 }
 
+// reopen creates new channels if the partition consumer was closed and yields
+// the messages and errors that were yielded in the meantime. It returns whether
+// the partition consumer was closed.
+func (pc *MockAutoPartitionConsumer) reopen() bool {
+	pc.l.Lock()
+	defer pc.l.Unlock()
+	if !pc.closed {
+		return false
+	}
+
+	pc.messages = make(chan *sarama.ConsumerMessage, cap(pc.messages))
+	pc.errors = make(chan *sarama.ConsumerError, cap(pc.errors))
+	pc.singleClose = new(sync.Once)
+	pc.closed = false
+
+	for _, msg := range pc.pendingMessages {
+		pc.messages <- msg
+	}
+	for _, err := range pc.pendingErrors {
+		pc.errors <- err
+	}
+	pc.pendingMessages = nil
+	pc.pendingErrors = nil
+	return true
+}
+
 // Close implements the Close method from the sarama.PartitionConsumer interface. It will
 // verify whether the partition consumer was actually started.
 func (pc *MockAutoPartitionConsumer) Close() error {
@@ -238,6 +277,7 @@ func (pc *MockAutoPartitionConsumer) Close() error {
 	}
 
 	pc.AsyncClose()
+	errors, messages := pc.Errors(), pc.Messages()
 
 	var (
 		closeErr error
@@ -249,7 +289,7 @@ func (pc *MockAutoPartitionConsumer) Close() error {
 		defer wg.Done()
 
 		var errs = make(sarama.ConsumerErrors, 0)
-		for err := range pc.errors {
+		for err := range errors {
 			errs = append(errs, err)
 		}
 
@@ -261,7 +301,7 @@ func (pc *MockAutoPartitionConsumer) Close() error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		for range pc.messages {
+		for range messages {
 			// drain
 		}
 	}()
@@ -272,11 +312,15 @@ func (pc *MockAutoPartitionConsumer) Close() error {
 
 // Errors implements the Errors method from the sarama.PartitionConsumer interface.
 func (pc *MockAutoPartitionConsumer) Errors() <-chan *sarama.ConsumerError {
+	pc.l.Lock()
+	defer pc.l.Unlock()
 	return pc.errors
 }
 
 // Messages implements the Messages method from the sarama.PartitionConsumer interface.
 func (pc *MockAutoPartitionConsumer) Messages() <-chan *sarama.ConsumerMessage {
+	pc.l.Lock()
+	defer pc.l.Unlock()
 	return pc.messages
 }
 
@@ -303,6 +347,10 @@ func (pc *MockAutoPartitionConsumer) YieldMessage(msg *sarama.ConsumerMessage) {
 	msg.Offset = atomic.LoadInt64(&pc.highWaterMarkOffset)
 	atomic.AddInt64(&pc.highWaterMarkOffset, 1)
 
+	if pc.closed {
+		pc.pendingMessages = append(pc.pendingMessages, msg)
+		return
+	}
 	pc.messages <- msg
 }
 
@@ -311,12 +359,23 @@ func (pc *MockAutoPartitionConsumer) YieldMessage(msg *sarama.ConsumerMessage) {
 // consumed from the Errors channel, because there are legitimate reasons for this
 // not to happen. You can call ExpectErrorsDrainedOnClose so it will verify that
 // the channel is empty on close.
+// Messages and errors yielded after the partition consumer was closed, e.g.
+// because a partition table handles the error by reconnecting, are yielded once
+// the partition is consumed again.
 func (pc *MockAutoPartitionConsumer) YieldError(err error) {
-	pc.errors <- &sarama.ConsumerError{
+	pc.l.Lock()
+	defer pc.l.Unlock()
+
+	consErr := &sarama.ConsumerError{
 		Topic:     pc.topic,
 		Partition: pc.partition,
 		Err:       err,
 	}
+	if pc.closed {
+		pc.pendingErrors = append(pc.pendingErrors, consErr)
+		return
+	}
+	pc.errors <- consErr
 }
 
 // ExpectMessagesDrainedOnClose sets an expectation on the partition consumer
@@ -435,9 +494,8 @@ func (cgs *MockConsumerGroupSession) MarkOffset(topic string, partition int32, o
 	panic("not implemented")
 }
 
-// Commit the offset to the backend
+// Commit the offset to the backend. The mock has no backend, so it does nothing.
 func (cgs *MockConsumerGroupSession) Commit() {
-	panic("not implemented")
 }
 
 // ResetOffset resets the offset to be consumed from
@@ -104,6 +104,35 @@ func (mr *MockTopicManagerMockRecorder) GetOffset(arg0, arg1, arg2 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOffset", reflect.TypeOf((*MockTopicManager)(nil).GetOffset), arg0, arg1, arg2)
 }
 
+// TopicConfig mocks base method
+func (m *MockTopicManager) TopicConfig(arg0 string) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TopicConfig", arg0)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TopicConfig indicates an expected call of TopicConfig
+func (mr *MockTopicManagerMockRecorder) TopicConfig(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TopicConfig", reflect.TypeOf((*MockTopicManager)(nil).TopicConfig), arg0)
+}
+
+// UpdateTopicConfig mocks base method
+func (m *MockTopicManager) UpdateTopicConfig(arg0 string, arg1 map[string]string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateTopicConfig", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateTopicConfig indicates an expected call of UpdateTopicConfig
+func (mr *MockTopicManagerMockRecorder) UpdateTopicConfig(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateTopicConfig", reflect.TypeOf((*MockTopicManager)(nil).UpdateTopicConfig), arg0, arg1)
+}
+
 // Partitions mocks base method
 func (m *MockTopicManager) Partitions(arg0 string) ([]int32, error) {
 	m.ctrl.T.Helper()
@@ -251,6 +280,36 @@ func (mr *MockBrokerMockRecorder) CreateTopics(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTopics", reflect.TypeOf((*MockBroker)(nil).CreateTopics), arg0)
 }
 
+// DescribeConfigs mocks base method
+func (m *MockBroker) DescribeConfigs(arg0 *sarama.DescribeConfigsRequest) (*sarama.DescribeConfigsResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DescribeConfigs", arg0)
+	ret0, _ := ret[0].(*sarama.DescribeConfigsResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DescribeConfigs indicates an expected call of DescribeConfigs
+func (mr *MockBrokerMockRecorder) DescribeConfigs(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DescribeConfigs", reflect.TypeOf((*MockBroker)(nil).DescribeConfigs), arg0)
+}
+
+// AlterConfigs mocks base method
+func (m *MockBroker) AlterConfigs(arg0 *sarama.AlterConfigsRequest) (*sarama.AlterConfigsResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AlterConfigs", arg0)
+	ret0, _ := ret[0].(*sarama.AlterConfigsResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AlterConfigs indicates an expected call of AlterConfigs
+func (mr *MockBrokerMockRecorder) AlterConfigs(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AlterConfigs", reflect.TypeOf((*MockBroker)(nil).AlterConfigs), arg0)
+}
+
 // Open mocks base method
 func (m *MockBroker) Open(arg0 *sarama.Config) error {
 	m.ctrl.T.Helper()
@@ -136,6 +136,20 @@ func (mr *MockStorageMockRecorder) IteratorWithRange(arg0, arg1 interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IteratorWithRange", reflect.TypeOf((*MockStorage)(nil).IteratorWithRange), arg0, arg1)
 }
 
+// Sync mocks base method
+func (m *MockStorage) Sync() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Sync")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Sync indicates an expected call of Sync
+func (mr *MockStorageMockRecorder) Sync() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Sync", reflect.TypeOf((*MockStorage)(nil).Sync))
+}
+
 // MarkRecovered mocks base method
 func (m *MockStorage) MarkRecovered() error {
 	m.ctrl.T.Helper()
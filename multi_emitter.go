@@ -0,0 +1,117 @@
+package goka
+
+import (
+	"fmt"
+)
+
+// MultiEmitter emits messages into multiple topics sharing a single producer.
+// Each message is encoded with the codec registered for its topic.
+type MultiEmitter struct {
+	producer Producer
+	emitters map[Stream]*Emitter
+	hold     *emitHold
+}
+
+// NewMultiEmitter creates a new emitter for all topics in codecs using passed
+// brokers and possibly options. The options are applied once per topic.
+func NewMultiEmitter(brokers []string, codecs map[Stream]Codec, options ...EmitterOption) (*MultiEmitter, error) {
+	if len(codecs) == 0 {
+		return nil, fmt.Errorf("multi emitter needs at least one topic")
+	}
+
+	options = append(
+		// default options comes first
+		[]EmitterOption{
+			WithEmitterClientID("goka-multi-emitter"),
+		},
+
+		// user-defined options (may overwrite default ones)
+		options...,
+	)
+
+	opts := new(eoptions)
+	for topic, codec := range codecs {
+		if codec == nil {
+			return nil, fmt.Errorf("no codec for topic %s", topic)
+		}
+		opts.applyOptions(topic, codec, options...)
+	}
+
+	prod, err := opts.builders.producer(brokers, opts.clientID, opts.hasher)
+	if err != nil {
+		return nil, fmt.Errorf(errBuildProducer, err)
+	}
+
+	me := &MultiEmitter{
+		producer: prod,
+		emitters: make(map[Stream]*Emitter, len(codecs)),
+		hold:     newEmitHold(opts.holdBufferSize, opts.holdTimeout),
+	}
+	for topic, codec := range codecs {
+		me.emitters[topic] = &Emitter{
+			codec:    codec,
+			producer: prod,
+			topic:    string(topic),
+			hold:     me.hold,
+			done:     make(chan struct{}),
+		}
+	}
+	return me, nil
+}
+
+func (me *MultiEmitter) emitter(topic Stream) (*Emitter, error) {
+	e, ok := me.emitters[topic]
+	if !ok {
+		return nil, fmt.Errorf("topic %s is not registered in the multi emitter", topic)
+	}
+	return e, nil
+}
+
+// EmitWithHeaders sends a message with the given headers for the passed key to
+// topic using the topic's codec.
+func (me *MultiEmitter) EmitWithHeaders(topic Stream, key string, msg interface{}, headers map[string][]byte) (*Promise, error) {
+	e, err := me.emitter(topic)
+	if err != nil {
+		return nil, err
+	}
+	return e.EmitWithHeaders(key, msg, headers)
+}
+
+// Emit sends a message for passed key to topic using the topic's codec.
+func (me *MultiEmitter) Emit(topic Stream, key string, msg interface{}) (*Promise, error) {
+	return me.EmitWithHeaders(topic, key, msg, nil)
+}
+
+// EmitSync sends a message for passed key to topic and waits until it is
+// acknowledged or failed.
+func (me *MultiEmitter) EmitSync(topic Stream, key string, msg interface{}) error {
+	e, err := me.emitter(topic)
+	if err != nil {
+		return err
+	}
+	return e.EmitSync(key, msg)
+}
+
+// QueueDepth returns the number of messages buffered in the shared producer
+// awaiting the broker's acknowledgement, see Emitter.QueueDepth.
+func (me *MultiEmitter) QueueDepth() int {
+	return producerQueueDepth(me.producer)
+}
+
+// Hold pauses emitting to all topics, see Emitter.Hold.
+func (me *MultiEmitter) Hold() {
+	me.hold.hold()
+}
+
+// Release sends all messages buffered since Hold and resumes emitting.
+func (me *MultiEmitter) Release() {
+	me.hold.release()
+}
+
+// Finish waits until all pending messages are produced and closes the producer.
+func (me *MultiEmitter) Finish() error {
+	for _, e := range me.emitters {
+		e.stop()
+	}
+	return me.producer.Close()
+}
@@ -0,0 +1,52 @@
+package goka
+
+import (
+	"testing"
+
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestMultiEmitter(t *testing.T) {
+	t.Run("succeed", func(t *testing.T) {
+		ctrl := NewMockController(t)
+		defer ctrl.Finish()
+		bm := newBuilderMock(ctrl)
+
+		emitter, err := NewMultiEmitter(emitterTestBrokers, map[Stream]Codec{
+			"ints":    new(codec.Int64),
+			"strings": new(codec.String),
+		}, WithEmitterProducerBuilder(bm.getProducerBuilder()))
+		test.AssertNil(t, err)
+
+		bm.producer.EXPECT().Emit("ints", "key", []byte("1312")).Return(NewPromise().Finish(nil, nil))
+		bm.producer.EXPECT().Emit("strings", "key", []byte("value")).Return(NewPromise().Finish(nil, nil))
+		test.AssertNil(t, emitter.EmitSync("ints", "key", int64(1312)))
+		test.AssertNil(t, emitter.EmitSync("strings", "key", "value"))
+
+		// the topic's codec is used
+		_, err = emitter.Emit("ints", "key", "value")
+		test.AssertNotNil(t, err)
+
+		bm.producer.EXPECT().Close().Return(nil)
+		test.AssertNil(t, emitter.Finish())
+	})
+	t.Run("fail_unknown_topic", func(t *testing.T) {
+		ctrl := NewMockController(t)
+		defer ctrl.Finish()
+		bm := newBuilderMock(ctrl)
+
+		emitter, err := NewMultiEmitter(emitterTestBrokers, map[Stream]Codec{
+			"ints": new(codec.Int64),
+		}, WithEmitterProducerBuilder(bm.getProducerBuilder()))
+		test.AssertNil(t, err)
+
+		_, err = emitter.Emit("unknown", "key", int64(1))
+		test.AssertNotNil(t, err)
+		test.AssertStringContains(t, err.Error(), "unknown")
+	})
+	t.Run("fail_no_topics", func(t *testing.T) {
+		_, err := NewMultiEmitter(emitterTestBrokers, nil)
+		test.AssertNotNil(t, err)
+	})
+}
@@ -2,6 +2,7 @@ package multierr
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 
@@ -42,3 +43,15 @@ func TestErrGroup_Go(t *testing.T) {
 	test.AssertNotNil(t, ctx.Err())
 	test.AssertStringContains(t, ctx.Err().Error(), "context canceled")
 }
+
+func TestErrors_Is(t *testing.T) {
+	target := errors.New("target")
+
+	errs := new(Errors)
+	test.AssertFalse(t, errors.Is(errs, target))
+
+	errs.Collect(fmt.Errorf("other"))
+	errs.Collect(fmt.Errorf("wrapped: %w", target))
+	test.AssertTrue(t, errors.Is(errs.NilOrError(), target))
+	test.AssertFalse(t, errors.Is(errs, errors.New("target")))
+}
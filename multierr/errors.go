@@ -1,6 +1,7 @@
 package multierr
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 )
@@ -57,6 +58,18 @@ func (e *Errors) Error() string {
 	return str
 }
 
+// Is reports whether any of the collected errors matches target (see errors.Is).
+func (e *Errors) Is(target error) bool {
+	e.m.Lock()
+	defer e.m.Unlock()
+	for _, err := range e.errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
 func (e *Errors) NilOrError() error {
 	if e.HasErrors() {
 		return e
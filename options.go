@@ -11,15 +11,38 @@ import (
 	"github.com/Shopify/sarama"
 	"github.com/lovoo/goka/logger"
 	"github.com/lovoo/goka/storage"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 )
 
 // UpdateCallback is invoked upon arrival of a message for a table partition.
 // The partition storage shall be updated in the callback.
 type UpdateCallback func(s storage.Storage, partition int32, key string, value []byte) error
 
+// DurableUpdateCallback is an UpdateCallback with side effects outside the
+// local storage that become durable asynchronously. It calls durable once the
+// side effects of the message are durable.
+type DurableUpdateCallback func(s storage.Storage, partition int32, key string, value []byte, durable func()) error
+
 // RebalanceCallback is invoked when the processor receives a new partition assignment.
 type RebalanceCallback func(a Assignment)
 
+// RebalanceEvent describes the partitions assigned to or revoked from the
+// processor in a generation of the consumer group, see WithRebalanceObserver.
+type RebalanceEvent struct {
+	// GenerationID is the generation of the consumer group session.
+	GenerationID int32
+	// Assigned contains the partitions assigned at the start of the session.
+	Assigned []int32
+	// Revoked contains the partitions revoked at the end of the session.
+	Revoked []int32
+}
+
+// RebalanceObserver is invoked when partitions are assigned to or revoked from
+// the processor.
+type RebalanceObserver func(ev RebalanceEvent)
+
 ///////////////////////////////////////////////////////////////////////////////
 // default values
 ///////////////////////////////////////////////////////////////////////////////
@@ -28,6 +51,9 @@ const (
 	defaultBaseStoragePath = "/tmp/goka"
 	defaultClientID        = "goka"
 	defaultBackoffRestTime = time.Minute
+
+	defaultHoldBufferSize = 10000
+	defaultHoldTimeout    = 30 * time.Second
 )
 
 // DefaultProcessorStoragePath is the default path where processor state
@@ -54,6 +80,34 @@ func DefaultUpdate(s storage.Storage, partition int32, key string, value []byte)
 	return s.Set(key, value)
 }
 
+// UpdateWithMerge returns an update callback that stores the result of merging
+// the stored and the received value of a key instead of overwriting it, e.g.
+// to keep the maximum of a counter if messages are replayed out of order. merge
+// is called with a nil old value if the key is not stored. Deletes are applied
+// without calling merge.
+//
+// The updates of a partition are applied one after another, so no other update
+// of the partition happens between reading the stored value and writing the
+// merged one. Concurrent reads like View.Get see either the old or the merged
+// value.
+func UpdateWithMerge(merge func(old, new []byte) ([]byte, error)) UpdateCallback {
+	return func(s storage.Storage, partition int32, key string, value []byte) error {
+		if value == nil {
+			return s.Delete(key)
+		}
+
+		old, err := s.Get(key)
+		if err != nil {
+			return fmt.Errorf("error reading value to merge (key %s): %v", key, err)
+		}
+		merged, err := merge(old, value)
+		if err != nil {
+			return fmt.Errorf("error merging value (key %s): %v", key, err)
+		}
+		return s.Set(key, merged)
+	}
+}
+
 // DefaultRebalance is the default callback when a new partition assignment is received.
 // DefaultRebalance can be used in the function passed to WithRebalanceCallback.
 func DefaultRebalance(a Assignment) {}
@@ -80,10 +134,39 @@ type poptions struct {
 
 	updateCallback       UpdateCallback
 	rebalanceCallback    RebalanceCallback
+	rebalanceObserver    RebalanceObserver
 	partitionChannelSize int
 	hasher               func() hash.Hash32
 	nilHandling          NilHandling
+	deliverySemantics    DeliverySemantics
+	producerFlush        producerFlush
+	rebalanceStrategy    sarama.BalanceStrategy
 	backoffResetTime     time.Duration
+	readinessCheck       func() error
+	partitionRestart     *PartitionRestartPolicy
+	holdBufferSize       int
+	holdTimeout          time.Duration
+	commitObserver       func(topic string, partition int32, offset int64)
+	commitOnRevoke       bool
+	emitConcurrency      map[Stream]int
+	inputRateLimit       *inputRateLimit
+	heartbeatKey         string
+	heartbeatInterval    time.Duration
+	delayTickTopic       string
+	delayTickInterval    time.Duration
+	tableKeyTTL          time.Duration
+	shutdownDrainTimeout time.Duration
+	clock                Clock
+	eventTimeBounds      *eventTimeBounds
+	storageWritePolicy   *storageWritePolicy
+	storageValueEncode   storage.ValueTransform
+	storageValueDecode   storage.ValueTransform
+	storageOpenAttempts  int
+	storageOpenBackoff   func(attempt int) time.Duration
+	deadLetter           *deadLetter
+	joinMissPolicy       *JoinMissPolicy
+	otelMeter            metric.Meter
+	tracer               trace.Tracer
 
 	builders struct {
 		storage        storage.Builder
@@ -138,6 +221,48 @@ func WithConsumerSaramaBuilder(cgb SaramaConsumerBuilder) ProcessorOption {
 	}
 }
 
+// WithProducerFlushFrequency sets the interval in which the processor's producer
+// sends its batched messages (sarama's Producer.Flush.Frequency).
+// The flush options have no effect when the producer builder is replaced.
+func WithProducerFlushFrequency(frequency time.Duration) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.producerFlush.frequency = frequency
+	}
+}
+
+// WithProducerFlushBytes sets the size in bytes at which the processor's producer
+// sends its batched messages (sarama's Producer.Flush.Bytes).
+// The flush options have no effect when the producer builder is replaced.
+func WithProducerFlushBytes(bytes int) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.producerFlush.bytes = bytes
+	}
+}
+
+// WithProducerFlushMessages sets the number of messages at which the processor's
+// producer sends its batched messages (sarama's Producer.Flush.Messages).
+// The flush options have no effect when the producer builder is replaced.
+func WithProducerFlushMessages(messages int) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.producerFlush.messages = messages
+	}
+}
+
+// WithRebalanceStrategy sets the strategy assigning the partitions to the
+// instances of the processor's group (sarama's Consumer.Group.Rebalance.Strategy),
+// e.g. sarama.BalanceStrategyRange, sarama.BalanceStrategyRoundRobin,
+// sarama.BalanceStrategySticky, CopartitioningStickyStrategy or a custom one.
+// By default, the strategy of the global config is used (CopartitioningStrategy).
+// Note that a processor with inputs or joins of multiple topics needs a strategy
+// assigning the same partitions of all topics to an instance, like the
+// copartitioning strategies. All instances of a group must use the same strategy.
+// The option has no effect when the consumer group builder is replaced.
+func WithRebalanceStrategy(strategy sarama.BalanceStrategy) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.rebalanceStrategy = strategy
+	}
+}
+
 // WithProducerBuilder replaces the default producer builder.
 func WithProducerBuilder(pb ProducerBuilder) ProcessorOption {
 	return func(o *poptions, gg *GroupGraph) {
@@ -161,6 +286,154 @@ func WithPartitionChannelSize(size int) ProcessorOption {
 	}
 }
 
+// WithHoldBuffer configures the buffer used for emits while the processor is on
+// hold (see Processor.Hold). If the buffer is full, emitting blocks the callback
+// until the buffer has space again or timeout expires, which fails the emit.
+// The buffer is sent when the partitions are revoked, even if still on hold.
+// The defaults are 10000 messages and 30 seconds.
+func WithHoldBuffer(size int, timeout time.Duration) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.holdBufferSize = size
+		o.holdTimeout = timeout
+	}
+}
+
+// WithCommitObserver sets a function that is called whenever the processor commits
+// the offset of an input message, i.e. after the message was processed and all
+// its emits succeeded. The passed offset is the committed offset, which is the
+// offset of the next message to be consumed.
+// This allows to track the commit progress of the processor, e.g. to detect
+// stalled commits independently from the lag.
+// The observer is called from the partition processors' goroutines, so it has
+// to be thread-safe and should return quickly.
+func WithCommitObserver(observer func(topic string, partition int32, offset int64)) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.commitObserver = observer
+	}
+}
+
+// WithCommitOnRevoke makes the processor commit the offsets of its partitions
+// synchronously when they are revoked during a rebalance or on shutdown.
+// The partition processors finish their in-flight callbacks and emits before
+// the commit, so the new owner of a partition continues right after the
+// last processed message instead of at the last auto-committed offset, which
+// reduces the messages processed twice.
+// By default, the offsets are committed in the interval of the sarama config
+// (Consumer.Offsets.AutoCommit.Interval).
+func WithCommitOnRevoke(commit bool) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.commitOnRevoke = commit
+	}
+}
+
+// WithEmitConcurrencyPerTopic limits the number of in-flight emits to each of
+// the passed topics, e.g. to protect a slow downstream topic without throttling
+// the emits to the other topics. The limits are shared by all partitions of
+// the processor. Emitting to a topic that reached its limit blocks the
+// callback until an emit to the topic finished or the partition is stopped.
+// The numbers of in-flight emits are exposed in ProcessorStats.EmitsInFlight.
+func WithEmitConcurrencyPerTopic(limits map[Stream]int) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.emitConcurrency = limits
+	}
+}
+
+// WithInputRateLimit limits the rate of input messages passed to the callbacks
+// to r messages per second with bursts of at most burst messages, e.g. to
+// protect a downstream service. The limit is shared by all partitions of the
+// processor. The limiter only engages once a partition is recovered, so the
+// recovery of the tables is not slowed down.
+// Waiting for the limiter is interrupted when the processor is stopped.
+func WithInputRateLimit(r rate.Limit, burst int) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.inputRateLimit = &inputRateLimit{limit: r, burst: burst}
+	}
+}
+
+// WithInputRateLimitPerPartition is like WithInputRateLimit but limits every
+// partition of the processor separately.
+func WithInputRateLimitPerPartition(r rate.Limit, burst int) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.inputRateLimit = &inputRateLimit{limit: r, burst: burst, perPartition: true}
+	}
+}
+
+// WithTableHeartbeat makes every partition processor emit a heartbeat to its
+// partition of the group table in the passed interval, so views of the table
+// advance their offsets and reach the high water mark even if no data is written.
+// The heartbeat is a tombstone (nil value), so it is neither stored by the views
+// nor kept by the compaction of the table. Its key is the passed key with a
+// suffix (".<n>") that makes it hash to the partition, e.g. "heartbeat.3".
+// Note that the heartbeats are visible to the update callbacks of the views
+// and to TableChanges, so the key must not be used for data.
+// An interval <= 0 disables the heartbeats, which is the default. The option has
+// no effect without a group table.
+func WithTableHeartbeat(key string, interval time.Duration) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.heartbeatKey = key
+		o.heartbeatInterval = interval
+	}
+}
+
+// WithDelayTickInterval sets the interval in which a delay scheduler (see
+// NewDelayScheduler) emits the due messages, which defaults to one second.
+// Messages are delivered up to one interval after they are due. The option has
+// no effect on other processors.
+func WithDelayTickInterval(interval time.Duration) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.delayTickInterval = interval
+	}
+}
+
+// WithShutdownDrainTimeout makes the processor drain its in-flight messages
+// when the context passed to Run is cancelled: it stops consuming new messages,
+// waits for the callbacks and their emits to finish for up to timeout and
+// commits the offsets of the finished messages before Run returns. This reduces
+// the messages processed again after a restart.
+// If the in-flight messages are not finished in time, Run returns
+// ErrShutdownDrainTimeout (check with errors.Is). The timeout also bounds
+// waiting for the in-flight messages when partitions are revoked in a
+// rebalance, which defaults to one minute.
+func WithShutdownDrainTimeout(timeout time.Duration) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.shutdownDrainTimeout = timeout
+	}
+}
+
+// WithClock sets the clock the processor reads the time from (see Clock), e.g.
+// the tester's clock to test time-dependent logic deterministically. The clock
+// is used by Context.Now, for the due time of Context.EmitDelayed and the ticks
+// of the delay scheduler, for WithEventTimeBounds, for the expiry of
+// WithTableKeyTTL and for the time of the last restart in the partition stats.
+// Defaults to DefaultClock().
+func WithClock(clock Clock) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.clock = clock
+	}
+}
+
+// WithTableKeyTTL deletes the keys of the group table that were not set (e.g.
+// by ctx.SetValue) within ttl. The keys are deleted like by ctx.Delete, so a
+// tombstone (nil value) is emitted to the table topic and the compaction of the
+// topic removes the key, which keeps the table topic from growing with stale
+// keys.
+// Every partition processor sweeps its partition of the table in an interval of
+// half the ttl once the partition is recovered. A sweep iterates the partition's
+// storage between two input messages like a visit of VisitAllWithStats, so a
+// key being set concurrently is not deleted, but the input messages of the
+// partition are not processed while sweeping.
+// The times the keys were set are kept in memory only, one entry per key of the
+// partition. They are lost when the processor restarts or the partition is
+// revoked, so the keys recovered from the table topic count as set at the first
+// sweep after the recovery and are deleted ttl after that sweep at the earliest.
+// A ttl <= 0 disables the deletion, which is the default. The option has no
+// effect without a group table.
+func WithTableKeyTTL(ttl time.Duration) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.tableKeyTTL = ttl
+	}
+}
+
 // WithLogger sets the logger the processor should use. By default, processors
 // use the standard library logger.
 func WithLogger(log logger.Logger) ProcessorOption {
@@ -191,6 +464,55 @@ func WithBackoffResetTimeout(duration time.Duration) ProcessorOption {
 	}
 }
 
+// WithReadinessCheck adds a check that has to pass in addition to the recovery
+// of the processor for Processor.Ready to return true. This allows to include
+// application specific conditions, e.g. the availability of a downstream
+// dependency, into a single readiness gate.
+func WithReadinessCheck(check func() error) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.readinessCheck = check
+	}
+}
+
+// WithStorageValueCodec transforms the values of the processor's tables at the
+// storage boundary: encode is applied before a value is written to the local
+// storage, decode after it is read. The callbacks and Kafka still see the plain
+// values, which allows e.g. to encrypt the local storage at rest.
+// Keys are stored unmodified.
+func WithStorageValueCodec(encode, decode func(value []byte) ([]byte, error)) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.storageValueEncode = encode
+		o.storageValueDecode = decode
+	}
+}
+
+// WithStorageOpenRetry retries opening a local storage that is locked by another
+// process (see storage.ErrLocked), e.g. by a previous instance that is still
+// shutting down during a rolling restart. The storage is opened up to attempts
+// times, waiting backoff(attempt) between the attempts.
+// Other errors, e.g. corrupted storages (see storage.ErrCorrupted), are not retried.
+func WithStorageOpenRetry(attempts int, backoff func(attempt int) time.Duration) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.storageOpenAttempts = attempts
+		o.storageOpenBackoff = backoff
+	}
+}
+
+// WithPartitionRestart makes the processor restart only a failed partition processor
+// instead of shutting down the whole processor instance.
+// The partition's table and joins are recovered again before the processing resumes, starting
+// with the message that failed (if the failure occurred synchronously in the callback).
+// Messages whose emits failed asynchronously are not reprocessed.
+// Restarts are tracked in the partition stats.
+func WithPartitionRestart(policy PartitionRestartPolicy) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		if policy.Backoff == nil {
+			policy.Backoff = DefaultBackoffBuilder
+		}
+		o.partitionRestart = &policy
+	}
+}
+
 // NilHandling defines how nil messages should be handled by the processor.
 type NilHandling int
 
@@ -211,6 +533,102 @@ func WithNilHandling(nh NilHandling) ProcessorOption {
 	}
 }
 
+// WithDeliverySemantics configures when the processor commits input messages.
+// By default, messages are processed at least once.
+// With AtMostOnce, messages are committed before they are processed and are not
+// retried after a restart (see WithPartitionRestart). Note that the commits are
+// sent to Kafka in the auto-commit interval of the sarama config, so messages
+// committed since the last interval are still processed again if the processor
+// crashes. WithCommitOnRevoke avoids that for rebalances.
+func WithDeliverySemantics(semantics DeliverySemantics) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.deliverySemantics = semantics
+	}
+}
+
+// WithEventTimeBounds rejects input messages whose Kafka timestamp is older than
+// maxLateness or more than maxFuture in the future, before they are passed to the
+// callback. This protects e.g. windowed aggregations from stray timestamps.
+// A zero duration disables the respective bound. Messages without timestamp
+// are always processed.
+// The rejected messages are handled according to policy (EventTimeDrop,
+// EventTimeLog or EventTimeDLQ).
+func WithEventTimeBounds(maxLateness, maxFuture time.Duration, policy EventTimePolicy) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.eventTimeBounds = &eventTimeBounds{
+			maxLateness: maxLateness,
+			maxFuture:   maxFuture,
+			policy:      policy,
+		}
+	}
+}
+
+// WithJoinMissPolicy sets how the processor handles Join and Lookup calls that
+// find no value for the key (JoinMissIgnore, JoinMissDrop, JoinMissDLQ or
+// JoinMissFunc). The policy applies to all joined and lookup tables of the group.
+func WithJoinMissPolicy(policy JoinMissPolicy) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.joinMissPolicy = &policy
+	}
+}
+
+// WithStorageWriteErrorPolicy sets how the processor handles failed writes to the
+// local storage of the group table (StorageWriteFail, StorageWriteDropAndContinue
+// or StorageWriteRetry).
+// The observer is called for every failed write, including each failed retry,
+// e.g. to count the errors. It may be nil.
+func WithStorageWriteErrorPolicy(policy StorageWriteErrorPolicy, observer func(partition int32, key string, err error)) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.storageWritePolicy = &storageWritePolicy{
+			policy:   policy,
+			observer: observer,
+		}
+	}
+}
+
+// WithOtelMeter records the processor's metrics with meter: the number of
+// messages passed to the callbacks (goka.messages.consumed), the duration of
+// the callbacks (goka.processing.duration), the number of updates written into
+// the local storage of the group and joined tables (goka.table.writes), the
+// number of committed messages (goka.offsets.committed) and the offset lag of
+// each input topic and partition (goka.consumer.lag).
+func WithOtelMeter(meter metric.Meter) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.otelMeter = meter
+	}
+}
+
+// WithTracer creates a span (goka.process) with tracer for every message passed
+// to the callbacks. The span carries the group, topic, partition and offset of
+// the message and is the child of the span context propagated in the message's
+// traceparent header. The context passed to the callbacks (Context.Context)
+// carries the span. The table accesses of the callbacks (goka.table.get and
+// goka.table.set) and their emits (goka.emit) create child spans, and the emitted
+// messages propagate the span context of their emit in the traceparent header.
+func WithTracer(tracer trace.Tracer) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.tracer = tracer
+	}
+}
+
+// WithDeadLetter processes a failing input message up to maxAttempts times and
+// then forwards it unmodified to passed topic (a dead letter queue) instead of
+// stopping the processor. A message fails if it cannot be decoded or its
+// callback panics or calls ctx.Fail. The forwarded message carries the input
+// message's headers plus the DeadLetterHeader* headers describing the failure.
+// The input message is committed once the forwarded message is written.
+// Emits and table writes of failed attempts are not rolled back.
+// Asynchronous failures, e.g. of an emit, still stop the processor.
+// Dead letters cannot be combined with AtMostOnce delivery semantics.
+func WithDeadLetter(topic Stream, maxAttempts int) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.deadLetter = &deadLetter{
+			topic:       topic,
+			maxAttempts: maxAttempts,
+		}
+	}
+}
+
 // Tester interface to avoid import cycles when a processor needs to register to
 // the tester.
 type Tester interface {
@@ -244,6 +662,9 @@ func (opt *poptions) applyOptions(gg *GroupGraph, opts ...ProcessorOption) error
 	opt.log = logger.Default()
 	opt.hasher = DefaultHasher()
 	opt.backoffResetTime = defaultBackoffRestTime
+	opt.holdBufferSize = defaultHoldBufferSize
+	opt.holdTimeout = defaultHoldTimeout
+	opt.clock = DefaultClock()
 
 	for _, o := range opts {
 		o(opt, gg)
@@ -254,12 +675,60 @@ func (opt *poptions) applyOptions(gg *GroupGraph, opts ...ProcessorOption) error
 		return fmt.Errorf("StorageBuilder not set")
 	}
 
+	if opt.delayTickTopic != "" && opt.delayTickInterval <= 0 {
+		return fmt.Errorf("delay tick interval must be positive")
+	}
+
+	if opt.storageOpenAttempts > 1 {
+		if opt.storageOpenBackoff == nil {
+			return fmt.Errorf("storage open retry requires a backoff")
+		}
+		opt.builders.storage = storage.RetryBuilder(opt.builders.storage, opt.storageOpenAttempts, opt.storageOpenBackoff)
+	}
+
+	if opt.storageValueEncode != nil || opt.storageValueDecode != nil {
+		if opt.storageValueEncode == nil || opt.storageValueDecode == nil {
+			return fmt.Errorf("storage value codec requires both encode and decode")
+		}
+		opt.builders.storage = storage.TransformBuilder(opt.builders.storage, opt.storageValueEncode, opt.storageValueDecode)
+	}
+
+	for topic, limit := range opt.emitConcurrency {
+		if limit <= 0 {
+			return fmt.Errorf("emit concurrency of topic %s must be positive, got %d", topic, limit)
+		}
+	}
+
+	if opt.inputRateLimit != nil {
+		if opt.inputRateLimit.limit < 0 {
+			return fmt.Errorf("input rate limit must not be negative, got %v", opt.inputRateLimit.limit)
+		}
+		if opt.inputRateLimit.burst <= 0 && opt.inputRateLimit.limit != rate.Inf {
+			return fmt.Errorf("input rate limit burst must be positive, got %d", opt.inputRateLimit.burst)
+		}
+	}
+
+	if opt.deadLetter != nil {
+		if opt.deadLetter.topic == "" {
+			return fmt.Errorf("dead letter topic must not be empty")
+		}
+		if opt.deadLetter.maxAttempts <= 0 {
+			return fmt.Errorf("dead letter attempts must be positive, got %d", opt.deadLetter.maxAttempts)
+		}
+		if opt.deliverySemantics == AtMostOnce {
+			return fmt.Errorf("dead letters cannot be used with at-most-once delivery semantics")
+		}
+	}
+
 	if globalConfig.Producer.RequiredAcks == sarama.NoResponse {
 		return fmt.Errorf("Processors do not work with `Config.Producer.RequiredAcks==sarama.NoResponse`, as it uses the response's offset to store the value")
 	}
 
 	if opt.builders.producer == nil {
 		opt.builders.producer = DefaultProducerBuilder
+		if opt.producerFlush.isSet() {
+			opt.builders.producer = producerBuilderWithFlush(opt.producerFlush)
+		}
 	}
 
 	if opt.builders.topicmgr == nil {
@@ -268,6 +737,9 @@ func (opt *poptions) applyOptions(gg *GroupGraph, opts ...ProcessorOption) error
 
 	if opt.builders.consumerGroup == nil {
 		opt.builders.consumerGroup = DefaultConsumerGroupBuilder
+		if opt.rebalanceStrategy != nil {
+			opt.builders.consumerGroup = consumerGroupBuilderWithStrategy(opt.rebalanceStrategy)
+		}
 	}
 
 	if opt.builders.consumerSarama == nil {
@@ -289,6 +761,19 @@ func WithRebalanceCallback(cb RebalanceCallback) ProcessorOption {
 	}
 }
 
+// WithRebalanceObserver sets the observer of the partition assignment, e.g. to
+// correlate latency spikes with rebalances, warm up caches or flush buffers.
+// The observer is called with the assigned partitions before the processor
+// starts recovering and consuming them, and with the revoked partitions before
+// the processor stops them. Since the partitions are reassigned eagerly, all
+// partitions of a generation are revoked at its end.
+// The observer blocks the rebalance, so it should return quickly.
+func WithRebalanceObserver(observer RebalanceObserver) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.rebalanceObserver = observer
+	}
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 // view options
 ///////////////////////////////////////////////////////////////////////////////
@@ -304,6 +789,33 @@ type voptions struct {
 	hasher           func() hash.Hash32
 	autoreconnect    bool
 	backoffResetTime time.Duration
+	readinessCheck   func() error
+
+	storageValueEncode  storage.ValueTransform
+	storageValueDecode  storage.ValueTransform
+	storageOpenAttempts int
+	storageOpenBackoff  func(attempt int) time.Duration
+	aggregator          *recoveryAggregator
+	timestamps          *recordTimestamps
+	offsetGapCallback   func(partition int32, expected, got int64)
+	recoverFrom         Stream
+	durableUpdate       DurableUpdateCallback
+	diskLimit           *diskLimit
+	offlinePath         string
+	evictCallback       func(key string)
+	getCache            *getCache
+	recoveredCallback   func(partition int32, count int64)
+	storagePathFunc     func(topic string, partition int32) string
+	// whether the storage builder was replaced by WithViewStorageBuilder or WithViewTester
+	customStorage       bool
+	updateTTL           time.Duration
+	recoverConcurrency  int
+	subscribeBufferSize int
+	subscribePolicy     SubscribePolicy
+	autoReset           bool
+	partitioner         Partitioner
+	otelMeter           metric.Meter
+	tester              Tester
 
 	builders struct {
 		storage        storage.Builder
@@ -329,8 +841,119 @@ func WithViewCallback(cb UpdateCallback) ViewOption {
 	}
 }
 
+// WithViewEvictCallback defines a callback that is called after a key was
+// deleted from the view's local storage, either by Evict or by a nil value
+// passed to the update callback while recovering. It is called synchronously
+// after the deletion succeeded, e.g. to invalidate caches on top of the view.
+func WithViewEvictCallback(cb func(key string)) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.evictCallback = cb
+	}
+}
+
+// WithViewRecoveredCallback defines a callback that is called once per
+// partition when it is recovered and can be queried, with the number of
+// messages loaded during the recovery. If the recovery is retried, the count
+// includes the messages loaded by the failed attempts.
+func WithViewRecoveredCallback(cb func(partition int32, count int64)) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.recoveredCallback = cb
+	}
+}
+
+// WithViewStoragePathFunc stores each partition in a LevelDB storage in the
+// directory returned by pathFunc, e.g. to spread the partitions over several
+// disks. It replaces the default storage builder and cannot be combined with
+// WithViewStorageBuilder or WithViewTester.
+func WithViewStoragePathFunc(pathFunc func(topic string, partition int32) string) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.storagePathFunc = pathFunc
+	}
+}
+
+// WithViewUpdateTTL expires the values stored by the view ttl after they were
+// written, even if no tombstone is received from Kafka. Expired values are not
+// visible to Get, Has and the iterators. Storages implementing
+// storage.ExpiringStorage expire the values themselves, for other storages the
+// expiry time is stored with the values. The values written while recovering
+// expire ttl after recovering them, not after producing them.
+func WithViewUpdateTTL(ttl time.Duration) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.updateTTL = ttl
+	}
+}
+
+// WithViewRecoverConcurrency limits the number of partitions recovering at the
+// same time to n, e.g. to bound the disk IO and memory used for the recovery.
+// The other partitions wait until a recovering partition is done. By default,
+// all partitions recover at the same time.
+func WithViewRecoverConcurrency(n int) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.recoverConcurrency = n
+	}
+}
+
+// WithViewSubscribeBuffer sets the size of the channels returned by
+// View.Subscribe (default 100) and what happens to the updates when a
+// subscriber's channel is full.
+func WithViewSubscribeBuffer(size int, policy SubscribePolicy) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.subscribeBufferSize = size
+		o.subscribePolicy = policy
+	}
+}
+
+// WithViewAutoReset defines whether a partition's local storage is reset if the
+// messages following its stored offset were deleted from Kafka, e.g. by the
+// retention, before the view recovered them. The storage may then contain keys
+// whose deletion was never received. If set, all keys are deleted (through the
+// update callback) before recovering from the oldest offset, otherwise a warning
+// is logged.
+func WithViewAutoReset(autoReset bool) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.autoReset = autoReset
+	}
+}
+
+// WithViewPartitioner defines the partitioner used to find the partition of a
+// key, e.g. to read a table produced by a non-goka producer. It takes
+// precedence over WithViewHasher.
+func WithViewPartitioner(partitioner Partitioner) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.partitioner = partitioner
+	}
+}
+
+// WithViewOtelMeter records the view's metrics with meter: the number of updates
+// written into the local storage (goka.table.writes) and the offset lag of
+// each partition (goka.consumer.lag).
+func WithViewOtelMeter(meter metric.Meter) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.otelMeter = meter
+	}
+}
+
+// WithViewGetCache caches up to maxEntries decoded values of View.Get in
+// memory, evicting the least recently used ones. Keys are removed from the
+// cache when the update callback or Evict changes them. The cached values are
+// shared between the callers of Get, so they must not be modified.
+func WithViewGetCache(maxEntries int) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.getCache = newGetCache(maxEntries)
+	}
+}
+
 // WithViewStorageBuilder defines a builder for the storage of each partition.
 func WithViewStorageBuilder(sb storage.Builder) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.builders.storage = sb
+		o.customStorage = true
+	}
+}
+
+// withViewDefaultStorageBuilder sets the storage builder used unless the
+// options replace it.
+func withViewDefaultStorageBuilder(sb storage.Builder) ViewOption {
 	return func(o *voptions, table Table, codec Codec) {
 		o.builders.storage = sb
 	}
@@ -395,14 +1018,108 @@ func WithViewBackoffResetTimeout(duration time.Duration) ViewOption {
 	}
 }
 
+// WithViewReadinessCheck adds a check that has to pass in addition to the recovery
+// of the view for View.Ready to return true.
+func WithViewReadinessCheck(check func() error) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.readinessCheck = check
+	}
+}
+
+// WithViewStorageValueCodec transforms the values of the view's table at the
+// storage boundary. See WithStorageValueCodec.
+func WithViewStorageValueCodec(encode, decode func(value []byte) ([]byte, error)) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.storageValueEncode = encode
+		o.storageValueDecode = decode
+	}
+}
+
+// WithViewStorageOpenRetry retries opening a local storage that is locked by another
+// process. See WithStorageOpenRetry.
+func WithViewStorageOpenRetry(attempts int, backoff func(attempt int) time.Duration) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.storageOpenAttempts = attempts
+		o.storageOpenBackoff = backoff
+	}
+}
+
+// WithViewOffsetGapCallback sets a callback that is called when the view loads a
+// message whose offset is not the expected next offset of the partition, i.e.
+// the offset after the locally stored one or after the previous message.
+// A higher offset indicates lost messages (e.g. by retention or log truncation),
+// a lower offset indicates that the local storage is ahead of the topic.
+// Note that compaction and transaction markers also leave gaps in the offsets,
+// so gaps are expected for compacted tables with a high write rate.
+// The callback is called from the partitions' goroutines, so it has to be
+// thread-safe.
+func WithViewOffsetGapCallback(cb func(partition int32, expected, got int64)) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.offsetGapCallback = cb
+	}
+}
+
+// WithViewDurableUpdateCallback replaces the update callback set with
+// WithViewCallback by a callback that maintains side effects outside the
+// view's storage, e.g. a secondary index in another store. The view advances
+// its locally stored offset only up to the last message whose side effects and
+// those of all previous messages were confirmed by calling durable. Whenever a
+// partition starts loading, e.g. after a crash or when switching from recovery
+// to catching up, it loads the messages after that offset, so the callback is
+// called again for all messages whose side effects were not confirmed and must
+// be idempotent. It cannot be combined with WithViewRecoveryAggregator.
+func WithViewDurableUpdateCallback(cb DurableUpdateCallback) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.durableUpdate = cb
+	}
+}
+
+// WithViewMaxDiskBytes caps the aggregate size of the view's local storages on
+// disk to maxBytes, which is enforced according to policy. The size is checked
+// every 30 seconds once the view is recovered. The storages must implement
+// storage.Sizer and, except for DiskLimitFail, storage.Compacter, which the
+// default LevelDB storage does.
+func WithViewMaxDiskBytes(maxBytes int64, policy DiskLimitPolicy) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.diskLimit = &diskLimit{
+			maxBytes: maxBytes,
+			policy:   policy,
+		}
+	}
+}
+
+// WithViewOfflineStorage makes NewView open the existing local storages in path
+// read-only instead of connecting to Kafka, which is the same as creating the
+// view with NewOfflineView. The partitions are discovered from the storage
+// directories, the brokers passed to NewView are ignored.
+func WithViewOfflineStorage(path string) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.offlinePath = path
+	}
+}
+
+// WithViewRecoverFrom makes the view recover from and keep up with the passed
+// topic instead of the table's topic, e.g. a mirror of the table in another
+// cluster or a backup topic. The view still serves the table, i.e. the storage,
+// stats and logs use the table's name. The topic must have the same number of
+// partitions as the table and be reachable via the brokers passed to NewView.
+// Since the offsets of a mirror differ from the table's, local storages that
+// were recovered from another topic have to be deleted before.
+func WithViewRecoverFrom(stream Stream) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.recoverFrom = stream
+	}
+}
+
 // WithViewTester configures all external connections of a processor, ie, storage,
 // consumer and producer
 func WithViewTester(t Tester) ViewOption {
 	return func(o *voptions, table Table, codec Codec) {
 		o.builders.storage = t.StorageBuilder()
+		o.customStorage = true
 		o.builders.topicmgr = t.TopicManagerBuilder()
 		o.builders.consumerSarama = t.ConsumerBuilder()
-		o.clientID = t.RegisterView(table, codec)
+		o.tester = t
 	}
 }
 
@@ -411,16 +1128,81 @@ func (opt *voptions) applyOptions(topic Table, codec Codec, opts ...ViewOption)
 	opt.log = logger.Default()
 	opt.hasher = DefaultHasher()
 	opt.backoffResetTime = defaultBackoffRestTime
+	opt.subscribeBufferSize = defaultSubscribeBufferSize
 
 	for _, o := range opts {
 		o(opt, topic, codec)
 	}
 
+	// the tester is registered after all options, so it knows the topic set by WithViewRecoverFrom
+	if opt.tester != nil {
+		recoveryTable := topic
+		if opt.recoverFrom != "" {
+			recoveryTable = Table(opt.recoverFrom)
+		}
+		opt.clientID = opt.tester.RegisterView(recoveryTable, codec)
+	}
+
+	if opt.storagePathFunc != nil {
+		if opt.customStorage {
+			return fmt.Errorf("storage path func cannot be combined with a custom storage builder")
+		}
+		opt.builders.storage = storage.PathFuncBuilder(opt.storagePathFunc)
+	}
+
 	// StorageBuilder should always be set as a default option in NewView
 	if opt.builders.storage == nil {
 		return fmt.Errorf("StorageBuilder not set")
 	}
 
+	if opt.storageOpenAttempts > 1 {
+		if opt.storageOpenBackoff == nil {
+			return fmt.Errorf("storage open retry requires a backoff")
+		}
+		opt.builders.storage = storage.RetryBuilder(opt.builders.storage, opt.storageOpenAttempts, opt.storageOpenBackoff)
+	}
+
+	if opt.storageValueEncode != nil || opt.storageValueDecode != nil {
+		if opt.storageValueEncode == nil || opt.storageValueDecode == nil {
+			return fmt.Errorf("storage value codec requires both encode and decode")
+		}
+		opt.builders.storage = storage.TransformBuilder(opt.builders.storage, opt.storageValueEncode, opt.storageValueDecode)
+	}
+
+	if opt.subscribeBufferSize < 0 {
+		return fmt.Errorf("subscribe buffer size must not be negative")
+	}
+
+	if opt.recoverConcurrency < 0 {
+		return fmt.Errorf("recover concurrency must not be negative")
+	}
+
+	if opt.updateTTL < 0 {
+		return fmt.Errorf("update ttl must not be negative")
+	} else if opt.updateTTL > 0 {
+		if opt.getCache != nil {
+			return fmt.Errorf("get cache cannot be combined with an update ttl")
+		}
+		opt.builders.storage = storage.TTLBuilder(opt.builders.storage, opt.updateTTL)
+	}
+
+	if err := opt.getCache.wrapOptions(opt); err != nil {
+		return err
+	}
+
+	if opt.evictCallback != nil {
+		opt.updateCallback = wrapEvictUpdate(opt.updateCallback, opt.evictCallback)
+	}
+
+	opt.diskLimit.wrapOptions(opt)
+
+	// inside the aggregator, so it reads the values without timestamps
+	opt.timestamps.wrapOptions(opt)
+
+	if err := opt.aggregator.wrapOptions(opt); err != nil {
+		return err
+	}
+
 	if opt.builders.consumerSarama == nil {
 		opt.builders.consumerSarama = DefaultSaramaConsumerBuilder
 	}
@@ -451,6 +1233,13 @@ type eoptions struct {
 
 	hasher func() hash.Hash32
 
+	holdBufferSize int
+	holdTimeout    time.Duration
+
+	syncTimeout time.Duration
+
+	producerFlush producerFlush
+
 	builders struct {
 		topicmgr TopicManagerBuilder
 		producer ProducerBuilder
@@ -479,6 +1268,33 @@ func WithEmitterTopicManagerBuilder(tmb TopicManagerBuilder) EmitterOption {
 	}
 }
 
+// WithEmitterProducerFlushFrequency sets the interval in which the emitter's producer
+// sends its batched messages (sarama's Producer.Flush.Frequency).
+// The flush options have no effect when the producer builder is replaced.
+func WithEmitterProducerFlushFrequency(frequency time.Duration) EmitterOption {
+	return func(o *eoptions, topic Stream, codec Codec) {
+		o.producerFlush.frequency = frequency
+	}
+}
+
+// WithEmitterProducerFlushBytes sets the size in bytes at which the emitter's producer
+// sends its batched messages (sarama's Producer.Flush.Bytes).
+// The flush options have no effect when the producer builder is replaced.
+func WithEmitterProducerFlushBytes(bytes int) EmitterOption {
+	return func(o *eoptions, topic Stream, codec Codec) {
+		o.producerFlush.bytes = bytes
+	}
+}
+
+// WithEmitterProducerFlushMessages sets the number of messages at which the emitter's
+// producer sends its batched messages (sarama's Producer.Flush.Messages).
+// The flush options have no effect when the producer builder is replaced.
+func WithEmitterProducerFlushMessages(messages int) EmitterOption {
+	return func(o *eoptions, topic Stream, codec Codec) {
+		o.producerFlush.messages = messages
+	}
+}
+
 // WithEmitterProducerBuilder replaces the default producer builder.
 func WithEmitterProducerBuilder(pb ProducerBuilder) EmitterOption {
 	return func(o *eoptions, topic Stream, codec Codec) {
@@ -493,6 +1309,26 @@ func WithEmitterHasher(hasher func() hash.Hash32) EmitterOption {
 	}
 }
 
+// WithEmitterHoldBuffer configures the buffer used for emits while the emitter is
+// on hold (see Emitter.Hold). If the buffer is full, Emit blocks until the buffer
+// has space again or timeout expires, which fails the emit with ErrHoldBufferFull.
+// The defaults are 10000 messages and 30 seconds.
+func WithEmitterHoldBuffer(size int, timeout time.Duration) EmitterOption {
+	return func(o *eoptions, topic Stream, codec Codec) {
+		o.holdBufferSize = size
+		o.holdTimeout = timeout
+	}
+}
+
+// WithEmitterSyncTimeout sets the maximum time EmitSync and EmitSyncWithHeaders wait
+// for the broker's acknowledgement. If it expires, they return ErrEmitSyncTimeout,
+// but the message may still be sent. By default, they wait without timeout.
+func WithEmitterSyncTimeout(timeout time.Duration) EmitterOption {
+	return func(o *eoptions, topic Stream, codec Codec) {
+		o.syncTimeout = timeout
+	}
+}
+
 // WithEmitterTester configures the emitter to use passed tester.
 // This is used for component tests
 func WithEmitterTester(t Tester) EmitterOption {
@@ -506,6 +1342,8 @@ func (opt *eoptions) applyOptions(topic Stream, codec Codec, opts ...EmitterOpti
 	opt.clientID = defaultClientID
 	opt.log = logger.Default()
 	opt.hasher = DefaultHasher()
+	opt.holdBufferSize = defaultHoldBufferSize
+	opt.holdTimeout = defaultHoldTimeout
 
 	for _, o := range opts {
 		o(opt, topic, codec)
@@ -514,6 +1352,9 @@ func (opt *eoptions) applyOptions(topic Stream, codec Codec, opts ...EmitterOpti
 	// config not set, use default one
 	if opt.builders.producer == nil {
 		opt.builders.producer = DefaultProducerBuilder
+		if opt.producerFlush.isSet() {
+			opt.builders.producer = producerBuilderWithFlush(opt.producerFlush)
+		}
 	}
 	if opt.builders.topicmgr == nil {
 		opt.builders.topicmgr = DefaultTopicManagerBuilder
@@ -1,11 +1,20 @@
 package goka
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"regexp"
 	"testing"
+	"time"
 
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/codec"
 	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/logger"
 	"github.com/lovoo/goka/storage"
 )
 
@@ -27,3 +36,192 @@ func newMockOptions(t *testing.T) *poptions {
 	fmt.Printf("%+v\n", opts)
 	return opts
 }
+
+func TestOptions_eventTimeBounds(t *testing.T) {
+	var (
+		now    = time.Now()
+		bounds = &eventTimeBounds{
+			maxLateness: time.Hour,
+			maxFuture:   time.Minute,
+		}
+	)
+
+	test.AssertTrue(t, bounds.inBounds(time.Time{}, now))
+	test.AssertTrue(t, bounds.inBounds(now, now))
+	test.AssertTrue(t, bounds.inBounds(now.Add(-59*time.Minute), now))
+	test.AssertFalse(t, bounds.inBounds(now.Add(-61*time.Minute), now))
+	test.AssertTrue(t, bounds.inBounds(now.Add(59*time.Second), now))
+	test.AssertFalse(t, bounds.inBounds(now.Add(61*time.Second), now))
+
+	// zero disables the bound
+	bounds.maxLateness = 0
+	test.AssertTrue(t, bounds.inBounds(now.Add(-24*time.Hour), now))
+}
+
+func TestOptions_deadLetter(t *testing.T) {
+	apply := func(opts ...ProcessorOption) error {
+		return new(poptions).applyOptions(new(GroupGraph), append([]ProcessorOption{WithStorageBuilder(nullStorageBuilder())}, opts...)...)
+	}
+
+	test.AssertNil(t, apply(WithDeadLetter("dlq", 1)))
+	test.AssertNotNil(t, apply(WithDeadLetter("", 1)))
+	test.AssertNotNil(t, apply(WithDeadLetter("dlq", 0)))
+	test.AssertNotNil(t, apply(WithDeadLetter("dlq", 1), WithDeliverySemantics(AtMostOnce)))
+}
+
+func TestOptions_storageWriteErrorPolicy(t *testing.T) {
+	newProc := func(policy StorageWriteErrorPolicy, observed *int) *PartitionProcessor {
+		opts := new(poptions)
+		WithStorageWriteErrorPolicy(policy, func(partition int32, key string, err error) {
+			*observed++
+		})(opts, nil)
+		return &PartitionProcessor{opts: opts, log: logger.Default()}
+	}
+	// write fails the first n times
+	failing := func(n int) func() error {
+		return func() error {
+			if n > 0 {
+				n--
+				return errors.New("no space left on device")
+			}
+			return nil
+		}
+	}
+	backoff := func() (Backoff, error) {
+		return &simpleBackoff{step: time.Millisecond}, nil
+	}
+	ctx := context.Background()
+
+	var observed int
+	pp := newProc(StorageWriteFail, &observed)
+	test.AssertNotNil(t, pp.writeStorage(ctx, "key", failing(1)))
+	test.AssertEqual(t, observed, 1)
+
+	observed = 0
+	pp = newProc(StorageWriteDropAndContinue, &observed)
+	test.AssertNil(t, pp.writeStorage(ctx, "key", failing(1)))
+	test.AssertEqual(t, observed, 1)
+
+	observed = 0
+	pp = newProc(StorageWriteRetry(3, backoff), &observed)
+	test.AssertNil(t, pp.writeStorage(ctx, "key", failing(3)))
+	test.AssertEqual(t, observed, 3)
+
+	observed = 0
+	test.AssertNotNil(t, pp.writeStorage(ctx, "key", failing(4)))
+	test.AssertEqual(t, observed, 4)
+
+	// without policy the error is returned
+	pp = &PartitionProcessor{opts: new(poptions)}
+	test.AssertNotNil(t, pp.writeStorage(ctx, "key", failing(1)))
+	test.AssertNil(t, pp.writeStorage(ctx, "key", failing(0)))
+}
+
+func TestOptions_producerFlush(t *testing.T) {
+	opts := new(eoptions)
+	opts.applyOptions("topic", new(codec.String),
+		WithEmitterProducerFlushFrequency(time.Second),
+		WithEmitterProducerFlushMessages(100),
+	)
+	test.AssertEqual(t, opts.producerFlush, producerFlush{frequency: time.Second, messages: 100})
+
+	config := DefaultConfig()
+	config.Producer.Flush.Bytes = 1024
+	opts.producerFlush.apply(config)
+	test.AssertEqual(t, config.Producer.Flush.Frequency, time.Second)
+	test.AssertEqual(t, config.Producer.Flush.Messages, 100)
+	// unset values keep the config's settings
+	test.AssertEqual(t, config.Producer.Flush.Bytes, 1024)
+}
+
+func TestOptions_rebalanceStrategy(t *testing.T) {
+	opts := new(poptions)
+	err := opts.applyOptions(new(GroupGraph),
+		WithStorageBuilder(nullStorageBuilder()),
+		WithRebalanceStrategy(sarama.BalanceStrategySticky),
+	)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, opts.rebalanceStrategy, sarama.BalanceStrategySticky)
+	test.AssertNotNil(t, opts.builders.consumerGroup)
+
+	// a replaced consumer group builder is kept
+	var built bool
+	opts = new(poptions)
+	err = opts.applyOptions(new(GroupGraph),
+		WithStorageBuilder(nullStorageBuilder()),
+		WithRebalanceStrategy(sarama.BalanceStrategySticky),
+		WithConsumerGroupBuilder(func(brokers []string, group, clientID string) (sarama.ConsumerGroup, error) {
+			built = true
+			return nil, nil
+		}),
+	)
+	test.AssertNil(t, err)
+	_, err = opts.builders.consumerGroup(nil, "group", "client")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, built)
+}
+
+func TestOptions_UpdateWithMerge(t *testing.T) {
+	max := UpdateWithMerge(func(old, new []byte) ([]byte, error) {
+		if string(old) > string(new) {
+			return old, nil
+		}
+		return new, nil
+	})
+	st := storage.NewMemory()
+
+	get := func() []byte {
+		value, err := st.Get("key")
+		test.AssertNil(t, err)
+		return value
+	}
+
+	test.AssertNil(t, max(st, 0, "key", []byte("2")))
+	test.AssertEqual(t, get(), []byte("2"))
+	test.AssertNil(t, max(st, 0, "key", []byte("1")))
+	test.AssertEqual(t, get(), []byte("2"))
+	test.AssertNil(t, max(st, 0, "key", []byte("3")))
+	test.AssertEqual(t, get(), []byte("3"))
+	test.AssertNil(t, max(st, 0, "key", nil))
+	test.AssertNil(t, get())
+
+	failing := UpdateWithMerge(func(old, new []byte) ([]byte, error) {
+		return nil, errors.New("merge error")
+	})
+	test.AssertNotNil(t, failing(st, 0, "key", []byte("1")))
+}
+
+func TestOptions_viewStoragePathFunc(t *testing.T) {
+	path, err := ioutil.TempDir("", "goka_storage_path_func_")
+	test.AssertNil(t, err)
+	defer os.RemoveAll(path)
+
+	pathFunc := func(topic string, partition int32) string {
+		return filepath.Join(path, fmt.Sprintf("disk-%d", partition%2))
+	}
+
+	// the path func can't replace a custom storage builder
+	err = new(voptions).applyOptions("table", new(codec.String),
+		WithViewStoragePathFunc(pathFunc),
+		WithViewStorageBuilder(storage.MemoryBuilder()),
+	)
+	test.AssertError(t, err, regexp.MustCompile("custom storage builder$"))
+
+	opts := new(voptions)
+	err = opts.applyOptions("table", new(codec.String),
+		withViewDefaultStorageBuilder(storage.MemoryBuilder()),
+		WithViewStoragePathFunc(pathFunc),
+	)
+	test.AssertNil(t, err)
+
+	for partition := int32(0); partition < 3; partition++ {
+		st, err := opts.builders.storage("table", partition)
+		test.AssertNil(t, err)
+		test.AssertNil(t, st.Close())
+	}
+
+	for _, dir := range []string{"disk-0/table.0", "disk-1/table.1", "disk-0/table.2"} {
+		_, err := os.Stat(filepath.Join(path, dir))
+		test.AssertNil(t, err)
+	}
+}
@@ -0,0 +1,122 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lovoo/goka/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// names of the instruments recorded with WithOtelMeter and WithViewOtelMeter
+const (
+	otelMessagesConsumed   = "goka.messages.consumed"
+	otelProcessingDuration = "goka.processing.duration"
+	otelTableWrites        = "goka.table.writes"
+	otelOffsetsCommitted   = "goka.offsets.committed"
+	otelConsumerLag        = "goka.consumer.lag"
+)
+
+// lagFunc returns the offset lag per topic and partition.
+type lagFunc func(ctx context.Context) map[string]map[int32]int64
+
+// otelMetrics records the metrics of a processor or view. All methods are
+// no-ops on a nil *otelMetrics, i.e. if no meter is configured.
+type otelMetrics struct {
+	// identifies the processor (goka.group) or view (goka.table)
+	owner attribute.KeyValue
+
+	consumed  metric.Int64Counter
+	duration  metric.Float64Histogram
+	writes    metric.Int64Counter
+	committed metric.Int64Counter
+}
+
+func newOtelMetrics(meter metric.Meter, owner attribute.KeyValue, lag lagFunc) (*otelMetrics, error) {
+	if meter == nil {
+		return nil, nil
+	}
+
+	var (
+		m   = &otelMetrics{owner: owner}
+		err error
+	)
+	if m.consumed, err = meter.Int64Counter(otelMessagesConsumed,
+		metric.WithDescription("Number of messages passed to the processor's callbacks"),
+	); err != nil {
+		return nil, fmt.Errorf("error creating instrument %s: %v", otelMessagesConsumed, err)
+	}
+	if m.duration, err = meter.Float64Histogram(otelProcessingDuration,
+		metric.WithDescription("Duration of the processor's callbacks"),
+		metric.WithUnit("s"),
+	); err != nil {
+		return nil, fmt.Errorf("error creating instrument %s: %v", otelProcessingDuration, err)
+	}
+	if m.writes, err = meter.Int64Counter(otelTableWrites,
+		metric.WithDescription("Number of updates written into the local storage of tables"),
+	); err != nil {
+		return nil, fmt.Errorf("error creating instrument %s: %v", otelTableWrites, err)
+	}
+	if m.committed, err = meter.Int64Counter(otelOffsetsCommitted,
+		metric.WithDescription("Number of committed input messages"),
+	); err != nil {
+		return nil, fmt.Errorf("error creating instrument %s: %v", otelOffsetsCommitted, err)
+	}
+
+	if _, err = meter.Int64ObservableGauge(otelConsumerLag,
+		metric.WithDescription("Number of messages between the consumed offset and the newest offset"),
+		metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+			for topic, partitions := range lag(ctx) {
+				for partition, offsetLag := range partitions {
+					o.Observe(offsetLag, metric.WithAttributes(m.attributes(topic, partition)...))
+				}
+			}
+			return nil
+		}),
+	); err != nil {
+		return nil, fmt.Errorf("error creating instrument %s: %v", otelConsumerLag, err)
+	}
+	return m, nil
+}
+
+func (m *otelMetrics) attributes(topic string, partition int32) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{m.owner, attribute.Int("goka.partition", int(partition))}
+	if topic != "" {
+		attrs = append(attrs, attribute.String("goka.topic", topic))
+	}
+	return attrs
+}
+
+// messageProcessed records a message passed to a callback that took d.
+func (m *otelMetrics) messageProcessed(topic string, partition int32, d time.Duration) {
+	if m == nil {
+		return
+	}
+	attrs := metric.WithAttributes(m.attributes(topic, partition)...)
+	m.consumed.Add(context.Background(), 1, attrs)
+	m.duration.Record(context.Background(), d.Seconds(), attrs)
+}
+
+// messageCommitted records a committed input message.
+func (m *otelMetrics) messageCommitted(topic string, partition int32) {
+	if m == nil {
+		return
+	}
+	m.committed.Add(context.Background(), 1, metric.WithAttributes(m.attributes(topic, partition)...))
+}
+
+// wrapUpdate returns an update callback that records the table writes of cb.
+func (m *otelMetrics) wrapUpdate(cb UpdateCallback) UpdateCallback {
+	if m == nil {
+		return cb
+	}
+	return func(s storage.Storage, partition int32, key string, value []byte) error {
+		if err := cb(s, partition, key, value); err != nil {
+			return err
+		}
+		m.writes.Add(context.Background(), 1, metric.WithAttributes(m.attributes("", partition)...))
+		return nil
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/Shopify/sarama"
 	"github.com/lovoo/goka/logger"
 	"github.com/lovoo/goka/multierr"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -23,6 +24,14 @@ const (
 	PPStateStopping
 )
 
+// ppStateNames are the names of the partition processor states.
+var ppStateNames = map[State]string{
+	PPStateIdle:       "idle",
+	PPStateRecovering: "recovering",
+	PPStateRunning:    "running",
+	PPStateStopping:   "stopping",
+}
+
 // PartitionProcessor handles message processing of one partition by serializing
 // messages from different input topics.
 // It also handles joined tables as well as lookup views (managed by `Processor`).
@@ -42,6 +51,8 @@ type PartitionProcessor struct {
 
 	input       chan *sarama.ConsumerMessage
 	inputTopics []string
+	// keys of the table to visit, see Processor.VisitAllWithStats
+	visitInput chan *visit
 
 	runnerGroup       *multierr.ErrGroup
 	cancelRunnerGroup func()
@@ -57,6 +68,32 @@ type PartitionProcessor struct {
 
 	session  sarama.ConsumerGroupSession
 	producer Producer
+	hold     *emitHold
+	keyLocks *keyMutex
+	// limits the in-flight emits per topic, shared by all partition processors
+	emitLimiter *emitLimiter
+	// limits the rate of input messages, nil if unlimited
+	inputLimiter *rate.Limiter
+	// records metrics, nil if no meter is configured
+	metrics *otelMetrics
+	// creates the spans of the processed messages, nil if no tracer is configured
+	tracing *tracing
+
+	// returns the partition of a key, nil if the partition can't be computed
+	partitionOf func(key string) (int32, error)
+	// message currently being processed. If processing fails, it's retried
+	// after a restart of the partition processor.
+	currentMsg *sarama.ConsumerMessage
+
+	// whether waiting for the in-flight messages timed out when stopping
+	drainTimedOut bool
+
+	// key of the heartbeats to the group table, empty if disabled
+	heartbeatKey string
+	// key of the ticks of a delay scheduler, empty for other processors
+	delayTickKey string
+	// tracks the keys of the group table to delete them after a ttl, nil if disabled
+	keyTTL *keyTTL
 
 	opts *poptions
 }
@@ -64,7 +101,7 @@ type PartitionProcessor struct {
 func newPartitionProcessor(partition int32,
 	graph *GroupGraph,
 	session sarama.ConsumerGroupSession,
-	logger logger.Logger,
+	log logger.Logger,
 	opts *poptions,
 	lookupTables map[string]*View,
 	consumer sarama.Consumer,
@@ -81,6 +118,9 @@ func newPartitionProcessor(partition int32,
 	if loop := graph.LoopStream(); loop != nil {
 		topicMap[loop.Topic()] = true
 	}
+	if changes := graph.TableChangeStream(); changes != nil {
+		topicMap[changes.Topic()] = true
+	}
 
 	var (
 		topicList  []string
@@ -102,7 +142,7 @@ func newPartitionProcessor(partition int32,
 		outputList = append(outputList, graph.GroupTable().Topic())
 	}
 
-	log := logger.Prefix(fmt.Sprintf("PartitionProcessor (%d)", partition))
+	log = log.Prefix(fmt.Sprintf("PartitionProcessor (%d)", partition))
 
 	statsLoopCtx, cancel := context.WithCancel(context.Background())
 
@@ -110,7 +150,7 @@ func newPartitionProcessor(partition int32,
 		log:             log,
 		opts:            opts,
 		partition:       partition,
-		state:           NewSignal(PPStateIdle, PPStateRecovering, PPStateRunning, PPStateStopping).SetState(PPStateIdle),
+		state:           NewSignal(PPStateIdle, PPStateRecovering, PPStateRunning, PPStateStopping).RegisterStateNames(ppStateNames).SetState(PPStateIdle),
 		callbacks:       callbacks,
 		lookups:         lookupTables,
 		consumer:        consumer,
@@ -119,6 +159,7 @@ func newPartitionProcessor(partition int32,
 		joins:           make(map[string]*PartitionTable),
 		input:           make(chan *sarama.ConsumerMessage, opts.partitionChannelSize),
 		inputTopics:     topicList,
+		visitInput:      make(chan *visit),
 		graph:           graph,
 		stats:           newPartitionProcStats(topicList, outputList),
 		requestStats:    make(chan bool),
@@ -137,10 +178,11 @@ func newPartitionProcessor(partition int32,
 			tmgr,
 			opts.updateCallback,
 			opts.builders.storage,
-			log.Prefix("PartTable"),
+			logger.With(log.Prefix("PartTable"), "topic", graph.GroupTable().Topic()),
 			backoff,
 			backoffResetTime,
 		)
+		partProc.keyTTL = newKeyTTL(opts.tableKeyTTL, opts.clock)
 	}
 	return partProc
 }
@@ -197,7 +239,7 @@ func (pp *PartitionProcessor) Setup(ctx context.Context) error {
 			pp.tmgr,
 			pp.opts.updateCallback,
 			pp.opts.builders.storage,
-			pp.log.Prefix(fmt.Sprintf("Join %s", join.Topic())),
+			logger.With(pp.log.Prefix(fmt.Sprintf("Join %s", join.Topic())), "topic", join.Topic()),
 			NewSimpleBackoff(time.Second*10),
 			time.Minute,
 		)
@@ -221,24 +263,55 @@ func (pp *PartitionProcessor) Setup(ctx context.Context) error {
 	default:
 	}
 
-	for _, join := range pp.joins {
-		join := join
+	if pp.heartbeatKey != "" && pp.table != nil {
+		pp.runnerGroup.Go(func() error {
+			pp.runHeartbeat(runnerCtx)
+			return nil
+		})
+	}
+
+	if pp.delayTickKey != "" {
 		pp.runnerGroup.Go(func() error {
-			return join.CatchupForever(runnerCtx, false)
+			pp.runDelayTicks(runnerCtx)
+			return nil
+		})
+	}
+
+	if pp.keyTTL != nil {
+		pp.runnerGroup.Go(func() error {
+			pp.runKeyTTLSweep(runnerCtx)
+			return nil
 		})
 	}
 
-	// now run the processor in a runner-group
+	// now run the processor and catch up the joins in a runner-group
 	pp.runnerGroup.Go(func() error {
-		err := pp.run(runnerCtx)
-		if err != nil {
-			pp.log.Printf("Run failed with error: %v", err)
-		}
-		return err
+		return pp.runRestarting(runnerCtx)
 	})
 	return nil
 }
 
+// runHeartbeat emits a tombstone for the heartbeat key to the group table
+// in the configured interval. Failed heartbeats are only logged.
+func (pp *PartitionProcessor) runHeartbeat(ctx context.Context) {
+	ticker := time.NewTicker(pp.opts.heartbeatInterval)
+	defer ticker.Stop()
+
+	topic := pp.graph.GroupTable().Topic()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pp.producer.Emit(topic, pp.heartbeatKey, nil).Then(func(err error) {
+				if err != nil {
+					logger.Errorf(pp.log, "error emitting heartbeat: %v", err)
+				}
+			})
+		}
+	}
+}
+
 // Stop stops the partition processor
 func (pp *PartitionProcessor) Stop() error {
 	pp.log.Debugf("Stopping")
@@ -324,13 +397,50 @@ func (pp *PartitionProcessor) run(ctx context.Context) (rerr error) {
 			close(done)
 		}()
 
+		timeout := 60 * time.Second
+		if pp.opts.shutdownDrainTimeout > 0 {
+			timeout = pp.opts.shutdownDrainTimeout
+		}
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
 		select {
 		case <-done:
-		case <-time.NewTimer(60 * time.Second).C:
-			pp.log.Printf("partition processor did not shutdown in time. Will stop waiting")
+			pp.drainTimedOut = false
+		case <-timer.C:
+			logger.Warnf(pp.log, "partition processor did not shutdown in time. Will stop waiting")
+			pp.drainTimedOut = true
 		}
 	}()
 
+	handleMessage := func(ev *sarama.ConsumerMessage) error {
+		// messages are committed before processing at most once, so they must not be retried
+		if pp.opts.deliverySemantics != AtMostOnce {
+			pp.currentMsg = ev
+		}
+		start := time.Now()
+		var err error
+		if pp.opts.deadLetter != nil {
+			err = pp.processDeadLettering(ctx, &wg, ev, asyncFailer)
+		} else {
+			err = pp.processMessage(ctx, &wg, ev, syncFailer, asyncFailer)
+		}
+		if err != nil {
+			return fmt.Errorf("error processing message: from %s %v", ev.Value, err)
+		}
+		pp.currentMsg = nil
+		pp.metrics.messageProcessed(ev.Topic, ev.Partition, time.Since(start))
+
+		pp.enqueueStatsUpdate(ctx, func() { pp.updateStatsWithMessage(ev) })
+		return nil
+	}
+
+	// retry the message that failed before a restart
+	if ev := pp.currentMsg; ev != nil {
+		if err := handleMessage(ev); err != nil {
+			return err
+		}
+	}
+
 	for {
 		select {
 		case ev, isOpen := <-pp.input:
@@ -338,12 +448,25 @@ func (pp *PartitionProcessor) run(ctx context.Context) (rerr error) {
 			if !isOpen {
 				return nil
 			}
-			err := pp.processMessage(ctx, &wg, ev, syncFailer, asyncFailer)
-			if err != nil {
-				return fmt.Errorf("error processing message: from %s %v", ev.Value, err)
+			// select picks randomly if the context is done as well, so check it
+			// to not start processing a new message when stopping
+			if ctx.Err() != nil {
+				pp.log.Debugf("exiting, context is cancelled")
+				return nil
+			}
+			if pp.inputLimiter != nil {
+				if err := pp.inputLimiter.Wait(ctx); err != nil {
+					// the context is done while waiting
+					pp.log.Debugf("exiting while waiting for the input rate limit: %v", err)
+					return nil
+				}
+			}
+			if err := handleMessage(ev); err != nil {
+				return err
 			}
 
-			pp.enqueueStatsUpdate(ctx, func() { pp.updateStatsWithMessage(ev) })
+		case v := <-pp.visitInput:
+			pp.processVisit(ctx, &wg, v, syncFailer, asyncFailer)
 
 		case <-ctx.Done():
 			pp.log.Debugf("exiting, context is cancelled")
@@ -356,6 +479,39 @@ func (pp *PartitionProcessor) run(ctx context.Context) (rerr error) {
 	}
 }
 
+// markMessage marks the message as processed in the consumer group session
+// and notifies the commit observer.
+func (pp *PartitionProcessor) markMessage(msg *sarama.ConsumerMessage) {
+	pp.session.MarkMessage(msg, "")
+	pp.metrics.messageCommitted(msg.Topic, msg.Partition)
+	// the stats loop might not run anymore, so the update is skipped in that case
+	pp.enqueueStatsUpdate(context.Background(), func() {
+		if ip := pp.stats.Input[msg.Topic]; ip != nil {
+			ip.CommittedOffset = msg.Offset + 1
+			ip.updateConsumerLag()
+		}
+	})
+	if pp.opts.commitObserver != nil {
+		// the committed offset is the offset of the next message to consume
+		pp.opts.commitObserver(msg.Topic, msg.Partition, msg.Offset+1)
+	}
+}
+
+// emit emits using the producer. Emits to output streams are buffered while the
+// processor is on hold.
+func (pp *PartitionProcessor) emit(topic string, key string, value []byte, headers map[string][]byte) *Promise {
+	produce := func() *Promise {
+		if len(headers) == 0 {
+			return pp.producer.Emit(topic, key, value)
+		}
+		return pp.producer.EmitWithHeaders(topic, key, value, headers)
+	}
+	if pp.hold == nil || !pp.graph.isOutputTopic(Stream(topic)) {
+		return produce()
+	}
+	return pp.hold.emit(produce)
+}
+
 func (pp *PartitionProcessor) enqueueStatsUpdate(ctx context.Context, updater func()) {
 	select {
 	case pp.updateStats <- updater:
@@ -371,6 +527,9 @@ func (pp *PartitionProcessor) runStatsLoop(ctx context.Context) {
 
 	updateHwmStatsTicker := time.NewTicker(statsHwmUpdateInterval)
 	defer updateHwmStatsTicker.Stop()
+
+	// whether the high water marks are being fetched, so slow fetches don't pile up
+	var fetchingHwms bool
 	for {
 		select {
 		case <-pp.requestStats:
@@ -385,6 +544,19 @@ func (pp *PartitionProcessor) runStatsLoop(ctx context.Context) {
 			update()
 		case <-updateHwmStatsTicker.C:
 			pp.updateHwmStats()
+			if pp.tmgr != nil && !fetchingHwms {
+				fetchingHwms = true
+				go func() {
+					hwms := pp.fetchHighWaterMarks()
+					select {
+					case pp.updateStats <- func() {
+						fetchingHwms = false
+						pp.applyHighWaterMarks(hwms)
+					}:
+					case <-ctx.Done():
+					}
+				}()
+			}
 		case <-ctx.Done():
 			return
 		}
@@ -414,6 +586,32 @@ func (pp *PartitionProcessor) updateHwmStats() {
 	}
 }
 
+// fetchHighWaterMarks fetches the high water marks of the input topics from
+// the topic manager. Topics failing to fetch are omitted.
+func (pp *PartitionProcessor) fetchHighWaterMarks() map[string]int64 {
+	hwms := make(map[string]int64, len(pp.inputTopics))
+	for _, topic := range pp.inputTopics {
+		hwm, err := pp.tmgr.GetOffset(topic, pp.partition, sarama.OffsetNewest)
+		if err != nil {
+			pp.log.Debugf("error fetching high water mark of %s: %v", topic, err)
+			continue
+		}
+		hwms[topic] = hwm
+	}
+	return hwms
+}
+
+// applyHighWaterMarks updates the consumer lag of the input topics with the
+// high water marks.
+func (pp *PartitionProcessor) applyHighWaterMarks(hwms map[string]int64) {
+	for topic, hwm := range hwms {
+		if ip := pp.stats.Input[topic]; ip != nil {
+			ip.HighWaterMark = hwm
+			ip.updateConsumerLag()
+		}
+	}
+}
+
 func (pp *PartitionProcessor) collectStats(ctx context.Context) *PartitionProcStats {
 	var (
 		stats = pp.stats.clone()
@@ -442,7 +640,7 @@ func (pp *PartitionProcessor) collectStats(ctx context.Context) *PartitionProcSt
 
 	err := errg.Wait().NilOrError()
 	if err != nil {
-		pp.log.Printf("Error retrieving stats: %v", err)
+		logger.Errorf(pp.log, "Error retrieving stats: %v", err)
 	}
 
 	return stats
@@ -453,7 +651,7 @@ func (pp *PartitionProcessor) fetchStats(ctx context.Context) *PartitionProcStat
 	case <-ctx.Done():
 		return nil
 	case <-time.After(fetchStatsTimeout):
-		pp.log.Printf("requesting stats timed out")
+		logger.Warnf(pp.log, "requesting stats timed out")
 		return nil
 	case pp.requestStats <- true:
 	}
@@ -463,7 +661,7 @@ func (pp *PartitionProcessor) fetchStats(ctx context.Context) *PartitionProcStat
 	case <-ctx.Done():
 		return nil
 	case <-time.After(fetchStatsTimeout):
-		pp.log.Printf("Fetching stats timed out")
+		logger.Warnf(pp.log, "Fetching stats timed out")
 		return nil
 	case stats := <-pp.responseStats:
 		return stats
@@ -476,21 +674,37 @@ func (pp *PartitionProcessor) enqueueTrackOutputStats(ctx context.Context, topic
 	})
 }
 
+// messageLog returns the logger for messages about the consumed message.
+func (pp *PartitionProcessor) messageLog(msg *sarama.ConsumerMessage) logger.Logger {
+	return logger.With(pp.log, "topic", msg.Topic, "offset", msg.Offset)
+}
+
 func (pp *PartitionProcessor) processMessage(ctx context.Context, wg *sync.WaitGroup, msg *sarama.ConsumerMessage, syncFailer func(err error), asyncFailer func(err error)) error {
+	if pp.rejectOutOfBounds(wg, msg, asyncFailer) {
+		return nil
+	}
+
 	msgContext := &cbContext{
 		ctx:   ctx,
 		graph: pp.graph,
 
 		trackOutputStats: pp.enqueueTrackOutputStats,
+		writeStorage:     pp.writeStorage,
 		pviews:           pp.joins,
 		views:            pp.lookups,
-		commit:           func() { pp.session.MarkMessage(msg, "") },
+		keyLocks:         pp.keyLocks,
+		emitLimiter:      pp.emitLimiter,
+		keyTTL:           pp.keyTTL,
+		clock:            pp.opts.clock,
+		commit:           func() { pp.markMessage(msg) },
 		wg:               wg,
 		msg:              msg,
 		syncFailer:       syncFailer,
 		asyncFailer:      asyncFailer,
-		emitter:          pp.producer.Emit,
+		emitter:          pp.emit,
 		table:            pp.table,
+		partitionOf:      pp.partitionOf,
+		joinMissPolicy:   pp.opts.joinMissPolicy,
 	}
 
 	var (
@@ -503,7 +717,7 @@ func (pp *PartitionProcessor) processMessage(ctx context.Context, wg *sync.WaitG
 	case msg.Value == nil && pp.opts.nilHandling == NilIgnore:
 		// mark the message upstream so we don't receive it again.
 		// this is usually only an edge case in unit tests, as kafka probably never sends us nil messages
-		pp.session.MarkMessage(msg, "")
+		pp.markMessage(msg)
 		// otherwise drop it.
 		return nil
 	case msg.Value == nil && pp.opts.nilHandling == NilProcess:
@@ -528,11 +742,44 @@ func (pp *PartitionProcessor) processMessage(ctx context.Context, wg *sync.WaitG
 		return fmt.Errorf("error processing message for key %s from %s/%d: %v", string(msg.Key), msg.Topic, msg.Partition, err)
 	}
 
+	// commit before processing, the context must not commit again
+	if pp.opts.deliverySemantics == AtMostOnce {
+		pp.markMessage(msg)
+		msgContext.commit = func() {}
+	}
+
+	// the span of the message is the parent of the callback's table accesses and emits
+	if pp.tracing != nil {
+		var end endSpan
+		msgContext.ctx, end = pp.tracing.startProcess(ctx, msg)
+		msgContext.tracing = pp.tracing
+		defer func() {
+			r := recover()
+			if r != nil {
+				end(fmt.Errorf("%v", r))
+				panic(r)
+			}
+			end(nil)
+		}()
+	}
+
 	// start context and call the ProcessorCallback cb
 	msgContext.start()
 
+	// a failed attempt is retried or forwarded to the dead letter topic, so its
+	// context must neither commit the message nor keep the processor waiting
+	if pp.opts.deadLetter != nil {
+		defer func() {
+			if r := recover(); r != nil {
+				msgContext.commit = func() {}
+				msgContext.finish(nil)
+				panic(r)
+			}
+		}()
+	}
+
 	// now call cb
-	cb(msgContext, m)
+	pp.callback(cb, msgContext, m)
 	msgContext.finish(nil)
 	return nil
 }
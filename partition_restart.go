@@ -0,0 +1,114 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lovoo/goka/logger"
+	"github.com/lovoo/goka/multierr"
+)
+
+// PartitionRestartPolicy configures how failed partition processors are restarted.
+type PartitionRestartPolicy struct {
+	// MaxRestarts limits the number of restarts of a partition processor within
+	// one rebalance generation. Zero means unlimited.
+	MaxRestarts int
+	// Backoff creates the backoff used to wait between restarts.
+	// If nil, DefaultBackoffBuilder is used.
+	Backoff BackoffBuilder
+}
+
+// runRestarting runs the partition processor and restarts it on failures
+// if a restart policy is configured.
+func (pp *PartitionProcessor) runRestarting(ctx context.Context) error {
+	var (
+		restarts int
+		backoff  Backoff
+	)
+
+	for {
+		err := pp.runWithJoins(ctx)
+		if err == nil {
+			return nil
+		}
+		logger.Errorf(pp.log, "Run failed with error: %v", err)
+
+		policy := pp.opts.partitionRestart
+		if policy == nil {
+			return err
+		}
+		if policy.MaxRestarts > 0 && restarts >= policy.MaxRestarts {
+			return fmt.Errorf("giving up after %d restarts: %v", restarts, err)
+		}
+
+		if backoff == nil {
+			var berr error
+			backoff, berr = policy.Backoff()
+			if berr != nil {
+				return fmt.Errorf("error creating restart backoff: %v (restarting after error: %v)", berr, err)
+			}
+		}
+		restarts++
+
+		failure := err.Error()
+		pp.enqueueStatsUpdate(ctx, func() {
+			pp.stats.Restarts++
+			pp.stats.LastFailure = failure
+			pp.stats.LastRestart = pp.opts.clock.Now()
+		})
+
+		retryDuration := backoff.Duration()
+		pp.log.Printf("Will restart in %.0f seconds (restarted %d times so far)", retryDuration.Seconds(), restarts-1)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retryDuration):
+		}
+
+		if err := pp.recoverTables(ctx); err != nil {
+			return fmt.Errorf("error recovering tables for restart: %v", err)
+		}
+	}
+}
+
+// runWithJoins runs the partition processor while catching up the joins. If
+// either fails, both are stopped.
+func (pp *PartitionProcessor) runWithJoins(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errg, errgCtx := multierr.NewErrGroup(ctx)
+	for _, join := range pp.joins {
+		join := join
+		errg.Go(func() error {
+			return join.CatchupForever(errgCtx, false)
+		})
+	}
+	errg.Go(func() error {
+		// stop catching up the joins when the processor stops
+		defer cancel()
+		return pp.run(errgCtx)
+	})
+	return errg.Wait().NilOrError()
+}
+
+// recoverTables recovers the partition's table and joins from kafka again.
+func (pp *PartitionProcessor) recoverTables(ctx context.Context) error {
+	pp.state.SetState(PPStateRecovering)
+	defer pp.state.SetState(PPStateRunning)
+
+	errg, errgCtx := multierr.NewErrGroup(ctx)
+	if pp.table != nil {
+		errg.Go(func() error {
+			return pp.table.load(errgCtx, true)
+		})
+	}
+	for _, join := range pp.joins {
+		join := join
+		errg.Go(func() error {
+			return join.load(errgCtx, true)
+		})
+	}
+	return errg.Wait().NilOrError()
+}
@@ -16,6 +16,7 @@ const (
 	defaultPartitionChannelSize = 10
 	defaultStallPeriod          = 30 * time.Second
 	defaultStalledTimeout       = 2 * time.Minute
+	waitForOffsetInterval       = 10 * time.Millisecond
 
 	// internal offset we use to detect if the offset has never been stored locally
 	offsetNotStored int64 = -3
@@ -58,9 +59,32 @@ type PartitionTable struct {
 
 	backoff             Backoff
 	backoffResetTimeout time.Duration
+
+	// topic the table is recovered from, usually the table's topic
+	recoveryTopic string
+	// called if a loaded offset is not the expected next offset
+	offsetGapCallback func(partition int32, expected, got int64)
+	// next offset expected while loading
+	nextOffset int64
+	// called with the timestamp of every loaded message before it is stored
+	recordTimestamp func(partition int32, timestamp time.Time)
+	// replaces the update callback, advancing the offset once the updates are durable
+	durableUpdate  DurableUpdateCallback
+	durableOffsets *durableOffsets
+	// called once when the partition is running for the first time
+	recoveredCallback func(partition int32, count int64)
+	recoveredOnce     sync.Once
+	// number of messages loaded while recovering
+	recoveredCount int64
+	// deletes the stored keys if kafka deleted the messages after the stored offset
+	autoReset bool
 }
 
 func newPartitionTableState() *Signal {
+	names := make(map[State]string)
+	for _, ps := range []PartitionStatus{PartitionStopped, PartitionInitializing, PartitionConnecting, PartitionRecovering, PartitionPreparing, PartitionRunning} {
+		names[State(ps)] = ps.String()
+	}
 	return NewSignal(
 		State(PartitionStopped),
 		State(PartitionInitializing),
@@ -68,7 +92,7 @@ func newPartitionTableState() *Signal {
 		State(PartitionRecovering),
 		State(PartitionPreparing),
 		State(PartitionRunning),
-	).SetState(State(PartitionStopped))
+	).RegisterStateNames(names).SetState(State(PartitionStopped))
 }
 
 func newPartitionTable(topic string,
@@ -87,6 +111,7 @@ func newPartitionTable(topic string,
 		consumer:       consumer,
 		tmgr:           tmgr,
 		topic:          topic,
+		recoveryTopic:  topic,
 		updateCallback: updateCallback,
 		builder:        builder,
 		log:            log,
@@ -145,7 +170,7 @@ func (p *PartitionTable) loadRestarting(ctx context.Context, stopAfterCatchup bo
 	for {
 		err := p.load(ctx, stopAfterCatchup)
 		if err != nil {
-			p.log.Printf("Error while starting up: %v", err)
+			logger.Errorf(p.log, "Error while starting up: %v", err)
 
 			retries++
 			if resetTimer != nil {
@@ -215,7 +240,7 @@ WaitLoop:
 		case <-ctx.Done():
 			return nil, nil
 		case <-ticker.C:
-			p.log.Printf("creating storage for topic %s/%d for %.1f minutes ...", p.topic, p.partition, time.Since(start).Minutes())
+			p.log.Debugf("creating storage for topic %s/%d for %.1f minutes ...", p.topic, p.partition, time.Since(start).Minutes())
 		case <-done:
 			p.log.Debugf("finished building storage for topic %s/%d in %.1f minutes", p.topic, p.partition, time.Since(start).Minutes())
 			if err != nil {
@@ -235,13 +260,13 @@ WaitLoop:
 
 // findOffsetToLoad returns the first offset to load and the high watermark.
 func (p *PartitionTable) findOffsetToLoad(storedOffset int64) (int64, int64, error) {
-	oldest, err := p.tmgr.GetOffset(p.topic, p.partition, sarama.OffsetOldest)
+	oldest, err := p.tmgr.GetOffset(p.recoveryTopic, p.partition, sarama.OffsetOldest)
 	if err != nil {
-		return 0, 0, fmt.Errorf("Error getting oldest offset for topic/partition %s/%d: %v", p.topic, p.partition, err)
+		return 0, 0, fmt.Errorf("Error getting oldest offset for topic/partition %s/%d: %v", p.recoveryTopic, p.partition, err)
 	}
-	hwm, err := p.tmgr.GetOffset(p.topic, p.partition, sarama.OffsetNewest)
+	hwm, err := p.tmgr.GetOffset(p.recoveryTopic, p.partition, sarama.OffsetNewest)
 	if err != nil {
-		return 0, 0, fmt.Errorf("Error getting newest offset for topic/partition %s/%d: %v", p.topic, p.partition, err)
+		return 0, 0, fmt.Errorf("Error getting newest offset for topic/partition %s/%d: %v", p.recoveryTopic, p.partition, err)
 	}
 	p.log.Debugf("topic manager gives us oldest: %d, hwm: %d", oldest, hwm)
 
@@ -264,6 +289,30 @@ func (p *PartitionTable) findOffsetToLoad(storedOffset int64) (int64, int64, err
 	return start, hwm, nil
 }
 
+// handleOffsetGap is called if the messages between the stored offset and the
+// oldest offset in kafka were deleted, so the local storage may keep keys whose
+// deletion was never received.
+func (p *PartitionTable) handleOffsetGap(storedOffset, oldest int64) error {
+	if !p.autoReset {
+		logger.Warnf(p.log, "Warning: messages %d to %d of topic %s, partition %d were deleted from kafka before they were recovered. The local storage may contain stale keys, delete it or use WithViewAutoReset.", storedOffset+1, oldest-1, p.recoveryTopic, p.partition)
+		return nil
+	}
+
+	logger.Warnf(p.log, "Warning: messages %d to %d of topic %s, partition %d were deleted from kafka before they were recovered. Resetting the local storage.", storedOffset+1, oldest-1, p.recoveryTopic, p.partition)
+	iter, err := p.st.Iterator()
+	if err != nil {
+		return fmt.Errorf("error opening iterator to reset local storage: %v", err)
+	}
+	defer iter.Release()
+	for iter.Next() {
+		// deleted through the update callback, so the views' wrappers see the deletes
+		if err := p.updateCallback(p.st.Storage, p.partition, string(iter.Key()), nil); err != nil {
+			return fmt.Errorf("error deleting key %s to reset local storage: %v", string(iter.Key()), err)
+		}
+	}
+	return iter.Err()
+}
+
 func (p *PartitionTable) load(ctx context.Context, stopAfterCatchup bool) (rerr error) {
 	var (
 		storedOffset int64
@@ -284,6 +333,13 @@ func (p *PartitionTable) load(ctx context.Context, stopAfterCatchup bool) (rerr
 
 	p.state.SetState(State(PartitionConnecting))
 
+	if p.durableUpdate != nil {
+		if p.durableOffsets == nil {
+			p.durableOffsets = newDurableOffsets(p.st.SetOffset)
+		}
+		p.durableOffsets.reset()
+	}
+
 	// fetch local offset
 	storedOffset, err = p.st.GetOffset(offsetNotStored)
 	if err != nil {
@@ -292,6 +348,9 @@ func (p *PartitionTable) load(ctx context.Context, stopAfterCatchup bool) (rerr
 	}
 
 	loadOffset, hwm, err := p.findOffsetToLoad(storedOffset)
+	if err == nil && storedOffset != offsetNotStored && loadOffset > storedOffset+1 {
+		err = p.handleOffsetGap(storedOffset, loadOffset)
+	}
 	if err != nil {
 		errs.Collect(err)
 		return
@@ -303,7 +362,7 @@ func (p *PartitionTable) load(ctx context.Context, stopAfterCatchup bool) (rerr
 	}
 
 	if storedOffset >= hwm {
-		p.log.Printf("Error: local offset is higher than partition offset. topic %s, partition %d, hwm %d, local offset %d. This can have several reasons: \n(1) The kafka topic storing the table is gone --> delete the local cache and restart! \n(2) the processor crashed last time while writing to disk. \n(3) You found a bug!", p.topic, p.partition, hwm, storedOffset)
+		logger.Errorf(p.log, "Error: local offset is higher than partition offset. topic %s, partition %d, hwm %d, local offset %d. This can have several reasons: \n(1) The kafka topic storing the table is gone --> delete the local cache and restart! \n(2) the processor crashed last time while writing to disk. \n(3) You found a bug!", p.topic, p.partition, hwm, storedOffset)
 
 		// we'll just pretend we were done so the partition looks recovered
 		loadOffset = hwm
@@ -335,9 +394,9 @@ func (p *PartitionTable) load(ctx context.Context, stopAfterCatchup bool) (rerr
 
 	defer p.log.Debugf("... Loading done")
 
-	partConsumer, err = p.consumer.ConsumePartition(p.topic, p.partition, loadOffset)
+	partConsumer, err = p.consumer.ConsumePartition(p.recoveryTopic, p.partition, loadOffset)
 	if err != nil {
-		errs.Collect(fmt.Errorf("Error creating partition consumer for topic %s, partition %d, offset %d: %v", p.topic, p.partition, storedOffset, err))
+		errs.Collect(fmt.Errorf("Error creating partition consumer for topic %s, partition %d, offset %d: %v", p.recoveryTopic, p.partition, storedOffset, err))
 		return
 	}
 
@@ -353,7 +412,13 @@ func (p *PartitionTable) load(ctx context.Context, stopAfterCatchup bool) (rerr
 	if stopAfterCatchup {
 		p.state.SetState(State(PartitionRecovering))
 	} else {
-		p.state.SetState(State(PartitionRunning))
+		p.setRunning()
+	}
+
+	// the next offset after the stored one is expected, even if kafka does not have it anymore
+	p.nextOffset = loadOffset
+	if storedOffset != offsetNotStored {
+		p.nextOffset = storedOffset + 1
 	}
 
 	// load messages and stop when you're at HWM
@@ -400,19 +465,30 @@ func (p *PartitionTable) markRecovered(ctx context.Context) error {
 	for {
 		select {
 		case <-ticker.C:
-			p.log.Printf("Committing storage after recovery for topic/partition %s/%d since %0.f seconds", p.topic, p.partition, time.Since(start).Seconds())
+			p.log.Debugf("Committing storage after recovery for topic/partition %s/%d since %0.f seconds", p.topic, p.partition, time.Since(start).Seconds())
 		case <-ctx.Done():
 			return nil
 		case err := <-done:
 			if err != nil {
 				return err
 			}
-			p.state.SetState(State(PartitionRunning))
+			p.setRunning()
 			return nil
 		}
 	}
 }
 
+// setRunning sets the partition running and calls the recovered callback the
+// first time.
+func (p *PartitionTable) setRunning() {
+	p.state.SetState(State(PartitionRunning))
+	if p.recoveredCallback != nil {
+		p.recoveredOnce.Do(func() {
+			p.recoveredCallback(p.partition, p.recoveredCount)
+		})
+	}
+}
+
 func (p *PartitionTable) handleConsumerErrors(ctx context.Context, errs *multierr.Errors, cons sarama.PartitionConsumer) {
 	for {
 		select {
@@ -421,7 +497,7 @@ func (p *PartitionTable) handleConsumerErrors(ctx context.Context, errs *multier
 				return
 			}
 			err := fmt.Errorf("Consumer error: %v", consError)
-			p.log.Printf("%v", err)
+			logger.Errorf(p.log, "%v", err)
 			errs.Collect(err)
 			// if there's an error, close the consumer
 			cons.AsyncClose()
@@ -443,7 +519,7 @@ func (p *PartitionTable) drainConsumer(cons sarama.PartitionConsumer, errs *mult
 		for {
 			select {
 			case <-ctx.Done():
-				p.log.Printf("draining errors channel timed out")
+				logger.Warnf(p.log, "draining errors channel timed out")
 				return nil
 			case err, ok := <-cons.Errors():
 				if !ok {
@@ -460,7 +536,7 @@ func (p *PartitionTable) drainConsumer(cons sarama.PartitionConsumer, errs *mult
 		for {
 			select {
 			case <-ctx.Done():
-				p.log.Printf("draining messages channel timed out")
+				logger.Warnf(p.log, "draining messages channel timed out")
 				return nil
 			case _, ok := <-cons.Messages():
 				if !ok {
@@ -506,10 +582,19 @@ func (p *PartitionTable) loadMessages(ctx context.Context, cons sarama.Partition
 			if p.state.IsState(State(PartitionRunning)) && stopAfterCatchup {
 				// TODO: should we really ignore the message?
 				// Shouldn't we instead break here to avoid losing messages or fail or just consume it?
-				p.log.Printf("received message in topic %s, partition %s after catchup. Another processor is still producing messages. Ignoring message.", p.topic, p.partition)
+				logger.Warnf(p.log, "received message in topic %s, partition %s after catchup. Another processor is still producing messages. Ignoring message.", p.topic, p.partition)
 				continue
 			}
 
+			if p.offsetGapCallback != nil && msg.Offset != p.nextOffset {
+				p.offsetGapCallback(p.partition, p.nextOffset, msg.Offset)
+			}
+			p.nextOffset = msg.Offset + 1
+
+			if p.recordTimestamp != nil {
+				p.recordTimestamp(p.partition, msg.Timestamp)
+			}
+
 			lastMessage = time.Now()
 			if err := p.storeEvent(string(msg.Key), msg.Value, msg.Offset); err != nil {
 				errs.Collect(fmt.Errorf("load: error updating storage: %v", err))
@@ -517,6 +602,7 @@ func (p *PartitionTable) loadMessages(ctx context.Context, cons sarama.Partition
 			}
 
 			if stopAfterCatchup {
+				p.recoveredCount++
 				p.enqueueStatsUpdate(ctx, func() { p.stats.Recovery.Offset = msg.Offset })
 			}
 
@@ -586,7 +672,7 @@ func (p *PartitionTable) fetchStats(ctx context.Context) *TableStats {
 	case <-ctx.Done():
 		return nil
 	case <-time.After(fetchStatsTimeout):
-		p.log.Printf("requesting stats timed out")
+		logger.Warnf(p.log, "requesting stats timed out")
 		return nil
 	case p.requestStats <- true:
 	}
@@ -596,7 +682,7 @@ func (p *PartitionTable) fetchStats(ctx context.Context) *TableStats {
 	case <-ctx.Done():
 		return nil
 	case <-time.After(fetchStatsTimeout):
-		p.log.Printf("fetching stats timed out")
+		logger.Warnf(p.log, "fetching stats timed out")
 		return nil
 	case stats := <-p.responseStats:
 		return stats
@@ -624,13 +710,16 @@ func (p *PartitionTable) TrackMessageWrite(ctx context.Context, length int) {
 
 func (p *PartitionTable) updateHwmStats() {
 	hwms := p.consumer.HighWaterMarks()
-	hwm := hwms[p.topic][p.partition]
+	hwm := hwms[p.recoveryTopic][p.partition]
 	if hwm != 0 {
 		p.stats.Input.OffsetLag = hwm - p.stats.Input.LastOffset
 	}
 }
 
 func (p *PartitionTable) storeEvent(key string, value []byte, offset int64) error {
+	if p.durableUpdate != nil {
+		return p.storeDurableEvent(key, value, offset)
+	}
 	err := p.st.Update(key, value)
 	if err != nil {
 		return fmt.Errorf("Error from the update callback while recovering from the log: %v", err)
@@ -642,6 +731,17 @@ func (p *PartitionTable) storeEvent(key string, value []byte, offset int64) erro
 	return nil
 }
 
+func (p *PartitionTable) storeDurableEvent(key string, value []byte, offset int64) error {
+	if err := p.durableOffsets.error(); err != nil {
+		return fmt.Errorf("Error updating offset in local storage while recovering from the log: %v", err)
+	}
+	err := p.durableUpdate(p.st.Storage, p.partition, key, value, p.durableOffsets.add(offset))
+	if err != nil {
+		return fmt.Errorf("Error from the update callback while recovering from the log: %v", err)
+	}
+	return nil
+}
+
 // IsRecovered returns whether the partition table is recovered
 func (p *PartitionTable) IsRecovered() bool {
 	return p.state.IsState(State(PartitionRunning))
@@ -665,6 +765,35 @@ func (p *PartitionTable) Get(key string) ([]byte, error) {
 	return p.st.Get(key)
 }
 
+// Sync forces the writes of the storage to stable storage.
+func (p *PartitionTable) Sync() error {
+	if !p.state.IsState(State(PartitionRunning)) {
+		return fmt.Errorf("Partition is not running so it cannot be synced")
+	}
+	return p.st.Sync()
+}
+
+// waitForOffset blocks until the partition has stored the passed offset or the
+// context is done.
+func (p *PartitionTable) waitForOffset(ctx context.Context, offset int64) error {
+	ticker := time.NewTicker(waitForOffsetInterval)
+	defer ticker.Stop()
+	for {
+		stored, err := p.st.GetOffset(offsetNotStored)
+		if err != nil {
+			return fmt.Errorf("error reading stored offset: %v", err)
+		}
+		if stored >= offset {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
 // Has returns whether the storage contains passed key
 func (p *PartitionTable) Has(key string) (bool, error) {
 	if !p.state.IsState(State(PartitionRunning)) {
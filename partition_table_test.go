@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -511,6 +512,48 @@ func TestPT_loadMessages(t *testing.T) {
 		err = pt.loadMessages(ctx, partConsumer, partitionHwm, stopAfterCatchup)
 		test.AssertNil(t, err)
 	})
+	t.Run("offset_gap", func(t *testing.T) {
+		var (
+			localOffset      int64
+			partitionHwm     int64 = 2
+			stopAfterCatchup       = true
+			topic                  = "some-topic"
+			partition        int32
+			consumer                        = defaultSaramaAutoConsumerMock(t)
+			updateCB         UpdateCallback = func(s storage.Storage, partition int32, key string, value []byte) error {
+				return nil
+			}
+			gaps [][2]int64
+		)
+		pt, bm, ctrl := defaultPT(
+			t,
+			topic,
+			partition,
+			nil,
+			updateCB,
+		)
+		defer ctrl.Finish()
+		pt.offsetGapCallback = func(partition int32, expected, got int64) {
+			gaps = append(gaps, [2]int64{expected, got})
+		}
+		partConsumer := consumer.ExpectConsumePartition(topic, partition, localOffset)
+		partConsumer.YieldMessage(&sarama.ConsumerMessage{Topic: topic, Partition: partition})
+		partConsumer.YieldMessage(&sarama.ConsumerMessage{Topic: topic, Partition: partition})
+		partConsumer.ExpectMessagesDrainedOnClose()
+		bm.mst.EXPECT().SetOffset(int64(0)).Return(nil)
+		bm.mst.EXPECT().SetOffset(int64(1)).Return(nil)
+		bm.mst.EXPECT().Open().Return(nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		err := pt.setup(ctx)
+		test.AssertNil(t, err)
+		// the local storage is ahead of the messages
+		pt.nextOffset = 5
+		err = pt.loadMessages(ctx, partConsumer, partitionHwm, stopAfterCatchup)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, gaps, [][2]int64{{5, 0}})
+	})
 	t.Run("consume_till_cancel", func(t *testing.T) {
 		var (
 			localOffset      int64
@@ -695,6 +738,33 @@ func TestPT_loadMessages(t *testing.T) {
 	})
 }
 
+func TestPT_handleOffsetGap(t *testing.T) {
+	newPT := func(autoReset bool) *PartitionTable {
+		st := storage.NewMemory()
+		test.AssertNil(t, st.Set("key", []byte("value")))
+		return &PartitionTable{
+			st:             &storageProxy{Storage: st},
+			updateCallback: DefaultUpdate,
+			log:            logger.Default(),
+			autoReset:      autoReset,
+		}
+	}
+	t.Run("keep", func(t *testing.T) {
+		pt := newPT(false)
+		test.AssertNil(t, pt.handleOffsetGap(10, 20))
+		has, err := pt.st.Has("key")
+		test.AssertNil(t, err)
+		test.AssertTrue(t, has)
+	})
+	t.Run("reset", func(t *testing.T) {
+		pt := newPT(true)
+		test.AssertNil(t, pt.handleOffsetGap(10, 20))
+		has, err := pt.st.Has("key")
+		test.AssertNil(t, err)
+		test.AssertFalse(t, has)
+	})
+}
+
 func TestPT_storeEvent(t *testing.T) {
 	t.Run("succeed", func(t *testing.T) {
 		var (
@@ -899,6 +969,115 @@ func TestPT_SetupAndCatchupToHwm(t *testing.T) {
 		test.AssertNil(t, err)
 		test.AssertTrue(t, count == msgsToRecover)
 	})
+	t.Run("succeed_recovered_callback", func(t *testing.T) {
+		var (
+			newest    int64 = 5
+			consumer        = defaultSaramaAutoConsumerMock(t)
+			topic           = "some-topic"
+			partition int32
+			recovered []int64
+		)
+		pt, bm, ctrl := defaultPT(
+			t,
+			topic,
+			partition,
+			nil,
+			func(s storage.Storage, partition int32, key string, value []byte) error {
+				return nil
+			},
+		)
+		defer ctrl.Finish()
+		pt.consumer = consumer
+		pt.recoveredCallback = func(partition int32, count int64) {
+			recovered = append(recovered, count)
+		}
+		bm.mst.EXPECT().Open().Return(nil)
+		bm.mst.EXPECT().GetOffset(gomock.Any()).Return(int64(0), nil)
+		bm.tmgr.EXPECT().GetOffset(pt.topic, pt.partition, sarama.OffsetOldest).Return(int64(0), nil)
+		bm.tmgr.EXPECT().GetOffset(pt.topic, pt.partition, sarama.OffsetNewest).Return(newest, nil)
+		bm.mst.EXPECT().MarkRecovered().Return(nil)
+		partConsumer := consumer.ExpectConsumePartition(topic, partition, 1)
+		partConsumer.ExpectMessagesDrainedOnClose()
+		for i := int64(0); i < newest; i++ {
+			partConsumer.YieldMessage(&sarama.ConsumerMessage{})
+			bm.mst.EXPECT().SetOffset(gomock.Any()).Return(nil)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		test.AssertNil(t, pt.SetupAndRecover(ctx, false))
+		test.AssertEqual(t, recovered, []int64{newest})
+
+		// the callback is called only the first time
+		pt.setRunning()
+		test.AssertEqual(t, len(recovered), 1)
+	})
+	t.Run("succeed_consumer_error", func(t *testing.T) {
+		var (
+			newest    int64 = 10
+			consumer        = defaultSaramaAutoConsumerMock(t)
+			topic           = "some-topic"
+			partition int32
+			count     int64
+		)
+		pt, bm, ctrl := defaultPT(
+			t,
+			topic,
+			partition,
+			nil,
+			func(s storage.Storage, partition int32, key string, value []byte) error {
+				atomic.AddInt64(&count, 1)
+				return nil
+			},
+		)
+		defer ctrl.Finish()
+		bm.useMemoryStorage()
+		pt.consumer = consumer
+		pt.backoff = &simpleBackoff{step: time.Millisecond}
+		bm.tmgr.EXPECT().GetOffset(pt.topic, pt.partition, sarama.OffsetOldest).Return(int64(0), nil).AnyTimes()
+		bm.tmgr.EXPECT().GetOffset(pt.topic, pt.partition, sarama.OffsetNewest).Return(newest, nil).AnyTimes()
+		partConsumer := consumer.ExpectConsumePartition(topic, partition, anyOffset)
+
+		states, stop := pt.state.ObserveAll()
+		defer stop()
+		// waitConnecting waits until the partition table (re-)connects
+		waitConnecting := func() {
+			for state := range states {
+				if state == State(PartitionConnecting) {
+					return
+				}
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		done := make(chan error, 1)
+		go func() {
+			done <- pt.SetupAndRecover(ctx, true)
+		}()
+
+		waitConnecting()
+		for i := int64(0); i < newest/2; i++ {
+			partConsumer.YieldMessage(&sarama.ConsumerMessage{})
+		}
+		for atomic.LoadInt64(&count) < newest/2 {
+			time.Sleep(time.Millisecond)
+		}
+
+		// the consumer error makes the partition table reconnect
+		partConsumer.YieldError(fmt.Errorf("consumer error"))
+		waitConnecting()
+		for i := newest / 2; i < newest; i++ {
+			partConsumer.YieldMessage(&sarama.ConsumerMessage{})
+		}
+
+		test.AssertNil(t, <-done)
+		test.AssertEqual(t, atomic.LoadInt64(&count), newest)
+		offset, err := bm.st.GetOffset(0)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, offset, newest-1)
+	})
 	t.Run("fail", func(t *testing.T) {
 		var (
 			consumer  = defaultSaramaAutoConsumerMock(t)
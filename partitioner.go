@@ -0,0 +1,42 @@
+package goka
+
+import (
+	"errors"
+	"hash"
+)
+
+// Partitioner assigns keys to partitions, e.g. to read a table produced by a
+// non-goka producer with a different partitioning.
+type Partitioner interface {
+	// Partition returns the partition of key in [0, numPartitions).
+	Partition(key string, numPartitions int32) (int32, error)
+}
+
+// HasherPartitioner returns a Partitioner assigning keys to partitions by
+// their hash like goka's emitters, e.g. HasherPartitioner(DefaultHasher()).
+func HasherPartitioner(hasher func() hash.Hash32) Partitioner {
+	return hasherPartitioner(hasher)
+}
+
+type hasherPartitioner func() hash.Hash32
+
+func (hp hasherPartitioner) Partition(key string, numPartitions int32) (int32, error) {
+	if numPartitions <= 0 {
+		return 0, errors.New("no partitions found")
+	}
+
+	// create a new hasher every time. Alternative would be to store the hash in
+	// view and every time reset the hasher (ie, hasher.Reset()). But that would
+	// also require us to protect the access of the hasher with a mutex.
+	hasher := hp()
+
+	_, err := hasher.Write([]byte(key))
+	if err != nil {
+		return -1, err
+	}
+	hash := int32(hasher.Sum32())
+	if hash < 0 {
+		hash = -hash
+	}
+	return hash % numPartitions, nil
+}
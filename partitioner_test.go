@@ -0,0 +1,49 @@
+package goka
+
+import (
+	"hash"
+	"strings"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+// prefixPartitioner assigns keys starting with "b" to partition 1.
+type prefixPartitioner struct{}
+
+func (prefixPartitioner) Partition(key string, numPartitions int32) (int32, error) {
+	if strings.HasPrefix(key, "b") {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func TestHasherPartitioner(t *testing.T) {
+	partitioner := HasherPartitioner(func() hash.Hash32 { return newConstHasher(5) })
+
+	partition, err := partitioner.Partition("key", 3)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, partition, int32(2))
+
+	_, err = partitioner.Partition("key", 0)
+	test.AssertNotNil(t, err)
+}
+
+func TestView_Partitioner(t *testing.T) {
+	view := createMemoryTestView(t, "table",
+		map[string]string{"a-key": "a"},
+		map[string]string{"b-key": "b"},
+	)
+	view.opts.partitioner = prefixPartitioner{}
+
+	for key, expected := range map[string]string{"a-key": "a", "b-key": "b"} {
+		value, err := view.Get(key)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, value, expected)
+	}
+
+	// partitions out of range are rejected
+	view.partitions = view.partitions[:1]
+	_, err := view.Get("b-key")
+	test.AssertNotNil(t, err)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -12,6 +13,8 @@ import (
 	"github.com/lovoo/goka/logger"
 	"github.com/lovoo/goka/multierr"
 	"github.com/lovoo/goka/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -27,6 +30,19 @@ const (
 	ProcStateStopping
 )
 
+// procStateNames are the names of the processor states.
+var procStateNames = map[State]string{
+	ProcStateIdle:     "idle",
+	ProcStateStarting: "starting",
+	ProcStateSetup:    "setup",
+	ProcStateRunning:  "running",
+	ProcStateStopping: "stopping",
+}
+
+// ErrShutdownDrainTimeout is returned by Processor.Run if the in-flight messages
+// were not finished within the timeout set by WithShutdownDrainTimeout.
+var ErrShutdownDrainTimeout = errors.New("processor did not drain the in-flight messages in time")
+
 // ProcessCallback function is called for every message received by the
 // processor.
 type ProcessCallback func(ctx Context, msg interface{})
@@ -44,6 +60,8 @@ type Processor struct {
 
 	// Partition processors
 	partitions map[int32]*PartitionProcessor
+	// protects partitions against concurrent reads, e.g. by NumAssignedPartitions
+	partitionsM sync.RWMutex
 	// lookup tables
 	lookupTables map[string]*View
 
@@ -57,6 +75,22 @@ type Processor struct {
 
 	state *Signal
 
+	// buffers emits to output streams while the processor is on hold
+	hold *emitHold
+	// per key locks for Context.WithKeyLock
+	keyLocks *keyMutex
+	// limits the in-flight emits per topic, nil if unlimited
+	emitLimiter *emitLimiter
+	// limits the rate of input messages of all partitions, nil if unlimited or
+	// limited per partition
+	inputLimiter *rate.Limiter
+	// records metrics, nil if no meter is configured
+	metrics *otelMetrics
+	// creates the spans of the processed messages, nil if no tracer is configured
+	tracing *tracing
+	// whether the shutdown drain timed out
+	drainTimedOut bool
+
 	ctx    context.Context
 	cancel context.CancelFunc
 }
@@ -90,6 +124,10 @@ func NewProcessor(brokers []string, gg *GroupGraph, options ...ProcessorOption)
 		return nil, fmt.Errorf(errApplyOptions, err)
 	}
 
+	if err := gg.checkCompatibility(); err != nil {
+		return nil, err
+	}
+
 	npar, err := prepareTopics(brokers, gg, opts)
 	if err != nil {
 		return nil, err
@@ -115,7 +153,7 @@ func NewProcessor(brokers []string, gg *GroupGraph, options ...ProcessorOption)
 	// combine things together
 	processor := &Processor{
 		opts:    opts,
-		log:     opts.log.Prefix(fmt.Sprintf("Processor %s", gg.Group())),
+		log:     logger.With(opts.log.Prefix(fmt.Sprintf("Processor %s", gg.Group())), "group", string(gg.Group())),
 		brokers: brokers,
 
 		rebalanceCallback: opts.rebalanceCallback,
@@ -126,12 +164,56 @@ func NewProcessor(brokers []string, gg *GroupGraph, options ...ProcessorOption)
 
 		graph: gg,
 
-		state: NewSignal(ProcStateIdle, ProcStateStarting, ProcStateSetup, ProcStateRunning, ProcStateStopping).SetState(ProcStateIdle),
+		state: NewSignal(ProcStateIdle, ProcStateStarting, ProcStateSetup, ProcStateRunning, ProcStateStopping).RegisterStateNames(procStateNames).SetState(ProcStateIdle),
+
+		hold:        newEmitHold(opts.holdBufferSize, opts.holdTimeout),
+		keyLocks:    newKeyMutex(),
+		emitLimiter: newEmitLimiter(opts.emitConcurrency),
+	}
+	if opts.inputRateLimit != nil && !opts.inputRateLimit.perPartition {
+		processor.inputLimiter = opts.inputRateLimit.newLimiter()
+	}
+
+	processor.metrics, err = newOtelMetrics(opts.otelMeter, attribute.String("goka.group", string(gg.Group())), processor.offsetLag)
+	if err != nil {
+		return nil, fmt.Errorf("error creating metrics: %v", err)
 	}
+	opts.updateCallback = processor.metrics.wrapUpdate(opts.updateCallback)
+	processor.tracing = newTracing(opts.tracer, gg.Group())
 
 	return processor, nil
 }
 
+// offsetLag returns the offset lag of the inputs and tables of the assigned partitions.
+func (g *Processor) offsetLag(ctx context.Context) map[string]map[int32]int64 {
+	lag := make(map[string]map[int32]int64)
+	add := func(topic string, partition int32, input *InputStats) {
+		if input == nil {
+			return
+		}
+		if lag[topic] == nil {
+			lag[topic] = make(map[int32]int64)
+		}
+		lag[topic][partition] = input.OffsetLag
+	}
+
+	for partition, stats := range g.StatsWithContext(ctx).Group {
+		if stats == nil {
+			continue
+		}
+		for topic, input := range stats.Input {
+			add(topic, partition, input)
+		}
+		for topic, joined := range stats.Joined {
+			add(topic, partition, joined.Input)
+		}
+		if table := g.graph.GroupTable(); table != nil && stats.TableStats != nil {
+			add(table.Topic(), partition, stats.TableStats.Input)
+		}
+	}
+	return lag
+}
+
 // Graph returns the group graph of the processor.
 func (g *Processor) Graph() *GroupGraph {
 	return g.graph
@@ -214,6 +296,22 @@ func (g *Processor) hash(key string) (int32, error) {
 	return hash % int32(g.partitionCount), nil
 }
 
+// partitionKey finds a key hashing to the partition by appending a counter to
+// prefix.
+func (g *Processor) partitionKey(prefix string, partition int32) (string, error) {
+	for i := 0; i < 1000*g.partitionCount; i++ {
+		key := fmt.Sprintf("%s.%d", prefix, i)
+		p, err := g.hash(key)
+		if err != nil {
+			return "", err
+		}
+		if p == partition {
+			return key, nil
+		}
+	}
+	return "", fmt.Errorf("no key with prefix %s found for partition %d", prefix, partition)
+}
+
 // Run starts the processor using passed context.
 // The processor stops in case of errors or if the context is cancelled
 func (g *Processor) Run(ctx context.Context) (rerr error) {
@@ -245,7 +343,7 @@ func (g *Processor) Run(ctx context.Context) (rerr error) {
 
 	go func() {
 		for err := range consumerGroup.Errors() {
-			g.log.Printf("Error executing group consumer: %v", err)
+			logger.Errorf(g.log, "Error executing group consumer: %v", err)
 		}
 	}()
 
@@ -294,7 +392,11 @@ func (g *Processor) Run(ctx context.Context) (rerr error) {
 		return g.rebalanceLoop(ctx, consumerGroup)
 	})
 
-	return errg.Wait().NilOrError()
+	errors.Collect(errg.Wait().NilOrError())
+	if g.drainTimedOut {
+		return ErrShutdownDrainTimeout
+	}
+	return nil
 }
 
 func (g *Processor) rebalanceLoop(ctx context.Context, consumerGroup sarama.ConsumerGroup) (rerr error) {
@@ -305,6 +407,9 @@ func (g *Processor) rebalanceLoop(ctx context.Context, consumerGroup sarama.Cons
 	if g.graph.LoopStream() != nil {
 		topics = append(topics, g.graph.LoopStream().Topic())
 	}
+	if g.graph.TableChangeStream() != nil {
+		topics = append(topics, g.graph.TableChangeStream().Topic())
+	}
 
 	var errs = new(multierr.Errors)
 
@@ -386,7 +491,7 @@ func (g *Processor) waitForLookupTables() {
 					tablesWaiting = append(tablesWaiting, topic)
 				}
 			}
-			g.log.Printf("Waiting for views [%s] to catchup since %.2f minutes",
+			g.log.Debugf("Waiting for views [%s] to catchup since %.2f minutes",
 				strings.Join(tablesWaiting, ", "),
 				time.Since(start).Minutes())
 		}
@@ -399,6 +504,44 @@ func (g *Processor) Recovered() bool {
 	return g.state.IsState(ProcStateRunning)
 }
 
+// CurrentState returns the current state of the processor (ProcStateIdle, ProcStateStarting, ...).
+// This is useful for polling e.g. when implementing health checks or metrics
+func (g *Processor) CurrentState() State {
+	return g.state.State()
+}
+
+// Ready returns true if the processor is recovered and the readiness check passed via
+// WithReadinessCheck (if any) succeeds.
+func (g *Processor) Ready() bool {
+	if !g.Recovered() {
+		return false
+	}
+	if g.opts.readinessCheck != nil {
+		if err := g.opts.readinessCheck(); err != nil {
+			g.log.Debugf("readiness check failed: %v", err)
+			return false
+		}
+	}
+	return true
+}
+
+// ObserveStateChanges returns a StateChangeObserver that allows to handle state changes
+// of the processor (ProcStateIdle, ProcStateStarting, ...) by reading from a channel.
+// It is crucial to continuously read from that channel, otherwise the processor might deadlock upon
+// state changes.
+// If the observer is not needed, the caller must call observer.Stop()
+func (g *Processor) ObserveStateChanges() *StateChangeObserver {
+	return g.state.ObserveStateChange()
+}
+
+// ObserveStateTransitions returns a StateChangeObserver that receives all state transitions
+// of the processor including their time via its Transitions channel, e.g. to detect a
+// transition from ProcStateRunning to ProcStateSetup caused by a rebalance.
+// The same rules as for ObserveStateChanges apply.
+func (g *Processor) ObserveStateTransitions() *StateChangeObserver {
+	return g.state.ObserveStateTransitions()
+}
+
 func (g *Processor) assignmentFromSession(session sarama.ConsumerGroupSession) (Assignment, error) {
 	var (
 		assignment Assignment
@@ -441,6 +584,9 @@ func (g *Processor) Setup(session sarama.ConsumerGroupSession) error {
 	g.log.Debugf("setup generation %d, claims=%#v", session.GenerationID(), session.Claims())
 	defer g.log.Debugf("setup generation %d ... done", session.GenerationID())
 
+	// buffer the emits again if held while the partitions were revoked
+	g.hold.resume()
+
 	assignment, err := g.assignmentFromSession(session)
 	if err != nil {
 		return fmt.Errorf("Error verifying assignment from session: %v", err)
@@ -449,6 +595,16 @@ func (g *Processor) Setup(session sarama.ConsumerGroupSession) error {
 	if g.rebalanceCallback != nil {
 		g.rebalanceCallback(assignment)
 	}
+	if g.opts.rebalanceObserver != nil {
+		assigned := make([]int32, 0, len(assignment))
+		for partition := range assignment {
+			assigned = append(assigned, partition)
+		}
+		g.opts.rebalanceObserver(RebalanceEvent{
+			GenerationID: session.GenerationID(),
+			Assigned:     sortedPartitions(assigned),
+		})
+	}
 
 	// no partitions configured, we cannot setup anything
 	if len(assignment) == 0 {
@@ -484,6 +640,22 @@ func (g *Processor) Cleanup(session sarama.ConsumerGroupSession) error {
 
 	g.state.SetState(ProcStateStopping)
 	defer g.state.SetState(ProcStateIdle)
+
+	// send the held emits, so the partition processors can finish and commit
+	// their messages before the partitions are revoked
+	g.hold.suspend()
+
+	if g.opts.rebalanceObserver != nil {
+		revoked := make([]int32, 0, len(g.partitions))
+		for partition := range g.partitions {
+			revoked = append(revoked, partition)
+		}
+		g.opts.rebalanceObserver(RebalanceEvent{
+			GenerationID: session.GenerationID(),
+			Revoked:      sortedPartitions(revoked),
+		})
+	}
+
 	errg, _ := multierr.NewErrGroup(session.Context())
 	for part, partition := range g.partitions {
 		partID, pproc := part, partition
@@ -496,7 +668,29 @@ func (g *Processor) Cleanup(session sarama.ConsumerGroupSession) error {
 		})
 	}
 	err := errg.Wait().NilOrError()
+
+	// when shutting down, the partition processors finished their in-flight
+	// messages unless they timed out
+	drain := g.ctx.Err() != nil && g.opts.shutdownDrainTimeout > 0
+	if drain {
+		for _, pproc := range g.partitions {
+			if pproc.drainTimedOut {
+				logger.Warnf(g.log, "draining the in-flight messages timed out after %v", g.opts.shutdownDrainTimeout)
+				g.drainTimedOut = true
+				break
+			}
+		}
+	}
+
+	g.partitionsM.Lock()
 	g.partitions = make(map[int32]*PartitionProcessor)
+	g.partitionsM.Unlock()
+
+	// the partition processors are stopped, so all their messages are marked
+	if g.opts.commitOnRevoke || drain {
+		g.log.Debugf("Committing offsets for %d", session.GenerationID())
+		session.Commit()
+	}
 	return err
 }
 
@@ -554,6 +748,15 @@ func (g *Processor) ConsumeClaim(session sarama.ConsumerGroupSession, claim sara
 	}
 }
 
+// NumAssignedPartitions returns the number of partitions currently assigned to
+// the processor by the consumer group. It changes with every rebalance and is
+// 0 while the processor is not part of a consumer group generation.
+func (g *Processor) NumAssignedPartitions() int {
+	g.partitionsM.RLock()
+	defer g.partitionsM.RUnlock()
+	return len(g.partitions)
+}
+
 // Stats returns the aggregated stats for the processor including all partitions, tables, lookups and joins
 func (g *Processor) Stats() *ProcessorStats {
 	return g.StatsWithContext(context.Background())
@@ -561,15 +764,22 @@ func (g *Processor) Stats() *ProcessorStats {
 
 // StatsWithContext returns stats for the processor, see #Processor.Stats()
 func (g *Processor) StatsWithContext(ctx context.Context) *ProcessorStats {
+	g.partitionsM.RLock()
+	partitions := make(map[int32]*PartitionProcessor, len(g.partitions))
+	for partID, proc := range g.partitions {
+		partitions[partID] = proc
+	}
+	g.partitionsM.RUnlock()
+
 	var (
 		m     sync.Mutex
-		stats = newProcessorStats(len(g.partitions))
+		stats = newProcessorStats(len(partitions))
 	)
 
 	errg, ctx := multierr.NewErrGroup(ctx)
 
 	// get partition-processor stats
-	for partID, proc := range g.partitions {
+	for partID, proc := range partitions {
 		partID, proc := partID, proc
 		errg.Go(func() error {
 			partStats := proc.fetchStats(ctx)
@@ -577,6 +787,20 @@ func (g *Processor) StatsWithContext(ctx context.Context) *ProcessorStats {
 			m.Lock()
 			defer m.Unlock()
 			stats.Group[partID] = partStats
+			stats.PartitionStates[partID] = proc.state.State()
+			if partStats == nil {
+				return nil
+			}
+			for _, input := range g.graph.InputStreams() {
+				ip := partStats.Input[input.Topic()]
+				if ip == nil {
+					continue
+				}
+				if stats.ConsumerLag[input.Topic()] == nil {
+					stats.ConsumerLag[input.Topic()] = make(map[int32]int64)
+				}
+				stats.ConsumerLag[input.Topic()][partID] = ip.ConsumerLag
+			}
 			return nil
 		})
 	}
@@ -594,8 +818,10 @@ func (g *Processor) StatsWithContext(ctx context.Context) *ProcessorStats {
 
 	err := errg.Wait().NilOrError()
 	if err != nil {
-		g.log.Printf("Error retrieving stats: %v", err)
+		logger.Errorf(g.log, "Error retrieving stats: %v", err)
 	}
+	stats.EmitsInFlight = g.emitLimiter.inFlight()
+	stats.ProducerQueueDepth = producerQueueDepth(g.producer)
 	return stats
 }
 
@@ -611,12 +837,55 @@ func (g *Processor) createPartitionProcessor(ctx context.Context, partition int3
 	if err != nil {
 		return fmt.Errorf("processor [%s]: could not build backoff handler: %v", g.graph.Group(), err)
 	}
-	pproc := newPartitionProcessor(partition, g.graph, session, g.log, g.opts, g.lookupTables, g.saramaConsumer, g.producer, g.tmgr, backoff, g.opts.backoffResetTime)
+	pproc := newPartitionProcessor(partition, g.graph, session, logger.With(g.log, "partition", partition), g.opts, g.lookupTables, g.saramaConsumer, g.producer, g.tmgr, backoff, g.opts.backoffResetTime)
+	pproc.partitionOf = g.hash
+	pproc.hold = g.hold
+	pproc.keyLocks = g.keyLocks
+	pproc.emitLimiter = g.emitLimiter
+	pproc.inputLimiter = g.inputLimiter
+	if g.opts.inputRateLimit != nil && g.opts.inputRateLimit.perPartition {
+		pproc.inputLimiter = g.opts.inputRateLimit.newLimiter()
+	}
+	pproc.metrics = g.metrics
+	pproc.tracing = g.tracing
+	if g.opts.heartbeatInterval > 0 {
+		if pproc.heartbeatKey, err = g.partitionKey(g.opts.heartbeatKey, partition); err != nil {
+			return fmt.Errorf("processor [%s]: %v", g.graph.Group(), err)
+		}
+	}
+	if g.opts.delayTickTopic != "" {
+		if pproc.delayTickKey, err = g.partitionKey(delayTickKey, partition); err != nil {
+			return fmt.Errorf("processor [%s]: %v", g.graph.Group(), err)
+		}
+	}
 
+	g.partitionsM.Lock()
 	g.partitions[partition] = pproc
+	g.partitionsM.Unlock()
 	return nil
 }
 
+// Hold pauses emitting to the output streams, e.g. during the maintenance of a
+// downstream system, while the processor keeps consuming its inputs.
+// Messages emitted while held are buffered and sent on Release in the order they
+// were emitted. Table updates and loopback messages are not affected.
+// Since the input offsets are committed only after all emits of a message
+// succeeded, the messages are not committed while held.
+// If the buffer is full (see WithHoldBuffer), emitting blocks the callback until
+// there is space or the configured timeout expires, which fails the processor.
+// When the partitions are revoked, i.e. on a rebalance or when stopping the
+// processor, the buffered messages are sent and the input messages committed
+// before the partitions are handed over, so they are neither lost nor processed
+// again by the next owner. The hold applies again after the rebalance.
+func (g *Processor) Hold() {
+	g.hold.hold()
+}
+
+// Release sends all messages buffered since Hold and resumes emitting.
+func (g *Processor) Release() {
+	g.hold.release()
+}
+
 // Stop stops the processor.
 // This is semantically equivalent of closing the Context
 // that was passed to Processor.Run(..).
@@ -656,6 +925,9 @@ func prepareTopics(brokers []string, gg *GroupGraph, opts *poptions) (npar int,
 	}
 
 	if gt := gg.GroupTable(); gt != nil {
+		if err = checkTablePartitions(tm, gt.Topic(), npar); err != nil {
+			return 0, err
+		}
 		if err = tm.EnsureTableExists(gt.Topic(), npar); err != nil {
 			return 0, err
 		}
@@ -664,6 +936,24 @@ func prepareTopics(brokers []string, gg *GroupGraph, opts *poptions) (npar int,
 	return
 }
 
+// checkTablePartitions returns an error if the table exists with a number of
+// partitions other than npar, since its keys would not match the partitions of the inputs.
+func checkTablePartitions(tm TopicManager, table string, npar int) error {
+	partitions, err := tm.Partitions(table)
+	if err != nil || len(partitions) == 0 || len(partitions) == npar {
+		// the table does not exist yet or cannot be checked, which EnsureTableExists handles
+		return nil
+	}
+	return fmt.Errorf("Table %s has %d partitions, but the inputs have %d. Use RepartitionTable to copy it into a table with %d partitions",
+		table, len(partitions), npar, npar)
+}
+
+// sortedPartitions sorts the partitions in ascending order.
+func sortedPartitions(partitions []int32) []int32 {
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+	return partitions
+}
+
 // returns the number of partitions the topics have, and an error if topics are
 // not copartitionea.
 func ensureCopartitioned(tm TopicManager, topics []string) (int, error) {
@@ -12,6 +12,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/lovoo/goka/codec"
 	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/logger"
 	"github.com/lovoo/goka/storage"
 )
 
@@ -318,3 +319,51 @@ func TestProcessor_Run(t *testing.T) {
 		test.AssertTrue(t, strings.Contains(procErr.Error(), "consume-error"))
 	})
 }
+
+func TestProcessor_checkTablePartitions(t *testing.T) {
+	ctrl, bm := createMockBuilder(t)
+	defer ctrl.Finish()
+
+	bm.tmgr.EXPECT().Partitions("same").Return([]int32{0, 1}, nil)
+	bm.tmgr.EXPECT().Partitions("missing").Return(nil, fmt.Errorf("unknown topic"))
+	bm.tmgr.EXPECT().Partitions("mismatch").Return([]int32{0, 1, 2}, nil)
+
+	test.AssertNil(t, checkTablePartitions(bm.tmgr, "same", 2))
+	test.AssertNil(t, checkTablePartitions(bm.tmgr, "missing", 2))
+	err := checkTablePartitions(bm.tmgr, "mismatch", 2)
+	test.AssertNotNil(t, err)
+	test.AssertStringContains(t, err.Error(), "RepartitionTable")
+}
+
+func TestPartitionProcessor_consumerLag(t *testing.T) {
+	ctrl, bm := createMockBuilder(t)
+	defer ctrl.Finish()
+
+	pp := &PartitionProcessor{
+		log:         logger.Default(),
+		partition:   1,
+		tmgr:        bm.tmgr,
+		inputTopics: []string{"input", "failing"},
+		stats:       newPartitionProcStats([]string{"input", "failing"}, nil),
+	}
+
+	bm.tmgr.EXPECT().GetOffset("input", int32(1), sarama.OffsetNewest).Return(int64(100), nil)
+	bm.tmgr.EXPECT().GetOffset("failing", int32(1), sarama.OffsetNewest).Return(int64(0), fmt.Errorf("broker down"))
+
+	hwms := pp.fetchHighWaterMarks()
+	test.AssertEqual(t, hwms, map[string]int64{"input": 100})
+
+	// no lag without committed offset
+	pp.applyHighWaterMarks(hwms)
+	test.AssertEqual(t, pp.stats.Input["input"].HighWaterMark, int64(100))
+	test.AssertEqual(t, pp.stats.Input["input"].ConsumerLag, int64(0))
+
+	pp.stats.Input["input"].CommittedOffset = 90
+	pp.applyHighWaterMarks(hwms)
+	test.AssertEqual(t, pp.stats.Input["input"].ConsumerLag, int64(10))
+
+	// the stats are copied
+	clone := pp.stats.clone()
+	clone.Input["input"].ConsumerLag = 0
+	test.AssertEqual(t, pp.stats.Input["input"].ConsumerLag, int64(10))
+}
@@ -3,6 +3,7 @@ package goka
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Shopify/sarama"
@@ -16,9 +17,26 @@ type Producer interface {
 	Close() error
 }
 
+// QueueDepthReporter is optionally implemented by producers to report how
+// many messages are buffered awaiting the broker's acknowledgement.
+type QueueDepthReporter interface {
+	QueueDepth() int
+}
+
+// producerQueueDepth returns the queue depth of the producer or 0 if the
+// producer does not report it.
+func producerQueueDepth(p Producer) int {
+	if qd, ok := p.(QueueDepthReporter); ok {
+		return qd.QueueDepth()
+	}
+	return 0
+}
+
 type producer struct {
 	producer sarama.AsyncProducer
 	wg       sync.WaitGroup
+	// number of messages passed to sarama that are not acknowledged yet
+	pending int64
 }
 
 // NewProducer creates new kafka producer for passed brokers.
@@ -59,11 +77,18 @@ func (p *producer) Close() error {
 	return nil
 }
 
+// QueueDepth returns the number of messages buffered in the producer that are
+// not acknowledged by the broker yet.
+func (p *producer) QueueDepth() int {
+	return int(atomic.LoadInt64(&p.pending))
+}
+
 // Emit emits a key-value pair to topic and returns a Promise that
 // can be checked for errors asynchronously
 func (p *producer) Emit(topic string, key string, value []byte) *Promise {
 	promise := NewPromise()
 
+	atomic.AddInt64(&p.pending, 1)
 	p.producer.Input() <- &sarama.ProducerMessage{
 		Topic:    topic,
 		Key:      sarama.StringEncoder(key),
@@ -87,6 +112,7 @@ func (p *producer) EmitWithHeaders(topic string, key string, value []byte, heade
 			})
 	}
 
+	atomic.AddInt64(&p.pending, 1)
 	p.producer.Input() <- &sarama.ProducerMessage{
 		Topic:    topic,
 		Key:      sarama.StringEncoder(key),
@@ -109,6 +135,7 @@ func (p *producer) run() {
 			if !ok {
 				return
 			}
+			atomic.AddInt64(&p.pending, -1)
 			err.Msg.Metadata.(*Promise).Finish(nil, err.Err)
 		}
 	}()
@@ -121,6 +148,7 @@ func (p *producer) run() {
 			if !ok {
 				return
 			}
+			atomic.AddInt64(&p.pending, -1)
 			msg.Metadata.(*Promise).Finish(msg, nil)
 		}
 	}()
@@ -28,6 +28,12 @@ func (s *storageProxy) Close() error {
 	return s.closedOnce.Do(s.Storage.Close)
 }
 
+// ReverseIterator makes the reverse iteration of the wrapped storage available,
+// see storage.ReverseIterable.
+func (s *storageProxy) ReverseIterator() (storage.Iterator, error) {
+	return storage.ReverseIterator(s.Storage)
+}
+
 func (s *storageProxy) Update(k string, v []byte) error {
 	return s.update(s.Storage, s.partition, k, v)
 }
@@ -0,0 +1,95 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/lovoo/goka/multierr"
+)
+
+// RepartitionTable copies every key of the view's table into the emitter's topic
+// so that each key ends up in the partition derived from npar partitions. It is
+// the supported way to fix a group table whose number of partitions differs from
+// the group's input topics (see Processor.Run), since Kafka cannot change the
+// partition count of a topic in place.
+//
+// The emitter's topic is created as a table with npar partitions if it does not exist
+// and must not be the view's table. Emitter and view must use the same codec.
+// RepartitionTable waits until the view is running, i.e. has recovered the table, and
+// returns the number of copied keys once all of them have been acknowledged.
+//
+// A typical migration copies GroupTable("group") into GroupTable("group-v2") and
+// starts the processor with the group "group-v2" afterwards. Note that
+// the inputs are consumed again from the beginning for a new group.
+//
+//	view, _ := goka.NewView(brokers, goka.GroupTable("group"), codec)
+//	go view.Run(ctx)
+//	emitter, _ := goka.NewEmitter(brokers, goka.Stream(goka.GroupTable("group-v2")), codec)
+//	defer emitter.Finish()
+//	tm, _ := goka.NewTopicManager(brokers, goka.DefaultConfig(), goka.NewTopicManagerConfig())
+//	defer tm.Close()
+//	copied, err := goka.RepartitionTable(ctx, view, emitter, tm, npar)
+func RepartitionTable(ctx context.Context, view *View, emitter *Emitter, tm TopicManager, npar int) (int, error) {
+	if npar <= 0 {
+		return 0, fmt.Errorf("invalid number of partitions: %d", npar)
+	}
+	if emitter.topic == view.Topic() {
+		return 0, fmt.Errorf("cannot repartition table %s into itself", view.Topic())
+	}
+
+	if err := tm.EnsureTableExists(emitter.topic, npar); err != nil {
+		return 0, fmt.Errorf("error ensuring table %s exists: %v", emitter.topic, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-view.WaitRunning():
+	}
+
+	it, err := view.Iterator()
+	if err != nil {
+		return 0, fmt.Errorf("error creating iterator: %v", err)
+	}
+	defer it.Release()
+
+	var (
+		wg     sync.WaitGroup
+		errs   multierr.Errors
+		copied int
+	)
+	for it.Next() {
+		if ctx.Err() != nil {
+			errs.Collect(ctx.Err())
+			break
+		}
+		value, err := it.Value()
+		if err != nil {
+			errs.Collect(fmt.Errorf("error decoding value of key %s: %v", it.Key(), err))
+			break
+		}
+		if value == nil {
+			continue
+		}
+
+		key := it.Key()
+		wg.Add(1)
+		err = emitter.EmitCallback(key, value, func(err error) {
+			defer wg.Done()
+			if err != nil {
+				errs.Collect(fmt.Errorf("error emitting key %s: %v", key, err))
+			}
+		})
+		if err != nil {
+			wg.Done()
+			errs.Collect(fmt.Errorf("error emitting key %s: %v", key, err))
+			break
+		}
+		copied++
+	}
+	errs.Collect(it.Err())
+	wg.Wait()
+
+	return copied, errs.NilOrError()
+}
@@ -3,6 +3,7 @@ package goka
 import (
 	"fmt"
 	"sync"
+	"time"
 )
 
 // State types a state of the Signal
@@ -22,6 +23,7 @@ type Signal struct {
 	waiters              []*waiter
 	stateChangeObservers []*StateChangeObserver
 	allowedStates        map[State]bool
+	names                map[State]string
 }
 
 // NewSignal creates a new Signal based on the states
@@ -42,7 +44,7 @@ func (s *Signal) SetState(state State) *Signal {
 	s.m.Lock()
 	defer s.m.Unlock()
 	if !s.allowedStates[state] {
-		panic(fmt.Errorf("trying to set illegal state %v", state))
+		panic(fmt.Errorf("trying to set illegal state %v", s.stateName(state)))
 	}
 
 	// if we're already in the state, do not notify anyone
@@ -51,6 +53,7 @@ func (s *Signal) SetState(state State) *Signal {
 	}
 
 	// set the state and notify all channels waiting for it.
+	previous := s.state
 	s.state = state
 
 	var newWaiters []*waiter
@@ -64,8 +67,9 @@ func (s *Signal) SetState(state State) *Signal {
 	s.waiters = newWaiters
 
 	// notify the state change observers
+	change := StateChange{From: previous, To: state, Time: time.Now()}
 	for _, obs := range s.stateChangeObservers {
-		obs.notify(state)
+		obs.notify(change)
 	}
 
 	return s
@@ -85,6 +89,43 @@ func (s *Signal) State() State {
 	return s.state
 }
 
+// RegisterStateNames registers the names of the signal's states, which are used
+// by StateName and String, e.g. for logging.
+// The states of different signals share their values (e.g. PPStateRunning and
+// ProcStateSetup), so the names are registered per signal.
+func (s *Signal) RegisterStateNames(names map[State]string) *Signal {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.names == nil {
+		s.names = make(map[State]string, len(names))
+	}
+	for state, name := range names {
+		s.names[state] = name
+	}
+	return s
+}
+
+// StateName returns the registered name of the state or its value if it has no name.
+func (s *Signal) StateName(state State) string {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.stateName(state)
+}
+
+func (s *Signal) stateName(state State) string {
+	if name, ok := s.names[state]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d", int(state))
+}
+
+// String returns the name of the current state.
+func (s *Signal) String() string {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return s.stateName(s.state)
+}
+
 // WaitForStateMin returns a channel that will be closed, when the signal enters passed
 // state or higher (states are ints, so we're just comparing ints here)
 func (s *Signal) WaitForStateMin(state State) chan struct{} {
@@ -104,7 +145,7 @@ func (s *Signal) WaitForStateMin(state State) chan struct{} {
 // state.
 func (s *Signal) WaitForState(state State) chan struct{} {
 	s.m.Lock()
-	s.m.Unlock()
+	defer s.m.Unlock()
 
 	w := &waiter{
 		done:  make(chan struct{}),
@@ -127,12 +168,25 @@ func (s *Signal) waitForWaiter(state State, w *waiter) chan struct{} {
 	return w.done
 }
 
+// StateChange describes a transition of a signal from one state to another.
+type StateChange struct {
+	From State
+	To   State
+	// Time is the time of the transition
+	Time time.Time
+}
+
 // StateChangeObserver wraps a channel that triggers when the signal's state changes
 type StateChangeObserver struct {
 	// state notifier channel
 	c chan State
+	// transition notifier channel, only used for observers created by ObserveStateTransitions
+	changes chan StateChange
 	// closed is closed when the observer is closed to avoid sending to a closed channel
 	closed chan struct{}
+	// whether notify drops the oldest buffered state instead of blocking,
+	// only used for observers created by ObserveAll
+	dropOldest bool
 	// stop is a callback to stop the observer
 	stop func()
 }
@@ -142,15 +196,45 @@ func (s *StateChangeObserver) Stop() {
 	s.stop()
 }
 
-// C returns the channel to observer state changes
+// C returns the channel to observer state changes.
+// The channel is nil for observers created by ObserveStateTransitions.
 func (s *StateChangeObserver) C() <-chan State {
 	return s.c
 }
 
-func (s *StateChangeObserver) notify(state State) {
+// Transitions returns the channel to observe the state transitions including their time.
+// The channel is nil for observers created by ObserveStateChange.
+func (s *StateChangeObserver) Transitions() <-chan StateChange {
+	return s.changes
+}
+
+func (s *StateChangeObserver) notify(change StateChange) {
+	if s.changes != nil {
+		select {
+		case <-s.closed:
+		case s.changes <- change:
+		}
+		return
+	}
+	if s.dropOldest {
+		for {
+			select {
+			case <-s.closed:
+				return
+			case s.c <- change.To:
+				return
+			default:
+			}
+			// the buffer is full, make room by dropping the oldest state
+			select {
+			case <-s.c:
+			default:
+			}
+		}
+	}
 	select {
 	case <-s.closed:
-	case s.c <- state:
+	case s.c <- change.To:
 	}
 }
 
@@ -158,16 +242,54 @@ func (s *StateChangeObserver) notify(state State) {
 // Note that the caller must take care of consuming that channel, otherwise the Signal
 // will block upon state changes.
 func (s *Signal) ObserveStateChange() *StateChangeObserver {
-	s.m.Lock()
-	defer s.m.Unlock()
-
-	observer := &StateChangeObserver{
+	return s.observe(&StateChangeObserver{
 		c:      make(chan State, 1),
 		closed: make(chan struct{}),
+	})
+}
+
+// ObserveStateTransitions returns an observer that receives all state transitions
+// including their time via its Transitions channel.
+// The first transition has the current state as From and To.
+// Note that the caller must take care of consuming that channel, otherwise the Signal
+// will block upon state changes.
+func (s *Signal) ObserveStateTransitions() *StateChangeObserver {
+	return s.observe(&StateChangeObserver{
+		changes: make(chan StateChange, 1),
+		closed:  make(chan struct{}),
+	})
+}
+
+// observeAllBufferSize is the number of states buffered for an observer created
+// by ObserveAll.
+const observeAllBufferSize = 64
+
+// ObserveAll returns a channel that receives the current state followed by every
+// state the signal transitions to, and a function to unsubscribe, which closes
+// the channel.
+// Unlike ObserveStateChange, a slow consumer never blocks the Signal: the
+// states are buffered and if the buffer is full, the oldest buffered state is
+// dropped in favor of the new one. So the channel always ends with the latest
+// state, but states can be missed if the consumer falls behind by more than 64
+// transitions.
+func (s *Signal) ObserveAll() (<-chan State, func()) {
+	obs := s.observe(&StateChangeObserver{
+		c:          make(chan State, observeAllBufferSize),
+		closed:     make(chan struct{}),
+		dropOldest: true,
+	})
+	var once sync.Once
+	return obs.c, func() {
+		once.Do(obs.Stop)
 	}
+}
+
+func (s *Signal) observe(observer *StateChangeObserver) *StateChangeObserver {
+	s.m.Lock()
+	defer s.m.Unlock()
 
 	// initialize the observer with the current state
-	observer.notify(s.state)
+	observer.notify(StateChange{From: s.state, To: s.state, Time: time.Now()})
 
 	// the stop funtion stops the observer by closing its channel
 	// and removing it from the list of observers
@@ -184,7 +306,12 @@ func (s *Signal) ObserveStateChange() *StateChangeObserver {
 				s.stateChangeObservers = s.stateChangeObservers[:len(s.stateChangeObservers)-1]
 			}
 		}
-		close(observer.c)
+		if observer.c != nil {
+			close(observer.c)
+		}
+		if observer.changes != nil {
+			close(observer.changes)
+		}
 	}
 
 	s.stateChangeObservers = append(s.stateChangeObservers, observer)
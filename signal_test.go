@@ -69,3 +69,75 @@ func TestSignalWaitMin(t *testing.T) {
 	<-done
 	test.AssertTrue(t, hasState)
 }
+
+func TestSignal_ObserveStateTransitions(t *testing.T) {
+	sig := NewSignal(0, 1, 2).SetState(0)
+
+	obs := sig.ObserveStateTransitions()
+	test.AssertTrue(t, obs.C() == nil)
+
+	// the first transition contains the current state
+	change := <-obs.Transitions()
+	test.AssertEqual(t, change.From, State(0))
+	test.AssertEqual(t, change.To, State(0))
+
+	go sig.SetState(2)
+	change = <-obs.Transitions()
+	test.AssertEqual(t, change.From, State(0))
+	test.AssertEqual(t, change.To, State(2))
+	test.AssertFalse(t, change.Time.IsZero())
+
+	obs.Stop()
+	_, ok := <-obs.Transitions()
+	test.AssertFalse(t, ok)
+}
+
+func TestSignal_ObserveAll(t *testing.T) {
+	sig := NewSignal(0, 1, 2).SetState(0)
+
+	states, stop := sig.ObserveAll()
+
+	// transitions are buffered, so SetState does not block without consumer
+	sig.SetState(1)
+	sig.SetState(2)
+	sig.SetState(1)
+
+	// the first state is the current state
+	for _, expected := range []State{0, 1, 2, 1} {
+		test.AssertEqual(t, <-states, expected)
+	}
+
+	// a full buffer drops the oldest states
+	for i := 0; i < observeAllBufferSize+2; i++ {
+		sig.SetState(State(i % 3))
+	}
+	var received []State
+	for len(states) > 0 {
+		received = append(received, <-states)
+	}
+	test.AssertEqual(t, len(received), observeAllBufferSize)
+	test.AssertEqual(t, received[0], State(2))
+	test.AssertEqual(t, received[len(received)-1], sig.State())
+
+	stop()
+	_, ok := <-states
+	test.AssertFalse(t, ok)
+
+	// stopping again is a no-op
+	stop()
+}
+
+func TestSignal_StateNames(t *testing.T) {
+	sig := NewSignal(0, 1, 2).RegisterStateNames(map[State]string{
+		0: "idle",
+		1: "running",
+	}).SetState(1)
+
+	test.AssertEqual(t, sig.String(), "running")
+	test.AssertEqual(t, sig.StateName(0), "idle")
+	// states without name use their value
+	test.AssertEqual(t, sig.StateName(2), "2")
+
+	test.AssertEqual(t, newViewSignal().String(), "idle")
+	test.AssertEqual(t, newPartitionTableState().SetState(State(PartitionRecovering)).String(), "recovering")
+}
@@ -1,6 +1,7 @@
 package goka
 
 import (
+	"fmt"
 	"log"
 	"time"
 )
@@ -27,6 +28,25 @@ const (
 	PartitionRunning
 )
 
+func (ps PartitionStatus) String() string {
+	switch ps {
+	case PartitionStopped:
+		return "stopped"
+	case PartitionInitializing:
+		return "initializing"
+	case PartitionConnecting:
+		return "connecting"
+	case PartitionRecovering:
+		return "recovering"
+	case PartitionPreparing:
+		return "preparing"
+	case PartitionRunning:
+		return "running"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(ps))
+	}
+}
+
 const (
 	statsHwmUpdateInterval = 5 * time.Second
 	fetchStatsTimeout      = 10 * time.Second
@@ -40,6 +60,15 @@ type InputStats struct {
 	OffsetLag  int64
 	LastOffset int64
 	Delay      time.Duration
+	// CommittedOffset is the offset of the next message to consume after the
+	// last committed message of an input stream.
+	CommittedOffset int64
+	// HighWaterMark is the offset of the next message produced to an input
+	// stream, fetched periodically.
+	HighWaterMark int64
+	// ConsumerLag is the number of messages of an input stream not committed
+	// yet, i.e. HighWaterMark - CommittedOffset.
+	ConsumerLag int64
 }
 
 // OutputStats represents the number of messages and the number of bytes emitted
@@ -59,6 +88,13 @@ type PartitionProcStats struct {
 
 	Input  map[string]*InputStats
 	Output map[string]*OutputStats
+
+	// Restarts counts how often the partition processor was restarted after a
+	// failure (see WithPartitionRestart).
+	Restarts    uint
+	LastFailure string
+	// LastRestart is the time the partition processor was restarted the last time.
+	LastRestart time.Time
 }
 
 // RecoveryStats groups statistics during recovery
@@ -91,7 +127,15 @@ func newOutputStats() *OutputStats {
 }
 
 func (is *InputStats) clone() *InputStats {
-	return &(*is)
+	clone := *is
+	return &clone
+}
+
+// updateConsumerLag updates the lag once both offsets are known.
+func (is *InputStats) updateConsumerLag() {
+	if is.HighWaterMark > 0 && is.CommittedOffset > 0 {
+		is.ConsumerLag = is.HighWaterMark - is.CommittedOffset
+	}
 }
 
 func (os *OutputStats) clone() *OutputStats {
@@ -179,6 +223,9 @@ func (s *PartitionProcStats) clone() *PartitionProcStats {
 	pps.Joined = make(map[string]*TableStats)
 	pps.Input = inputStatsMap(s.Input).clone()
 	pps.Output = outputStatsMap(s.Output).clone()
+	pps.Restarts = s.Restarts
+	pps.LastFailure = s.LastFailure
+	pps.LastRestart = s.LastRestart
 
 	return pps
 }
@@ -209,12 +256,26 @@ func newViewStats() *ViewStats {
 type ProcessorStats struct {
 	Group  map[int32]*PartitionProcStats
 	Lookup map[string]*ViewStats
+	// EmitsInFlight is the number of in-flight emits per topic limited by
+	// WithEmitConcurrencyPerTopic
+	EmitsInFlight map[string]int
+	// ProducerQueueDepth is the number of messages buffered in the producer
+	// awaiting the broker's acknowledgement (see Emitter.QueueDepth)
+	ProducerQueueDepth int
+	// ConsumerLag is the consumer lag (see InputStats.ConsumerLag) by input
+	// stream and partition
+	ConsumerLag map[string]map[int32]int64
+	// PartitionStates are the states of the partition processors (PPStateIdle,
+	// PPStateRecovering etc.)
+	PartitionStates map[int32]State
 }
 
 func newProcessorStats(partitions int) *ProcessorStats {
 	stats := &ProcessorStats{
-		Group:  make(map[int32]*PartitionProcStats),
-		Lookup: make(map[string]*ViewStats),
+		Group:           make(map[int32]*PartitionProcStats),
+		Lookup:          make(map[string]*ViewStats),
+		ConsumerLag:     make(map[string]map[int32]int64),
+		PartitionStates: make(map[int32]State, partitions),
 	}
 
 	return stats
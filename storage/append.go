@@ -37,6 +37,13 @@ func (f *file) MarkRecovered() error {
 	return nil
 }
 
+func (f *file) Sync() error {
+	if s, ok := f.file.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
 func (f *file) Has(key string) (bool, error) {
 	return false, nil
 }
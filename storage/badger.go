@@ -0,0 +1,305 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+)
+
+// badgerGCDiscardRatio is the ratio of stale data a value log file must have to
+// be rewritten by Compact.
+const badgerGCDiscardRatio = 0.5
+
+// BuildBadger builds a Badger storage for each partition in a subdirectory of
+// the given path. If options are passed, the first one is used with its
+// directories replaced by the partition's directory, otherwise Badger's
+// default options apply.
+func BuildBadger(path string, opts ...badger.Options) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		fp := filepath.Join(path, fmt.Sprintf("%s.%d", topic, partition))
+		o := badger.DefaultOptions(fp)
+		if len(opts) > 0 {
+			o = opts[0]
+			o.Dir = fp
+			o.ValueDir = fp
+		}
+		db, err := badger.Open(o)
+		if err != nil {
+			return nil, fmt.Errorf("error opening badger (path %s): %v", fp, err)
+		}
+		return NewBadger(db), nil
+	}
+}
+
+type badgerStorage struct {
+	db *badger.DB
+}
+
+// NewBadger creates a new Storage backed by Badger. Unlike the LevelDB
+// storage, the recovery writes are not batched in a transaction, since Badger
+// limits the size of a transaction.
+func NewBadger(db *badger.DB) Storage {
+	return &badgerStorage{db: db}
+}
+
+func (s *badgerStorage) Open() error {
+	// the database is opened by the builder
+	return nil
+}
+
+// Close flushes all pending writes to disk and closes the database.
+func (s *badgerStorage) Close() error {
+	if err := s.db.Sync(); err != nil {
+		s.db.Close()
+		return fmt.Errorf("error syncing badger: %v", err)
+	}
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("error closing badger: %v", err)
+	}
+	return nil
+}
+
+func (s *badgerStorage) Has(key string) (bool, error) {
+	err := s.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(key))
+		return err
+	})
+	switch err {
+	case nil:
+		return true, nil
+	case badger.ErrKeyNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("error checking for existence in badger (key %s): %v", key, err)
+	}
+}
+
+func (s *badgerStorage) Get(key string) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		value, err = item.ValueCopy(nil)
+		return err
+	})
+	switch err {
+	case nil:
+		return value, nil
+	case badger.ErrKeyNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("error getting from badger (key %s): %v", key, err)
+	}
+}
+
+func (s *badgerStorage) Set(key string, value []byte) error {
+	err := s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(key), value)
+	})
+	if err != nil {
+		return fmt.Errorf("error setting to badger (key %s): %v", key, err)
+	}
+	return nil
+}
+
+// SetWithTTL stores the value with Badger's native expiry, which has a
+// granularity of seconds.
+func (s *badgerStorage) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	err := s.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry([]byte(key), value).WithTTL(ttl))
+	})
+	if err != nil {
+		return fmt.Errorf("error setting to badger (key %s): %v", key, err)
+	}
+	return nil
+}
+
+func (s *badgerStorage) Delete(key string) error {
+	err := s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(key))
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting from badger (key %s): %v", key, err)
+	}
+	return nil
+}
+
+func (s *badgerStorage) GetOffset(defValue int64) (int64, error) {
+	data, err := s.Get(offsetKey)
+	if err != nil {
+		return 0, err
+	}
+
+	if data == nil {
+		return defValue, nil
+	}
+
+	value, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error decoding offset: %v", err)
+	}
+
+	return value, nil
+}
+
+func (s *badgerStorage) SetOffset(offset int64) error {
+	return s.Set(offsetKey, []byte(strconv.FormatInt(offset, 10)))
+}
+
+func (s *badgerStorage) MarkRecovered() error {
+	return nil
+}
+
+// Sync flushes the value log and the write-ahead log to disk.
+func (s *badgerStorage) Sync() error {
+	if err := s.db.Sync(); err != nil {
+		return fmt.Errorf("error syncing badger: %v", err)
+	}
+	return nil
+}
+
+// ApproximateSize returns the size of the LSM tree and the value log on disk.
+func (s *badgerStorage) ApproximateSize() (int64, error) {
+	lsm, vlog := s.db.Size()
+	return lsm + vlog, nil
+}
+
+// Compact runs Badger's value log garbage collection until no more files can be
+// rewritten, which removes deleted and overwritten values from disk.
+func (s *badgerStorage) Compact() error {
+	for {
+		err := s.db.RunValueLogGC(badgerGCDiscardRatio)
+		if err == badger.ErrNoRewrite {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error compacting badger: %v", err)
+		}
+	}
+}
+
+// Iterator returns an iterator that traverses over a snapshot of the storage.
+func (s *badgerStorage) Iterator() (Iterator, error) {
+	return s.newIterator(nil, nil, nil), nil
+}
+
+// IteratorWithRange returns an iterator over a snapshot of the storage, which
+// traverses the range [start, limit) or, if limit is empty, the keys prefixed
+// with start.
+func (s *badgerStorage) IteratorWithRange(start, limit []byte) (Iterator, error) {
+	if len(limit) > 0 {
+		return s.newIterator(start, limit, nil), nil
+	}
+	return s.newIterator(start, nil, start), nil
+}
+
+func (s *badgerStorage) newIterator(start, limit, prefix []byte) *badgerIterator {
+	// a read-only transaction reads from a consistent snapshot of the database
+	txn := s.db.NewTransaction(false)
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	return &badgerIterator{
+		txn:   txn,
+		iter:  txn.NewIterator(opts),
+		start: start,
+		limit: limit,
+	}
+}
+
+// badgerIterator adapts Badger's iterator, which is positioned on the current
+// item, to the Iterator interface, which needs Next before the first item.
+type badgerIterator struct {
+	txn   *badger.Txn
+	iter  *badger.Iterator
+	start []byte
+	limit []byte
+	// whether the iterator was positioned on the first item
+	started bool
+	// whether Seek positioned the iterator on the item for the next call to Next
+	seeked bool
+	// the current item, nil before Next and after the iterator is exhausted
+	item *badger.Item
+	err  error
+}
+
+func (i *badgerIterator) Next() bool {
+	switch {
+	case i.seeked:
+		i.seeked = false
+	case !i.started:
+		i.iter.Seek(i.start)
+	default:
+		i.iter.Next()
+	}
+	i.started = true
+	i.skipOffset()
+	i.item = i.current()
+	return i.item != nil
+}
+
+// skipOffset moves the iterator past the offset key.
+func (i *badgerIterator) skipOffset() {
+	if i.iter.Valid() && string(i.iter.Item().Key()) == offsetKey {
+		i.iter.Next()
+	}
+}
+
+// current returns the item the iterator is positioned on, or nil if it is
+// exhausted.
+func (i *badgerIterator) current() *badger.Item {
+	if !i.iter.Valid() {
+		return nil
+	}
+	item := i.iter.Item()
+	if len(i.limit) > 0 && bytes.Compare(item.Key(), i.limit) >= 0 {
+		return nil
+	}
+	return item
+}
+
+func (i *badgerIterator) Err() error {
+	return i.err
+}
+
+func (i *badgerIterator) Key() []byte {
+	if i.item == nil {
+		return nil
+	}
+	return i.item.Key()
+}
+
+func (i *badgerIterator) Value() ([]byte, error) {
+	if i.item == nil {
+		return nil, nil
+	}
+	value, err := i.item.ValueCopy(nil)
+	if err != nil {
+		i.err = fmt.Errorf("error reading value from badger (key %s): %v", i.item.Key(), err)
+		return nil, i.err
+	}
+	return value, nil
+}
+
+func (i *badgerIterator) Release() {
+	i.iter.Close()
+	i.txn.Discard()
+	i.item = nil
+}
+
+func (i *badgerIterator) Seek(key []byte) bool {
+	if bytes.Compare(key, i.start) < 0 {
+		key = i.start
+	}
+	i.iter.Seek(key)
+	i.started = true
+	i.seeked = true
+	i.skipOffset()
+	i.item = nil
+	return i.current() != nil
+}
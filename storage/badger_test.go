@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/lovoo/goka/internal/test"
+)
+
+func newBadgerTestStorage(t *testing.T, path string) Storage {
+	st, err := BuildBadger(path, badger.DefaultOptions("").WithLogger(nil))("topic", 0)
+	test.AssertNil(t, err)
+	test.AssertNil(t, st.Open())
+	return st
+}
+
+func TestBadger(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "goka_storage_TestBadger")
+	test.AssertNil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	st := newBadgerTestStorage(t, tmpdir)
+
+	has, err := st.Has("key")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, has)
+	value, err := st.Get("key")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, value == nil)
+
+	test.AssertNil(t, st.Set("key", []byte("value")))
+	has, err = st.Has("key")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, has)
+	value, err = st.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, value, []byte("value"))
+
+	test.AssertNil(t, st.Delete("key"))
+	has, err = st.Has("key")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, has)
+
+	offset, err := st.GetOffset(-2)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, offset, int64(-2))
+	test.AssertNil(t, st.SetOffset(777))
+	test.AssertNil(t, st.Set("persisted", []byte("value")))
+	test.AssertNil(t, st.MarkRecovered())
+	test.AssertNil(t, st.Close())
+
+	// the writes survive reopening the storage
+	st = newBadgerTestStorage(t, tmpdir)
+	defer st.Close()
+	offset, err = st.GetOffset(-2)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, offset, int64(777))
+	value, err = st.Get("persisted")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, value, []byte("value"))
+}
+
+func TestBadgerIterator(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "goka_storage_TestBadgerIterator")
+	test.AssertNil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	st := newBadgerTestStorage(t, tmpdir)
+	defer st.Close()
+
+	for _, key := range []string{"a-1", "a-2", "a-3", "b-1"} {
+		test.AssertNil(t, st.Set(key, []byte(fmt.Sprintf("val-%s", key))))
+	}
+	test.AssertNil(t, st.SetOffset(777))
+
+	collect := func(iter Iterator) []string {
+		defer iter.Release()
+		var keys []string
+		for iter.Next() {
+			value, err := iter.Value()
+			test.AssertNil(t, err)
+			test.AssertEqual(t, string(value), fmt.Sprintf("val-%s", iter.Key()))
+			keys = append(keys, string(iter.Key()))
+		}
+		test.AssertNil(t, iter.Err())
+		return keys
+	}
+
+	t.Run("all", func(t *testing.T) {
+		iter, err := st.Iterator()
+		test.AssertNil(t, err)
+
+		// accessing the iterator before Next returns nils
+		value, err := iter.Value()
+		test.AssertNil(t, err)
+		test.AssertTrue(t, value == nil)
+
+		// the offset key is skipped
+		test.AssertEqual(t, collect(iter), []string{"a-1", "a-2", "a-3", "b-1"})
+	})
+	t.Run("prefix", func(t *testing.T) {
+		iter, err := st.IteratorWithRange([]byte("a-"), nil)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, collect(iter), []string{"a-1", "a-2", "a-3"})
+	})
+	t.Run("range", func(t *testing.T) {
+		iter, err := st.IteratorWithRange([]byte("a-2"), []byte("b-1"))
+		test.AssertNil(t, err)
+		test.AssertEqual(t, collect(iter), []string{"a-2", "a-3"})
+	})
+	t.Run("seek", func(t *testing.T) {
+		iter, err := st.Iterator()
+		test.AssertNil(t, err)
+		test.AssertTrue(t, iter.Seek([]byte("a-3")))
+		test.AssertEqual(t, collect(iter), []string{"a-3", "b-1"})
+	})
+	t.Run("snapshot", func(t *testing.T) {
+		iter, err := st.IteratorWithRange([]byte("a-"), nil)
+		test.AssertNil(t, err)
+
+		// writes after creating the iterator are not visible
+		test.AssertNil(t, st.Set("a-4", []byte("val-a-4")))
+		test.AssertNil(t, st.Delete("a-1"))
+		test.AssertEqual(t, collect(iter), []string{"a-1", "a-2", "a-3"})
+	})
+}
+
+func TestBadgerTTL(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "goka_storage_TestBadgerTTL")
+	test.AssertNil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	st := NewTTLStorage(newBadgerTestStorage(t, tmpdir), time.Second)
+	defer st.Close()
+
+	// badger expires the values natively
+	_, native := st.(*nativeTTLStorage)
+	test.AssertTrue(t, native)
+
+	test.AssertNil(t, st.Set("key", []byte("value")))
+	test.AssertNil(t, st.SetWithTTL("long", []byte("value"), time.Hour))
+	value, err := st.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, value, []byte("value"))
+
+	// the expiry is rounded to seconds
+	time.Sleep(2 * time.Second)
+	has, err := st.Has("key")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, has)
+	has, err = st.Has("long")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, has)
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"path/filepath"
 
-	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 )
 
@@ -17,27 +16,52 @@ type Builder func(topic string, partition int32) (Storage, error)
 func DefaultBuilder(path string) Builder {
 	return func(topic string, partition int32) (Storage, error) {
 		fp := filepath.Join(path, fmt.Sprintf("%s.%d", topic, partition))
-		db, err := leveldb.OpenFile(fp, nil)
+		db, err := openLevelDB(fp, nil)
 		if err != nil {
-			return nil, fmt.Errorf("error opening leveldb: %v", err)
+			return nil, err
 		}
 		return New(db)
 	}
 }
 
+// PathFuncBuilder builds a LevelDB storage with default configuration in the
+// path returned by pathFunc for each partition, e.g. to spread the partitions
+// over several disks.
+func PathFuncBuilder(pathFunc func(topic string, partition int32) string) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		return DefaultBuilder(pathFunc(topic, partition))(topic, partition)
+	}
+}
+
 // BuilderWithOptions builds LevelDB storage with the given options and
 // in the given path.
 func BuilderWithOptions(path string, opts *opt.Options) Builder {
 	return func(topic string, partition int32) (Storage, error) {
 		fp := filepath.Join(path, fmt.Sprintf("%s.%d", topic, partition))
-		db, err := leveldb.OpenFile(fp, opts)
+		db, err := openLevelDB(fp, opts)
 		if err != nil {
-			return nil, fmt.Errorf("error opening leveldb: %v", err)
+			return nil, err
 		}
 		return New(db)
 	}
 }
 
+// ReadOnlyBuilder opens existing LevelDB storages in the given path in
+// read-only mode, e.g. to analyze a copy of a table's local storage.
+func ReadOnlyBuilder(path string) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		fp := filepath.Join(path, fmt.Sprintf("%s.%d", topic, partition))
+		db, err := openLevelDB(fp, &opt.Options{
+			ReadOnly:       true,
+			ErrorIfMissing: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return NewReadOnly(db)
+	}
+}
+
 // MemoryBuilder builds in-memory storage.
 func MemoryBuilder() Builder {
 	return func(topic string, partition int32) (Storage, error) {
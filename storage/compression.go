@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/golang/snappy"
+)
+
+// compressionMagic prefixes the compressed values, followed by the id of the
+// compression codec. Values without it were stored uncompressed.
+var compressionMagic = []byte{0, 'g', 'k', 'c'}
+
+// CompressionCodec compresses the values of a storage, see NewCompressionStorage.
+type CompressionCodec struct {
+	id         byte
+	name       string
+	compress   ValueTransform
+	decompress ValueTransform
+}
+
+var (
+	// CompressionGzip compresses values with gzip.
+	CompressionGzip = &CompressionCodec{id: 1, name: "gzip", compress: gzipCompress, decompress: gzipDecompress}
+	// CompressionSnappy compresses values with snappy, which is faster than gzip
+	// but compresses less.
+	CompressionSnappy = &CompressionCodec{id: 2, name: "snappy", compress: snappyCompress, decompress: snappyDecompress}
+
+	compressionCodecs = map[byte]*CompressionCodec{
+		CompressionGzip.id:   CompressionGzip,
+		CompressionSnappy.id: CompressionSnappy,
+	}
+)
+
+func (c *CompressionCodec) String() string {
+	return c.name
+}
+
+// NewCompressionStorage wraps st so that values are compressed with codec
+// before being stored and decompressed after being read (including iterators).
+// Keys and offsets are stored uncompressed.
+// Stored values carry a header identifying their codec, so values stored
+// uncompressed (e.g. before enabling the compression) or with another codec are
+// still read, and the compression can be enabled on an existing storage.
+func NewCompressionStorage(st Storage, codec *CompressionCodec) Storage {
+	return NewTransformStorage(st, codec.encode, decompress)
+}
+
+// CompressionBuilder wraps the storages created by builder with NewCompressionStorage.
+func CompressionBuilder(builder Builder, codec *CompressionCodec) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		st, err := builder(topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		return NewCompressionStorage(st, codec), nil
+	}
+}
+
+// encode compresses the value and prefixes it with the header.
+func (c *CompressionCodec) encode(value []byte) ([]byte, error) {
+	compressed, err := c.compress(value)
+	if err != nil {
+		return nil, fmt.Errorf("error compressing with %s: %v", c, err)
+	}
+	encoded := make([]byte, 0, len(compressionMagic)+1+len(compressed))
+	encoded = append(encoded, compressionMagic...)
+	encoded = append(encoded, c.id)
+	return append(encoded, compressed...), nil
+}
+
+// decompress decompresses a value with the codec of its header. Values without
+// header are returned unmodified.
+func decompress(value []byte) ([]byte, error) {
+	if !bytes.HasPrefix(value, compressionMagic) || len(value) == len(compressionMagic) {
+		return value, nil
+	}
+	id := value[len(compressionMagic)]
+	codec, ok := compressionCodecs[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression codec %d", id)
+	}
+	plain, err := codec.decompress(value[len(compressionMagic)+1:])
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing with %s: %v", codec, err)
+	}
+	return plain, nil
+}
+
+func gzipCompress(value []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(value); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gzipDecompress(value []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(value))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func snappyCompress(value []byte) ([]byte, error) {
+	return snappy.Encode(nil, value), nil
+}
+
+func snappyDecompress(value []byte) ([]byte, error) {
+	return snappy.Decode(nil, value)
+}
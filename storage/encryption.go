@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrDecryption is returned when a stored value or key fails the authentication
+// on decryption, e.g. because it was modified or encrypted with another key.
+var ErrDecryption = errors.New("stored data failed authentication")
+
+// EncryptionOption configures the storage created by NewEncryptionStorage.
+type EncryptionOption func(s *encryptionStorage)
+
+// EncryptKeys encrypts the keys as well. Since the keys must be found by Get,
+// they are encrypted deterministically: the nonce of a key is derived from the
+// key with HMAC-SHA256 and secret, so the same key is always stored the same.
+// The stored keys are ordered by their ciphertext, so IteratorWithRange and the
+// iterators' Seek are not supported.
+func EncryptKeys(secret []byte) EncryptionOption {
+	return func(s *encryptionStorage) {
+		s.keySecret = secret
+	}
+}
+
+// encryptionStorage wraps a storage and encrypts all values (and keys) when
+// being written and decrypts them when being read.
+type encryptionStorage struct {
+	Storage
+	aead      cipher.AEAD
+	keySecret []byte
+}
+
+// NewEncryptionStorage wraps st so that values are encrypted with aead before
+// being stored and decrypted after being read (including iterators). Every value
+// is encrypted with a random nonce, which is prepended to the ciphertext, and is
+// authenticated together with its key, so a value moved to another key fails to
+// decrypt with ErrDecryption.
+// Offsets are stored unencrypted, since the wrapped storage reads and writes
+// them itself.
+func NewEncryptionStorage(st Storage, aead cipher.AEAD, opts ...EncryptionOption) Storage {
+	s := &encryptionStorage{
+		Storage: st,
+		aead:    aead,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// EncryptionBuilder wraps the storages created by builder with NewEncryptionStorage.
+func EncryptionBuilder(builder Builder, aead cipher.AEAD, opts ...EncryptionOption) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		st, err := builder(topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		return NewEncryptionStorage(st, aead, opts...), nil
+	}
+}
+
+// storedKey returns the key as stored in the wrapped storage.
+func (s *encryptionStorage) storedKey(key string) string {
+	if s.keySecret == nil {
+		return key
+	}
+	mac := hmac.New(sha256.New, s.keySecret)
+	mac.Write([]byte(key))
+	nonce := mac.Sum(nil)[:s.aead.NonceSize()]
+	return string(s.aead.Seal(nonce, nonce, []byte(key), nil))
+}
+
+// plainKey decrypts a key read from the wrapped storage.
+func (s *encryptionStorage) plainKey(stored []byte) ([]byte, error) {
+	if s.keySecret == nil {
+		return stored, nil
+	}
+	return s.open(stored, nil)
+}
+
+func (s *encryptionStorage) seal(key string, value []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(value)+s.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("error creating nonce: %v", err)
+	}
+	return s.aead.Seal(nonce, nonce, value, []byte(key)), nil
+}
+
+func (s *encryptionStorage) open(data []byte, key []byte) ([]byte, error) {
+	size := s.aead.NonceSize()
+	if len(data) < size {
+		return nil, ErrDecryption
+	}
+	plain, err := s.aead.Open(nil, data[:size], data[size:], key)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return plain, nil
+}
+
+func (s *encryptionStorage) Has(key string) (bool, error) {
+	return s.Storage.Has(s.storedKey(key))
+}
+
+func (s *encryptionStorage) Get(key string) ([]byte, error) {
+	value, err := s.Storage.Get(s.storedKey(key))
+	if err != nil || value == nil {
+		return value, err
+	}
+	plain, err := s.open(value, []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting stored value for key %s: %w", key, err)
+	}
+	return plain, nil
+}
+
+func (s *encryptionStorage) Set(key string, value []byte) error {
+	sealed, err := s.seal(key, value)
+	if err != nil {
+		return fmt.Errorf("error encrypting value for key %s: %v", key, err)
+	}
+	return s.Storage.Set(s.storedKey(key), sealed)
+}
+
+func (s *encryptionStorage) Delete(key string) error {
+	return s.Storage.Delete(s.storedKey(key))
+}
+
+func (s *encryptionStorage) Iterator() (Iterator, error) {
+	iter, err := s.Storage.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	return &encryptionIterator{Iterator: iter, s: s}, nil
+}
+
+func (s *encryptionStorage) IteratorWithRange(start, limit []byte) (Iterator, error) {
+	if s.keySecret != nil {
+		return nil, ErrUnsupported
+	}
+	iter, err := s.Storage.IteratorWithRange(start, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptionIterator{Iterator: iter, s: s}, nil
+}
+
+func (s *encryptionStorage) ReverseIterator() (Iterator, error) {
+	if s.keySecret != nil {
+		return nil, ErrUnsupported
+	}
+	iter, err := ReverseIterator(s.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptionIterator{Iterator: iter, s: s}, nil
+}
+
+func (s *encryptionStorage) ApproximateSize() (int64, error) {
+	return ApproximateSize(s.Storage)
+}
+
+func (s *encryptionStorage) Compact() error {
+	return Compact(s.Storage)
+}
+
+// encryptionIterator decrypts the keys and values of the wrapped iterator when
+// they are accessed.
+type encryptionIterator struct {
+	Iterator
+	s *encryptionStorage
+
+	// decrypted key of the current position, nil if not decrypted yet
+	key []byte
+	err error
+}
+
+func (i *encryptionIterator) Next() bool {
+	i.key = nil
+	return i.Iterator.Next()
+}
+
+func (i *encryptionIterator) Err() error {
+	if err := i.Iterator.Err(); err != nil {
+		return err
+	}
+	return i.err
+}
+
+// plainKey decrypts the current key, recording the error of a key failing the
+// authentication to be returned by Err.
+func (i *encryptionIterator) plainKey() ([]byte, error) {
+	if i.key != nil {
+		return i.key, nil
+	}
+	key, err := i.s.plainKey(i.Iterator.Key())
+	if err != nil {
+		err = fmt.Errorf("error decrypting stored key: %w", err)
+		i.err = err
+		return nil, err
+	}
+	i.key = key
+	return key, nil
+}
+
+// Key returns the decrypted key or nil if it fails the authentication.
+func (i *encryptionIterator) Key() []byte {
+	key, _ := i.plainKey()
+	return key
+}
+
+func (i *encryptionIterator) Value() ([]byte, error) {
+	key, err := i.plainKey()
+	if err != nil {
+		return nil, err
+	}
+	value, err := i.Iterator.Value()
+	if err != nil || value == nil {
+		return value, err
+	}
+	plain, err := i.s.open(value, key)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting stored value for key %s: %w", key, err)
+	}
+	return plain, nil
+}
+
+// Seek is not supported with encrypted keys and returns false.
+func (i *encryptionIterator) Seek(key []byte) bool {
+	i.key = nil
+	if i.s.keySecret != nil {
+		i.err = ErrUnsupported
+		return false
+	}
+	return i.Iterator.Seek(key)
+}
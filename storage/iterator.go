@@ -44,5 +44,9 @@ func (i *iterator) Release() {
 }
 
 func (i *iterator) Seek(key []byte) bool {
-	return i.iter.Seek(key)
+	seek := i.iter.Seek(key)
+	if seek && string(i.iter.Key()) == offsetKey {
+		seek = i.iter.Next()
+	}
+	return seek
 }
@@ -0,0 +1,10 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package storage
+
+// isLockError returns whether err is caused by a file lock held by another process.
+// Lock errors are not detected on this platform.
+func isLockError(err error) bool {
+	return false
+}
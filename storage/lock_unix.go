@@ -0,0 +1,14 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package storage
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isLockError returns whether err is caused by a file lock held by another process.
+func isLockError(err error) bool {
+	return errors.Is(err, syscall.EWOULDBLOCK)
+}
@@ -3,7 +3,7 @@ package storage
 import (
 	"bytes"
 	"fmt"
-	"strings"
+	"sort"
 
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
@@ -12,6 +12,8 @@ type memiter struct {
 	current int
 	keys    []string
 	storage map[string][]byte
+	// keys are sorted in descending order
+	reverse bool
 }
 
 func (i *memiter) exhausted() bool {
@@ -51,21 +53,31 @@ func (i *memiter) Release() {
 	i.current = len(i.keys)
 }
 
+// Seek positions the iterator at the first key greater or equal to key (less
+// or equal if reverse), like the LevelDB iterator.
 func (i *memiter) Seek(key []byte) bool {
-	seek := make(map[string][]byte)
-	keys := []string{}
-	for k, v := range i.storage {
-		if strings.Contains(k, string(key)) {
-			keys = append(keys, k)
-			seek[k] = v
-		}
+	if i.reverse {
+		i.current = sort.Search(len(i.keys), func(n int) bool { return i.keys[n] <= string(key) })
+	} else {
+		i.current = sort.SearchStrings(i.keys, string(key))
+	}
+	if string(i.Key()) == offsetKey {
+		i.current++
 	}
-	i.current = -1
-	i.storage = seek
-	i.keys = keys
 	return !i.exhausted()
 }
 
+// Snapshotter is implemented by storages that can copy all their key-value
+// pairs and load them back, e.g. to set up the state of a table in tests without
+// replaying its messages. It is supported by the memory storage (NewMemory).
+type Snapshotter interface {
+	// Snapshot returns a copy of all key-value pairs.
+	Snapshot() map[string][]byte
+	// Restore replaces all key-value pairs with a copy of the snapshot. Keys
+	// with nil values are skipped. The offset is not changed.
+	Restore(snapshot map[string][]byte)
+}
+
 type memory struct {
 	storage   map[string][]byte
 	offset    *int64
@@ -108,8 +120,20 @@ func (m *memory) Iterator() (Iterator, error) {
 	for k := range m.storage {
 		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 
-	return &memiter{-1, keys, m.storage}, nil
+	return &memiter{-1, keys, m.storage, false}, nil
+}
+
+// ReverseIterator returns an iterator over the keys in descending order.
+func (m *memory) ReverseIterator() (Iterator, error) {
+	keys := make([]string, 0, len(m.storage))
+	for k := range m.storage {
+		keys = append(keys, k)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+
+	return &memiter{-1, keys, m.storage, true}, nil
 }
 
 func (m *memory) IteratorWithRange(start, limit []byte) (Iterator, error) {
@@ -118,18 +142,47 @@ func (m *memory) IteratorWithRange(start, limit []byte) (Iterator, error) {
 		limit = util.BytesPrefix(start).Limit
 	}
 	for k := range m.storage {
-		if bytes.Compare([]byte(k), start) > -1 && bytes.Compare([]byte(k), limit) < 1 {
+		if bytes.Compare([]byte(k), start) > -1 && bytes.Compare([]byte(k), limit) < 0 {
 			keys = append(keys, k)
 		}
 	}
+	sort.Strings(keys)
+
+	return &memiter{-1, keys, m.storage, false}, nil
+}
+
+// Snapshot returns a copy of all key-value pairs.
+func (m *memory) Snapshot() map[string][]byte {
+	snapshot := make(map[string][]byte, len(m.storage))
+	for key, value := range m.storage {
+		if key == offsetKey {
+			continue
+		}
+		snapshot[key] = append([]byte{}, value...)
+	}
+	return snapshot
+}
 
-	return &memiter{-1, keys, m.storage}, nil
+// Restore replaces all key-value pairs with a copy of the snapshot.
+func (m *memory) Restore(snapshot map[string][]byte) {
+	m.storage = make(map[string][]byte, len(snapshot))
+	for key, value := range snapshot {
+		if value == nil {
+			continue
+		}
+		m.storage[key] = append([]byte{}, value...)
+	}
 }
 
 func (m *memory) MarkRecovered() error {
 	return nil
 }
 
+// Sync does nothing, since the memory storage is not durable.
+func (m *memory) Sync() error {
+	return nil
+}
+
 func (m *memory) Recovered() bool {
 	return m.recovered
 }
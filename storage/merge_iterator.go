@@ -15,6 +15,15 @@ func (h iterHeap) Less(i, j int) bool {
 	return bytes.Compare(h[i].Key(), h[j].Key()) == -1
 }
 
+// reverseIterHeap orders the iterators by their keys in descending order.
+type reverseIterHeap struct {
+	*iterHeap
+}
+
+func (h reverseIterHeap) Less(i, j int) bool {
+	return bytes.Compare((*h.iterHeap)[i].Key(), (*h.iterHeap)[j].Key()) == 1
+}
+
 func (h iterHeap) Swap(i, j int) {
 	h[i], h[j] = h[j], h[i]
 }
@@ -35,7 +44,9 @@ type mergeIterator struct {
 	value []byte
 	err   error
 
-	heap  iterHeap
+	heap iterHeap
+	// orders the heap, i.e. &heap or reverseIterHeap for descending keys
+	order heap.Interface
 	iters []Iterator
 }
 
@@ -47,6 +58,22 @@ func NewMultiIterator(iters []Iterator) Iterator {
 		iters: iters,
 		heap:  make([]Iterator, 0, len(iters)),
 	}
+	miter.order = &miter.heap
+
+	miter.buildHeap(func(i Iterator) bool { return i.Next() })
+
+	return miter
+}
+
+// NewReverseMultiIterator returns an Iterator that iterates over the given
+// subiterators in reverse lexicographical order given that the subiterators
+// return values in reverse order, e.g. created with ReverseIterator.
+func NewReverseMultiIterator(iters []Iterator) Iterator {
+	miter := &mergeIterator{
+		iters: iters,
+		heap:  make([]Iterator, 0, len(iters)),
+	}
+	miter.order = reverseIterHeap{&miter.heap}
 
 	miter.buildHeap(func(i Iterator) bool { return i.Next() })
 
@@ -65,7 +92,7 @@ func (m *mergeIterator) buildHeap(hasValue func(i Iterator) bool) {
 			continue
 		}
 
-		heap.Push(&m.heap, iter)
+		heap.Push(m.order, iter)
 	}
 }
 
@@ -102,7 +129,7 @@ func (m *mergeIterator) Next() bool {
 		return false
 	}
 
-	iter := heap.Pop(&m.heap).(Iterator)
+	iter := heap.Pop(m.order).(Iterator)
 
 	// cache the values as the underlying iterator might reuse its buffers on
 	// call to Next
@@ -115,7 +142,7 @@ func (m *mergeIterator) Next() bool {
 	m.value = append(m.value[:0], val...)
 
 	if iter.Next() {
-		heap.Push(&m.heap, iter)
+		heap.Push(m.order, iter)
 	} else if m.err = iter.Err(); m.err != nil {
 		return false
 	}
@@ -16,6 +16,11 @@ func (n *Null) MarkRecovered() error {
 	return nil
 }
 
+// Sync does nothing.
+func (n *Null) Sync() error {
+	return nil
+}
+
 // Recovered returns whether the storage has recovered.
 func (n *Null) Recovered() bool {
 	return n.recovered
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	lerrors "github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	lstorage "github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+var (
+	// ErrLocked indicates that a storage could not be opened because it is
+	// locked by another process (or another storage in this process), e.g. an
+	// instance that is still shutting down.
+	ErrLocked = errors.New("storage locked by another process")
+	// ErrCorrupted indicates that a storage could not be opened because its
+	// files are corrupted.
+	ErrCorrupted = errors.New("storage corrupted")
+)
+
+// openError wraps errors occurring when opening a storage, so they can be checked
+// with errors.Is against ErrLocked and ErrCorrupted.
+type openError struct {
+	kind error
+	err  error
+}
+
+func (e *openError) Error() string {
+	return fmt.Sprintf("%v: %v", e.kind, e.err)
+}
+
+func (e *openError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *openError) Unwrap() error {
+	return e.err
+}
+
+// openLevelDB opens the leveldb in path, classifying lock and corruption errors.
+func openLevelDB(path string, opts *opt.Options) (*leveldb.DB, error) {
+	db, err := leveldb.OpenFile(path, opts)
+	switch {
+	case err == nil:
+		return db, nil
+	case err == lstorage.ErrLocked || isLockError(err):
+		err = &openError{kind: ErrLocked, err: err}
+	case lerrors.IsCorrupted(err):
+		err = &openError{kind: ErrCorrupted, err: err}
+	}
+	return nil, fmt.Errorf("error opening leveldb: %w", err)
+}
+
+// RetryBuilder wraps builder to retry building a storage that is locked by
+// another process (see ErrLocked). It makes up to attempts attempts, waiting
+// backoff(attempt) before the next one, where attempt starts at 1.
+// This helps when an instance is restarted while the previous instance has not
+// released the storage yet.
+func RetryBuilder(builder Builder, attempts int, backoff func(attempt int) time.Duration) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		var (
+			st  Storage
+			err error
+		)
+		for attempt := 1; ; attempt++ {
+			st, err = builder(topic, partition)
+			if err == nil || !errors.Is(err, ErrLocked) || attempt >= attempts {
+				return st, err
+			}
+			time.Sleep(backoff(attempt))
+		}
+	}
+}
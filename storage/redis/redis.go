@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/lovoo/goka/storage"
 
@@ -38,14 +39,10 @@ func (s *redisStorage) Has(key string) (bool, error) {
 }
 
 func (s *redisStorage) Get(key string) ([]byte, error) {
-	has, err := s.client.HExists(s.hash, key).Result()
-	if err != nil {
-		return nil, fmt.Errorf("error checking for existence in redis (key %s): %v", key, err)
-	} else if !has {
-		return nil, nil
-	}
 	value, err := s.client.HGet(s.hash, key).Bytes()
-	if err != nil {
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
 		return nil, fmt.Errorf("error getting from redis (key %s): %v", key, err)
 	}
 	return value, nil
@@ -83,38 +80,46 @@ func (s *redisStorage) Delete(key string) error {
 	return s.client.HDel(s.hash, key).Err()
 }
 
+// Iterator returns an iterator scanning the hash with a cursor. Since the
+// iterator does not use a snapshot, it may miss or repeat keys that are
+// modified while iterating.
 func (s *redisStorage) Iterator() (storage.Iterator, error) {
-	var current uint64
-	var keys []string
-	var err error
+	return newIterator(s.client, s.hash, "", nil, nil), nil
+}
 
-	keys, current, err = s.client.HScan(s.hash, current, "", 0).Result()
-	if err != nil {
-		return nil, err
+// IteratorWithRange returns an iterator over the keys in the range
+// [start, limit), or the keys with the prefix start if limit is empty. Redis
+// hashes are not ordered, so the keys are neither returned in order nor can the
+// scan be restricted to a range, except for the prefix.
+func (s *redisStorage) IteratorWithRange(start, limit []byte) (storage.Iterator, error) {
+	if len(limit) == 0 {
+		return newIterator(s.client, s.hash, escapePattern(string(start))+"*", nil, nil), nil
 	}
-	return &redisIterator{
-		current: current,
-		keys:    keys,
-		client:  s.client,
-		hash:    s.hash,
-	}, nil
+	return newIterator(s.client, s.hash, "", start, limit), nil
 }
 
-func (s *redisStorage) IteratorWithRange(start, limit []byte) (storage.Iterator, error) {
-	var current uint64
-	var keys []string
-	var err error
+func newIterator(client hashScanner, hash, match string, start, limit []byte) *redisIterator {
+	return &redisIterator{
+		client: client,
+		hash:   hash,
+		match:  match,
+		start:  start,
+		limit:  limit,
+		pos:    -2,
+	}
+}
 
-	keys, current, err = s.client.HScan(s.hash, current, string(start), 0).Result()
-	if err != nil {
-		return nil, err
+// escapePattern escapes the special characters of redis glob-style patterns.
+func escapePattern(s string) string {
+	var escaped strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\', '^', '-':
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(r)
 	}
-	return &redisIterator{
-		current: current,
-		keys:    keys,
-		client:  s.client,
-		hash:    s.hash,
-	}, nil
+	return escaped.String()
 }
 
 func (s *redisStorage) Recovered() bool {
@@ -125,6 +130,12 @@ func (s *redisStorage) MarkRecovered() error {
 	return nil
 }
 
+// Sync does nothing, the durability of the writes depends on the persistence
+// configured in redis.
+func (s *redisStorage) Sync() error {
+	return nil
+}
+
 func (s *redisStorage) Open() error {
 	return nil
 }
@@ -133,49 +144,91 @@ func (s *redisStorage) Close() error {
 	return nil
 }
 
-type redisIterator struct {
-	current uint64
-	keys    []string
-	client  *redis.Client
-	hash    string
+// scanCount is the number of fields requested per HSCAN call
+const scanCount = 100
+
+// hashScanner scans the fields of a hash, e.g. a *redis.Client.
+type hashScanner interface {
+	HScan(key string, cursor uint64, match string, count int64) *redis.ScanCmd
 }
 
-func (i *redisIterator) exhausted() bool {
-	return uint64(len(i.keys)) <= i.current
+type redisIterator struct {
+	client hashScanner
+	hash   string
+	match  string
+	// keys outside [start, limit) are skipped if set
+	start, limit []byte
+
+	cursor   uint64
+	scanned  bool
+	released bool
+	// the current page of the scan, alternating keys and values
+	page []string
+	pos  int
+	err  error
 }
 
 func (i *redisIterator) Next() bool {
-	i.current++
-	if string(i.Key()) == offsetKey {
-		i.current++
+	for !i.released && i.err == nil {
+		i.pos += 2
+		if i.pos >= len(i.page) {
+			if i.scanned && i.cursor == 0 {
+				return false
+			}
+			i.page, i.cursor, i.err = i.client.HScan(i.hash, i.cursor, i.match, scanCount).Result()
+			i.scanned = true
+			i.pos = -2
+			continue
+		}
+		if i.pos+1 < len(i.page) && i.inRange(i.page[i.pos]) {
+			return true
+		}
 	}
-	return !i.exhausted()
+	return false
+}
+
+func (i *redisIterator) inRange(key string) bool {
+	if key == offsetKey {
+		return false
+	}
+	if i.start != nil && key < string(i.start) {
+		return false
+	}
+	return len(i.limit) == 0 || key < string(i.limit)
+}
+
+func (i *redisIterator) valid() bool {
+	return !i.released && i.pos >= 0 && i.pos+1 < len(i.page)
 }
 
 func (i *redisIterator) Key() []byte {
-	if i.exhausted() {
+	if !i.valid() {
 		return nil
 	}
-	key := i.keys[i.current]
-	return []byte(key)
+	return []byte(i.page[i.pos])
 }
 
 func (i *redisIterator) Err() error {
-	return nil
+	return i.err
 }
 
 func (i *redisIterator) Value() ([]byte, error) {
-	if i.exhausted() {
+	if !i.valid() {
 		return nil, nil
 	}
-	key := i.keys[i.current]
-	return i.client.HGet(i.hash, key).Bytes()
+	return []byte(i.page[i.pos+1]), nil
 }
 
 func (i *redisIterator) Release() {
-	i.current = uint64(len(i.keys))
+	i.released = true
+	i.page = nil
 }
 
+// Seek skips the keys lower than key. Since the hash is not ordered, it can
+// only filter the remaining keys, so it returns whether the scan may have
+// more keys.
 func (i *redisIterator) Seek(key []byte) bool {
-	return !i.exhausted()
+	i.start = key
+	exhausted := i.scanned && i.cursor == 0 && i.pos+2 >= len(i.page)
+	return !i.released && i.err == nil && !exhausted
 }
@@ -0,0 +1,112 @@
+package redis
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+
+	redis "gopkg.in/redis.v5"
+)
+
+// scanPage is the result of one HSCAN call.
+type scanPage struct {
+	fields []string
+	next   uint64
+	err    error
+}
+
+// fakeScanner returns the pages by the cursor they were requested with and
+// records the requested cursors.
+type fakeScanner struct {
+	t       *testing.T
+	pages   map[uint64]scanPage
+	cursors []uint64
+}
+
+func (s *fakeScanner) HScan(key string, cursor uint64, match string, count int64) *redis.ScanCmd {
+	test.AssertEqual(s.t, key, "hash")
+	test.AssertEqual(s.t, count, int64(scanCount))
+	s.cursors = append(s.cursors, cursor)
+	page, ok := s.pages[cursor]
+	if !ok {
+		s.t.Fatalf("unexpected cursor %d", cursor)
+	}
+	return redis.NewScanCmdResult(page.fields, page.next, page.err)
+}
+
+func iterate(t *testing.T, it *redisIterator) map[string]string {
+	values := make(map[string]string)
+	for it.Next() {
+		value, err := it.Value()
+		test.AssertNil(t, err)
+		values[string(it.Key())] = string(value)
+	}
+	return values
+}
+
+func TestRedisIterator(t *testing.T) {
+	t.Run("multiple_pages", func(t *testing.T) {
+		scanner := &fakeScanner{t: t, pages: map[uint64]scanPage{
+			0:  {fields: []string{"a", "1", offsetKey, "5"}, next: 17},
+			17: {fields: []string{"b", "2", "c", "3"}, next: 42},
+			// redis may return empty pages before the scan is complete
+			42: {next: 9},
+			9:  {fields: []string{"d", "4"}},
+		}}
+		it := newIterator(scanner, "hash", "", nil, nil)
+		defer it.Release()
+
+		test.AssertEqual(t, iterate(t, it), map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"})
+		test.AssertNil(t, it.Err())
+		test.AssertEqual(t, scanner.cursors, []uint64{0, 17, 42, 9})
+
+		// the exhausted iterator doesn't scan again
+		test.AssertFalse(t, it.Next())
+		test.AssertEqual(t, len(scanner.cursors), 4)
+		test.AssertNil(t, it.Key())
+	})
+	t.Run("empty", func(t *testing.T) {
+		scanner := &fakeScanner{t: t, pages: map[uint64]scanPage{
+			0: {},
+		}}
+		it := newIterator(scanner, "hash", "", nil, nil)
+		defer it.Release()
+
+		test.AssertFalse(t, it.Next())
+		test.AssertNil(t, it.Err())
+		test.AssertNil(t, it.Key())
+		value, err := it.Value()
+		test.AssertNil(t, err)
+		test.AssertNil(t, value)
+		test.AssertEqual(t, scanner.cursors, []uint64{0})
+	})
+	t.Run("range", func(t *testing.T) {
+		scanner := &fakeScanner{t: t, pages: map[uint64]scanPage{
+			0: {fields: []string{"a", "1", "b", "2"}, next: 3},
+			3: {fields: []string{"c", "3", "d", "4"}},
+		}}
+		it := newIterator(scanner, "hash", "", []byte("b"), []byte("d"))
+		defer it.Release()
+
+		test.AssertEqual(t, iterate(t, it), map[string]string{"b": "2", "c": "3"})
+		test.AssertNil(t, it.Err())
+	})
+	t.Run("fail", func(t *testing.T) {
+		scanErr := errors.New("connection lost")
+		scanner := &fakeScanner{t: t, pages: map[uint64]scanPage{
+			0: {fields: []string{"a", "1"}, next: 5},
+			5: {err: scanErr},
+		}}
+		it := newIterator(scanner, "hash", "", nil, nil)
+		defer it.Release()
+
+		test.AssertEqual(t, iterate(t, it), map[string]string{"a": "1"})
+		test.AssertEqual(t, it.Err(), scanErr)
+	})
+}
+
+func TestEscapePattern(t *testing.T) {
+	test.AssertEqual(t, escapePattern("key"), "key")
+	test.AssertEqual(t, escapePattern("a*b?[c]"), `a\*b\?\[c\]`)
+}
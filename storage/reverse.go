@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"bytes"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	ldbiter "github.com/syndtr/goleveldb/leveldb/iterator"
+)
+
+// ReverseIterable is implemented by storages that can iterate over their keys
+// in descending order. It is supported by the LevelDB storage (New,
+// DefaultBuilder etc.) and the memory storage (NewMemory), as well as by
+// NewTransformStorage, NewCompressionStorage and NewEncryptionStorage (without
+// EncryptKeys) wrapping them. Other storages, e.g. redis, the append-only file
+// storage or NewTTLStorage, do not support it.
+type ReverseIterable interface {
+	// ReverseIterator returns an iterator that traverses over a snapshot of the
+	// storage in descending key order. Its Seek moves the iterator to the
+	// key-value pair with the greatest key less or equal to the given key.
+	ReverseIterator() (Iterator, error)
+}
+
+// ReverseIterator returns an iterator over st in descending key order or
+// ErrUnsupported if st does not implement ReverseIterable.
+func ReverseIterator(st Storage) (Iterator, error) {
+	if r, ok := st.(ReverseIterable); ok {
+		return r.ReverseIterator()
+	}
+	return nil, ErrUnsupported
+}
+
+// ReverseIterator returns an iterator that traverses over a snapshot of the
+// storage in descending key order.
+func (s *storage) ReverseIterator() (Iterator, error) {
+	snap, err := s.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	return &reverseIterator{
+		iter: s.store.NewIterator(nil, nil),
+		snap: snap,
+	}, nil
+}
+
+// reverseIterator iterates over the wrapped iterator backwards skipping the
+// offset key.
+type reverseIterator struct {
+	iter    ldbiter.Iterator
+	snap    *leveldb.Snapshot
+	started bool
+}
+
+func (i *reverseIterator) Next() bool {
+	var next bool
+	if i.started {
+		next = i.iter.Prev()
+	} else {
+		i.started = true
+		next = i.iter.Last()
+	}
+	if next && string(i.iter.Key()) == offsetKey {
+		next = i.iter.Prev()
+	}
+	return next
+}
+
+func (i *reverseIterator) Err() error {
+	return i.iter.Error()
+}
+
+func (i *reverseIterator) Key() []byte {
+	return i.iter.Key()
+}
+
+func (i *reverseIterator) Value() ([]byte, error) {
+	return i.iter.Value(), nil
+}
+
+func (i *reverseIterator) Release() {
+	i.iter.Release()
+	i.snap.Release()
+}
+
+func (i *reverseIterator) Seek(key []byte) bool {
+	i.started = true
+	// position at the first key greater or equal and step back if it's greater
+	var seek bool
+	if i.iter.Seek(key) {
+		seek = bytes.Equal(i.iter.Key(), key) || i.iter.Prev()
+	} else {
+		seek = i.iter.Last()
+	}
+	if seek && string(i.iter.Key()) == offsetKey {
+		seek = i.iter.Prev()
+	}
+	return seek
+}
@@ -0,0 +1,36 @@
+package storage
+
+import "errors"
+
+// ErrUnsupported is returned for optional operations a storage does not support.
+var ErrUnsupported = errors.New("operation not supported by the storage")
+
+// Sizer is implemented by storages that can report their approximate size on
+// disk.
+type Sizer interface {
+	ApproximateSize() (int64, error)
+}
+
+// Compacter is implemented by storages that can compact their data on disk,
+// e.g. to reclaim the space of deleted keys.
+type Compacter interface {
+	Compact() error
+}
+
+// ApproximateSize returns the approximate size of st on disk or ErrUnsupported
+// if st does not implement Sizer.
+func ApproximateSize(st Storage) (int64, error) {
+	if s, ok := st.(Sizer); ok {
+		return s.ApproximateSize()
+	}
+	return 0, ErrUnsupported
+}
+
+// Compact compacts st or returns ErrUnsupported if st does not implement
+// Compacter.
+func Compact(st Storage) error {
+	if c, ok := st.(Compacter); ok {
+		return c.Compact()
+	}
+	return ErrUnsupported
+}
@@ -12,6 +12,8 @@ import (
 
 const (
 	offsetKey = "__offset"
+	// syncKey is deleted with a synced write to flush the journal
+	syncKey = "__sync"
 )
 
 // Iterator provides iteration access to the stored values.
@@ -72,6 +74,10 @@ type Storage interface {
 	// to a different configuration after the recovery is done.
 	MarkRecovered() error
 
+	// Sync forces all writes to stable storage and returns once they are durable,
+	// e.g. before taking a snapshot of the storage's files.
+	Sync() error
+
 	// Iterator returns an iterator that traverses over a snapshot of the storage.
 	Iterator() (Iterator, error)
 
@@ -112,6 +118,16 @@ func New(db *leveldb.DB) (Storage, error) {
 	}, nil
 }
 
+// NewReadOnly creates a new Storage backed by a LevelDB opened in read-only
+// mode. Since no recovery happens, the storage does not use a transaction and
+// all writes fail.
+func NewReadOnly(db *leveldb.DB) (Storage, error) {
+	return &storage{
+		store: db,
+		db:    db,
+	}, nil
+}
+
 // Iterator returns an iterator that traverses over a snapshot of the storage.
 func (s *storage) Iterator() (Iterator, error) {
 	snap, err := s.db.GetSnapshot()
@@ -211,6 +227,43 @@ func (s *storage) MarkRecovered() error {
 	return s.tx.Commit()
 }
 
+// Sync flushes the journal of leveldb, which contains all previous writes, to disk.
+// It fails during recovery, since the recovery transaction is only written on
+// MarkRecovered.
+func (s *storage) Sync() error {
+	if s.store != s.db {
+		return fmt.Errorf("cannot sync storage during recovery")
+	}
+	if err := s.db.Delete([]byte(syncKey), &opt.WriteOptions{Sync: true}); err != nil {
+		return fmt.Errorf("error syncing leveldb: %v", err)
+	}
+	return nil
+}
+
+// ApproximateSize returns the size of the leveldb table files on disk. Recent
+// writes that are only in the journal are not included until they are
+// compacted into the tables.
+func (s *storage) ApproximateSize() (int64, error) {
+	var stats leveldb.DBStats
+	if err := s.db.Stats(&stats); err != nil {
+		return 0, fmt.Errorf("error getting leveldb stats: %v", err)
+	}
+	var size int64
+	for _, levelSize := range stats.LevelSizes {
+		size += levelSize
+	}
+	return size, nil
+}
+
+// Compact compacts the whole leveldb, which removes deleted and overwritten
+// values from disk.
+func (s *storage) Compact() error {
+	if err := s.db.CompactRange(util.Range{}); err != nil {
+		return fmt.Errorf("error compacting leveldb: %v", err)
+	}
+	return nil
+}
+
 func (s *storage) Recovered() bool {
 	return s.store == s.db
 }
@@ -1,9 +1,16 @@
 package storage
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"os"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/lovoo/goka/internal/test"
 	"github.com/syndtr/goleveldb/leveldb"
@@ -180,3 +187,493 @@ func TestSetGet(t *testing.T) {
 	recoveredValue := string(value)
 	test.AssertEqual(t, recoveredValue, "example-message")
 }
+
+func TestSync(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "goka_storage_TestSync")
+	test.AssertNil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	db, err := leveldb.OpenFile(tmpdir, nil)
+	test.AssertNil(t, err)
+	st, err := New(db)
+	test.AssertNil(t, err)
+
+	// the recovery transaction cannot be synced
+	test.AssertNil(t, st.Set("key", []byte("value")))
+	test.AssertNotNil(t, st.Sync())
+
+	test.AssertNil(t, st.MarkRecovered())
+	test.AssertNil(t, st.Set("key2", []byte("value2")))
+	test.AssertNil(t, st.Sync())
+	test.AssertNil(t, st.Close())
+
+	// the sync does not leave keys behind
+	db, err = leveldb.OpenFile(tmpdir, nil)
+	test.AssertNil(t, err)
+	st, err = New(db)
+	test.AssertNil(t, err)
+	defer st.Close()
+	iter, err := st.Iterator()
+	test.AssertNil(t, err)
+	defer iter.Release()
+	var keys []string
+	for iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	test.AssertEqual(t, keys, []string{"key", "key2"})
+
+	test.AssertNil(t, NewMemory().Sync())
+}
+
+func TestMemorySnapshot(t *testing.T) {
+	st := NewMemory()
+	test.AssertNil(t, st.Set("key-1", []byte("value-1")))
+	test.AssertNil(t, st.Set("key-2", []byte("value-2")))
+	test.AssertNil(t, st.SetOffset(2))
+
+	snap := st.(Snapshotter).Snapshot()
+	test.AssertEqual(t, snap, map[string][]byte{
+		"key-1": []byte("value-1"),
+		"key-2": []byte("value-2"),
+	})
+
+	// the snapshot is a copy
+	test.AssertNil(t, st.Set("key-1", []byte("changed")))
+	test.AssertEqual(t, string(snap["key-1"]), "value-1")
+
+	restored := NewMemory()
+	restored.(Snapshotter).Restore(snap)
+	value, err := restored.Get("key-2")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "value-2")
+
+	// restoring replaces all keys but keeps the offset
+	st.(Snapshotter).Restore(map[string][]byte{"key-3": []byte("value-3")})
+	has, err := st.Has("key-1")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, has)
+	value, err = st.Get("key-3")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "value-3")
+	offset, err := st.GetOffset(0)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, offset, int64(2))
+}
+
+func TestApproximateSize(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "goka_storage_TestApproximateSize")
+	test.AssertNil(t, err)
+	defer os.RemoveAll(tmpdir)
+
+	db, err := leveldb.OpenFile(tmpdir, nil)
+	test.AssertNil(t, err)
+	st, err := New(db)
+	test.AssertNil(t, err)
+	defer st.Close()
+	test.AssertNil(t, st.MarkRecovered())
+
+	value := make([]byte, 1024)
+	for i := 0; i < 1000; i++ {
+		test.AssertNil(t, st.Set(fmt.Sprintf("key-%d", i), value))
+	}
+	// the size covers the compacted tables only
+	test.AssertNil(t, Compact(st))
+	size, err := ApproximateSize(st)
+	test.AssertNil(t, err)
+	test.AssertTrue(t, size > 0)
+
+	for i := 0; i < 1000; i++ {
+		test.AssertNil(t, st.Delete(fmt.Sprintf("key-%d", i)))
+	}
+	test.AssertNil(t, Compact(st))
+	compacted, err := ApproximateSize(st)
+	test.AssertNil(t, err)
+	test.AssertTrue(t, compacted < size)
+
+	_, err = ApproximateSize(NewMemory())
+	test.AssertEqual(t, err, ErrUnsupported)
+	test.AssertEqual(t, Compact(NewMemory()), ErrUnsupported)
+}
+
+func TestTransformStorage(t *testing.T) {
+	reverse := func(value []byte) ([]byte, error) {
+		reversed := make([]byte, len(value))
+		for i := range value {
+			reversed[len(value)-1-i] = value[i]
+		}
+		return reversed, nil
+	}
+
+	raw := NewMemory()
+	st := NewTransformStorage(raw, reverse, reverse)
+
+	test.AssertNil(t, st.Set("key", []byte("value")))
+
+	stored, err := raw.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(stored), "eulav")
+
+	value, err := st.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "value")
+
+	value, err = st.Get("not-existent")
+	test.AssertNil(t, err)
+	test.AssertNil(t, value)
+
+	iter, err := st.Iterator()
+	test.AssertNil(t, err)
+	defer iter.Release()
+	test.AssertTrue(t, iter.Next())
+	value, err = iter.Value()
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "value")
+	test.AssertFalse(t, iter.Next())
+}
+
+func TestIteratorSeek(t *testing.T) {
+	ldb, cleanUp := NewLevelDB(t)
+	defer cleanUp(t)
+
+	for name, st := range map[string]Storage{"memory": NewMemory(), "leveldb": ldb} {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range []string{"key-1", "key-3", "key-5"} {
+				test.AssertNil(t, st.Set(key, []byte(key)))
+			}
+			test.AssertNil(t, st.SetOffset(5))
+
+			keysFrom := func(seek string) []string {
+				iter, err := st.Iterator()
+				test.AssertNil(t, err)
+				defer iter.Release()
+
+				if !iter.Seek([]byte(seek)) {
+					return nil
+				}
+				// the iterator is positioned at the first key
+				keys := []string{string(iter.Key())}
+				for iter.Next() {
+					keys = append(keys, string(iter.Key()))
+				}
+				return keys
+			}
+
+			test.AssertEqual(t, keysFrom("key-3"), []string{"key-3", "key-5"})
+			test.AssertEqual(t, keysFrom("key-2"), []string{"key-3", "key-5"})
+			test.AssertEqual(t, keysFrom(""), []string{"key-1", "key-3", "key-5"})
+			test.AssertNil(t, keysFrom("key-6"))
+			// the offset is skipped
+			test.AssertEqual(t, keysFrom("__"), []string{"key-1", "key-3", "key-5"})
+		})
+	}
+}
+
+func TestReverseIterator(t *testing.T) {
+	ldb, cleanUp := NewLevelDB(t)
+	defer cleanUp(t)
+
+	for name, st := range map[string]Storage{"memory": NewMemory(), "leveldb": ldb} {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range []string{"key-1", "key-3", "key-5"} {
+				test.AssertNil(t, st.Set(key, []byte(key)))
+			}
+			test.AssertNil(t, st.SetOffset(5))
+
+			keysFrom := func(seek string) []string {
+				iter, err := ReverseIterator(st)
+				test.AssertNil(t, err)
+				defer iter.Release()
+
+				var keys []string
+				if seek != "" {
+					if !iter.Seek([]byte(seek)) {
+						return nil
+					}
+					keys = append(keys, string(iter.Key()))
+				}
+				for iter.Next() {
+					value, err := iter.Value()
+					test.AssertNil(t, err)
+					test.AssertEqual(t, string(value), string(iter.Key()))
+					keys = append(keys, string(iter.Key()))
+				}
+				return keys
+			}
+
+			// the offset is skipped
+			test.AssertEqual(t, keysFrom(""), []string{"key-5", "key-3", "key-1"})
+			test.AssertEqual(t, keysFrom("key-3"), []string{"key-3", "key-1"})
+			test.AssertEqual(t, keysFrom("key-4"), []string{"key-3", "key-1"})
+			test.AssertEqual(t, keysFrom("key-9"), []string{"key-5", "key-3", "key-1"})
+			test.AssertNil(t, keysFrom("key-0"))
+		})
+	}
+
+	t.Run("wrapped", func(t *testing.T) {
+		st := NewCompressionStorage(NewMemory(), CompressionSnappy)
+		test.AssertNil(t, st.Set("a", []byte("1")))
+		test.AssertNil(t, st.Set("b", []byte("2")))
+
+		iter, err := ReverseIterator(st)
+		test.AssertNil(t, err)
+		defer iter.Release()
+		test.AssertTrue(t, iter.Next())
+		value, err := iter.Value()
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(iter.Key()), "b")
+		test.AssertEqual(t, string(value), "2")
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := ReverseIterator(NewTTLStorage(NewMemory(), time.Hour))
+		test.AssertEqual(t, err, ErrUnsupported)
+	})
+}
+
+func TestCompressionStorage(t *testing.T) {
+	value := []byte(strings.Repeat(`{"key":"value"}`, 100))
+
+	for _, codec := range []*CompressionCodec{CompressionGzip, CompressionSnappy} {
+		t.Run(codec.String(), func(t *testing.T) {
+			raw := NewMemory()
+			test.AssertNil(t, raw.Set("legacy", []byte("uncompressed")))
+			st := NewCompressionStorage(raw, codec)
+
+			test.AssertNil(t, st.Set("key", value))
+
+			stored, err := raw.Get("key")
+			test.AssertNil(t, err)
+			test.AssertTrue(t, len(stored) < len(value))
+
+			read, err := st.Get("key")
+			test.AssertNil(t, err)
+			test.AssertEqual(t, read, value)
+
+			// values stored before enabling the compression are read unmodified
+			read, err = st.Get("legacy")
+			test.AssertNil(t, err)
+			test.AssertEqual(t, string(read), "uncompressed")
+
+			// values are read regardless of the codec they were compressed with
+			other := CompressionGzip
+			if codec == CompressionGzip {
+				other = CompressionSnappy
+			}
+			test.AssertNil(t, NewCompressionStorage(raw, other).Set("other", []byte("value")))
+			read, err = st.Get("other")
+			test.AssertNil(t, err)
+			test.AssertEqual(t, string(read), "value")
+
+			iter, err := st.Iterator()
+			test.AssertNil(t, err)
+			defer iter.Release()
+			values := make(map[string]string)
+			for iter.Next() {
+				read, err := iter.Value()
+				test.AssertNil(t, err)
+				values[string(iter.Key())] = string(read)
+			}
+			test.AssertEqual(t, values, map[string]string{
+				"key":    string(value),
+				"legacy": "uncompressed",
+				"other":  "value",
+			})
+		})
+	}
+
+	t.Run("fail_corrupted", func(t *testing.T) {
+		raw := NewMemory()
+		st := NewCompressionStorage(raw, CompressionGzip)
+		test.AssertNil(t, raw.Set("corrupted", append(compressionMagic, CompressionGzip.id, 1, 2, 3)))
+		test.AssertNil(t, raw.Set("unknown", append(compressionMagic, 255, 1, 2, 3)))
+
+		_, err := st.Get("corrupted")
+		test.AssertNotNil(t, err)
+		_, err = st.Get("unknown")
+		test.AssertNotNil(t, err)
+	})
+}
+
+func TestEncryptionStorage(t *testing.T) {
+	newAEAD := func(key string) cipher.AEAD {
+		block, err := aes.NewCipher([]byte(key))
+		test.AssertNil(t, err)
+		aead, err := cipher.NewGCM(block)
+		test.AssertNil(t, err)
+		return aead
+	}
+	aead := newAEAD("0123456789abcdef")
+
+	t.Run("values", func(t *testing.T) {
+		raw := NewMemory()
+		st := NewEncryptionStorage(raw, aead)
+
+		test.AssertNil(t, st.Set("key", []byte("value")))
+		test.AssertNil(t, st.SetOffset(42))
+
+		stored, err := raw.Get("key")
+		test.AssertNil(t, err)
+		test.AssertFalse(t, strings.Contains(string(stored), "value"))
+
+		// the same value is encrypted with another nonce
+		test.AssertNil(t, st.Set("other", []byte("value")))
+		other, err := raw.Get("other")
+		test.AssertNil(t, err)
+		test.AssertNotEqual(t, other, stored)
+
+		value, err := st.Get("key")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(value), "value")
+
+		offset, err := st.GetOffset(0)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, offset, int64(42))
+
+		iter, err := st.IteratorWithRange([]byte("k"), nil)
+		test.AssertNil(t, err)
+		defer iter.Release()
+		test.AssertTrue(t, iter.Next())
+		test.AssertEqual(t, string(iter.Key()), "key")
+		value, err = iter.Value()
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(value), "value")
+		test.AssertFalse(t, iter.Next())
+	})
+
+	t.Run("keys", func(t *testing.T) {
+		raw := NewMemory()
+		st := NewEncryptionStorage(raw, aead, EncryptKeys([]byte("secret")))
+
+		test.AssertNil(t, st.Set("key", []byte("value")))
+		has, err := raw.Has("key")
+		test.AssertNil(t, err)
+		test.AssertFalse(t, has)
+
+		has, err = st.Has("key")
+		test.AssertNil(t, err)
+		test.AssertTrue(t, has)
+		value, err := st.Get("key")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(value), "value")
+
+		iter, err := st.Iterator()
+		test.AssertNil(t, err)
+		defer iter.Release()
+		test.AssertTrue(t, iter.Next())
+		test.AssertEqual(t, string(iter.Key()), "key")
+		value, err = iter.Value()
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(value), "value")
+		test.AssertFalse(t, iter.Next())
+		test.AssertNil(t, iter.Err())
+
+		test.AssertNil(t, st.Delete("key"))
+		test.AssertEqual(t, raw.(*memory).storage, map[string][]byte{})
+
+		_, err = st.IteratorWithRange([]byte("k"), nil)
+		test.AssertEqual(t, err, ErrUnsupported)
+	})
+
+	t.Run("fail_authentication", func(t *testing.T) {
+		raw := NewMemory()
+		st := NewEncryptionStorage(raw, aead)
+		test.AssertNil(t, st.Set("key", []byte("value")))
+
+		// a value moved to another key
+		stored, err := raw.Get("key")
+		test.AssertNil(t, err)
+		test.AssertNil(t, raw.Set("moved", stored))
+		_, err = st.Get("moved")
+		test.AssertTrue(t, errors.Is(err, ErrDecryption))
+
+		// a value encrypted with another key
+		_, err = NewEncryptionStorage(raw, newAEAD("fedcba9876543210")).Get("key")
+		test.AssertTrue(t, errors.Is(err, ErrDecryption))
+
+		// a modified value
+		stored[len(stored)-1] ^= 1
+		test.AssertNil(t, raw.Set("key", stored))
+		_, err = st.Get("key")
+		test.AssertTrue(t, errors.Is(err, ErrDecryption))
+
+		iter, err := st.Iterator()
+		test.AssertNil(t, err)
+		defer iter.Release()
+		test.AssertTrue(t, iter.Next())
+		_, err = iter.Value()
+		test.AssertTrue(t, errors.Is(err, ErrDecryption))
+	})
+}
+
+func TestTTLStorage(t *testing.T) {
+	now := time.Unix(1000, 0)
+	st := NewTTLStorage(NewMemory(), time.Minute).(*ttlStorage)
+	st.now = func() time.Time { return now }
+
+	test.AssertNil(t, st.Set("expiring", []byte("1")))
+	test.AssertNil(t, st.SetWithTTL("lasting", []byte("2"), time.Hour))
+
+	assertVisible := func(key string, expected []byte) {
+		value, err := st.Get(key)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, value, expected)
+		has, err := st.Has(key)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, has, expected != nil)
+	}
+	assertVisible("expiring", []byte("1"))
+	assertVisible("lasting", []byte("2"))
+
+	now = now.Add(time.Minute)
+	assertVisible("expiring", nil)
+	assertVisible("lasting", []byte("2"))
+
+	iter, err := st.Iterator()
+	test.AssertNil(t, err)
+	defer iter.Release()
+	test.AssertTrue(t, iter.Next())
+	test.AssertEqual(t, string(iter.Key()), "lasting")
+	value, err := iter.Value()
+	test.AssertNil(t, err)
+	test.AssertEqual(t, value, []byte("2"))
+	test.AssertFalse(t, iter.Next())
+}
+
+func TestRetryBuilder(t *testing.T) {
+	path, err := ioutil.TempDir("", "goka_storage_retry_")
+	test.AssertNil(t, err)
+	defer os.RemoveAll(path)
+
+	builder := DefaultBuilder(path)
+
+	// the first storage holds the lock
+	st, err := builder("topic", 0)
+	test.AssertNil(t, err)
+
+	_, err = builder("topic", 0)
+	test.AssertTrue(t, errors.Is(err, ErrLocked))
+	test.AssertFalse(t, errors.Is(err, ErrCorrupted))
+
+	// release the lock while retrying
+	var attempts []int
+	retrying := RetryBuilder(builder, 3, func(attempt int) time.Duration {
+		attempts = append(attempts, attempt)
+		if attempt == 2 {
+			test.AssertNil(t, st.Close())
+		}
+		return time.Millisecond
+	})
+	st, err = retrying("topic", 0)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, attempts, []int{1, 2})
+
+	// give up after all attempts
+	attempts = nil
+	_, err = RetryBuilder(builder, 2, func(attempt int) time.Duration {
+		attempts = append(attempts, attempt)
+		return time.Millisecond
+	})("topic", 0)
+	test.AssertTrue(t, errors.Is(err, ErrLocked))
+	test.AssertEqual(t, attempts, []int{1})
+	test.AssertNil(t, st.Close())
+}
@@ -0,0 +1,109 @@
+package storage
+
+import "fmt"
+
+// ValueTransform transforms a value at the storage boundary, e.g. to encrypt
+// or compress it.
+type ValueTransform func(value []byte) ([]byte, error)
+
+// transformStorage wraps a storage and transforms all values when being
+// written and read.
+type transformStorage struct {
+	Storage
+	encode ValueTransform
+	decode ValueTransform
+}
+
+// NewTransformStorage wraps st so that values are passed through encode before
+// being stored and through decode after being read (including iterators).
+// Keys and offsets are stored unmodified.
+// This can be used to implement encryption at rest without changing the
+// values seen by the application or written to Kafka.
+func NewTransformStorage(st Storage, encode, decode ValueTransform) Storage {
+	return &transformStorage{
+		Storage: st,
+		encode:  encode,
+		decode:  decode,
+	}
+}
+
+// TransformBuilder wraps the storages created by builder with NewTransformStorage.
+func TransformBuilder(builder Builder, encode, decode ValueTransform) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		st, err := builder(topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		return NewTransformStorage(st, encode, decode), nil
+	}
+}
+
+func (s *transformStorage) Get(key string) ([]byte, error) {
+	value, err := s.Storage.Get(key)
+	if err != nil || value == nil {
+		return value, err
+	}
+	plain, err := s.decode(value)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding stored value for key %s: %v", key, err)
+	}
+	return plain, nil
+}
+
+func (s *transformStorage) Set(key string, value []byte) error {
+	stored, err := s.encode(value)
+	if err != nil {
+		return fmt.Errorf("error encoding value for key %s: %v", key, err)
+	}
+	return s.Storage.Set(key, stored)
+}
+
+func (s *transformStorage) Iterator() (Iterator, error) {
+	iter, err := s.Storage.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	return &transformIterator{Iterator: iter, decode: s.decode}, nil
+}
+
+func (s *transformStorage) IteratorWithRange(start, limit []byte) (Iterator, error) {
+	iter, err := s.Storage.IteratorWithRange(start, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &transformIterator{Iterator: iter, decode: s.decode}, nil
+}
+
+// transformIterator decodes the values of the wrapped iterator.
+type transformIterator struct {
+	Iterator
+	decode ValueTransform
+}
+
+func (i *transformIterator) Value() ([]byte, error) {
+	value, err := i.Iterator.Value()
+	if err != nil || value == nil {
+		return value, err
+	}
+	plain, err := i.decode(value)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding stored value for key %s: %v", i.Key(), err)
+	}
+	return plain, nil
+}
+
+func (s *transformStorage) ReverseIterator() (Iterator, error) {
+	iter, err := ReverseIterator(s.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return &transformIterator{Iterator: iter, decode: s.decode}, nil
+}
+
+func (s *transformStorage) ApproximateSize() (int64, error) {
+	return ApproximateSize(s.Storage)
+}
+
+func (s *transformStorage) Compact() error {
+	return Compact(s.Storage)
+}
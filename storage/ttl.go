@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// expirySize is the size of the expiry time prefixed to the stored values.
+const expirySize = 8
+
+// ExpiringStorage is implemented by storages that can expire values.
+type ExpiringStorage interface {
+	Storage
+	// SetWithTTL stores the value, which expires after ttl. Expired values are
+	// not returned by Get, Has and the iterators.
+	SetWithTTL(key string, value []byte, ttl time.Duration) error
+}
+
+// ttlStorage expires values by prefixing them with their expiry time. Expired
+// values are skipped when reading and remain stored until they are
+// overwritten or deleted, since readers must not write to the storage.
+type ttlStorage struct {
+	Storage
+	ttl time.Duration
+	now func() time.Time
+}
+
+// nativeTTLStorage passes the TTL to a storage expiring values itself.
+type nativeTTLStorage struct {
+	ExpiringStorage
+	ttl time.Duration
+}
+
+// NewTTLStorage wraps st so that values written with Set expire after ttl. If
+// st implements ExpiringStorage, the values are written with its SetWithTTL,
+// otherwise the expiry time is stored with the values. Offsets never expire.
+func NewTTLStorage(st Storage, ttl time.Duration) ExpiringStorage {
+	if es, ok := st.(ExpiringStorage); ok {
+		return &nativeTTLStorage{ExpiringStorage: es, ttl: ttl}
+	}
+	return &ttlStorage{Storage: st, ttl: ttl, now: time.Now}
+}
+
+// TTLBuilder wraps the storages created by builder with NewTTLStorage.
+func TTLBuilder(builder Builder, ttl time.Duration) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		st, err := builder(topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		return NewTTLStorage(st, ttl), nil
+	}
+}
+
+func (s *nativeTTLStorage) Set(key string, value []byte) error {
+	return s.SetWithTTL(key, value, s.ttl)
+}
+
+func (s *nativeTTLStorage) ApproximateSize() (int64, error) {
+	return ApproximateSize(s.ExpiringStorage)
+}
+
+func (s *nativeTTLStorage) Compact() error {
+	return Compact(s.ExpiringStorage)
+}
+
+func (s *ttlStorage) Set(key string, value []byte) error {
+	return s.SetWithTTL(key, value, s.ttl)
+}
+
+func (s *ttlStorage) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	data := make([]byte, expirySize+len(value))
+	binary.BigEndian.PutUint64(data, uint64(s.now().Add(ttl).UnixNano()))
+	copy(data[expirySize:], value)
+	return s.Storage.Set(key, data)
+}
+
+func (s *ttlStorage) Get(key string) ([]byte, error) {
+	data, err := s.Storage.Get(key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return s.unwrap(key, data)
+}
+
+func (s *ttlStorage) Has(key string) (bool, error) {
+	value, err := s.Get(key)
+	return value != nil, err
+}
+
+// unwrap removes the expiry time from data and returns nil if it is expired.
+func (s *ttlStorage) unwrap(key string, data []byte) ([]byte, error) {
+	if len(data) < expirySize {
+		return nil, fmt.Errorf("stored value for key %s is missing its expiry time", key)
+	}
+	expiry := time.Unix(0, int64(binary.BigEndian.Uint64(data)))
+	if !s.now().Before(expiry) {
+		return nil, nil
+	}
+	return data[expirySize:], nil
+}
+
+func (s *ttlStorage) Iterator() (Iterator, error) {
+	iter, err := s.Storage.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	return &ttlIterator{Iterator: iter, storage: s}, nil
+}
+
+func (s *ttlStorage) IteratorWithRange(start, limit []byte) (Iterator, error) {
+	iter, err := s.Storage.IteratorWithRange(start, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &ttlIterator{Iterator: iter, storage: s}, nil
+}
+
+func (s *ttlStorage) ApproximateSize() (int64, error) {
+	return ApproximateSize(s.Storage)
+}
+
+func (s *ttlStorage) Compact() error {
+	return Compact(s.Storage)
+}
+
+// ttlIterator skips the expired values of the wrapped iterator.
+type ttlIterator struct {
+	Iterator
+	storage *ttlStorage
+}
+
+func (i *ttlIterator) Next() bool {
+	for i.Iterator.Next() {
+		value, err := i.Value()
+		// errors are returned by Value
+		if err != nil || value != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *ttlIterator) Value() ([]byte, error) {
+	data, err := i.Iterator.Value()
+	if err != nil || data == nil {
+		return data, err
+	}
+	return i.storage.unwrap(string(i.Key()), data)
+}
@@ -0,0 +1,85 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lovoo/goka/logger"
+)
+
+// StorageWriteErrorPolicy defines how the processor handles failed writes to the
+// local storage of the group table (SetValue and Delete in a callback), see
+// WithStorageWriteErrorPolicy.
+type StorageWriteErrorPolicy struct {
+	drop       bool
+	maxRetries int
+	backoff    BackoffBuilder
+}
+
+var (
+	// StorageWriteFail fails the processor on a failed write, which is the default.
+	StorageWriteFail = StorageWriteErrorPolicy{}
+	// StorageWriteDropAndContinue drops the failed write and continues processing.
+	// The value is still emitted to the group table topic, so the local storage
+	// gets it back on the next recovery.
+	StorageWriteDropAndContinue = StorageWriteErrorPolicy{drop: true}
+)
+
+// StorageWriteRetry retries a failed write up to maxRetries times, waiting
+// for the durations of the backoff in between, and fails the processor if all
+// retries failed. This bridges transient errors like a full disk that is resized.
+func StorageWriteRetry(maxRetries int, backoff BackoffBuilder) StorageWriteErrorPolicy {
+	return StorageWriteErrorPolicy{maxRetries: maxRetries, backoff: backoff}
+}
+
+type storageWritePolicy struct {
+	policy   StorageWriteErrorPolicy
+	observer func(partition int32, key string, err error)
+}
+
+// writeStorage performs a write to the table's storage and handles a failure
+// according to the storage write error policy.
+func (pp *PartitionProcessor) writeStorage(ctx context.Context, key string, write func() error) error {
+	err := write()
+	wp := pp.opts.storageWritePolicy
+	if err == nil || wp == nil {
+		return err
+	}
+
+	var backoff Backoff
+	for retries := 0; ; retries++ {
+		if wp.observer != nil {
+			wp.observer(pp.partition, key, err)
+		}
+
+		switch {
+		case wp.policy.drop:
+			logger.Errorf(pp.log, "dropping failed storage write (key %s): %v", key, err)
+			return nil
+		case retries >= wp.policy.maxRetries:
+			if retries > 0 {
+				return fmt.Errorf("giving up after %d retries: %v", retries, err)
+			}
+			return err
+		}
+
+		if backoff == nil {
+			var berr error
+			if backoff, berr = wp.policy.backoff(); berr != nil {
+				return fmt.Errorf("error creating storage write backoff: %v (retrying after error: %v)", berr, err)
+			}
+		}
+		retryDuration := backoff.Duration()
+		logger.Warnf(pp.log, "storage write (key %s) failed, will retry in %.0f seconds: %v", key, retryDuration.Seconds(), err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(retryDuration):
+		}
+
+		if err = write(); err == nil {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lovoo/goka/logger"
+)
+
+// tableKeyTTLSweepName is the topic of the visit deleting the expired keys.
+const tableKeyTTLSweepName = "goka-table-key-ttl"
+
+// keyTTL tracks when the keys of a partition's group table were set the last
+// time, so keys not set within the ttl can be deleted (see WithTableKeyTTL).
+// A nil keyTTL tracks nothing.
+type keyTTL struct {
+	ttl   time.Duration
+	clock Clock
+
+	m    sync.Mutex
+	seen map[string]keySeen
+	// the number of the current sweep
+	sweep uint64
+}
+
+// keySeen is the time a key was set and the last sweep that found the key in
+// the table or saw it being set.
+type keySeen struct {
+	at    time.Time
+	sweep uint64
+}
+
+func newKeyTTL(ttl time.Duration, clock Clock) *keyTTL {
+	if ttl <= 0 {
+		return nil
+	}
+	return &keyTTL{
+		ttl:   ttl,
+		clock: clock,
+		seen:  make(map[string]keySeen),
+	}
+}
+
+// touch records that the key was set.
+func (k *keyTTL) touch(key string) {
+	if k == nil {
+		return
+	}
+	k.m.Lock()
+	defer k.m.Unlock()
+	k.seen[key] = keySeen{at: k.clock.Now(), sweep: k.sweep}
+}
+
+// forget removes the key after it was deleted.
+func (k *keyTTL) forget(key string) {
+	if k == nil {
+		return
+	}
+	k.m.Lock()
+	defer k.m.Unlock()
+	delete(k.seen, key)
+}
+
+// startSweep starts a sweep over the keys of the table.
+func (k *keyTTL) startSweep() {
+	k.m.Lock()
+	defer k.m.Unlock()
+	k.sweep++
+}
+
+// expired returns whether the key found by the current sweep was not set
+// within the ttl. Keys that are not tracked yet, e.g. recovered from the table
+// topic, are tracked from now on.
+func (k *keyTTL) expired(key string) bool {
+	k.m.Lock()
+	defer k.m.Unlock()
+	now := k.clock.Now()
+	seen, ok := k.seen[key]
+	if !ok {
+		seen.at = now
+	}
+	seen.sweep = k.sweep
+	k.seen[key] = seen
+	return now.Sub(seen.at) >= k.ttl
+}
+
+// finishSweep drops the tracked keys the current sweep did not find in the
+// table, so the tracked keys never outgrow the table.
+func (k *keyTTL) finishSweep() {
+	k.m.Lock()
+	defer k.m.Unlock()
+	for key, seen := range k.seen {
+		if seen.sweep != k.sweep {
+			delete(k.seen, key)
+		}
+	}
+}
+
+// runKeyTTLSweep deletes the expired keys of the group table in an interval of
+// half the ttl until ctx is done. A sweep is passed to the run loop like a
+// visit and the next one starts no earlier than the interval after it is done.
+func (pp *PartitionProcessor) runKeyTTLSweep(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-pp.keyTTL.clock.After(pp.keyTTL.ttl / 2):
+		}
+
+		done := make(chan struct{})
+		v := &visit{
+			name: tableKeyTTLSweepName,
+			cb: func(ctx Context) {
+				// visits are always called with the processor's context
+				if err := pp.sweepExpiredKeys(ctx.(*cbContext)); err != nil {
+					ctx.Fail(err)
+				}
+			},
+			done: func(err error) {
+				defer close(done)
+				if err != nil {
+					logger.Errorf(pp.log, "error deleting expired keys: %v", err)
+				}
+			},
+		}
+		select {
+		case pp.visitInput <- v:
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sweepExpiredKeys deletes the expired keys of the group table while iterating
+// it. It's called by a visit in the run loop, so iterating the storage and
+// deleting the keys is serialized with the processing of the input messages.
+func (pp *PartitionProcessor) sweepExpiredKeys(ctx *cbContext) error {
+	it, err := pp.table.st.Iterator()
+	if err != nil {
+		return fmt.Errorf("error creating iterator for partition %d: %v", pp.partition, err)
+	}
+	defer it.Release()
+
+	pp.keyTTL.startSweep()
+	for it.Next() {
+		key := string(it.Key())
+		if !pp.keyTTL.expired(key) {
+			continue
+		}
+		if err := ctx.deleteKey(key); err != nil {
+			return fmt.Errorf("error deleting expired key %s: %v", key, err)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return fmt.Errorf("error iterating partition %d: %v", pp.partition, err)
+	}
+	pp.keyTTL.finishSweep()
+	return nil
+}
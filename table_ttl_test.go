@@ -0,0 +1,64 @@
+package goka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestKeyTTL(t *testing.T) {
+	test.AssertNil(t, newKeyTTL(0, DefaultClock()))
+	// a nil keyTTL tracks nothing
+	var disabled *keyTTL
+	disabled.touch("key")
+	disabled.forget("key")
+
+	clock := &manualClock{now: time.Unix(100, 0)}
+	k := newKeyTTL(time.Minute, clock)
+
+	k.touch("set")
+	k.touch("deleted")
+	// untracked keys are tracked from the first sweep on
+	k.startSweep()
+	test.AssertFalse(t, k.expired("set"))
+	test.AssertFalse(t, k.expired("recovered"))
+	k.finishSweep()
+
+	clock.now = clock.now.Add(30 * time.Second)
+	k.touch("updated")
+	k.startSweep()
+	test.AssertFalse(t, k.expired("set"))
+	test.AssertFalse(t, k.expired("recovered"))
+	test.AssertFalse(t, k.expired("updated"))
+	k.finishSweep()
+	// keys the sweep did not find in the table are not tracked anymore
+	_, tracked := k.seen["deleted"]
+	test.AssertFalse(t, tracked)
+
+	clock.now = clock.now.Add(30 * time.Second)
+	k.startSweep()
+	test.AssertTrue(t, k.expired("set"))
+	test.AssertTrue(t, k.expired("recovered"))
+	test.AssertFalse(t, k.expired("updated"))
+	k.finishSweep()
+
+	// deleted keys are tracked again once they are swept
+	k.forget("set")
+	k.startSweep()
+	test.AssertFalse(t, k.expired("set"))
+	k.finishSweep()
+}
+
+// manualClock is a clock whose time is only changed by the test.
+type manualClock struct {
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	return c.now
+}
+
+func (c *manualClock) After(d time.Duration) <-chan time.Time {
+	return make(chan time.Time)
+}
@@ -0,0 +1,64 @@
+package tester
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a goka.Clock whose time only changes by AdvanceTime, so processors
+// using it (see goka.WithClock and Tester.Clock) behave deterministically.
+type Clock struct {
+	m       sync.Mutex
+	now     time.Time
+	waiters []*clockWaiter
+}
+
+type clockWaiter struct {
+	due time.Time
+	c   chan time.Time
+}
+
+func newClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.now
+}
+
+// After returns a channel receiving the clock's time once it was advanced by d.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	w := &clockWaiter{
+		due: c.now.Add(d),
+		c:   make(chan time.Time, 1),
+	}
+	if d <= 0 {
+		w.c <- c.now
+		return w.c
+	}
+	c.waiters = append(c.waiters, w)
+	return w.c
+}
+
+// AdvanceTime moves the clock forward by d and notifies the waiters that are due.
+func (c *Clock) AdvanceTime(d time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.now = c.now.Add(d)
+	var waiting []*clockWaiter
+	for _, w := range c.waiters {
+		if w.due.After(c.now) {
+			waiting = append(waiting, w)
+			continue
+		}
+		w.c <- c.now
+	}
+	c.waiters = waiting
+}
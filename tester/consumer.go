@@ -113,6 +113,8 @@ func (pcm *partConsumerMock) catchup() int {
 			Topic:     pcm.queue.topic,
 			Partition: 0,
 			Offset:    msg.offset,
+			Headers:   msg.recordHeaders(),
+			Timestamp: msg.timestamp,
 		}
 
 		// we'll send a nil that is being ignored by the partition_table to make sure the other message
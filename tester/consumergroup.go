@@ -13,6 +13,8 @@ import (
 
 // consumerGroup mocks the consumergroup
 type consumerGroup struct {
+	// protects errs and currentSession
+	m    sync.RWMutex
 	errs chan error
 
 	// use the same offset counter for all topics
@@ -43,10 +45,32 @@ func newConsumerGroup(t T, tt *Tester) *consumerGroup {
 }
 
 func (cg *consumerGroup) catchupAndWait() int {
-	if cg.currentSession == nil {
+	session := cg.session()
+	if session == nil {
 		panic("There is currently no session. Cannot catchup, but we shouldn't be at this point")
 	}
-	return cg.currentSession.catchupAndWait()
+	return session.catchupAndWait()
+}
+
+func (cg *consumerGroup) session() *cgSession {
+	cg.m.RLock()
+	defer cg.m.RUnlock()
+	return cg.currentSession
+}
+
+// nextSession starts the session of the next generation.
+func (cg *consumerGroup) nextSession(ctx context.Context, topics []string) *cgSession {
+	cg.m.Lock()
+	defer cg.m.Unlock()
+	cg.currentGeneration++
+	cg.currentSession = newCgSession(ctx, cg.currentGeneration, cg, topics)
+	return cg.currentSession
+}
+
+func (cg *consumerGroup) setSession(session *cgSession) {
+	cg.m.Lock()
+	defer cg.m.Unlock()
+	cg.currentSession = session
 }
 
 // Consume starts consuming from the consumergroup
@@ -62,10 +86,7 @@ func (cg *consumerGroup) Consume(ctx context.Context, topics []string, handler s
 
 	for {
 		cg.state.SetState(cgStateRebalancing)
-		cg.currentGeneration++
-		session := newCgSession(ctx, cg.currentGeneration, cg, topics)
-
-		cg.currentSession = session
+		session := cg.nextSession(ctx, topics)
 
 		cg.state.SetState(cgStateSetup)
 		err := handler.Setup(session)
@@ -96,7 +117,7 @@ func (cg *consumerGroup) Consume(ctx context.Context, topics []string, handler s
 		errs.Collect(handler.Cleanup(session))
 
 		// remove current sessions
-		cg.currentSession = nil
+		cg.setSession(nil)
 
 		err = errs.NilOrError()
 		if err != nil {
@@ -116,11 +137,16 @@ func (cg *consumerGroup) Consume(ctx context.Context, topics []string, handler s
 
 // SendError sends an error the consumergroup
 func (cg *consumerGroup) SendError(err error) {
-	cg.errs <- err
+	cg.m.RLock()
+	errs := cg.errs
+	cg.m.RUnlock()
+	errs <- err
 }
 
 // Errors returns the errors channel
 func (cg *consumerGroup) Errors() <-chan error {
+	cg.m.RLock()
+	defer cg.m.RUnlock()
 	return cg.errs
 }
 
@@ -135,11 +161,13 @@ func (cg *consumerGroup) nextOffset() int64 {
 // Close closes the consumergroup
 func (cg *consumerGroup) Close() error {
 	// close old errs chan and create new one
+	cg.m.Lock()
 	close(cg.errs)
 	cg.errs = make(chan error)
-
-	cg.offset = 0
 	cg.currentGeneration = 0
+	cg.m.Unlock()
+
+	atomic.StoreInt64(&cg.offset, 0)
 	return nil
 }
 
@@ -236,8 +264,8 @@ func (cgs *cgSession) MarkOffset(topic string, partition int32, offset int64, me
 	cgs.queues[topic].setHwmIfNewer(offset + 1)
 }
 
+// Commit does nothing, the mock commits the offsets when messages are marked
 func (cgs *cgSession) Commit() {
-	panic("commit offset is not implemented by the mock")
 }
 
 // ResetOffset resets the offset to be consumed from
@@ -304,10 +332,12 @@ func (cgs *cgSession) pushMessageToClaim(claim *cgClaim, msg *message) {
 	cgs.wgMessages.Add(1)
 
 	claim.msgs <- &sarama.ConsumerMessage{
-		Key:    []byte(msg.key),
-		Value:  msg.value,
-		Topic:  claim.Topic(),
-		Offset: msg.offset,
+		Key:       []byte(msg.key),
+		Value:     msg.value,
+		Topic:     claim.Topic(),
+		Offset:    msg.offset,
+		Headers:   msg.recordHeaders(),
+		Timestamp: msg.timestamp,
 	}
 }
 
@@ -2,12 +2,44 @@ package tester
 
 import (
 	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
 )
 
 type message struct {
-	offset int64
-	key    string
-	value  []byte
+	offset    int64
+	key       string
+	value     []byte
+	headers   map[string][]byte
+	timestamp time.Time
+}
+
+// recordHeaders returns the message's headers as passed by sarama.
+func (m *message) recordHeaders() []*sarama.RecordHeader {
+	if len(m.headers) == 0 {
+		return nil
+	}
+	headers := make([]*sarama.RecordHeader, 0, len(m.headers))
+	for key, value := range m.headers {
+		headers = append(headers, &sarama.RecordHeader{
+			Key:   []byte(key),
+			Value: value,
+		})
+	}
+	return headers
+}
+
+// copyHeaders returns a copy of the message's headers, nil if it has none.
+func (m *message) copyHeaders() map[string][]byte {
+	if len(m.headers) == 0 {
+		return nil
+	}
+	headers := make(map[string][]byte, len(m.headers))
+	for key, value := range m.headers {
+		headers[key] = append([]byte(nil), value...)
+	}
+	return headers
 }
 
 type queue struct {
@@ -32,14 +64,16 @@ func (q *queue) Hwm() int64 {
 	return hwm
 }
 
-func (q *queue) push(key string, value []byte) int64 {
+func (q *queue) push(key string, value []byte, headers map[string][]byte, timestamp time.Time) int64 {
 	q.Lock()
 	defer q.Unlock()
 	offset := q.hwm
 	q.messages = append(q.messages, &message{
-		offset: offset,
-		key:    key,
-		value:  value,
+		offset:    offset,
+		key:       key,
+		value:     value,
+		headers:   headers,
+		timestamp: timestamp,
 	})
 	q.hwm++
 	return offset
@@ -101,14 +135,35 @@ func (mt *QueueTracker) Next() (string, interface{}, bool) {
 
 // NextRaw returns the next message similar to Next(), but without the decoding
 func (mt *QueueTracker) NextRaw() (string, []byte, bool) {
+	key, value, _, hasNext := mt.NextRawWithHeaders()
+	return key, value, hasNext
+}
+
+// NextWithHeaders returns the next message similar to Next(), along with its headers
+func (mt *QueueTracker) NextWithHeaders() (string, interface{}, map[string][]byte, bool) {
+	key, msgRaw, headers, hasNext := mt.NextRawWithHeaders()
+
+	if !hasNext {
+		return key, msgRaw, headers, hasNext
+	}
+
+	decoded, err := mt.tester.codecForTopic(mt.topic).Decode(msgRaw)
+	if err != nil {
+		mt.t.Fatalf("Error decoding message: %v", err)
+	}
+	return key, decoded, headers, true
+}
+
+// NextRawWithHeaders returns the next message similar to NextWithHeaders(), but without the decoding
+func (mt *QueueTracker) NextRawWithHeaders() (string, []byte, map[string][]byte, bool) {
 	q := mt.tester.getOrCreateQueue(mt.topic)
 	if int(mt.nextOffset) >= q.size() {
-		return "", nil, false
+		return "", nil, nil, false
 	}
 	msg := q.message(int(mt.nextOffset))
 
 	mt.nextOffset++
-	return msg.key, msg.value, true
+	return msg.key, msg.value, msg.copyHeaders(), true
 }
 
 // Seek moves the index pointer of the queue tracker to passed offset
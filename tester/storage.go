@@ -0,0 +1,134 @@
+package tester
+
+import (
+	"sync"
+
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/storage"
+)
+
+// storageFaults are the errors injected into the storage of a table.
+type storageFaults struct {
+	m sync.Mutex
+
+	sets int
+	gets int
+	// errors of the Set/Get calls by their number
+	failSet map[int]error
+	failGet map[int]error
+	// errors of all Set/Get calls of the keys
+	failKey map[string]error
+}
+
+func newStorageFaults() *storageFaults {
+	return &storageFaults{
+		failSet: make(map[int]error),
+		failGet: make(map[int]error),
+		failKey: make(map[string]error),
+	}
+}
+
+func (f *storageFaults) set(key string) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.sets++
+	if err := f.failKey[key]; err != nil {
+		return err
+	}
+	err := f.failSet[f.sets]
+	delete(f.failSet, f.sets)
+	return err
+}
+
+func (f *storageFaults) get(key string) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.gets++
+	if err := f.failKey[key]; err != nil {
+		return err
+	}
+	err := f.failGet[f.gets]
+	delete(f.failGet, f.gets)
+	return err
+}
+
+// faultStorage wraps a table's storage to return the injected errors.
+type faultStorage struct {
+	storage.Storage
+	faults *storageFaults
+}
+
+func (s *faultStorage) Get(key string) ([]byte, error) {
+	if err := s.faults.get(key); err != nil {
+		return nil, err
+	}
+	return s.Storage.Get(key)
+}
+
+func (s *faultStorage) Set(key string, value []byte) error {
+	if err := s.faults.set(key); err != nil {
+		return err
+	}
+	return s.Storage.Set(key, value)
+}
+
+// ReverseIterator passes the reverse iteration of the wrapped storage through.
+func (s *faultStorage) ReverseIterator() (storage.Iterator, error) {
+	return storage.ReverseIterator(s.Storage)
+}
+
+func (tt *Tester) getOrCreateStorageFaults(table string) *storageFaults {
+	tt.mStorages.Lock()
+	defer tt.mStorages.Unlock()
+
+	faults := tt.storageFaults[table]
+	if faults == nil {
+		faults = newStorageFaults()
+		tt.storageFaults[table] = faults
+	}
+	return faults
+}
+
+// FailStorageSet makes the n-th call of Set (counting from 1 from now on) to the
+// table's storage fail with err, e.g. to test the error handling of a processor
+// setting a value. The faults only apply to the processors and views, not to
+// the Tester's methods like SetTableValue.
+func (tt *Tester) FailStorageSet(table goka.Table, n int, err error) {
+	faults := tt.getOrCreateStorageFaults(string(table))
+	faults.m.Lock()
+	defer faults.m.Unlock()
+	faults.failSet[faults.sets+n] = err
+}
+
+// FailStorageGet makes the n-th call of Get (counting from 1 from now on) to the
+// table's storage fail with err. Like FailStorageSet, it only applies to the
+// processors and views.
+func (tt *Tester) FailStorageGet(table goka.Table, n int, err error) {
+	faults := tt.getOrCreateStorageFaults(string(table))
+	faults.m.Lock()
+	defer faults.m.Unlock()
+	faults.failGet[faults.gets+n] = err
+}
+
+// FailStorageKey makes all calls of Set and Get of the key to the table's
+// storage fail with err until ClearStorageFaults is called. Like
+// FailStorageSet, it only applies to the processors and views.
+func (tt *Tester) FailStorageKey(table goka.Table, key string, err error) {
+	faults := tt.getOrCreateStorageFaults(string(table))
+	faults.m.Lock()
+	defer faults.m.Unlock()
+	faults.failKey[key] = err
+}
+
+// ClearStorageFaults removes all errors injected into the storages.
+func (tt *Tester) ClearStorageFaults() {
+	tt.mStorages.Lock()
+	defer tt.mStorages.Unlock()
+	for _, faults := range tt.storageFaults {
+		faults.m.Lock()
+		faults.failSet = make(map[int]error)
+		faults.failGet = make(map[int]error)
+		faults.failKey = make(map[string]error)
+		faults.m.Unlock()
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"hash"
 	"reflect"
 	"sync"
+	"time"
 
 	"github.com/lovoo/goka"
 	"github.com/lovoo/goka/storage"
@@ -47,8 +48,12 @@ type Tester struct {
 	mQueues     sync.Mutex
 	topicQueues map[string]*queue
 
-	mStorages sync.Mutex
-	storages  map[string]storage.Storage
+	mStorages     sync.Mutex
+	storages      map[string]storage.Storage
+	storageFaults map[string]*storageFaults
+
+	mClock sync.Mutex
+	clock  *Clock
 }
 
 // New creates a new tester instance
@@ -62,6 +67,8 @@ func New(t T) *Tester {
 		codecs:      make(map[string]goka.Codec),
 		topicQueues: make(map[string]*queue),
 		storages:    make(map[string]storage.Storage),
+
+		storageFaults: make(map[string]*storageFaults),
 	}
 	tt.tmgr = NewMockTopicManager(tt, 1, 1)
 	tt.producer = newProducerMock(tt.handleEmit)
@@ -130,14 +137,14 @@ func (tt *Tester) EmitterProducerBuilder() goka.ProducerBuilder {
 // handleEmit handles an Emit-call on the producerMock.
 // This takes care of queueing calls
 // to handled topics or putting the emitted messages in the emitted-messages-list
-func (tt *Tester) handleEmit(topic string, key string, value []byte) *goka.Promise {
+func (tt *Tester) handleEmit(topic string, key string, value []byte, headers map[string][]byte) *goka.Promise {
 	promise := goka.NewPromise()
-	offset := tt.pushMessage(topic, key, value)
+	offset := tt.pushMessage(topic, key, value, headers)
 	return promise.Finish(&sarama.ProducerMessage{Offset: offset}, nil)
 }
 
-func (tt *Tester) pushMessage(topic string, key string, data []byte) int64 {
-	return tt.getOrCreateQueue(topic).push(key, data)
+func (tt *Tester) pushMessage(topic string, key string, data []byte, headers map[string][]byte) int64 {
+	return tt.getOrCreateQueue(topic).push(key, data, headers, tt.now())
 }
 
 func (tt *Tester) ProducerBuilder() goka.ProducerBuilder {
@@ -289,6 +296,23 @@ func (tt *Tester) SetTableValue(table goka.Table, key string, value interface{})
 		panic(fmt.Errorf("Error setting key %s in storage %s: %v", key, table, err))
 	}
 }
+
+// DeleteTableValue deletes a value from a processor's or view's table directly
+// via storage, e.g. to test a missing join or lookup value.
+// Like SetTableValue, call it *after* starting all processors/views.
+func (tt *Tester) DeleteTableValue(table goka.Table, key string) {
+	tt.waitStartup()
+
+	topic := string(table)
+	st, err := tt.getOrCreateStorage(topic)
+	if err != nil {
+		panic(fmt.Errorf("error creating storage for topic %s: %v", topic, err))
+	}
+	if err := st.Delete(key); err != nil {
+		panic(fmt.Errorf("Error deleting key %s in storage %s: %v", key, table, err))
+	}
+}
+
 func (tt *Tester) getOrCreateStorage(table string) (storage.Storage, error) {
 	tt.mStorages.Lock()
 	defer tt.mStorages.Unlock()
@@ -301,10 +325,18 @@ func (tt *Tester) getOrCreateStorage(table string) (storage.Storage, error) {
 	return st, nil
 }
 
-// StorageBuilder builds inmemory storages
+// StorageBuilder builds inmemory storages, which return the errors injected by
+// FailStorageSet, FailStorageGet and FailStorageKey
 func (tt *Tester) StorageBuilder() storage.Builder {
 	return func(topic string, partition int32) (storage.Storage, error) {
-		return tt.getOrCreateStorage(topic)
+		st, err := tt.getOrCreateStorage(topic)
+		if err != nil {
+			return nil, err
+		}
+		return &faultStorage{
+			Storage: st,
+			faults:  tt.getOrCreateStorageFaults(topic),
+		}, nil
 	}
 }
 
@@ -322,6 +354,34 @@ func (tt *Tester) ClearValues() {
 
 }
 
+// Clock returns the tester's clock, which starts at the current time and only
+// changes by AdvanceTime. Pass it to the processors with goka.WithClock.
+// Once the clock is used, the tester stamps the messages with its time.
+func (tt *Tester) Clock() *Clock {
+	tt.mClock.Lock()
+	defer tt.mClock.Unlock()
+	if tt.clock == nil {
+		tt.clock = newClock(time.Now())
+	}
+	return tt.clock
+}
+
+// AdvanceTime moves the tester's clock forward by d (see Clock).
+func (tt *Tester) AdvanceTime(d time.Duration) {
+	tt.Clock().AdvanceTime(d)
+}
+
+// now returns the time of the tester's clock if it is used or the current time.
+func (tt *Tester) now() time.Time {
+	tt.mClock.Lock()
+	clock := tt.clock
+	tt.mClock.Unlock()
+	if clock == nil {
+		return time.Now()
+	}
+	return clock.Now()
+}
+
 // NewQueueTracker creates a new queue tracker
 func (tt *Tester) NewQueueTracker(topic string) *QueueTracker {
 	return newQueueTracker(tt, tt.t, topic)
@@ -358,17 +418,23 @@ func (tt *Tester) waitForClients() {
 // Consume pushes a message for topic/key to be consumed by all processors/views
 // whoever is using it being registered to the Tester
 func (tt *Tester) Consume(topic string, key string, msg interface{}) {
+	tt.ConsumeWithHeaders(topic, key, msg, nil)
+}
+
+// ConsumeWithHeaders pushes a message with the given headers for topic/key to be consumed
+// by all processors/views whoever is using it being registered to the Tester
+func (tt *Tester) ConsumeWithHeaders(topic string, key string, msg interface{}, headers map[string][]byte) {
 	tt.waitStartup()
 
 	value := reflect.ValueOf(msg)
 	if msg == nil || (value.Kind() == reflect.Ptr && value.IsNil()) {
-		tt.pushMessage(topic, key, nil)
+		tt.pushMessage(topic, key, nil, headers)
 	} else {
 		data, err := tt.codecForTopic(topic).Encode(msg)
 		if err != nil {
 			panic(fmt.Errorf("Error encoding value %v: %v", msg, err))
 		}
-		tt.pushMessage(topic, key, data)
+		tt.pushMessage(topic, key, data, headers)
 	}
 
 	tt.waitForClients()
@@ -2,6 +2,7 @@ package tester
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/Shopify/sarama"
 )
@@ -11,6 +12,9 @@ type MockTopicManager struct {
 	DefaultNumPartitions     int
 	DefaultReplicationFactor int
 	tt                       *Tester
+
+	m       sync.Mutex
+	configs map[string]map[string]string
 }
 
 // NewMockTopicManager creates a new topic manager mock
@@ -68,6 +72,33 @@ func (tm *MockTopicManager) GetOffset(topicName string, partitionID int32, time
 	}
 }
 
+// TopicConfig returns the configuration values set with UpdateTopicConfig
+func (tm *MockTopicManager) TopicConfig(topic string) (map[string]string, error) {
+	tm.m.Lock()
+	defer tm.m.Unlock()
+	config := make(map[string]string)
+	for k, v := range tm.configs[topic] {
+		config[k] = v
+	}
+	return config, nil
+}
+
+// UpdateTopicConfig stores the configuration values for the topic
+func (tm *MockTopicManager) UpdateTopicConfig(topic string, config map[string]string) error {
+	tm.m.Lock()
+	defer tm.m.Unlock()
+	if tm.configs == nil {
+		tm.configs = make(map[string]map[string]string)
+	}
+	if tm.configs[topic] == nil {
+		tm.configs[topic] = make(map[string]string)
+	}
+	for k, v := range config {
+		tm.configs[topic][k] = v
+	}
+	return nil
+}
+
 // Close has no action on the mock
 func (tm *MockTopicManager) Close() error {
 	return nil
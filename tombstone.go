@@ -0,0 +1,92 @@
+package goka
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	configCleanupPolicy    = "cleanup.policy"
+	configDeleteRetention  = "delete.retention.ms"
+	configMaxCompactionLag = "max.compaction.lag.ms"
+
+	// Kafka's default of delete.retention.ms
+	defaultDeleteRetention = 24 * time.Hour
+)
+
+// EmitTombstone deletes the key from the table the emitter writes into by
+// emitting a tombstone, e.g. to implement the right to be forgotten.
+//
+// Before emitting, it verifies that the table is log-compacted and that its
+// delete.retention.ms, i.e. how long Kafka keeps the tombstone after
+// compacting, does not exceed gracePeriod. If it does, it is lowered to
+// gracePeriod via the topic manager.
+//
+// EmitTombstone returns the time by which the tombstone and all previous values
+// of the key are physically removed from the topic. That is the emit time plus
+// the table's max.compaction.lag.ms and delete.retention.ms. It is zero if
+// max.compaction.lag.ms is not set, since Kafka does not guarantee when the
+// key is compacted then.
+func EmitTombstone(emitter *Emitter, tm TopicManager, key string, gracePeriod time.Duration) (time.Time, error) {
+	if gracePeriod <= 0 {
+		return time.Time{}, fmt.Errorf("grace period must be positive, got %v", gracePeriod)
+	}
+
+	config, err := tm.TopicConfig(emitter.topic)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error getting config of table %s: %v", emitter.topic, err)
+	}
+	if policy, ok := config[configCleanupPolicy]; ok && !strings.Contains(policy, "compact") {
+		return time.Time{}, fmt.Errorf("table %s is not log-compacted (cleanup.policy=%s)", emitter.topic, policy)
+	}
+
+	deleteRetention, err := configDuration(config, configDeleteRetention, defaultDeleteRetention)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if deleteRetention > gracePeriod {
+		err = tm.UpdateTopicConfig(emitter.topic, map[string]string{
+			configDeleteRetention: strconv.FormatInt(int64(gracePeriod/time.Millisecond), 10),
+		})
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error lowering %s of table %s: %v", configDeleteRetention, emitter.topic, err)
+		}
+		deleteRetention = gracePeriod
+	}
+
+	maxCompactionLag, err := configDuration(config, configMaxCompactionLag, 0)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	emitted := time.Now()
+	if err := emitter.EmitSync(key, nil); err != nil {
+		return time.Time{}, fmt.Errorf("error emitting tombstone for key %s: %v", key, err)
+	}
+
+	if maxCompactionLag == 0 {
+		return time.Time{}, nil
+	}
+	return emitted.Add(maxCompactionLag + deleteRetention), nil
+}
+
+// configDuration parses a topic config value in milliseconds. Missing values
+// and values too large for a time.Duration, which Kafka uses to disable a
+// setting, return def.
+func configDuration(config map[string]string, name string, def time.Duration) (time.Duration, error) {
+	value, ok := config[name]
+	if !ok {
+		return def, nil
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing %s=%s: %v", name, value, err)
+	}
+	if ms > math.MaxInt64/int64(time.Millisecond) {
+		return def, nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
@@ -0,0 +1,69 @@
+package goka
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestEmitTombstone(t *testing.T) {
+	t.Run("succeed_lower_retention", func(t *testing.T) {
+		emitter, bm, ctrl := createEmitter(t)
+		defer ctrl.Finish()
+
+		bm.tmgr.EXPECT().TopicConfig(emitter.topic).Return(map[string]string{
+			"cleanup.policy":        "compact",
+			"delete.retention.ms":   "86400000",
+			"max.compaction.lag.ms": "3600000",
+		}, nil)
+		bm.tmgr.EXPECT().UpdateTopicConfig(emitter.topic, map[string]string{
+			"delete.retention.ms": "60000",
+		}).Return(nil)
+		bm.producer.EXPECT().Emit(emitter.topic, "key", nil).Return(NewPromise().Finish(nil, nil))
+
+		before := time.Now()
+		removeBy, err := EmitTombstone(emitter, bm.tmgr, "key", time.Minute)
+		test.AssertNil(t, err)
+		test.AssertFalse(t, removeBy.Before(before.Add(time.Hour+time.Minute)))
+		test.AssertTrue(t, removeBy.Before(time.Now().Add(time.Hour+time.Minute+time.Second)))
+	})
+	t.Run("succeed_no_compaction_lag", func(t *testing.T) {
+		emitter, bm, ctrl := createEmitter(t)
+		defer ctrl.Finish()
+
+		bm.tmgr.EXPECT().TopicConfig(emitter.topic).Return(map[string]string{
+			"delete.retention.ms":   "1000",
+			"max.compaction.lag.ms": "9223372036854775807",
+		}, nil)
+		bm.producer.EXPECT().Emit(emitter.topic, "key", nil).Return(NewPromise().Finish(nil, nil))
+
+		removeBy, err := EmitTombstone(emitter, bm.tmgr, "key", time.Minute)
+		test.AssertNil(t, err)
+		test.AssertTrue(t, removeBy.IsZero())
+	})
+	t.Run("fail_not_compacted", func(t *testing.T) {
+		emitter, bm, ctrl := createEmitter(t)
+		defer ctrl.Finish()
+
+		bm.tmgr.EXPECT().TopicConfig(emitter.topic).Return(map[string]string{
+			"cleanup.policy": "delete",
+		}, nil)
+
+		_, err := EmitTombstone(emitter, bm.tmgr, "key", time.Minute)
+		test.AssertNotNil(t, err)
+	})
+	t.Run("fail_update_config", func(t *testing.T) {
+		emitter, bm, ctrl := createEmitter(t)
+		defer ctrl.Finish()
+
+		bm.tmgr.EXPECT().TopicConfig(emitter.topic).Return(map[string]string{}, nil)
+		bm.tmgr.EXPECT().UpdateTopicConfig(emitter.topic, map[string]string{
+			"delete.retention.ms": "60000",
+		}).Return(errors.New("some-error"))
+
+		_, err := EmitTombstone(emitter, bm.tmgr, "key", time.Minute)
+		test.AssertNotNil(t, err)
+	})
+}
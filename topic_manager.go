@@ -26,6 +26,13 @@ type TopicManager interface {
 
 	GetOffset(topic string, partitionID int32, time int64) (int64, error)
 
+	// TopicConfig returns the effective configuration of a topic, including
+	// the values inherited from the broker defaults
+	TopicConfig(topic string) (map[string]string, error)
+	// UpdateTopicConfig sets the passed configuration values of a topic. Values
+	// that are set for the topic but not passed are kept.
+	UpdateTopicConfig(topic string, config map[string]string) error
+
 	// Close closes the topic manager
 	Close() error
 }
@@ -112,6 +119,83 @@ func (m *topicManager) GetOffset(topic string, partitionID int32, time int64) (i
 	return m.client.GetOffset(topic, partitionID, time)
 }
 
+func (m *topicManager) describeTopicConfig(topic string) ([]*sarama.ConfigEntry, error) {
+	response, err := m.broker.DescribeConfigs(&sarama.DescribeConfigsRequest{
+		Resources: []*sarama.ConfigResource{
+			&sarama.ConfigResource{
+				Type: sarama.TopicResource,
+				Name: topic,
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error describing config of topic %s: %v", topic, err)
+	}
+	for _, resource := range response.Resources {
+		if resource.Name != topic {
+			continue
+		}
+		if resource.ErrorCode != int16(sarama.ErrNoError) {
+			return nil, fmt.Errorf("error describing config of topic %s: %v (%s)", topic, sarama.KError(resource.ErrorCode), resource.ErrorMsg)
+		}
+		return resource.Configs, nil
+	}
+	return nil, fmt.Errorf("error describing config of topic %s: topic missing in response", topic)
+}
+
+func (m *topicManager) TopicConfig(topic string) (map[string]string, error) {
+	entries, err := m.describeTopicConfig(topic)
+	if err != nil {
+		return nil, err
+	}
+	config := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		config[entry.Name] = entry.Value
+	}
+	return config, nil
+}
+
+func (m *topicManager) UpdateTopicConfig(topic string, config map[string]string) error {
+	entries, err := m.describeTopicConfig(topic)
+	if err != nil {
+		return err
+	}
+
+	// altering replaces all values set for the topic, so we have to pass the
+	// current ones too
+	configEntries := make(map[string]*string)
+	for _, entry := range entries {
+		if entry.Default || entry.ReadOnly || entry.Sensitive {
+			continue
+		}
+		value := entry.Value
+		configEntries[entry.Name] = &value
+	}
+	for k, v := range config {
+		value := v
+		configEntries[k] = &value
+	}
+
+	response, err := m.broker.AlterConfigs(&sarama.AlterConfigsRequest{
+		Resources: []*sarama.AlterConfigsResource{
+			&sarama.AlterConfigsResource{
+				Type:          sarama.TopicResource,
+				Name:          topic,
+				ConfigEntries: configEntries,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error altering config of topic %s, config=%#v: %v", topic, config, err)
+	}
+	for _, resource := range response.Resources {
+		if resource.ErrorCode != int16(sarama.ErrNoError) {
+			return fmt.Errorf("error altering config of topic %s, config=%#v: %v (%s)", topic, config, sarama.KError(resource.ErrorCode), resource.ErrorMsg)
+		}
+	}
+	return nil
+}
+
 func (m *topicManager) checkTopicExistsWithPartitions(topic string, npar int) (bool, error) {
 	par, err := m.client.Partitions(topic)
 	if err != nil {
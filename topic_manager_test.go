@@ -402,3 +402,59 @@ func TestTM_EnsureTopicExists(t *testing.T) {
 		test.AssertNotNil(t, err)
 	})
 }
+
+func TestTM_UpdateTopicConfig(t *testing.T) {
+	t.Run("succeed", func(t *testing.T) {
+		tm, bm, ctrl := createTopicManager(t)
+		defer ctrl.Finish()
+		var (
+			topic     = "some-topic"
+			retention = "1000"
+			policy    = "compact"
+		)
+
+		bm.broker.EXPECT().DescribeConfigs(gomock.Any()).Return(&sarama.DescribeConfigsResponse{
+			Resources: []*sarama.ResourceResponse{
+				&sarama.ResourceResponse{
+					Name: topic,
+					Configs: []*sarama.ConfigEntry{
+						&sarama.ConfigEntry{Name: "cleanup.policy", Value: "compact"},
+						&sarama.ConfigEntry{Name: "delete.retention.ms", Value: "86400000", Default: true},
+					},
+				},
+			},
+		}, nil)
+		bm.broker.EXPECT().AlterConfigs(&sarama.AlterConfigsRequest{
+			Resources: []*sarama.AlterConfigsResource{
+				&sarama.AlterConfigsResource{
+					Type: sarama.TopicResource,
+					Name: topic,
+					ConfigEntries: map[string]*string{
+						"cleanup.policy":      &policy,
+						"delete.retention.ms": &retention,
+					},
+				},
+			},
+		}).Return(&sarama.AlterConfigsResponse{}, nil)
+
+		err := tm.UpdateTopicConfig(topic, map[string]string{"delete.retention.ms": retention})
+		test.AssertNil(t, err)
+	})
+	t.Run("fail", func(t *testing.T) {
+		tm, bm, ctrl := createTopicManager(t)
+		defer ctrl.Finish()
+		topic := "some-topic"
+
+		bm.broker.EXPECT().DescribeConfigs(gomock.Any()).Return(&sarama.DescribeConfigsResponse{
+			Resources: []*sarama.ResourceResponse{
+				&sarama.ResourceResponse{
+					ErrorCode: int16(sarama.ErrUnknownTopicOrPartition),
+					Name:      topic,
+				},
+			},
+		}, nil)
+
+		err := tm.UpdateTopicConfig(topic, map[string]string{"delete.retention.ms": "1000"})
+		test.AssertNotNil(t, err)
+	})
+}
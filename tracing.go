@@ -0,0 +1,120 @@
+package goka
+
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// names of the spans created with WithTracer
+const (
+	spanProcess  = "goka.process"
+	spanTableGet = "goka.table.get"
+	spanTableSet = "goka.table.set"
+	spanEmit     = "goka.emit"
+)
+
+// tracePropagator propagates the span contexts in the traceparent and
+// tracestate headers of the messages.
+var tracePropagator = propagation.TraceContext{}
+
+// headerCarrier adapts the headers of a message to propagate span contexts.
+type headerCarrier map[string][]byte
+
+func (hc headerCarrier) Get(key string) string {
+	return string(hc[key])
+}
+
+func (hc headerCarrier) Set(key string, value string) {
+	hc[key] = []byte(value)
+}
+
+func (hc headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(hc))
+	for key := range hc {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// endSpan ends a span, recording err if not nil.
+type endSpan func(err error)
+
+func endNoSpan(err error) {}
+
+// tracing creates the spans of a processor. All methods are no-ops on a nil
+// *tracing, i.e. if no tracer is configured.
+type tracing struct {
+	tracer trace.Tracer
+	group  attribute.KeyValue
+}
+
+func newTracing(tracer trace.Tracer, group Group) *tracing {
+	if tracer == nil {
+		return nil
+	}
+	return &tracing{
+		tracer: tracer,
+		group:  attribute.String("goka.group", string(group)),
+	}
+}
+
+// startProcess starts the span of processing msg as child of the span context
+// propagated in the message's headers.
+func (t *tracing) startProcess(ctx context.Context, msg *sarama.ConsumerMessage) (context.Context, endSpan) {
+	if t == nil {
+		return ctx, endNoSpan
+	}
+
+	headers := make(headerCarrier, len(msg.Headers))
+	for _, header := range msg.Headers {
+		headers[string(header.Key)] = header.Value
+	}
+	ctx = tracePropagator.Extract(ctx, headers)
+
+	return t.start(ctx, spanProcess, trace.SpanKindConsumer,
+		attribute.String("goka.topic", msg.Topic),
+		attribute.Int("goka.partition", int(msg.Partition)),
+		attribute.Int64("goka.offset", msg.Offset),
+	)
+}
+
+// startTable starts the span of reading (spanTableGet) or writing (spanTableSet) table.
+func (t *tracing) startTable(ctx context.Context, name string, table string) endSpan {
+	if t == nil {
+		return endNoSpan
+	}
+	_, end := t.start(ctx, name, trace.SpanKindInternal, attribute.String("goka.table", table))
+	return end
+}
+
+// startEmit starts the span of emitting into topic and returns the headers
+// propagating its span context.
+func (t *tracing) startEmit(ctx context.Context, topic string) (map[string][]byte, endSpan) {
+	if t == nil {
+		return nil, endNoSpan
+	}
+
+	ctx, end := t.start(ctx, spanEmit, trace.SpanKindProducer, attribute.String("goka.topic", topic))
+	headers := make(headerCarrier)
+	tracePropagator.Inject(ctx, headers)
+	return headers, end
+}
+
+func (t *tracing) start(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, endSpan) {
+	ctx, span := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(kind),
+		trace.WithAttributes(append(attrs, t.group)...),
+	)
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
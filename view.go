@@ -2,7 +2,6 @@ package goka
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"sync"
 
@@ -10,6 +9,7 @@ import (
 	"github.com/lovoo/goka/logger"
 	"github.com/lovoo/goka/multierr"
 	"github.com/lovoo/goka/storage"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ViewState represents the state of the view
@@ -28,12 +28,33 @@ const (
 	ViewStateRunning
 )
 
+func (vs ViewState) String() string {
+	switch vs {
+	case ViewStateIdle:
+		return "idle"
+	case ViewStateInitializing:
+		return "initializing"
+	case ViewStateConnecting:
+		return "connecting"
+	case ViewStateCatchUp:
+		return "catchup"
+	case ViewStateRunning:
+		return "running"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(vs))
+	}
+}
+
 func newViewSignal() *Signal {
+	names := make(map[State]string)
+	for _, vs := range []ViewState{ViewStateIdle, ViewStateInitializing, ViewStateConnecting, ViewStateCatchUp, ViewStateRunning} {
+		names[State(vs)] = vs.String()
+	}
 	return NewSignal(State(ViewStateIdle),
 		State(ViewStateInitializing),
 		State(ViewStateConnecting),
 		State(ViewStateCatchUp),
-		State(ViewStateRunning)).SetState(State(ViewStateIdle))
+		State(ViewStateRunning)).RegisterStateNames(names).SetState(State(ViewStateIdle))
 }
 
 // Getter functions return a value for a key or an error. If no value exists for the key, nil is returned without errors.
@@ -49,17 +70,35 @@ type View struct {
 	consumer   sarama.Consumer
 	tmgr       TopicManager
 	state      *Signal
+
+	// offline views serve existing storages without connecting to Kafka
+	offline bool
+
+	subscriptions *viewSubscriptions
+
+	// protects opts.tableCodec, which may be replaced by SetCodec
+	codecM sync.RWMutex
+
+	// protects the partitions slice, which may be extended by Reload
+	partitionsM sync.RWMutex
+	// passes the partitions added by Reload to Run
+	added chan []*PartitionTable
+	// serializes Reload and protects knownPartitions
+	reloadM sync.Mutex
+	// number of partitions including the ones added by Reload but not yet recovered
+	knownPartitions int
 }
 
 // NewView creates a new View object from a group.
 func NewView(brokers []string, topic Table, codec Codec, options ...ViewOption) (*View, error) {
+	userOptions := options
 	options = append(
 		// default options comes first
 		[]ViewOption{
 			WithViewClientID(fmt.Sprintf("goka-view-%s", topic)),
 			WithViewLogger(logger.Default()),
 			WithViewCallback(DefaultUpdate),
-			WithViewStorageBuilder(storage.DefaultBuilder(DefaultViewStoragePath())),
+			withViewDefaultStorageBuilder(storage.DefaultBuilder(DefaultViewStoragePath())),
 		},
 
 		// then the user passed options
@@ -71,6 +110,9 @@ func NewView(brokers []string, topic Table, codec Codec, options ...ViewOption)
 	if err != nil {
 		return nil, fmt.Errorf("Error applying user-defined options: %v", err)
 	}
+	if opts.offlinePath != "" {
+		return NewOfflineView(opts.offlinePath, topic, codec, userOptions...)
+	}
 
 	consumer, err := opts.builders.consumerSarama(brokers, opts.clientID)
 	if err != nil {
@@ -87,11 +129,25 @@ func NewView(brokers []string, topic Table, codec Codec, options ...ViewOption)
 		brokers:  brokers,
 		topic:    string(topic),
 		opts:     opts,
-		log:      opts.log.Prefix(fmt.Sprintf("View %s", topic)),
+		log:      logger.With(opts.log.Prefix(fmt.Sprintf("View %s", topic)), "topic", string(topic)),
 		consumer: consumer,
 		tmgr:     tmgr,
 		state:    newViewSignal(),
+		added:    make(chan []*PartitionTable),
+	}
+
+	v.subscriptions = newViewSubscriptions(opts.subscribeBufferSize, opts.subscribePolicy, v.codec)
+	v.subscriptions.recovered = func(partition int32) bool {
+		partitions := v.partitionTables()
+		return int(partition) < len(partitions) && partitions[partition].IsRecovered()
+	}
+	opts.updateCallback = v.subscriptions.wrapUpdate(opts.updateCallback)
+
+	metrics, err := newOtelMetrics(opts.otelMeter, attribute.String("goka.table", string(topic)), v.offsetLag)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating metrics: %v", err)
 	}
+	opts.updateCallback = metrics.wrapUpdate(opts.updateCallback)
 
 	if err = v.createPartitions(brokers); err != nil {
 		return nil, err
@@ -117,38 +173,65 @@ func (v *View) createPartitions(brokers []string) (rerr error) {
 		}
 	}()
 
-	partitions, err := tm.Partitions(v.topic)
+	recoveryTopic := v.recoveryTopic()
+	partitions, err := tm.Partitions(recoveryTopic)
 	if err != nil {
-		return fmt.Errorf("Error getting partitions for topic %s: %v", v.topic, err)
+		return fmt.Errorf("Error getting partitions for topic %s: %v", recoveryTopic, err)
 	}
 
 	// check assumption that partitions are gap-less
 	for i, p := range partitions {
 		if i != int(p) {
-			return fmt.Errorf("Partition numbers are not sequential for topic %s", v.topic)
+			return fmt.Errorf("Partition numbers are not sequential for topic %s", recoveryTopic)
 		}
 	}
 
-	for partID, p := range partitions {
-		backoff, err := v.opts.builders.backoff()
+	for _, p := range partitions {
+		pt, err := v.newPartitionTable(p)
 		if err != nil {
-			return fmt.Errorf("Error creating backoff: %v", err)
+			return err
 		}
-		v.partitions = append(v.partitions, newPartitionTable(v.topic,
-			p,
-			v.consumer,
-			v.tmgr,
-			v.opts.updateCallback,
-			v.opts.builders.storage,
-			v.log.Prefix(fmt.Sprintf("PartTable-%d", partID)),
-			backoff,
-			v.opts.backoffResetTime,
-		))
+		v.partitions = append(v.partitions, pt)
 	}
+	v.knownPartitions = len(v.partitions)
 
 	return nil
 }
 
+func (v *View) newPartitionTable(partition int32) (*PartitionTable, error) {
+	backoff, err := v.opts.builders.backoff()
+	if err != nil {
+		return nil, fmt.Errorf("Error creating backoff: %v", err)
+	}
+	pt := newPartitionTable(v.topic,
+		partition,
+		v.consumer,
+		v.tmgr,
+		v.opts.updateCallback,
+		v.opts.builders.storage,
+		logger.With(v.log.Prefix(fmt.Sprintf("PartTable-%d", partition)), "partition", partition),
+		backoff,
+		v.opts.backoffResetTime,
+	)
+	pt.recoveryTopic = v.recoveryTopic()
+	pt.durableUpdate = v.opts.durableUpdate
+	pt.offsetGapCallback = v.opts.offsetGapCallback
+	pt.recoveredCallback = v.opts.recoveredCallback
+	pt.autoReset = v.opts.autoReset
+	if v.opts.timestamps != nil {
+		pt.recordTimestamp = v.opts.timestamps.setCurrent
+	}
+	return pt, nil
+}
+
+// partitionTables returns the view's partitions. The returned slice is not
+// modified by Reload, which replaces it.
+func (v *View) partitionTables() []*PartitionTable {
+	v.partitionsM.RLock()
+	defer v.partitionsM.RUnlock()
+	return v.partitions
+}
+
 func (v *View) runStateMerger(ctx context.Context) {
 
 	var (
@@ -187,7 +270,7 @@ func (v *View) runStateMerger(ctx context.Context) {
 		case PartitionRunning:
 			newState = ViewStateRunning
 		default:
-			v.log.Printf("State merger received unknown partition state: %v", lowestState)
+			logger.Warnf(v.log, "State merger received unknown partition state: %v", lowestState)
 		}
 
 		if newState != -1 {
@@ -231,10 +314,15 @@ func (v *View) Run(ctx context.Context) (rerr error) {
 	v.log.Debugf("starting")
 	defer v.log.Debugf("stopped")
 
+	if v.offline {
+		return v.runOffline(ctx)
+	}
+
 	// update the view state asynchronously by observing
 	// the partition's state and translating that to the view
 	v.runStateMerger(ctx)
 	defer v.state.SetState(State(ViewStateIdle))
+	defer v.subscriptions.closeAll()
 
 	// close the view after running
 	defer func() {
@@ -246,10 +334,24 @@ func (v *View) Run(ctx context.Context) (rerr error) {
 
 	recoverErrg, recoverCtx := multierr.NewErrGroup(ctx)
 
+	// limits the partitions recovering at the same time, if configured
+	var recoverSlots chan struct{}
+	if v.opts.recoverConcurrency > 0 {
+		recoverSlots = make(chan struct{}, v.opts.recoverConcurrency)
+	}
+
 	for _, partition := range v.partitions {
 		partition := partition
 		go partition.RunStatsLoop(ctx)
 		recoverErrg.Go(func() error {
+			if recoverSlots != nil {
+				select {
+				case recoverSlots <- struct{}{}:
+					defer func() { <-recoverSlots }()
+				case <-recoverCtx.Done():
+					return nil
+				}
+			}
 			return partition.SetupAndRecover(recoverCtx, v.opts.autoreconnect)
 		})
 	}
@@ -274,6 +376,23 @@ func (v *View) Run(ctx context.Context) (rerr error) {
 			return partition.CatchupForever(catchupCtx, v.opts.autoreconnect)
 		})
 	}
+	if v.opts.diskLimit != nil {
+		catchupErrg.Go(func() error {
+			return v.runDiskLimit(catchupCtx)
+		})
+	}
+	catchupErrg.Go(func() error {
+		for {
+			select {
+			case <-catchupCtx.Done():
+				return nil
+			case added := <-v.added:
+				catchupErrg.Go(func() error {
+					return v.addPartitions(catchupCtx, catchupErrg, added)
+				})
+			}
+		}
+	})
 
 	err = catchupErrg.Wait().NilOrError()
 	if err != nil {
@@ -282,45 +401,132 @@ func (v *View) Run(ctx context.Context) (rerr error) {
 	return
 }
 
+// Reload checks whether partitions were added to the view's topic and starts
+// recovering them. Once all added partitions are recovered, they are added to
+// the view, so keys are assigned to them from then on. Until then, the view
+// keeps serving from its existing partitions. Reload must be called while the
+// view is running and returns once the recovery is started.
+func (v *View) Reload(ctx context.Context) error {
+	if v.offline {
+		return fmt.Errorf("cannot reload offline view %s", v.Topic())
+	}
+
+	v.reloadM.Lock()
+	defer v.reloadM.Unlock()
+
+	recoveryTopic := v.recoveryTopic()
+	partitions, err := v.tmgr.Partitions(recoveryTopic)
+	if err != nil {
+		return fmt.Errorf("Error getting partitions for topic %s: %v", recoveryTopic, err)
+	}
+	for i, p := range partitions {
+		if i != int(p) {
+			return fmt.Errorf("Partition numbers are not sequential for topic %s", recoveryTopic)
+		}
+	}
+	if len(partitions) < v.knownPartitions {
+		return fmt.Errorf("topic %s has %d partitions, less than the view's %d", recoveryTopic, len(partitions), v.knownPartitions)
+	}
+	if len(partitions) == v.knownPartitions {
+		return nil
+	}
+
+	var added []*PartitionTable
+	for _, p := range partitions[v.knownPartitions:] {
+		pt, err := v.newPartitionTable(p)
+		if err != nil {
+			return err
+		}
+		added = append(added, pt)
+	}
+
+	select {
+	case v.added <- added:
+		v.knownPartitions = len(partitions)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// addPartitions recovers the partitions added by Reload, adds them to the view
+// and keeps them catching up in errg.
+func (v *View) addPartitions(ctx context.Context, errg *multierr.ErrGroup, added []*PartitionTable) error {
+	recoverErrg, recoverCtx := multierr.NewErrGroup(ctx)
+	for _, partition := range added {
+		partition := partition
+		go partition.RunStatsLoop(ctx)
+		recoverErrg.Go(func() error {
+			return partition.SetupAndRecover(recoverCtx, v.opts.autoreconnect)
+		})
+	}
+
+	if err := recoverErrg.Wait().NilOrError(); err != nil {
+		for _, partition := range added {
+			partition.Close()
+		}
+		return fmt.Errorf("Error recovering added partitions for view %s: %v", v.Topic(), err)
+	}
+
+	// replace the slice, so readers can keep using the old one
+	v.partitionsM.Lock()
+	partitions := make([]*PartitionTable, 0, len(v.partitions)+len(added))
+	partitions = append(partitions, v.partitions...)
+	v.partitions = append(partitions, added...)
+	v.partitionsM.Unlock()
+
+	for _, partition := range added {
+		partition := partition
+		errg.Go(func() error {
+			return partition.CatchupForever(ctx, v.opts.autoreconnect)
+		})
+	}
+	return nil
+}
+
 // close closes all storage partitions
 func (v *View) close() error {
 	errg, _ := multierr.NewErrGroup(context.Background())
-	for _, p := range v.partitions {
+	for _, p := range v.partitionTables() {
 		p := p
 		errg.Go(func() error {
 			return p.Close()
 		})
 	}
+	v.partitionsM.Lock()
 	v.partitions = nil
+	v.partitionsM.Unlock()
 	return errg.Wait().NilOrError()
 }
 
 func (v *View) hash(key string) (int32, error) {
-	// create a new hasher every time. Alternative would be to store the hash in
-	// view and every time reset the hasher (ie, hasher.Reset()). But that would
-	// also require us to protect the access of the hasher with a mutex.
-	hasher := v.opts.hasher()
+	return v.hashIn(key, v.partitionTables())
+}
 
-	_, err := hasher.Write([]byte(key))
+// hashIn returns the partition of key among partitions.
+func (v *View) hashIn(key string, partitions []*PartitionTable) (int32, error) {
+	partitioner := v.opts.partitioner
+	if partitioner == nil {
+		partitioner = HasherPartitioner(v.opts.hasher)
+	}
+
+	partition, err := partitioner.Partition(key, int32(len(partitions)))
 	if err != nil {
 		return -1, err
 	}
-	hash := int32(hasher.Sum32())
-	if hash < 0 {
-		hash = -hash
+	if partition < 0 || int(partition) >= len(partitions) {
+		return -1, fmt.Errorf("partitioner returned invalid partition %d for key %s (%d partitions)", partition, key, len(partitions))
 	}
-	if len(v.partitions) == 0 {
-		return 0, errors.New("no partitions found")
-	}
-	return hash % int32(len(v.partitions)), nil
+	return partition, nil
 }
 
 func (v *View) find(key string) (*PartitionTable, error) {
-	h, err := v.hash(key)
+	partitions := v.partitionTables()
+	h, err := v.hashIn(key, partitions)
 	if err != nil {
 		return nil, err
 	}
-	return v.partitions[h], nil
+	return partitions[h], nil
 }
 
 // Topic returns  the view's topic
@@ -328,6 +534,21 @@ func (v *View) Topic() string {
 	return v.topic
 }
 
+// recoveryTopic returns the topic the view consumes, which is the table's
+// topic unless WithViewRecoverFrom is set.
+func (v *View) recoveryTopic() string {
+	if v.opts.recoverFrom != "" {
+		return string(v.opts.recoverFrom)
+	}
+	return v.topic
+}
+
+// NumPartitions returns the number of partitions the view is serving.
+func (v *View) NumPartitions() int {
+	partitions := v.partitionTables()
+	return len(partitions)
+}
+
 // Get returns the value for the key in the view, if exists. Nil if it doesn't.
 // Get can be called by multiple goroutines concurrently.
 // Get can only be called after Recovered returns true.
@@ -338,6 +559,19 @@ func (v *View) Get(key string) (interface{}, error) {
 		return nil, err
 	}
 
+	var generation uint64
+	if v.opts.getCache != nil {
+		var (
+			value  interface{}
+			cached bool
+		)
+		value, cached, generation = v.opts.getCache.get(key)
+		if cached {
+			v.opts.diskLimit.touch(key)
+			return value, nil
+		}
+	}
+
 	// get key and return
 	data, err := partTable.Get(key)
 	if err != nil {
@@ -345,17 +579,108 @@ func (v *View) Get(key string) (interface{}, error) {
 	} else if data == nil {
 		return nil, nil
 	}
+	v.opts.diskLimit.touch(key)
 
 	// decode value
-	value, err := v.opts.tableCodec.Decode(data)
+	value, err := v.codec().Decode(data)
 	if err != nil {
 		return nil, fmt.Errorf("error decoding value (key %s): %v", key, err)
 	}
+	if v.opts.getCache != nil {
+		v.opts.getCache.put(key, value, generation)
+	}
 
 	// if the key does not exist the return value is nil
 	return value, nil
 }
 
+// GetCtx returns the value for the key in the view like Get, but returns
+// ctx.Err() if the context is done before the value is read. The storage
+// cannot be interrupted, so a read that was started is finished in the
+// background and its result is dropped.
+func (v *View) GetCtx(ctx context.Context, key string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		value interface{}
+		err   error
+	}
+	// buffered, so the read does not block if the context is done
+	done := make(chan result, 1)
+	go func() {
+		value, err := v.Get(key)
+		done <- result{value: value, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-done:
+		return res.value, res.err
+	}
+}
+
+// GetAll returns the values of the passed keys, grouping the reads by
+// partition. Keys that do not exist are not contained in the returned map.
+// GetAll fails if a partition of the keys is not recovered.
+func (v *View) GetAll(keys []string) (map[string]interface{}, error) {
+	partitions := v.partitionTables()
+	byPartition := make(map[int32][]string)
+	for _, key := range keys {
+		partition, err := v.hashIn(key, partitions)
+		if err != nil {
+			return nil, err
+		}
+		byPartition[partition] = append(byPartition[partition], key)
+	}
+
+	for partition := range byPartition {
+		if !partitions[partition].IsRecovered() {
+			return nil, fmt.Errorf("partition %d of view %s is not recovered", partition, v.Topic())
+		}
+	}
+
+	values := make(map[string]interface{}, len(keys))
+	for partition, keys := range byPartition {
+		partTable := partitions[partition]
+		for _, key := range keys {
+			var generation uint64
+			if v.opts.getCache != nil {
+				var (
+					value  interface{}
+					cached bool
+				)
+				value, cached, generation = v.opts.getCache.get(key)
+				if cached {
+					v.opts.diskLimit.touch(key)
+					values[key] = value
+					continue
+				}
+			}
+
+			data, err := partTable.Get(key)
+			if err != nil {
+				return nil, fmt.Errorf("error getting value (key %s): %v", key, err)
+			} else if data == nil {
+				continue
+			}
+			v.opts.diskLimit.touch(key)
+
+			value, err := v.codec().Decode(data)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding value (key %s): %v", key, err)
+			}
+			if v.opts.getCache != nil {
+				v.opts.getCache.put(key, value, generation)
+			}
+			values[key] = value
+		}
+	}
+	return values, nil
+}
+
 // Has checks whether a value for passed key exists in the view.
 func (v *View) Has(key string) (bool, error) {
 	// find partition where key is located
@@ -367,49 +692,94 @@ func (v *View) Has(key string) (bool, error) {
 	return partTable.Has(key)
 }
 
+// Sync forces all writes of the view's storages to stable storage and returns
+// once they are durable, e.g. to take a consistent snapshot of the storage
+// directory. Note that the view keeps updating its storages, so the snapshot
+// contains at least the state at the time of Sync.
+// Sync can only be called after Recovered returns true.
+func (v *View) Sync() error {
+	partitions := v.partitionTables()
+	errs := new(multierr.Errors)
+	for i, p := range partitions {
+		if err := p.Sync(); err != nil {
+			errs.Collect(fmt.Errorf("error syncing partition %d: %v", i, err))
+		}
+	}
+	return errs.NilOrError()
+}
+
 // Iterator returns an iterator that iterates over the state of the View.
 func (v *View) Iterator() (Iterator, error) {
-	iters := make([]storage.Iterator, 0, len(v.partitions))
-	for i := range v.partitions {
-		iter, err := v.partitions[i].st.Iterator()
-		if err != nil {
-			// release already opened iterators
-			for i := range iters {
-				iters[i].Release()
-			}
+	return v.iterator(func(st storage.Storage) (storage.Iterator, error) {
+		return st.Iterator()
+	})
+}
 
-			return nil, fmt.Errorf("error opening partition iterator: %v", err)
-		}
+// IteratorWithRange returns an iterator that iterates over the state of the View. This iterator is build using the range.
+func (v *View) IteratorWithRange(start, limit string) (Iterator, error) {
+	return v.iterator(func(st storage.Storage) (storage.Iterator, error) {
+		return st.IteratorWithRange([]byte(start), []byte(limit))
+	})
+}
 
-		iters = append(iters, iter)
+// IteratorWithPrefix returns an iterator that iterates over the keys of the
+// View starting with prefix. The prefix is passed down to the storages, so
+// storages like LevelDB seek to it instead of scanning all keys. Since keys are
+// assigned to partitions by their hash, every partition is searched.
+// IteratorWithPrefix fails if any partition is not recovered yet.
+func (v *View) IteratorWithPrefix(prefix string) (Iterator, error) {
+	partitions := v.partitionTables()
+	for _, p := range partitions {
+		if !p.IsRecovered() {
+			return nil, fmt.Errorf("cannot iterate view %s: partition %d is not recovered", v.Topic(), p.partition)
+		}
+	}
+	if prefix == "" {
+		return v.Iterator()
 	}
+	return v.iterator(func(st storage.Storage) (storage.Iterator, error) {
+		// an empty limit iterates over the keys with the prefix start
+		return st.IteratorWithRange([]byte(prefix), nil)
+	})
+}
 
-	return &iterator{
-		iter:  storage.NewMultiIterator(iters),
-		codec: v.opts.tableCodec,
-	}, nil
+// IteratorReverse returns an iterator that iterates over the state of the View
+// in descending key order. Its Seek moves the iterator to the greatest key less
+// or equal to the given key.
+// Reverse iteration is supported by the LevelDB and memory storages (and the
+// transform, compression and encryption storages wrapping them, see
+// storage.ReverseIterable). IteratorReverse fails with storage.ErrUnsupported
+// for other storages.
+func (v *View) IteratorReverse() (Iterator, error) {
+	return v.mergedIterator(storage.NewReverseMultiIterator, storage.ReverseIterator)
 }
 
-// IteratorWithRange returns an iterator that iterates over the state of the View. This iterator is build using the range.
-func (v *View) IteratorWithRange(start, limit string) (Iterator, error) {
-	iters := make([]storage.Iterator, 0, len(v.partitions))
-	for i := range v.partitions {
-		iter, err := v.partitions[i].st.IteratorWithRange([]byte(start), []byte(limit))
+// iterator opens an iterator on each partition and merges them.
+func (v *View) iterator(open func(st storage.Storage) (storage.Iterator, error)) (Iterator, error) {
+	return v.mergedIterator(storage.NewMultiIterator, open)
+}
+
+// mergedIterator opens an iterator on each partition and merges them with merge.
+func (v *View) mergedIterator(merge func(iters []storage.Iterator) storage.Iterator, open func(st storage.Storage) (storage.Iterator, error)) (Iterator, error) {
+	partitions := v.partitionTables()
+	iters := make([]storage.Iterator, 0, len(partitions))
+	for i := range partitions {
+		iter, err := open(partitions[i].st)
 		if err != nil {
 			// release already opened iterators
 			for i := range iters {
 				iters[i].Release()
 			}
 
-			return nil, fmt.Errorf("error opening partition iterator: %v", err)
+			return nil, fmt.Errorf("error opening partition iterator: %w", err)
 		}
 
 		iters = append(iters, iter)
 	}
 
 	return &iterator{
-		iter:  storage.NewMultiIterator(iters),
-		codec: v.opts.tableCodec,
+		iter:  merge(iters),
+		codec: v.codec(),
 	}, nil
 }
 
@@ -421,12 +791,33 @@ func (v *View) Evict(key string) error {
 		return err
 	}
 
-	return s.Delete(key)
+	if err := s.Delete(key); err != nil {
+		return err
+	}
+	v.opts.getCache.invalidate(key)
+	if v.opts.evictCallback != nil {
+		v.opts.evictCallback(key)
+	}
+	return nil
+}
+
+// wrapEvictUpdate calls evict for the keys deleted by the update callback.
+func wrapEvictUpdate(cb UpdateCallback, evict func(key string)) UpdateCallback {
+	return func(s storage.Storage, partition int32, key string, value []byte) error {
+		if err := cb(s, partition, key, value); err != nil {
+			return err
+		}
+		if value == nil {
+			evict(key)
+		}
+		return nil
+	}
 }
 
 // Recovered returns true when the view has caught up with events from kafka.
 func (v *View) Recovered() bool {
-	for _, p := range v.partitions {
+	partitions := v.partitionTables()
+	for _, p := range partitions {
 		if !p.IsRecovered() {
 			return false
 		}
@@ -435,6 +826,129 @@ func (v *View) Recovered() bool {
 	return true
 }
 
+// SetCodec replaces the codec of the view, e.g. after a migration rewrote all
+// stored values into a new format, without restarting the view.
+// The codec is only replaced if migrationDone confirms the migration is complete,
+// otherwise an error is returned. The new codec applies to all subsequent reads;
+// reads running concurrently finish with the previous codec.
+func (v *View) SetCodec(codec Codec, migrationDone func() bool) error {
+	if codec == nil {
+		return fmt.Errorf("cannot set nil codec for view %s", v.Topic())
+	}
+	if migrationDone == nil || !migrationDone() {
+		return fmt.Errorf("cannot set codec for view %s: migration is not confirmed as done", v.Topic())
+	}
+
+	v.codecM.Lock()
+	defer v.codecM.Unlock()
+	v.opts.tableCodec = codec
+	return nil
+}
+
+// Codec returns the codec of the view's values, which is the one passed to
+// NewView unless it was replaced with SetCodec.
+func (v *View) Codec() Codec {
+	return v.codec()
+}
+
+// codec returns the current codec of the view.
+func (v *View) codec() Codec {
+	v.codecM.RLock()
+	defer v.codecM.RUnlock()
+	return v.opts.tableCodec
+}
+
+// VerifyCodec checks that the view's codec can decode the stored values by
+// decoding a sample of up to sampleSize values, spread over all partitions.
+// If more than maxFailureRatio (0 to 1) of the sampled values fail to decode,
+// it returns an error listing all keys that failed. Pass 0 to fail on any
+// value that cannot be decoded.
+// This allows to detect a codec mismatch, e.g. after a bad deployment, before
+// serving requests, e.g. as part of a check passed to WithViewReadinessCheck.
+// The view must be recovered.
+func (v *View) VerifyCodec(sampleSize int, maxFailureRatio float64) error {
+	partitions := v.partitionTables()
+	if !v.Recovered() {
+		return fmt.Errorf("cannot verify codec of view %s: view is not recovered", v.Topic())
+	}
+	if maxFailureRatio < 0 || maxFailureRatio > 1 {
+		return fmt.Errorf("cannot verify codec of view %s: invalid failure ratio %f", v.Topic(), maxFailureRatio)
+	}
+	if sampleSize <= 0 || len(partitions) == 0 {
+		return nil
+	}
+
+	// sample all partitions equally
+	perPartition := (sampleSize + len(partitions) - 1) / len(partitions)
+
+	var (
+		errs            = new(multierr.Errors)
+		sampled, failed int
+	)
+	for idx, partition := range partitions {
+		if sampled >= sampleSize {
+			break
+		}
+		limit := perPartition
+		if limit > sampleSize-sampled {
+			limit = sampleSize - sampled
+		}
+		n, nFailed, err := v.verifyPartitionCodec(partition, limit, errs)
+		if err != nil {
+			return fmt.Errorf("error sampling partition %d of view %s: %v", idx, v.Topic(), err)
+		}
+		sampled += n
+		failed += nFailed
+	}
+
+	if failed == 0 || float64(failed) <= maxFailureRatio*float64(sampled) {
+		return nil
+	}
+	return fmt.Errorf("%d of %d sampled values of view %s failed to decode: %v", failed, sampled, v.Topic(), errs.NilOrError())
+}
+
+// verifyPartitionCodec decodes up to limit values of the partition, collecting all
+// decoding errors in errs. It returns the number of sampled and failed values.
+func (v *View) verifyPartitionCodec(partition *PartitionTable, limit int, errs *multierr.Errors) (sampled, failed int, err error) {
+	iter, err := partition.st.Iterator()
+	if err != nil {
+		return 0, 0, fmt.Errorf("error opening iterator: %v", err)
+	}
+	defer iter.Release()
+
+	for sampled < limit && iter.Next() {
+		data, err := iter.Value()
+		if err != nil {
+			return sampled, failed, fmt.Errorf("error reading value (key %s): %v", iter.Key(), err)
+		}
+		sampled++
+		if data == nil {
+			continue
+		}
+		if _, err := v.codec().Decode(data); err != nil {
+			failed++
+			errs.Collect(fmt.Errorf("error decoding value (key %s): %v", iter.Key(), err))
+		}
+	}
+	return sampled, failed, iter.Err()
+}
+
+// Ready returns true if the view is recovered and the readiness check passed via
+// WithViewReadinessCheck (if any) succeeds.
+// This is useful to implement a single readiness probe for the application.
+func (v *View) Ready() bool {
+	if !v.Recovered() {
+		return false
+	}
+	if v.opts.readinessCheck != nil {
+		if err := v.opts.readinessCheck(); err != nil {
+			v.log.Debugf("readiness check failed: %v", err)
+			return false
+		}
+	}
+	return true
+}
+
 // CurrentState returns the current ViewState of the view
 // This is useful for polling e.g. when implementing health checks or metrics
 func (v *View) CurrentState() ViewState {
@@ -467,19 +981,38 @@ func (v *View) ObserveStateChanges() *StateChangeObserver {
 	return v.state.ObserveStateChange()
 }
 
+// ObserveStateTransitions returns a StateChangeObserver that receives all state transitions
+// of the view including their time via its Transitions channel, e.g. to build a lifecycle
+// timeline. The same rules as for ObserveStateChanges apply.
+func (v *View) ObserveStateTransitions() *StateChangeObserver {
+	return v.state.ObserveStateTransitions()
+}
+
 // Stats returns a set of performance metrics of the view.
 func (v *View) Stats(ctx context.Context) *ViewStats {
 	return v.statsWithContext(ctx)
 }
 
+// offsetLag returns the offset lag of the view's partitions.
+func (v *View) offsetLag(ctx context.Context) map[string]map[int32]int64 {
+	lag := make(map[int32]int64)
+	for partition, stats := range v.statsWithContext(ctx).Partitions {
+		if stats != nil && stats.Input != nil {
+			lag[partition] = stats.Input.OffsetLag
+		}
+	}
+	return map[string]map[int32]int64{v.topic: lag}
+}
+
 func (v *View) statsWithContext(ctx context.Context) *ViewStats {
+	partitions := v.partitionTables()
 	var (
 		m     sync.Mutex
 		stats = newViewStats()
 	)
 	errg, ctx := multierr.NewErrGroup(ctx)
 
-	for _, partTable := range v.partitions {
+	for _, partTable := range partitions {
 		partTable := partTable
 
 		errg.Go(func() error {
@@ -494,7 +1027,7 @@ func (v *View) statsWithContext(ctx context.Context) *ViewStats {
 
 	err := errg.Wait().NilOrError()
 	if err != nil {
-		v.log.Printf("Error retrieving stats: %v", err)
+		logger.Errorf(v.log, "Error retrieving stats: %v", err)
 	}
 	return stats
 }
@@ -0,0 +1,176 @@
+package goka
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/lovoo/goka/storage"
+)
+
+// AggregateInit creates the initial aggregate of a partition.
+type AggregateInit func() interface{}
+
+// AggregateFold updates the aggregate of a partition with the update of a key.
+// oldValue and newValue are decoded by the view's codec and nil if the key did
+// not exist before or is deleted by the update.
+// It returns the new aggregate.
+type AggregateFold func(agg interface{}, key string, oldValue, newValue interface{}) interface{}
+
+// recoveryAggregator maintains an aggregate per partition.
+type recoveryAggregator struct {
+	codec Codec
+	init  AggregateInit
+	fold  AggregateFold
+
+	m          sync.RWMutex
+	aggregates map[int32]interface{}
+}
+
+func newRecoveryAggregator(codec Codec, init AggregateInit, fold AggregateFold) *recoveryAggregator {
+	return &recoveryAggregator{
+		codec:      codec,
+		init:       init,
+		fold:       fold,
+		aggregates: make(map[int32]interface{}),
+	}
+}
+
+func (ra *recoveryAggregator) get(partition int32) interface{} {
+	ra.m.RLock()
+	defer ra.m.RUnlock()
+	return ra.aggregates[partition]
+}
+
+func (ra *recoveryAggregator) update(partition int32, key string, oldData, newData []byte) error {
+	oldValue, err := ra.decode(oldData)
+	if err != nil {
+		return fmt.Errorf("error decoding value (key %s) for aggregate: %v", key, err)
+	}
+	newValue, err := ra.decode(newData)
+	if err != nil {
+		return fmt.Errorf("error decoding value (key %s) for aggregate: %v", key, err)
+	}
+
+	ra.m.Lock()
+	defer ra.m.Unlock()
+	agg, ok := ra.aggregates[partition]
+	if !ok {
+		agg = ra.init()
+	}
+	ra.aggregates[partition] = ra.fold(agg, key, oldValue, newValue)
+	return nil
+}
+
+func (ra *recoveryAggregator) decode(data []byte) (interface{}, error) {
+	if data == nil {
+		return nil, nil
+	}
+	return ra.codec.Decode(data)
+}
+
+// wrapOptions wraps the view's storage builder and update callback to maintain
+// the aggregates. A nil aggregator keeps the options unchanged.
+func (ra *recoveryAggregator) wrapOptions(opt *voptions) error {
+	if ra == nil {
+		return nil
+	}
+	if opt.durableUpdate != nil {
+		return fmt.Errorf("recovery aggregator cannot be combined with a durable update callback")
+	}
+	opt.builders.storage = ra.wrapBuilder(opt.builders.storage)
+	opt.updateCallback = ra.wrapUpdate(opt.updateCallback)
+	return nil
+}
+
+// wrapUpdate wraps the update callback to fold every update into the aggregate.
+func (ra *recoveryAggregator) wrapUpdate(update UpdateCallback) UpdateCallback {
+	return func(s storage.Storage, partition int32, key string, value []byte) error {
+		old, err := s.Get(key)
+		if err != nil {
+			return fmt.Errorf("error reading value (key %s) for aggregate: %v", key, err)
+		}
+		if err := update(s, partition, key, value); err != nil {
+			return err
+		}
+		return ra.update(partition, key, old, value)
+	}
+}
+
+// wrapBuilder wraps the storage builder to initialize the aggregate of a partition
+// with the values already stored locally when the storage is opened.
+func (ra *recoveryAggregator) wrapBuilder(builder storage.Builder) storage.Builder {
+	return func(topic string, partition int32) (storage.Storage, error) {
+		st, err := builder(topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		return &aggregatedStorage{Storage: st, partition: partition, aggregator: ra}, nil
+	}
+}
+
+// aggregatedStorage initializes the partition's aggregate on Open.
+type aggregatedStorage struct {
+	storage.Storage
+	partition  int32
+	aggregator *recoveryAggregator
+}
+
+func (s *aggregatedStorage) Open() error {
+	if err := s.Storage.Open(); err != nil {
+		return err
+	}
+
+	ra := s.aggregator
+	ra.m.Lock()
+	ra.aggregates[s.partition] = ra.init()
+	ra.m.Unlock()
+
+	iter, err := s.Storage.Iterator()
+	if err != nil {
+		return fmt.Errorf("error opening iterator to initialize aggregate: %v", err)
+	}
+	defer iter.Release()
+	for iter.Next() {
+		value, err := iter.Value()
+		if err != nil {
+			return fmt.Errorf("error reading value to initialize aggregate: %v", err)
+		}
+		if err := ra.update(s.partition, string(iter.Key()), nil, value); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+func (s *aggregatedStorage) ApproximateSize() (int64, error) {
+	return storage.ApproximateSize(s.Storage)
+}
+
+func (s *aggregatedStorage) Compact() error {
+	return storage.Compact(s.Storage)
+}
+
+// WithViewRecoveryAggregator maintains an aggregate per partition of the view,
+// e.g. the number of keys or the sum of a field, which is available via View.Aggregate
+// right after the recovery without scanning the table.
+// The aggregate of each partition is created by init. When the local storage is
+// opened, the values already stored are folded into it once. Afterwards every
+// update of the table, while recovering and while running, is folded into it.
+// Note that every update reads the key's previous value from the storage.
+func WithViewRecoveryAggregator(init AggregateInit, fold AggregateFold) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.aggregator = newRecoveryAggregator(codec, init, fold)
+	}
+}
+
+// Aggregate returns the aggregate of the partition configured with
+// WithViewRecoveryAggregator.
+func (v *View) Aggregate(partition int32) (interface{}, error) {
+	if v.opts.aggregator == nil {
+		return nil, fmt.Errorf("view %s has no aggregator", v.Topic())
+	}
+	if partition < 0 || int(partition) >= len(v.partitionTables()) {
+		return nil, fmt.Errorf("view %s has no partition %d", v.Topic(), partition)
+	}
+	return v.opts.aggregator.get(partition), nil
+}
@@ -0,0 +1,106 @@
+package goka
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/lovoo/goka/storage"
+)
+
+// getCache is a bounded LRU cache of decoded values in front of View.Get.
+type getCache struct {
+	m          sync.Mutex
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+	// incremented on every invalidation, so values read from the storage
+	// before an invalidation are not cached afterwards
+	generation uint64
+}
+
+type getCacheEntry struct {
+	key   string
+	value interface{}
+}
+
+func newGetCache(maxEntries int) *getCache {
+	return &getCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached value of key. It returns the current generation to be
+// passed to put if the key is not cached.
+func (c *getCache) get(key string) (interface{}, bool, uint64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*getCacheEntry).value, true, c.generation
+	}
+	return nil, false, c.generation
+}
+
+// put caches the value of key unless the cache was invalidated since
+// generation.
+func (c *getCache) put(key string, value interface{}, generation uint64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*getCacheEntry).value = value
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&getCacheEntry{key: key, value: value})
+	for c.order.Len() > c.maxEntries {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.entries, e.Value.(*getCacheEntry).key)
+	}
+}
+
+// invalidate removes the key from the cache. It is nil-safe, so it can be
+// called without checking whether the cache is enabled.
+func (c *getCache) invalidate(key string) {
+	if c == nil {
+		return
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.generation++
+	if e, ok := c.entries[key]; ok {
+		c.order.Remove(e)
+		delete(c.entries, key)
+	}
+}
+
+// wrapOptions wraps the view's update callback to invalidate the cached keys.
+// A nil getCache keeps the options unchanged.
+func (c *getCache) wrapOptions(opt *voptions) error {
+	if c == nil {
+		return nil
+	}
+	if c.maxEntries <= 0 {
+		return fmt.Errorf("get cache requires a positive number of entries")
+	}
+	if opt.durableUpdate != nil {
+		return fmt.Errorf("get cache cannot be combined with a durable update callback")
+	}
+	opt.updateCallback = c.wrapUpdate(opt.updateCallback)
+	return nil
+}
+
+// wrapUpdate invalidates the keys written by the update callback.
+func (c *getCache) wrapUpdate(cb UpdateCallback) UpdateCallback {
+	return func(s storage.Storage, partition int32, key string, value []byte) error {
+		// invalidate after the write, so no Get caches the old value in between
+		defer c.invalidate(key)
+		return cb(s, partition, key, value)
+	}
+}
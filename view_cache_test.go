@@ -0,0 +1,43 @@
+package goka
+
+import (
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestView_GetCache(t *testing.T) {
+	view := createMemoryTestView(t, "table", map[string]string{"a": "1", "b": "2", "c": "3"})
+	view.opts.getCache = newGetCache(2)
+	st := view.partitions[0].st
+	update := view.opts.getCache.wrapUpdate(DefaultUpdate)
+
+	assertGet := func(key string, expected interface{}) {
+		value, err := view.Get(key)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, value, expected)
+	}
+
+	// a hit does not read the storage
+	assertGet("a", "1")
+	test.AssertNil(t, st.Storage.Set("a", []byte("changed")))
+	assertGet("a", "1")
+
+	// updates invalidate the key
+	test.AssertNil(t, update(st, 0, "a", []byte("updated")))
+	assertGet("a", "updated")
+
+	// evicting removes the key
+	test.AssertNil(t, view.Evict("a"))
+	assertGet("a", nil)
+
+	// the least recently used key is dropped
+	assertGet("b", "2")
+	assertGet("c", "3")
+	test.AssertNil(t, update(st, 0, "a", []byte("1")))
+	assertGet("a", "1")
+	test.AssertNil(t, st.Storage.Set("b", []byte("changed")))
+	test.AssertNil(t, st.Storage.Set("c", []byte("changed")))
+	assertGet("c", "3")
+	assertGet("b", "changed")
+}
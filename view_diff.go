@@ -0,0 +1,182 @@
+package goka
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// diffProbeKeys is the number of keys hashed by both views to check that they
+// assign keys to the same partitions.
+const diffProbeKeys = 1024
+
+// DiffType describes how a key differs between two views.
+type DiffType int
+
+const (
+	// DiffValue indicates the key exists in both views but the values differ.
+	DiffValue DiffType = iota
+	// DiffMissingInA indicates the key only exists in view B.
+	DiffMissingInA
+	// DiffMissingInB indicates the key only exists in view A.
+	DiffMissingInB
+)
+
+// DiffEntry is a key that differs between two views, as streamed by DiffViews.
+// A and B contain the values decoded by the respective view's codec, or nil if the
+// key is missing in that view.
+// If Err is set, the diff was aborted and no further entries will follow.
+type DiffEntry struct {
+	Key  string
+	Type DiffType
+	A    interface{}
+	B    interface{}
+	Err  error
+}
+
+// DiffViews compares the content of two views and streams all keys that differ
+// or are missing on one side. This can be used to reconcile a view against another
+// one, e.g. a view rebuilt after a suspected corruption.
+// Both views must be recovered and copartitioned, since the comparison is done
+// partition by partition. The views are considered copartitioned if they have
+// the same number of partitions and assign a set of probe keys to the same
+// partitions, which fails if they use different hashers.
+// The returned channel is closed when the comparison is done or ctx is
+// cancelled. The caller must either drain it or cancel ctx.
+func DiffViews(ctx context.Context, a, b *View) (<-chan DiffEntry, error) {
+	if a == nil || b == nil {
+		return nil, fmt.Errorf("cannot diff nil views")
+	}
+	if !a.Recovered() || !b.Recovered() {
+		return nil, fmt.Errorf("cannot diff views %s and %s: both views must be recovered", a.Topic(), b.Topic())
+	}
+	partsA, partsB := a.partitionTables(), b.partitionTables()
+	if len(partsA) == 0 || len(partsA) != len(partsB) {
+		return nil, fmt.Errorf("cannot diff views %s and %s: views are not copartitioned (%d vs. %d partitions)",
+			a.Topic(), b.Topic(), len(partsA), len(partsB))
+	}
+	if err := checkCopartitioned(a, b); err != nil {
+		return nil, fmt.Errorf("cannot diff views %s and %s: %v", a.Topic(), b.Topic(), err)
+	}
+
+	diffs := make(chan DiffEntry)
+	go func() {
+		defer close(diffs)
+		for i := range partsA {
+			if err := diffPartitions(ctx, a, b, partsA[i], partsB[i], diffs); err != nil {
+				select {
+				case diffs <- DiffEntry{Err: fmt.Errorf("error diffing partition %d: %v", i, err)}:
+				case <-ctx.Done():
+				}
+				return
+			}
+		}
+	}()
+	return diffs, nil
+}
+
+// checkCopartitioned returns an error if the views assign any of the probe keys
+// to different partitions.
+func checkCopartitioned(a, b *View) error {
+	for i := 0; i < diffProbeKeys; i++ {
+		key := strconv.Itoa(i)
+		pa, err := a.hash(key)
+		if err != nil {
+			return err
+		}
+		pb, err := b.hash(key)
+		if err != nil {
+			return err
+		}
+		if pa != pb {
+			return fmt.Errorf("views are not copartitioned (key %s is in partition %d vs. %d)", key, pa, pb)
+		}
+	}
+	return nil
+}
+
+// diffPartitions sends the differences of two partition tables to the passed channel.
+// It first iterates over pa to find keys missing in pb or having different values,
+// then it iterates over pb to find keys missing in pa. It stops with ctx's error
+// if ctx is done.
+func diffPartitions(ctx context.Context, a, b *View, pa, pb *PartitionTable, diffs chan<- DiffEntry) error {
+	iterA, err := pa.st.Iterator()
+	if err != nil {
+		return fmt.Errorf("error opening iterator for %s: %v", a.Topic(), err)
+	}
+	defer iterA.Release()
+
+	for iterA.Next() {
+		key := string(iterA.Key())
+		dataA, err := iterA.Value()
+		if err != nil {
+			return fmt.Errorf("error reading value (key %s) from %s: %v", key, a.Topic(), err)
+		}
+		dataB, err := pb.st.Get(key)
+		if err != nil {
+			return fmt.Errorf("error reading value (key %s) from %s: %v", key, b.Topic(), err)
+		}
+
+		if dataB != nil && bytes.Equal(dataA, dataB) {
+			continue
+		}
+
+		entry := DiffEntry{Key: key, Type: DiffValue}
+		if dataB == nil {
+			entry.Type = DiffMissingInB
+		}
+		if entry.A, err = decodeDiffValue(a, dataA); err != nil {
+			return fmt.Errorf("error decoding value (key %s) from %s: %v", key, a.Topic(), err)
+		}
+		if entry.B, err = decodeDiffValue(b, dataB); err != nil {
+			return fmt.Errorf("error decoding value (key %s) from %s: %v", key, b.Topic(), err)
+		}
+		select {
+		case diffs <- entry:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := iterA.Err(); err != nil {
+		return fmt.Errorf("error iterating %s: %v", a.Topic(), err)
+	}
+
+	iterB, err := pb.st.Iterator()
+	if err != nil {
+		return fmt.Errorf("error opening iterator for %s: %v", b.Topic(), err)
+	}
+	defer iterB.Release()
+
+	for iterB.Next() {
+		key := string(iterB.Key())
+		has, err := pa.st.Has(key)
+		if err != nil {
+			return fmt.Errorf("error checking key %s in %s: %v", key, a.Topic(), err)
+		}
+		if has {
+			continue
+		}
+		dataB, err := iterB.Value()
+		if err != nil {
+			return fmt.Errorf("error reading value (key %s) from %s: %v", key, b.Topic(), err)
+		}
+		value, err := decodeDiffValue(b, dataB)
+		if err != nil {
+			return fmt.Errorf("error decoding value (key %s) from %s: %v", key, b.Topic(), err)
+		}
+		select {
+		case diffs <- DiffEntry{Key: key, Type: DiffMissingInA, B: value}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return iterB.Err()
+}
+
+func decodeDiffValue(v *View, data []byte) (interface{}, error) {
+	if data == nil {
+		return nil, nil
+	}
+	return v.codec().Decode(data)
+}
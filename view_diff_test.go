@@ -0,0 +1,104 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"testing"
+
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
+)
+
+func createMemoryTestView(t *testing.T, topic string, values ...map[string]string) *View {
+	view := &View{
+		topic: topic,
+		opts: &voptions{
+			tableCodec: new(codec.String),
+			hasher:     DefaultHasher(),
+		},
+	}
+	for _, partValues := range values {
+		st := storage.NewMemory()
+		for k, v := range partValues {
+			test.AssertNil(t, st.Set(k, []byte(v)))
+		}
+		view.partitions = append(view.partitions, &PartitionTable{
+			st:    &storageProxy{Storage: st},
+			state: newPartitionTableState().SetState(State(PartitionRunning)),
+		})
+	}
+	return view
+}
+
+func TestDiffViews(t *testing.T) {
+	t.Run("succeed", func(t *testing.T) {
+		a := createMemoryTestView(t, "a",
+			map[string]string{"same": "1", "changed": "a", "only-a": "x"},
+			map[string]string{"same-2": "2"},
+		)
+		b := createMemoryTestView(t, "b",
+			map[string]string{"same": "1", "changed": "b"},
+			map[string]string{"same-2": "2", "only-b": "y"},
+		)
+
+		diffs, err := DiffViews(context.Background(), a, b)
+		test.AssertNil(t, err)
+
+		entries := make(map[string]DiffEntry)
+		for entry := range diffs {
+			test.AssertNil(t, entry.Err)
+			entries[entry.Key] = entry
+		}
+		test.AssertEqual(t, len(entries), 3)
+		test.AssertEqual(t, entries["changed"], DiffEntry{Key: "changed", Type: DiffValue, A: "a", B: "b"})
+		test.AssertEqual(t, entries["only-a"], DiffEntry{Key: "only-a", Type: DiffMissingInB, A: "x"})
+		test.AssertEqual(t, entries["only-b"], DiffEntry{Key: "only-b", Type: DiffMissingInA, B: "y"})
+	})
+	t.Run("fail_not_copartitioned", func(t *testing.T) {
+		a := createMemoryTestView(t, "a", map[string]string{}, map[string]string{})
+		b := createMemoryTestView(t, "b", map[string]string{})
+
+		_, err := DiffViews(context.Background(), a, b)
+		test.AssertNotNil(t, err)
+	})
+	t.Run("fail_other_hasher", func(t *testing.T) {
+		a := createMemoryTestView(t, "a", map[string]string{}, map[string]string{})
+		b := createMemoryTestView(t, "b", map[string]string{}, map[string]string{})
+		b.opts.hasher = func() hash.Hash32 { return crc32.NewIEEE() }
+
+		_, err := DiffViews(context.Background(), a, b)
+		test.AssertNotNil(t, err)
+	})
+	t.Run("cancel", func(t *testing.T) {
+		values := make(map[string]string)
+		for i := 0; i < 100; i++ {
+			values[fmt.Sprintf("key-%d", i)] = "a"
+		}
+		a := createMemoryTestView(t, "a", values)
+		b := createMemoryTestView(t, "b", map[string]string{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		diffs, err := DiffViews(ctx, a, b)
+		test.AssertNil(t, err)
+		<-diffs
+		cancel()
+
+		// the channel is closed without receiving all remaining entries
+		var received int
+		for range diffs {
+			received++
+		}
+		test.AssertTrue(t, received < len(values)-1)
+	})
+	t.Run("fail_not_recovered", func(t *testing.T) {
+		a := createMemoryTestView(t, "a", map[string]string{})
+		b := createMemoryTestView(t, "b", map[string]string{})
+		b.partitions[0].state.SetState(State(PartitionRecovering))
+
+		_, err := DiffViews(context.Background(), a, b)
+		test.AssertNotNil(t, err)
+	})
+}
@@ -0,0 +1,215 @@
+package goka
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lovoo/goka/logger"
+	"github.com/lovoo/goka/storage"
+)
+
+// DiskLimitPolicy defines how a view enforces the limit set with
+// WithViewMaxDiskBytes.
+type DiskLimitPolicy int
+
+const (
+	// DiskLimitFail stops the view with an error once the limit is exceeded.
+	DiskLimitFail DiskLimitPolicy = iota
+	// DiskLimitCompact compacts the storages of all partitions once the limit
+	// is exceeded, which reclaims the space of deleted and overwritten values.
+	DiskLimitCompact
+	// DiskLimitEvictLRU evicts the least recently read or updated keys from the
+	// local storages and compacts them until the view is below the limit. It is
+	// meant for cache-like views that can lose keys, which come back with their
+	// next update.
+	DiskLimitEvictLRU
+)
+
+const (
+	diskLimitCheckInterval = 30 * time.Second
+	// fraction of the tracked keys evicted per round
+	diskLimitEvictFraction  = 0.1
+	diskLimitMaxEvictRounds = 10
+)
+
+type diskLimit struct {
+	maxBytes int64
+	policy   DiskLimitPolicy
+	// tracks the key usage for DiskLimitEvictLRU, nil otherwise
+	lru *keyLRU
+}
+
+// touch marks the key as recently used.
+func (dl *diskLimit) touch(key string) {
+	if dl != nil && dl.lru != nil {
+		dl.lru.touch(key)
+	}
+}
+
+// wrapOptions wraps the view's update callback to track the key usage for
+// DiskLimitEvictLRU. A nil diskLimit keeps the options unchanged.
+func (dl *diskLimit) wrapOptions(opt *voptions) {
+	if dl != nil && dl.policy == DiskLimitEvictLRU {
+		dl.lru = newKeyLRU()
+		opt.updateCallback = dl.wrapUpdate(opt.updateCallback)
+	}
+}
+
+// wrapUpdate tracks the keys updated by the update callback.
+func (dl *diskLimit) wrapUpdate(cb UpdateCallback) UpdateCallback {
+	return func(s storage.Storage, partition int32, key string, value []byte) error {
+		if value == nil {
+			dl.lru.remove(key)
+		} else {
+			dl.lru.touch(key)
+		}
+		return cb(s, partition, key, value)
+	}
+}
+
+// keyLRU keeps the keys in the order they were used.
+type keyLRU struct {
+	m     sync.Mutex
+	order *list.List
+	keys  map[string]*list.Element
+}
+
+func newKeyLRU() *keyLRU {
+	return &keyLRU{
+		order: list.New(),
+		keys:  make(map[string]*list.Element),
+	}
+}
+
+func (l *keyLRU) touch(key string) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if e, ok := l.keys[key]; ok {
+		l.order.MoveToFront(e)
+		return
+	}
+	l.keys[key] = l.order.PushFront(key)
+}
+
+func (l *keyLRU) remove(key string) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if e, ok := l.keys[key]; ok {
+		l.order.Remove(e)
+		delete(l.keys, key)
+	}
+}
+
+// evictable removes and returns the least recently used fraction of the keys,
+// at least one if any key is tracked.
+func (l *keyLRU) evictable(fraction float64) []string {
+	l.m.Lock()
+	defer l.m.Unlock()
+	n := int(float64(l.order.Len()) * fraction)
+	if n == 0 {
+		n = l.order.Len()
+		if n > 1 {
+			n = 1
+		}
+	}
+	keys := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		e := l.order.Back()
+		key := l.order.Remove(e).(string)
+		delete(l.keys, key)
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// ApproximateSize returns the approximate size of the view's local storages on
+// disk. It fails if a storage does not implement storage.Sizer.
+func (v *View) ApproximateSize() (int64, error) {
+	var total int64
+	for _, p := range v.partitionTables() {
+		if p.st == nil {
+			return 0, fmt.Errorf("partition %d of view %s is not set up", p.partition, v.Topic())
+		}
+		size, err := storage.ApproximateSize(p.st.Storage)
+		if err != nil {
+			return 0, fmt.Errorf("error getting size of partition %d of view %s: %v", p.partition, v.Topic(), err)
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// compact compacts the local storages of all partitions.
+func (v *View) compact() error {
+	for _, p := range v.partitionTables() {
+		if err := storage.Compact(p.st.Storage); err != nil {
+			return fmt.Errorf("error compacting partition %d of view %s: %v", p.partition, v.Topic(), err)
+		}
+	}
+	return nil
+}
+
+// runDiskLimit enforces the disk limit periodically until the context is done.
+func (v *View) runDiskLimit(ctx context.Context) error {
+	ticker := time.NewTicker(diskLimitCheckInterval)
+	defer ticker.Stop()
+	for {
+		if err := v.enforceDiskLimit(); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (v *View) enforceDiskLimit() error {
+	dl := v.opts.diskLimit
+	size, err := v.ApproximateSize()
+	if err != nil {
+		return err
+	}
+	if size <= dl.maxBytes {
+		return nil
+	}
+
+	switch dl.policy {
+	case DiskLimitCompact:
+		if err := v.compact(); err != nil {
+			return err
+		}
+	case DiskLimitEvictLRU:
+		for round := 0; round < diskLimitMaxEvictRounds && size > dl.maxBytes; round++ {
+			keys := dl.lru.evictable(diskLimitEvictFraction)
+			if len(keys) == 0 {
+				break
+			}
+			for _, key := range keys {
+				if err := v.Evict(key); err != nil {
+					return err
+				}
+			}
+			if err := v.compact(); err != nil {
+				return err
+			}
+			if size, err = v.ApproximateSize(); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("view %s exceeds its disk limit (%d > %d bytes)", v.Topic(), size, dl.maxBytes)
+	}
+
+	if size, err = v.ApproximateSize(); err != nil {
+		return err
+	}
+	if size > dl.maxBytes {
+		logger.Warnf(v.log, "view still exceeds its disk limit after enforcing it (%d > %d bytes)", size, dl.maxBytes)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package goka
+
+import (
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/logger"
+	"github.com/lovoo/goka/storage"
+)
+
+// sizedStorage reports the number of stored keys as its size.
+type sizedStorage struct {
+	storage.Storage
+	compactions int
+}
+
+func (s *sizedStorage) ApproximateSize() (int64, error) {
+	iter, err := s.Iterator()
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Release()
+	var size int64
+	for iter.Next() {
+		size++
+	}
+	return size, nil
+}
+
+func (s *sizedStorage) Compact() error {
+	s.compactions++
+	return nil
+}
+
+func createDiskLimitTestView(t *testing.T, maxBytes int64, policy DiskLimitPolicy, values map[string]string) (*View, *sizedStorage) {
+	view := createMemoryTestView(t, "table", values)
+	st := &sizedStorage{Storage: view.partitions[0].st.Storage}
+	view.partitions[0].st.Storage = st
+	view.log = logger.Default()
+	view.opts.diskLimit = &diskLimit{maxBytes: maxBytes, policy: policy}
+	if policy == DiskLimitEvictLRU {
+		view.opts.diskLimit.lru = newKeyLRU()
+	}
+	return view, st
+}
+
+func TestView_DiskLimit(t *testing.T) {
+	values := map[string]string{"a": "1", "b": "2", "c": "3"}
+
+	t.Run("below_limit", func(t *testing.T) {
+		view, st := createDiskLimitTestView(t, 3, DiskLimitCompact, values)
+		size, err := view.ApproximateSize()
+		test.AssertNil(t, err)
+		test.AssertEqual(t, size, int64(3))
+		test.AssertNil(t, view.enforceDiskLimit())
+		test.AssertEqual(t, st.compactions, 0)
+	})
+	t.Run("fail", func(t *testing.T) {
+		view, _ := createDiskLimitTestView(t, 2, DiskLimitFail, values)
+		err := view.enforceDiskLimit()
+		test.AssertNotNil(t, err)
+		test.AssertStringContains(t, err.Error(), "exceeds its disk limit")
+	})
+	t.Run("compact", func(t *testing.T) {
+		view, st := createDiskLimitTestView(t, 2, DiskLimitCompact, values)
+		test.AssertNil(t, view.enforceDiskLimit())
+		test.AssertEqual(t, st.compactions, 1)
+	})
+	t.Run("evict_lru", func(t *testing.T) {
+		view, _ := createDiskLimitTestView(t, 2, DiskLimitEvictLRU, values)
+		update := view.opts.diskLimit.wrapUpdate(DefaultUpdate)
+		for _, key := range []string{"a", "b", "c"} {
+			test.AssertNil(t, update(view.partitions[0].st, 0, key, []byte(values[key])))
+		}
+		// reading a makes b the least recently used key
+		value, err := view.Get("a")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, value, "1")
+
+		test.AssertNil(t, view.enforceDiskLimit())
+		for key, has := range map[string]bool{"a": true, "b": false, "c": true} {
+			ok, err := view.Has(key)
+			test.AssertNil(t, err)
+			test.AssertEqual(t, ok, has)
+		}
+	})
+	t.Run("unsupported", func(t *testing.T) {
+		view := createMemoryTestView(t, "table", values)
+		_, err := view.ApproximateSize()
+		test.AssertNotNil(t, err)
+	})
+}
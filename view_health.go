@@ -0,0 +1,83 @@
+package goka
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// healthStatsTimeout bounds the time the health handler waits for the stats.
+const healthStatsTimeout = time.Second
+
+// ViewHealth is the health of a view reported by NewViewHealthHandler.
+type ViewHealth struct {
+	Ready      bool                      `json:"ready"`
+	Recovered  bool                      `json:"recovered"`
+	Partitions map[int32]PartitionHealth `json:"partitions"`
+}
+
+// PartitionHealth is the health of a view's partition.
+type PartitionHealth struct {
+	Status string `json:"status"`
+	// OffsetLag is the number of messages the partition is behind, or -1 if
+	// the stats could not be fetched in time
+	OffsetLag int64 `json:"offset_lag"`
+}
+
+// Health returns the health of the view. The partitions' stats are fetched
+// with the passed context, partitions not reporting in time have an offset lag
+// of -1.
+func (v *View) Health(ctx context.Context) *ViewHealth {
+	health := &ViewHealth{
+		Ready:      v.Ready(),
+		Recovered:  v.Recovered(),
+		Partitions: make(map[int32]PartitionHealth),
+	}
+
+	stats := v.statsWithContext(ctx)
+	for _, p := range v.partitionTables() {
+		partition := p.partition
+		ph := PartitionHealth{
+			Status:    p.CurrentState().String(),
+			OffsetLag: -1,
+		}
+		if ts := stats.Partitions[partition]; ts != nil {
+			if p.IsRecovered() {
+				ph.OffsetLag = ts.Input.OffsetLag
+			} else if ts.Recovery.Hwm > 0 {
+				ph.OffsetLag = ts.Recovery.Hwm - ts.Recovery.Offset - 1
+			}
+		}
+		health.Partitions[partition] = ph
+	}
+	return health
+}
+
+// NewViewHealthHandler returns a handler reporting the health of the view.
+// Requests to a path ending with /ready are answered with 200 once the view is
+// ready (see View.Ready) and with 503 before, e.g. as readiness probe. All
+// other requests are answered with the ViewHealth as JSON.
+func NewViewHealthHandler(v *View) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/ready") {
+			if !v.Ready() {
+				http.Error(w, "not ready", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("ready"))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), healthStatsTimeout)
+		defer cancel()
+		health := v.Health(ctx)
+
+		w.Header().Set("Content-Type", "application/json")
+		if !health.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(health)
+	})
+}
@@ -0,0 +1,39 @@
+package goka
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestView_Health(t *testing.T) {
+	view := createMemoryTestView(t, "table", map[string]string{}, map[string]string{})
+	for i, p := range view.partitions {
+		p.partition = int32(i)
+	}
+	handler := NewViewHealthHandler(view)
+
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+		return rec.Code
+	}
+	test.AssertEqual(t, ready(), http.StatusOK)
+
+	view.partitions[1].state.SetState(State(PartitionRecovering))
+	test.AssertEqual(t, ready(), http.StatusServiceUnavailable)
+
+	// the stats are not fetched in time, since the view is not running
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	health := view.Health(ctx)
+	test.AssertFalse(t, health.Ready)
+	test.AssertFalse(t, health.Recovered)
+	test.AssertEqual(t, health.Partitions, map[int32]PartitionHealth{
+		0: {Status: "running", OffsetLag: -1},
+		1: {Status: "recovering", OffsetLag: -1},
+	})
+}
@@ -0,0 +1,132 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/lovoo/goka/logger"
+	"github.com/lovoo/goka/storage"
+)
+
+// NewOfflineView creates a view serving a table from existing local storages
+// without connecting to Kafka, e.g. to analyze a copy of a processor's or view's
+// storage directory. The storages are expected in path using the layout of
+// storage.DefaultBuilder (one directory "<table>.<partition>" per partition) and
+// are opened read-only.
+//
+// The returned view is recovered immediately, so Get, Has and Iterator can be
+// used without calling Run. Run does not consume anything, it only waits for the
+// context to be closed and closes the storages.
+func NewOfflineView(path string, table Table, codec Codec, options ...ViewOption) (*View, error) {
+	options = append(
+		// default options comes first
+		[]ViewOption{
+			WithViewClientID(fmt.Sprintf("goka-offline-view-%s", table)),
+			WithViewLogger(logger.Default()),
+			WithViewCallback(DefaultUpdate),
+			WithViewStorageBuilder(storage.ReadOnlyBuilder(path)),
+		},
+
+		// then the user passed options
+		options...,
+	)
+
+	opts := new(voptions)
+	err := opts.applyOptions(table, codec, options...)
+	if err != nil {
+		return nil, fmt.Errorf("Error applying user-defined options: %v", err)
+	}
+	opts.tableCodec = codec
+
+	npar, err := findOfflinePartitions(path, string(table))
+	if err != nil {
+		return nil, err
+	}
+
+	v := &View{
+		topic:   string(table),
+		opts:    opts,
+		log:     logger.With(opts.log.Prefix(fmt.Sprintf("OfflineView %s", table)), "topic", string(table)),
+		state:   newViewSignal(),
+		offline: true,
+	}
+
+	for partition := int32(0); partition < npar; partition++ {
+		st, err := opts.builders.storage(v.topic, partition)
+		if err != nil {
+			v.close()
+			return nil, fmt.Errorf("error opening storage for partition %d: %v", partition, err)
+		}
+		if err := st.Open(); err != nil {
+			v.close()
+			return nil, fmt.Errorf("error opening storage for partition %d: %v", partition, err)
+		}
+
+		pt := newPartitionTable(v.topic,
+			partition,
+			nil,
+			nil,
+			opts.updateCallback,
+			opts.builders.storage,
+			logger.With(v.log.Prefix(fmt.Sprintf("PartTable-%d", partition)), "partition", partition),
+			nil,
+			opts.backoffResetTime,
+		)
+		pt.st = &storageProxy{
+			Storage:   st,
+			partition: partition,
+			update:    opts.updateCallback,
+		}
+		pt.state.SetState(State(PartitionRunning))
+		v.partitions = append(v.partitions, pt)
+	}
+
+	v.state.SetState(State(ViewStateRunning))
+	return v, nil
+}
+
+// findOfflinePartitions returns the number of partitions of table stored in path.
+func findOfflinePartitions(path, table string) (int32, error) {
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return 0, fmt.Errorf("error reading storage path %s: %v", path, err)
+	}
+
+	partitions := make(map[int32]bool)
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), table+".") {
+			continue
+		}
+		partition, err := strconv.ParseInt(strings.TrimPrefix(entry.Name(), table+"."), 10, 32)
+		if err != nil {
+			continue
+		}
+		partitions[int32(partition)] = true
+	}
+
+	if len(partitions) == 0 {
+		return 0, fmt.Errorf("no storage found for table %s in %s", table, path)
+	}
+
+	// check assumption that partitions are gap-less
+	for i := 0; i < len(partitions); i++ {
+		if !partitions[int32(i)] {
+			return 0, fmt.Errorf("Partition numbers are not sequential for table %s in %s", table, path)
+		}
+	}
+	return int32(len(partitions)), nil
+}
+
+// runOffline runs an offline view until the context is closed.
+func (v *View) runOffline(ctx context.Context) error {
+	for _, partition := range v.partitions {
+		go partition.RunStatsLoop(ctx)
+	}
+	<-ctx.Done()
+
+	defer v.state.SetState(State(ViewStateIdle))
+	return v.close()
+}
@@ -0,0 +1,87 @@
+package goka
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
+)
+
+func TestView_Offline(t *testing.T) {
+	path, err := ioutil.TempDir("", "goka_offline_view_")
+	test.AssertNil(t, err)
+	defer os.RemoveAll(path)
+
+	// find the partition of the key like the view does
+	keyPartition, err := (&View{
+		opts:       &voptions{hasher: DefaultHasher()},
+		partitions: make([]*PartitionTable, 2),
+	}).hash("key")
+	test.AssertNil(t, err)
+
+	// create the storages like a processor or view would do
+	builder := storage.DefaultBuilder(path)
+	for partition := int32(0); partition < 2; partition++ {
+		st, err := builder("table", partition)
+		test.AssertNil(t, err)
+		test.AssertNil(t, st.MarkRecovered())
+		if partition == keyPartition {
+			test.AssertNil(t, st.Set("key", []byte("value")))
+		}
+		test.AssertNil(t, st.Close())
+	}
+
+	t.Run("fail_missing", func(t *testing.T) {
+		_, err := NewOfflineView(path, "other-table", new(codec.String))
+		test.AssertNotNil(t, err)
+	})
+
+	t.Run("succeed", func(t *testing.T) {
+		view, err := NewOfflineView(path, "table", new(codec.String))
+		test.AssertNil(t, err)
+		test.AssertTrue(t, view.Recovered())
+		test.AssertEqual(t, len(view.partitions), 2)
+
+		value, err := view.Get("key")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, value, "value")
+
+		has, err := view.Has("other-key")
+		test.AssertNil(t, err)
+		test.AssertFalse(t, has)
+
+		iter, err := view.Iterator()
+		test.AssertNil(t, err)
+		var keys int
+		for iter.Next() {
+			value, err := iter.Value()
+			test.AssertNil(t, err)
+			test.AssertEqual(t, value, "value")
+			keys++
+		}
+		iter.Release()
+		test.AssertEqual(t, keys, 1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		test.AssertNil(t, view.Run(ctx))
+	})
+
+	t.Run("succeed_option", func(t *testing.T) {
+		view, err := NewView([]string{"unreachable:9092"}, "table", new(codec.String),
+			WithViewOfflineStorage(path),
+		)
+		test.AssertNil(t, err)
+		test.AssertTrue(t, view.Recovered())
+
+		value, err := view.Get("key")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, value, "value")
+
+		test.AssertNil(t, view.close())
+	})
+}
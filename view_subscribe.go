@@ -0,0 +1,152 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/lovoo/goka/storage"
+)
+
+const defaultSubscribeBufferSize = 100
+
+// Update is a change of a view's table sent to the subscribers of the view.
+// Value is nil if the key was deleted.
+type Update struct {
+	Key       string
+	Value     interface{}
+	Partition int32
+}
+
+// SubscribePolicy defines what happens to the updates if a subscriber's
+// channel is full.
+type SubscribePolicy int
+
+const (
+	// SubscribeBlock blocks the partition's updates until the subscriber
+	// reads from the channel. A slow subscriber slows down the view.
+	SubscribeBlock SubscribePolicy = iota
+	// SubscribeDrop drops the updates the subscriber cannot receive.
+	SubscribeDrop
+)
+
+type viewSubscriber struct {
+	ctx     context.Context
+	updates chan Update
+}
+
+// viewSubscriptions sends the updates applied by the update callback to the
+// subscribers.
+type viewSubscriptions struct {
+	m           sync.RWMutex
+	subscribers map[*viewSubscriber]struct{}
+	bufferSize  int
+	policy      SubscribePolicy
+	codec       func() Codec
+	// returns whether the partition is recovered, so only live updates are sent
+	recovered func(partition int32) bool
+}
+
+func newViewSubscriptions(bufferSize int, policy SubscribePolicy, codec func() Codec) *viewSubscriptions {
+	return &viewSubscriptions{
+		subscribers: make(map[*viewSubscriber]struct{}),
+		bufferSize:  bufferSize,
+		policy:      policy,
+		codec:       codec,
+	}
+}
+
+func (vs *viewSubscriptions) subscribe(ctx context.Context) <-chan Update {
+	sub := &viewSubscriber{
+		ctx:     ctx,
+		updates: make(chan Update, vs.bufferSize),
+	}
+	vs.m.Lock()
+	vs.subscribers[sub] = struct{}{}
+	vs.m.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		vs.unsubscribe(sub)
+	}()
+	return sub.updates
+}
+
+// unsubscribe removes the subscriber and closes its channel, unless it was
+// closed already.
+func (vs *viewSubscriptions) unsubscribe(sub *viewSubscriber) {
+	vs.m.Lock()
+	defer vs.m.Unlock()
+	if _, ok := vs.subscribers[sub]; ok {
+		delete(vs.subscribers, sub)
+		close(sub.updates)
+	}
+}
+
+// closeAll removes all subscribers and closes their channels. It is nil-safe.
+func (vs *viewSubscriptions) closeAll() {
+	if vs == nil {
+		return
+	}
+	vs.m.Lock()
+	defer vs.m.Unlock()
+	for sub := range vs.subscribers {
+		delete(vs.subscribers, sub)
+		close(sub.updates)
+	}
+}
+
+// wrapUpdate sends the updates of recovered partitions to the subscribers
+// after they were applied.
+func (vs *viewSubscriptions) wrapUpdate(cb UpdateCallback) UpdateCallback {
+	return func(s storage.Storage, partition int32, key string, value []byte) error {
+		if err := cb(s, partition, key, value); err != nil {
+			return err
+		}
+		return vs.publish(partition, key, value)
+	}
+}
+
+func (vs *viewSubscriptions) publish(partition int32, key string, value []byte) error {
+	// the subscribers are not removed while sending
+	vs.m.RLock()
+	defer vs.m.RUnlock()
+	if len(vs.subscribers) == 0 || vs.recovered == nil || !vs.recovered(partition) {
+		return nil
+	}
+
+	update := Update{Key: key, Partition: partition}
+	if value != nil {
+		decoded, err := vs.codec().Decode(value)
+		if err != nil {
+			return fmt.Errorf("error decoding value for subscribers (key %s): %v", key, err)
+		}
+		update.Value = decoded
+	}
+
+	for sub := range vs.subscribers {
+		if vs.policy == SubscribeDrop {
+			select {
+			case sub.updates <- update:
+			default:
+			}
+			continue
+		}
+		select {
+		case sub.updates <- update:
+		case <-sub.ctx.Done():
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a channel receiving the changes of the view's table once
+// the changed partition is recovered. The channel is closed when ctx is done or
+// the view stops running. If the subscriber does not keep up, the updates are
+// blocked or dropped as configured with WithViewSubscribeBuffer.
+func (v *View) Subscribe(ctx context.Context) (<-chan Update, error) {
+	if v.subscriptions == nil {
+		return nil, fmt.Errorf("view %s does not support subscriptions", v.Topic())
+	}
+	return v.subscriptions.subscribe(ctx), nil
+}
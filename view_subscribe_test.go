@@ -0,0 +1,53 @@
+package goka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestViewSubscriptions_publish(t *testing.T) {
+	newSubscriptions := func(policy SubscribePolicy) *viewSubscriptions {
+		vs := newViewSubscriptions(1, policy, func() Codec { return new(codec.String) })
+		vs.recovered = func(partition int32) bool { return partition == 0 }
+		return vs
+	}
+
+	t.Run("drop", func(t *testing.T) {
+		vs := newSubscriptions(SubscribeDrop)
+		updates := vs.subscribe(context.Background())
+
+		// the second update does not fit into the buffer
+		test.AssertNil(t, vs.publish(0, "a", []byte("1")))
+		test.AssertNil(t, vs.publish(0, "b", []byte("2")))
+		test.AssertEqual(t, <-updates, Update{Key: "a", Value: "1"})
+		test.AssertEqual(t, len(updates), 0)
+	})
+	t.Run("skip_recovering", func(t *testing.T) {
+		vs := newSubscriptions(SubscribeBlock)
+		updates := vs.subscribe(context.Background())
+
+		test.AssertNil(t, vs.publish(1, "a", []byte("1")))
+		test.AssertEqual(t, len(updates), 0)
+	})
+	t.Run("block_until_unsubscribed", func(t *testing.T) {
+		vs := newSubscriptions(SubscribeBlock)
+		ctx, cancel := context.WithCancel(context.Background())
+		updates := vs.subscribe(ctx)
+
+		test.AssertNil(t, vs.publish(0, "a", []byte("1")))
+		published := make(chan struct{})
+		go func() {
+			defer close(published)
+			test.AssertNil(t, vs.publish(0, "b", []byte("2")))
+		}()
+
+		cancel()
+		<-published
+		test.AssertEqual(t, <-updates, Update{Key: "a", Value: "1"})
+		_, ok := <-updates
+		test.AssertFalse(t, ok)
+	})
+}
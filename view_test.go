@@ -257,6 +257,51 @@ func TestView_Get(t *testing.T) {
 	})
 }
 
+func TestView_GetCtx(t *testing.T) {
+	t.Run("succeed", func(t *testing.T) {
+		view := createMemoryTestView(t, "table", map[string]string{"key": "value"})
+
+		value, err := view.GetCtx(context.Background(), "key")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, value, "value")
+	})
+	t.Run("fail_canceled", func(t *testing.T) {
+		view, _, ctrl := createTestView(t, NewMockAutoConsumer(t, DefaultConfig()))
+		defer ctrl.Finish()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// the storage is not read, so the mock does not expect any call
+		_, err := view.GetCtx(ctx, "key")
+		test.AssertEqual(t, err, context.Canceled)
+	})
+}
+
+func TestView_GetAll(t *testing.T) {
+	t.Run("succeed", func(t *testing.T) {
+		view := createMemoryTestView(t, "table",
+			map[string]string{"a": "1", "b": "2"},
+			map[string]string{"c": "3"},
+		)
+		// keys are stored in the partitions of the memory test view regardless of their hash
+		view.opts.hasher = func() hash.Hash32 {
+			return newConstHasher(0)
+		}
+
+		values, err := view.GetAll([]string{"a", "b", "missing"})
+		test.AssertNil(t, err)
+		test.AssertEqual(t, values, map[string]interface{}{"a": "1", "b": "2"})
+	})
+	t.Run("fail_not_recovered", func(t *testing.T) {
+		view := createMemoryTestView(t, "table", map[string]string{"a": "1"})
+		view.partitions[0].state.SetState(State(PartitionRecovering))
+
+		_, err := view.GetAll([]string{"a"})
+		test.AssertNotNil(t, err)
+	})
+}
+
 func TestView_Has(t *testing.T) {
 	t.Run("succeed", func(t *testing.T) {
 		view, bm, ctrl := createTestView(t, NewMockAutoConsumer(t, DefaultConfig()))
@@ -362,6 +407,27 @@ func TestView_Evict(t *testing.T) {
 		err := view.Evict(key)
 		test.AssertNil(t, err)
 	})
+	t.Run("succeed_callback", func(t *testing.T) {
+		view := createMemoryTestView(t, "table", map[string]string{"key": "value"})
+		var evicted []string
+		view.opts.evictCallback = func(key string) {
+			evicted = append(evicted, key)
+		}
+
+		test.AssertNil(t, view.Evict("key"))
+		test.AssertEqual(t, evicted, []string{"key"})
+	})
+	t.Run("succeed_update_callback", func(t *testing.T) {
+		var evicted []string
+		update := wrapEvictUpdate(DefaultUpdate, func(key string) {
+			evicted = append(evicted, key)
+		})
+
+		st := storage.NewMemory()
+		test.AssertNil(t, update(st, 0, "key", []byte("value")))
+		test.AssertNil(t, update(st, 0, "key", nil))
+		test.AssertEqual(t, evicted, []string{"key"})
+	})
 }
 
 func TestView_Recovered(t *testing.T) {
@@ -400,6 +466,131 @@ func TestView_Recovered(t *testing.T) {
 	})
 }
 
+func TestView_Ready(t *testing.T) {
+	t.Run("ready", func(t *testing.T) {
+		view, _, ctrl := createTestView(t, NewMockAutoConsumer(t, DefaultConfig()))
+		defer ctrl.Finish()
+
+		view.partitions = []*PartitionTable{
+			&PartitionTable{
+				state: NewSignal(State(PartitionRunning)).SetState(State(PartitionRunning)),
+			},
+		}
+		view.opts.readinessCheck = func() error { return nil }
+		test.AssertTrue(t, view.Ready())
+	})
+	t.Run("not_recovered", func(t *testing.T) {
+		view, _, ctrl := createTestView(t, NewMockAutoConsumer(t, DefaultConfig()))
+		defer ctrl.Finish()
+
+		view.partitions = []*PartitionTable{
+			&PartitionTable{
+				state: NewSignal(State(PartitionRunning), State(PartitionRecovering)).SetState(State(PartitionRecovering)),
+			},
+		}
+		view.opts.readinessCheck = func() error { return nil }
+		test.AssertFalse(t, view.Ready())
+	})
+	t.Run("check_fails", func(t *testing.T) {
+		view, _, ctrl := createTestView(t, NewMockAutoConsumer(t, DefaultConfig()))
+		defer ctrl.Finish()
+
+		view.partitions = []*PartitionTable{
+			&PartitionTable{
+				state: NewSignal(State(PartitionRunning)).SetState(State(PartitionRunning)),
+			},
+		}
+		view.opts.readinessCheck = func() error { return fmt.Errorf("downstream not reachable") }
+		test.AssertFalse(t, view.Ready())
+	})
+}
+
+func TestView_VerifyCodec(t *testing.T) {
+	t.Run("succeed", func(t *testing.T) {
+		view := createMemoryTestView(t, "table",
+			map[string]string{"a": "1", "b": "2"},
+			map[string]string{"c": "3"},
+		)
+		view.opts.tableCodec = new(codec.Int64)
+		test.AssertNil(t, view.VerifyCodec(10, 0))
+	})
+	t.Run("fail", func(t *testing.T) {
+		view := createMemoryTestView(t, "table",
+			map[string]string{"a": "1"},
+			map[string]string{"b": "not-a-number"},
+		)
+		view.opts.tableCodec = new(codec.Int64)
+		err := view.VerifyCodec(10, 0)
+		test.AssertNotNil(t, err)
+		test.AssertStringContains(t, err.Error(), "key b")
+	})
+	t.Run("failure_ratio", func(t *testing.T) {
+		view := createMemoryTestView(t, "table",
+			map[string]string{"a": "1", "b": "2"},
+			map[string]string{"c": "3", "d": "not-a-number"},
+		)
+		view.opts.tableCodec = new(codec.Int64)
+		// one of four values fails
+		test.AssertNil(t, view.VerifyCodec(10, 0.25))
+		test.AssertNotNil(t, view.VerifyCodec(10, 0.2))
+		test.AssertNotNil(t, view.VerifyCodec(10, 1.5))
+	})
+	t.Run("sample_size", func(t *testing.T) {
+		view := createMemoryTestView(t, "table",
+			map[string]string{"a": "1"},
+			map[string]string{"b": "not-a-number"},
+		)
+		view.opts.tableCodec = new(codec.Int64)
+		// only the first partition is sampled
+		test.AssertNil(t, view.VerifyCodec(1, 0))
+	})
+	t.Run("fail_not_recovered", func(t *testing.T) {
+		view := createMemoryTestView(t, "table", map[string]string{"a": "1"})
+		view.partitions[0].state.SetState(State(PartitionRecovering))
+		test.AssertNotNil(t, view.VerifyCodec(10, 0))
+	})
+}
+
+func TestView_SetCodec(t *testing.T) {
+	view := createMemoryTestView(t, "table", map[string]string{"key": "1"})
+
+	value, err := view.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, value, "1")
+	test.AssertEqual(t, view.Codec(), Codec(new(codec.String)))
+
+	// migration not confirmed
+	err = view.SetCodec(new(codec.Int64), func() bool { return false })
+	test.AssertNotNil(t, err)
+	err = view.SetCodec(new(codec.Int64), nil)
+	test.AssertNotNil(t, err)
+
+	value, err = view.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, value, "1")
+
+	err = view.SetCodec(new(codec.Int64), func() bool { return true })
+	test.AssertNil(t, err)
+	test.AssertEqual(t, view.Codec(), Codec(new(codec.Int64)))
+
+	value, err = view.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, value, int64(1))
+}
+
+func TestView_NumPartitions(t *testing.T) {
+	view := createMemoryTestView(t, "table", map[string]string{}, map[string]string{})
+	test.AssertEqual(t, view.NumPartitions(), 2)
+}
+
+func TestView_Sync(t *testing.T) {
+	view := createMemoryTestView(t, "table", map[string]string{"key": "value"}, map[string]string{})
+	test.AssertNil(t, view.Sync())
+
+	view.partitions[1].state.SetState(State(PartitionRecovering))
+	test.AssertNotNil(t, view.Sync())
+}
+
 func TestView_Topic(t *testing.T) {
 	t.Run("succeed", func(t *testing.T) {
 		view, _, ctrl := createTestView(t, NewMockAutoConsumer(t, DefaultConfig()))
@@ -692,6 +883,67 @@ func TestView_createPartitions(t *testing.T) {
 	})
 }
 
+func TestView_Reload(t *testing.T) {
+	t.Run("succeed_unchanged", func(t *testing.T) {
+		view, bm, ctrl := createTestView(t, NewMockAutoConsumer(t, DefaultConfig()))
+		defer ctrl.Finish()
+
+		view.tmgr = bm.tmgr
+		view.knownPartitions = 2
+		bm.tmgr.EXPECT().Partitions(viewTestTopic).Return([]int32{0, 1}, nil)
+
+		test.AssertNil(t, view.Reload(context.Background()))
+	})
+	t.Run("succeed_added", func(t *testing.T) {
+		view, bm, ctrl := createTestView(t, NewMockAutoConsumer(t, DefaultConfig()))
+		defer ctrl.Finish()
+
+		view.tmgr = bm.tmgr
+		view.knownPartitions = 1
+		view.added = make(chan []*PartitionTable, 1)
+		bm.tmgr.EXPECT().Partitions(viewTestTopic).Return([]int32{0, 1, 2}, nil)
+
+		test.AssertNil(t, view.Reload(context.Background()))
+		test.AssertEqual(t, view.knownPartitions, 3)
+
+		added := <-view.added
+		test.AssertEqual(t, len(added), 2)
+		test.AssertEqual(t, added[0].partition, int32(1))
+		test.AssertEqual(t, added[1].partition, int32(2))
+	})
+	t.Run("fail_removed", func(t *testing.T) {
+		view, bm, ctrl := createTestView(t, NewMockAutoConsumer(t, DefaultConfig()))
+		defer ctrl.Finish()
+
+		view.tmgr = bm.tmgr
+		view.knownPartitions = 2
+		bm.tmgr.EXPECT().Partitions(viewTestTopic).Return([]int32{0}, nil)
+
+		test.AssertNotNil(t, view.Reload(context.Background()))
+	})
+	t.Run("fail_not_running", func(t *testing.T) {
+		view, bm, ctrl := createTestView(t, NewMockAutoConsumer(t, DefaultConfig()))
+		defer ctrl.Finish()
+
+		view.tmgr = bm.tmgr
+		view.knownPartitions = 1
+		view.added = make(chan []*PartitionTable)
+		bm.tmgr.EXPECT().Partitions(viewTestTopic).Return([]int32{0, 1}, nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		test.AssertEqual(t, view.Reload(ctx), context.Canceled)
+		test.AssertEqual(t, view.knownPartitions, 1)
+	})
+	t.Run("fail_offline", func(t *testing.T) {
+		view, _, ctrl := createTestView(t, NewMockAutoConsumer(t, DefaultConfig()))
+		defer ctrl.Finish()
+
+		view.offline = true
+		test.AssertNotNil(t, view.Reload(context.Background()))
+	})
+}
+
 func TestView_WaitRunning(t *testing.T) {
 	t.Run("succeed", func(t *testing.T) {
 		view, _, ctrl := createTestView(t, NewMockAutoConsumer(t, DefaultConfig()))
@@ -859,3 +1111,102 @@ func ExampleView_autoreconnect() {
 	cancel()
 	<-done
 }
+
+func TestView_IteratorSeek(t *testing.T) {
+	view := createMemoryTestView(t, "table",
+		map[string]string{"a": "1", "c": "3", "e": "5"},
+		map[string]string{"b": "2", "d": "4"},
+	)
+
+	// pages through the view starting at cursor
+	page := func(cursor string, size int) (keys []string, next string) {
+		iter, err := view.Iterator()
+		test.AssertNil(t, err)
+		defer iter.Release()
+
+		if cursor != "" && !iter.Seek(cursor) {
+			return nil, ""
+		}
+		for iter.Next() {
+			if len(keys) == size {
+				return keys, iter.Key()
+			}
+			keys = append(keys, iter.Key())
+		}
+		test.AssertNil(t, iter.Err())
+		return keys, ""
+	}
+
+	keys, next := page("", 2)
+	test.AssertEqual(t, keys, []string{"a", "b"})
+	test.AssertEqual(t, next, "c")
+	keys, next = page(next, 2)
+	test.AssertEqual(t, keys, []string{"c", "d"})
+	test.AssertEqual(t, next, "e")
+	keys, next = page(next, 2)
+	test.AssertEqual(t, keys, []string{"e"})
+	test.AssertEqual(t, next, "")
+
+	// seeking to a missing key starts at the next key
+	keys, _ = page("bb", 10)
+	test.AssertEqual(t, keys, []string{"c", "d", "e"})
+	keys, _ = page("f", 10)
+	test.AssertEqual(t, len(keys), 0)
+}
+
+func TestView_IteratorReverse(t *testing.T) {
+	view := createMemoryTestView(t, "table",
+		map[string]string{"a": "1", "c": "3", "e": "5"},
+		map[string]string{"b": "2", "d": "4"},
+	)
+
+	keysFrom := func(seek string) []string {
+		iter, err := view.IteratorReverse()
+		test.AssertNil(t, err)
+		defer iter.Release()
+
+		if seek != "" && !iter.Seek(seek) {
+			return nil
+		}
+		var keys []string
+		for iter.Next() {
+			keys = append(keys, iter.Key())
+		}
+		test.AssertNil(t, iter.Err())
+		return keys
+	}
+
+	test.AssertEqual(t, keysFrom(""), []string{"e", "d", "c", "b", "a"})
+	test.AssertEqual(t, keysFrom("c"), []string{"c", "b", "a"})
+	// seeking to a missing key starts at the previous key
+	test.AssertEqual(t, keysFrom("cc"), []string{"c", "b", "a"})
+	test.AssertEqual(t, len(keysFrom("0")), 0)
+}
+
+func TestView_IteratorWithPrefix(t *testing.T) {
+	t.Run("succeed", func(t *testing.T) {
+		view := createMemoryTestView(t, "table",
+			map[string]string{"tenant-a:1": "1", "tenant-b:1": "2"},
+			map[string]string{"tenant-a:2": "3", "tenant-a;": "4"},
+		)
+
+		iter, err := view.IteratorWithPrefix("tenant-a:")
+		test.AssertNil(t, err)
+		defer iter.Release()
+
+		values := make(map[string]interface{})
+		for iter.Next() {
+			value, err := iter.Value()
+			test.AssertNil(t, err)
+			values[iter.Key()] = value
+		}
+		test.AssertEqual(t, values, map[string]interface{}{"tenant-a:1": "1", "tenant-a:2": "3"})
+	})
+	t.Run("fail_not_recovered", func(t *testing.T) {
+		view := createMemoryTestView(t, "table", map[string]string{}, map[string]string{})
+		view.partitions[1].state.SetState(State(PartitionRecovering))
+
+		_, err := view.IteratorWithPrefix("tenant-a:")
+		test.AssertNotNil(t, err)
+	})
+}
@@ -0,0 +1,228 @@
+package goka
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/storage"
+)
+
+// timestampSize is the size of the timestamp prefixed to the stored values.
+const timestampSize = 8
+
+// recordTimestamps keeps the timestamp storages of the view's partitions.
+type recordTimestamps struct {
+	m        sync.RWMutex
+	storages map[int32]*timestampStorage
+}
+
+func newRecordTimestamps() *recordTimestamps {
+	return &recordTimestamps{
+		storages: make(map[int32]*timestampStorage),
+	}
+}
+
+// wrapOptions wraps the view's storage builder to store the record timestamps.
+// A nil recordTimestamps keeps the options unchanged.
+func (rt *recordTimestamps) wrapOptions(opt *voptions) {
+	if rt != nil {
+		opt.builders.storage = rt.wrapBuilder(opt.builders.storage)
+	}
+}
+
+// wrapBuilder wraps the storage builder to store the record timestamps with the values.
+func (rt *recordTimestamps) wrapBuilder(builder storage.Builder) storage.Builder {
+	return func(topic string, partition int32) (storage.Storage, error) {
+		st, err := builder(topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		ts := &timestampStorage{Storage: st}
+
+		rt.m.Lock()
+		defer rt.m.Unlock()
+		rt.storages[partition] = ts
+		return ts, nil
+	}
+}
+
+func (rt *recordTimestamps) get(partition int32) (*timestampStorage, error) {
+	rt.m.RLock()
+	defer rt.m.RUnlock()
+	ts, ok := rt.storages[partition]
+	if !ok {
+		return nil, fmt.Errorf("no storage for partition %d", partition)
+	}
+	return ts, nil
+}
+
+// setCurrent sets the timestamp of the record the partition's next writes belong to.
+func (rt *recordTimestamps) setCurrent(partition int32, timestamp time.Time) {
+	if ts, err := rt.get(partition); err == nil {
+		ts.current = timestamp
+	}
+}
+
+// timestampStorage prefixes all values with the timestamp of the record
+// currently being stored and removes the prefix when reading.
+type timestampStorage struct {
+	storage.Storage
+	// current is only accessed by the partition's loading goroutine
+	current time.Time
+}
+
+func (s *timestampStorage) Get(key string) ([]byte, error) {
+	value, _, err := s.getWithTimestamp(key)
+	return value, err
+}
+
+func (s *timestampStorage) getWithTimestamp(key string) ([]byte, time.Time, error) {
+	data, err := s.Storage.Get(key)
+	if err != nil || data == nil {
+		return nil, time.Time{}, err
+	}
+	return splitTimestamp(data)
+}
+
+func (s *timestampStorage) Set(key string, value []byte) error {
+	data := make([]byte, timestampSize+len(value))
+	var nanos int64
+	if !s.current.IsZero() {
+		nanos = s.current.UnixNano()
+	}
+	binary.BigEndian.PutUint64(data, uint64(nanos))
+	copy(data[timestampSize:], value)
+	return s.Storage.Set(key, data)
+}
+
+func (s *timestampStorage) ApproximateSize() (int64, error) {
+	return storage.ApproximateSize(s.Storage)
+}
+
+func (s *timestampStorage) Compact() error {
+	return storage.Compact(s.Storage)
+}
+
+func (s *timestampStorage) Iterator() (storage.Iterator, error) {
+	iter, err := s.Storage.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	return &timestampIterator{Iterator: iter}, nil
+}
+
+func (s *timestampStorage) IteratorWithRange(start, limit []byte) (storage.Iterator, error) {
+	iter, err := s.Storage.IteratorWithRange(start, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &timestampIterator{Iterator: iter}, nil
+}
+
+// splitTimestamp splits a stored value into the value and the timestamp.
+func splitTimestamp(data []byte) ([]byte, time.Time, error) {
+	if len(data) < timestampSize {
+		return nil, time.Time{}, fmt.Errorf("stored value has no timestamp")
+	}
+	var timestamp time.Time
+	if nanos := int64(binary.BigEndian.Uint64(data)); nanos != 0 {
+		timestamp = time.Unix(0, nanos)
+	}
+	return data[timestampSize:], timestamp, nil
+}
+
+// timestampIterator removes the timestamps from the values.
+type timestampIterator struct {
+	storage.Iterator
+}
+
+func (i *timestampIterator) Value() ([]byte, error) {
+	data, err := i.Iterator.Value()
+	if err != nil || data == nil {
+		return nil, err
+	}
+	value, _, err := splitTimestamp(data)
+	return value, err
+}
+
+// WithViewRecordTimestamps stores the Kafka timestamp of the record that last
+// set a key along with the value, which can be read with View.GetWithTimestamp.
+// This adds 8 bytes to every value in the local storage. The storage must be
+// recovered from scratch when enabling or disabling the option.
+func WithViewRecordTimestamps() ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.timestamps = newRecordTimestamps()
+	}
+}
+
+// GetWithTimestamp returns the value for the key like Get and the Kafka timestamp
+// of the record that last set the key. The timestamp is zero if the key does not
+// exist or the record had no timestamp.
+// It requires the view to be created with WithViewRecordTimestamps.
+func (v *View) GetWithTimestamp(key string) (interface{}, time.Time, error) {
+	if v.opts.timestamps == nil {
+		return nil, time.Time{}, fmt.Errorf("view %s does not record timestamps", v.Topic())
+	}
+
+	partTable, err := v.find(key)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if !partTable.IsRecovered() {
+		return nil, time.Time{}, fmt.Errorf("Partition is not running so it's not safe to read values")
+	}
+	ts, err := v.opts.timestamps.get(partTable.partition)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	data, timestamp, err := ts.getWithTimestamp(key)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("error getting value (key %s): %v", key, err)
+	} else if data == nil {
+		return nil, time.Time{}, nil
+	}
+
+	value, err := v.codec().Decode(data)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("error decoding value (key %s): %v", key, err)
+	}
+	return value, timestamp, nil
+}
+
+// GetFresh returns the value for the key like Get. If the key does not exist or
+// was last updated longer than maxStaleness ago, GetFresh first waits until the
+// key's partition has consumed all messages that were in the table topic when
+// GetFresh was called, so a more recent update of the key is materialized
+// before returning. It returns an error if the context is done before.
+// It requires the view to be created with WithViewRecordTimestamps.
+func (v *View) GetFresh(ctx context.Context, key string, maxStaleness time.Duration) (interface{}, error) {
+	value, updatedAt, err := v.GetWithTimestamp(key)
+	if err != nil {
+		return nil, err
+	}
+	if value != nil && time.Since(updatedAt) <= maxStaleness {
+		return value, nil
+	}
+
+	partTable, err := v.find(key)
+	if err != nil {
+		return nil, err
+	}
+	hwm, err := v.tmgr.GetOffset(v.recoveryTopic(), partTable.partition, sarama.OffsetNewest)
+	if err != nil {
+		return nil, fmt.Errorf("error getting newest offset (topic %s, partition %d): %v", v.recoveryTopic(), partTable.partition, err)
+	}
+	if hwm > 0 {
+		if err := partTable.waitForOffset(ctx, hwm-1); err != nil {
+			return nil, err
+		}
+	}
+
+	value, _, err = v.GetWithTimestamp(key)
+	return value, err
+}
@@ -0,0 +1,135 @@
+package goka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
+)
+
+func TestView_GetWithTimestamp(t *testing.T) {
+	t.Run("succeed", func(t *testing.T) {
+		view := createMemoryTestView(t, "table", map[string]string{})
+		view.opts.timestamps = newRecordTimestamps()
+		st, err := view.opts.timestamps.wrapBuilder(func(topic string, partition int32) (storage.Storage, error) {
+			return storage.NewMemory(), nil
+		})("table", 0)
+		test.AssertNil(t, err)
+		view.partitions[0].st = &storageProxy{Storage: st, update: DefaultUpdate}
+
+		updatedAt := time.Unix(1600000000, 0)
+		view.opts.timestamps.setCurrent(0, updatedAt)
+		test.AssertNil(t, view.partitions[0].st.Update("key", []byte("value")))
+
+		value, timestamp, err := view.GetWithTimestamp("key")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, value, "value")
+		test.AssertTrue(t, timestamp.Equal(updatedAt))
+
+		// the timestamps are hidden from Get and iterators
+		value, err = view.Get("key")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, value, "value")
+		it, err := view.Iterator()
+		test.AssertNil(t, err)
+		defer it.Release()
+		test.AssertTrue(t, it.Next())
+		value, err = it.Value()
+		test.AssertNil(t, err)
+		test.AssertEqual(t, value, "value")
+
+		value, timestamp, err = view.GetWithTimestamp("missing")
+		test.AssertNil(t, err)
+		test.AssertNil(t, value)
+		test.AssertTrue(t, timestamp.IsZero())
+	})
+	t.Run("fail_not_enabled", func(t *testing.T) {
+		view := createMemoryTestView(t, "table", map[string]string{"key": "value"})
+
+		_, _, err := view.GetWithTimestamp("key")
+		test.AssertNotNil(t, err)
+	})
+}
+
+func TestView_GetFresh(t *testing.T) {
+	ctrl := NewMockController(t)
+	defer ctrl.Finish()
+
+	view := createMemoryTestView(t, "table", map[string]string{})
+	view.opts.timestamps = newRecordTimestamps()
+	// the test stores the values concurrently to GetFresh
+	st, err := view.opts.timestamps.wrapBuilder(func(topic string, partition int32) (storage.Storage, error) {
+		return &syncedStorage{Storage: storage.NewMemory()}, nil
+	})("table", 0)
+	test.AssertNil(t, err)
+	view.partitions[0].st = &storageProxy{Storage: st, update: DefaultUpdate}
+	tmgr := NewMockTopicManager(ctrl)
+	view.tmgr = tmgr
+
+	store := func(value string, updatedAt time.Time, offset int64) {
+		view.opts.timestamps.setCurrent(0, updatedAt)
+		test.AssertNil(t, view.partitions[0].st.Update("key", []byte(value)))
+		test.AssertNil(t, view.partitions[0].st.SetOffset(offset))
+	}
+	store("old", time.Now().Add(-time.Hour), 0)
+
+	t.Run("fresh", func(t *testing.T) {
+		value, err := view.GetFresh(context.Background(), "key", 2*time.Hour)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, value, "old")
+	})
+	t.Run("stale", func(t *testing.T) {
+		tmgr.EXPECT().GetOffset("table", int32(0), sarama.OffsetNewest).Return(int64(2), nil)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			store("new", time.Now(), 1)
+		}()
+
+		value, err := view.GetFresh(context.Background(), "key", time.Minute)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, value, "new")
+	})
+	t.Run("fail_context_done", func(t *testing.T) {
+		tmgr.EXPECT().GetOffset("table", int32(0), sarama.OffsetNewest).Return(int64(5), nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := view.GetFresh(ctx, "key", 0)
+		test.AssertEqual(t, err, context.DeadlineExceeded)
+	})
+}
+
+// syncedStorage serializes the accesses to a storage that is not safe for
+// concurrent use, like the memory storage.
+type syncedStorage struct {
+	storage.Storage
+	m sync.Mutex
+}
+
+func (s *syncedStorage) Get(key string) ([]byte, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.Storage.Get(key)
+}
+
+func (s *syncedStorage) Set(key string, value []byte) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.Storage.Set(key, value)
+}
+
+func (s *syncedStorage) GetOffset(defValue int64) (int64, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.Storage.GetOffset(defValue)
+}
+
+func (s *syncedStorage) SetOffset(offset int64) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.Storage.SetOffset(offset)
+}
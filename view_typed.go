@@ -0,0 +1,135 @@
+//go:build go1.18
+// +build go1.18
+
+package goka
+
+import (
+	"fmt"
+)
+
+// KeyCodec encodes typed keys into the string keys used by goka and decodes them back.
+// Note that goka keys are treated as raw bytes, so the encoded string may contain
+// arbitrary binary data. The hasher assigning keys to partitions operates on the
+// encoded bytes.
+type KeyCodec[K any] interface {
+	EncodeKey(key K) (string, error)
+	DecodeKey(key string) (K, error)
+}
+
+// StringKeyCodec is the identity KeyCodec for string keys.
+type StringKeyCodec struct{}
+
+// EncodeKey returns the key as is.
+func (StringKeyCodec) EncodeKey(key string) (string, error) { return key, nil }
+
+// DecodeKey returns the key as is.
+func (StringKeyCodec) DecodeKey(key string) (string, error) { return key, nil }
+
+// BytesKeyCodec is a KeyCodec for binary keys.
+type BytesKeyCodec struct{}
+
+// EncodeKey converts the binary key to a goka key without further encoding.
+func (BytesKeyCodec) EncodeKey(key []byte) (string, error) { return string(key), nil }
+
+// DecodeKey converts the goka key back to bytes.
+func (BytesKeyCodec) DecodeKey(key string) ([]byte, error) { return []byte(key), nil }
+
+// ViewTyped wraps a View to access it using typed keys and values.
+// Keys are encoded using the passed KeyCodec, values are decoded by the view's
+// codec and must be of type V.
+type ViewTyped[K any, V any] struct {
+	view *View
+	keys KeyCodec[K]
+}
+
+// NewViewTyped creates a typed wrapper around view using keys to encode the keys.
+// The view still has to be run by the caller.
+func NewViewTyped[K any, V any](view *View, keys KeyCodec[K]) *ViewTyped[K, V] {
+	return &ViewTyped[K, V]{
+		view: view,
+		keys: keys,
+	}
+}
+
+// View returns the wrapped view.
+func (v *ViewTyped[K, V]) View() *View {
+	return v.view
+}
+
+// Get returns the value for the key. If the key does not exist, the zero value
+// of V is returned without error.
+func (v *ViewTyped[K, V]) Get(key K) (V, error) {
+	value, _, err := v.Find(key)
+	return value, err
+}
+
+// Find returns the value for the key and whether the key exists. Unlike a type
+// assertion on View.Get, a value of another type than V is returned as error.
+func (v *ViewTyped[K, V]) Find(key K) (V, bool, error) {
+	var zero V
+
+	encKey, err := v.keys.EncodeKey(key)
+	if err != nil {
+		return zero, false, fmt.Errorf("error encoding key %v: %v", key, err)
+	}
+
+	value, err := v.view.Get(encKey)
+	if err != nil || value == nil {
+		return zero, false, err
+	}
+
+	typed, err := castValue[V](value)
+	if err != nil {
+		return zero, false, fmt.Errorf("value for key %v: %v", key, err)
+	}
+	return typed, true, nil
+}
+
+// Iterator returns an iterator over the typed keys and values of the view.
+func (v *ViewTyped[K, V]) Iterator() (*IteratorTyped[K, V], error) {
+	iter, err := v.view.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	return &IteratorTyped[K, V]{Iterator: iter, keys: v.keys}, nil
+}
+
+// IteratorTyped iterates over the typed keys and values of a ViewTyped.
+type IteratorTyped[K any, V any] struct {
+	Iterator
+	keys KeyCodec[K]
+}
+
+// Key returns the decoded current key.
+func (i *IteratorTyped[K, V]) Key() (K, error) {
+	return i.keys.DecodeKey(i.Iterator.Key())
+}
+
+// Value returns the current value. The zero value of V is returned for nil
+// values.
+func (i *IteratorTyped[K, V]) Value() (V, error) {
+	var zero V
+	value, err := i.Iterator.Value()
+	if err != nil || value == nil {
+		return zero, err
+	}
+	return castValue[V](value)
+}
+
+// castValue converts a decoded value to V.
+func castValue[V any](value interface{}) (V, error) {
+	typed, ok := value.(V)
+	if !ok {
+		return typed, fmt.Errorf("value has type %T, expected %T", value, typed)
+	}
+	return typed, nil
+}
+
+// Has checks whether a value for passed key exists in the view.
+func (v *ViewTyped[K, V]) Has(key K) (bool, error) {
+	encKey, err := v.keys.EncodeKey(key)
+	if err != nil {
+		return false, fmt.Errorf("error encoding key %v: %v", key, err)
+	}
+	return v.view.Has(encKey)
+}
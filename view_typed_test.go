@@ -0,0 +1,83 @@
+//go:build go1.18
+// +build go1.18
+
+package goka
+
+import (
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestViewTyped(t *testing.T) {
+	view := createMemoryTestView(t, "typed", map[string]string{
+		"key":             "value",
+		string([]byte{0}): "binary",
+	})
+
+	t.Run("string", func(t *testing.T) {
+		tv := NewViewTyped[string, string](view, StringKeyCodec{})
+
+		val, err := tv.Get("key")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, val, "value")
+
+		val, err = tv.Get("not-existing")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, val, "")
+
+		has, err := tv.Has("key")
+		test.AssertNil(t, err)
+		test.AssertTrue(t, has)
+	})
+	t.Run("bytes", func(t *testing.T) {
+		tv := NewViewTyped[[]byte, string](view, BytesKeyCodec{})
+
+		val, err := tv.Get([]byte{0})
+		test.AssertNil(t, err)
+		test.AssertEqual(t, val, "binary")
+	})
+	t.Run("find", func(t *testing.T) {
+		tv := NewViewTyped[string, string](view, StringKeyCodec{})
+
+		val, found, err := tv.Find("key")
+		test.AssertNil(t, err)
+		test.AssertTrue(t, found)
+		test.AssertEqual(t, val, "value")
+
+		_, found, err = tv.Find("not-existing")
+		test.AssertNil(t, err)
+		test.AssertFalse(t, found)
+	})
+	t.Run("iterator", func(t *testing.T) {
+		tv := NewViewTyped[[]byte, string](view, BytesKeyCodec{})
+
+		iter, err := tv.Iterator()
+		test.AssertNil(t, err)
+		defer iter.Release()
+
+		values := make(map[string]string)
+		for iter.Next() {
+			key, err := iter.Key()
+			test.AssertNil(t, err)
+			val, err := iter.Value()
+			test.AssertNil(t, err)
+			values[string(key)] = val
+		}
+		test.AssertNil(t, iter.Err())
+		test.AssertEqual(t, values, map[string]string{"key": "value", string([]byte{0}): "binary"})
+	})
+	t.Run("fail_type", func(t *testing.T) {
+		tv := NewViewTyped[string, int64](view, StringKeyCodec{})
+
+		_, err := tv.Get("key")
+		test.AssertNotNil(t, err)
+
+		iter, err := tv.Iterator()
+		test.AssertNil(t, err)
+		defer iter.Release()
+		test.AssertTrue(t, iter.Next())
+		_, err = iter.Value()
+		test.AssertNotNil(t, err)
+	})
+}
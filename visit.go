@@ -0,0 +1,170 @@
+package goka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/multierr"
+)
+
+// ErrVisitAborted is returned by VisitAllWithStats if a partition was revoked
+// or stopped while it was visited.
+var ErrVisitAborted = errors.New("visit aborted, partition was revoked")
+
+// visit is a key of the group table passed to the partition processor's run
+// loop to be visited.
+type visit struct {
+	key  string
+	name string
+	cb   func(ctx Context)
+	done func(err error)
+}
+
+// VisitAllWithStats calls visit for every key in the group table of all partitions
+// currently assigned to the processor and returns the number of visited keys.
+// The visits are interleaved with the processing of the input messages of their
+// partition, so visit may modify the table (e.g. ctx.SetValue) like a
+// ProcessCallback. Its context's Topic returns name. A key counts as visited once
+// all emits of its visit are done.
+// If a partition is revoked or stopped during the visit, VisitAllWithStats
+// returns ErrVisitAborted. If visit fails (e.g. ctx.Fail), the partition
+// processor fails like for an input message.
+func (g *Processor) VisitAllWithStats(ctx context.Context, name string, visit func(ctx Context)) (int64, error) {
+	if g.graph.GroupTable() == nil {
+		return 0, fmt.Errorf("processor %s has no group table to visit", g.graph.Group())
+	}
+
+	// copy the partitions, a rebalance replaces them while visiting
+	g.partitionsM.RLock()
+	parts := make([]*PartitionProcessor, 0, len(g.partitions))
+	for _, part := range g.partitions {
+		parts = append(parts, part)
+	}
+	g.partitionsM.RUnlock()
+
+	var (
+		visited int64
+		errg, _ = multierr.NewErrGroup(ctx)
+	)
+	for _, part := range parts {
+		part := part
+		errg.Go(func() error {
+			return part.visitAll(ctx, name, visit, &visited)
+		})
+	}
+
+	err := errg.Wait().NilOrError()
+	return atomic.LoadInt64(&visited), err
+}
+
+// visitAll passes all keys of the table to the run loop to be visited and waits
+// until they are visited.
+func (pp *PartitionProcessor) visitAll(ctx context.Context, name string, cb func(ctx Context), visited *int64) error {
+	// wait before checking the state, the partition might just be stopping
+	stopping := pp.state.WaitForStateMin(PPStateStopping)
+	if !pp.state.IsState(PPStateRunning) {
+		return ErrVisitAborted
+	}
+
+	it, err := pp.table.st.Iterator()
+	if err != nil {
+		return fmt.Errorf("error creating iterator for partition %d: %v", pp.partition, err)
+	}
+	defer it.Release()
+
+	var (
+		wg   sync.WaitGroup
+		errs = new(multierr.Errors)
+	)
+	for it.Next() {
+		wg.Add(1)
+		v := &visit{
+			key:  string(it.Key()),
+			name: name,
+			cb:   cb,
+			done: func(err error) {
+				defer wg.Done()
+				if err != nil {
+					errs.Collect(err)
+					return
+				}
+				atomic.AddInt64(visited, 1)
+			},
+		}
+
+		select {
+		case pp.visitInput <- v:
+		case <-stopping:
+			return ErrVisitAborted
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := it.Err(); err != nil {
+		return fmt.Errorf("error iterating partition %d: %v", pp.partition, err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wg.Wait()
+	}()
+	select {
+	case <-done:
+		return errs.NilOrError()
+	case <-stopping:
+		return ErrVisitAborted
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// processVisit calls the visit's callback for its key.
+func (pp *PartitionProcessor) processVisit(ctx context.Context, wg *sync.WaitGroup, v *visit, syncFailer func(err error), asyncFailer func(err error)) {
+	msg := &sarama.ConsumerMessage{
+		Key:       []byte(v.key),
+		Topic:     v.name,
+		Partition: pp.partition,
+		Offset:    -1,
+	}
+	msgContext := &cbContext{
+		ctx:   ctx,
+		graph: pp.graph,
+
+		trackOutputStats: pp.enqueueTrackOutputStats,
+		writeStorage:     pp.writeStorage,
+		pviews:           pp.joins,
+		views:            pp.lookups,
+		keyLocks:         pp.keyLocks,
+		emitLimiter:      pp.emitLimiter,
+		partitionOf:      pp.partitionOf,
+		keyTTL:           pp.keyTTL,
+		clock:            pp.opts.clock,
+		// there is no message to commit, the visit is done once all emits are done
+		commit:     func() { v.done(nil) },
+		wg:         wg,
+		msg:        msg,
+		syncFailer: syncFailer,
+		asyncFailer: func(err error) {
+			v.done(err)
+			asyncFailer(err)
+		},
+		emitter: pp.emit,
+		table:   pp.table,
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			v.done(fmt.Errorf("visiting key %s failed: %v", v.key, r))
+			panic(r)
+		}
+	}()
+
+	msgContext.start()
+	v.cb(msgContext)
+	msgContext.finish(nil)
+}
@@ -60,6 +60,6 @@ func (s *Server) index(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := tmpl.Execute(w, params); err != nil {
-		s.log.Printf("error rendering index template: %v", err)
+		logger.Errorf(s.log, "error rendering index template: %v", err)
 	}
 }
@@ -90,7 +90,7 @@ func (s *Server) index(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := tmpl.Execute(w, params); err != nil {
-		s.log.Printf("error rendering index template: %v", err)
+		logger.Errorf(s.log, "error rendering index template: %v", err)
 	}
 }
 
@@ -162,7 +162,7 @@ func (s *Server) renderProcessor(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err = tmpl.Execute(w, params); err != nil {
-		s.log.Printf("error rendering processor details: %v", err)
+		logger.Errorf(s.log, "error rendering processor details: %v", err)
 	}
 }
 
@@ -191,6 +191,6 @@ func (s *Server) renderView(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err = tmpl.Execute(w, params); err != nil {
-		s.log.Printf("error rendering view details: %v", err)
+		logger.Errorf(s.log, "error rendering view details: %v", err)
 	}
 }
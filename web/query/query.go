@@ -122,7 +122,7 @@ func (s *Server) executeQueryTemplate(w http.ResponseWriter, params map[string]i
 	params["base_path"] = s.basePath
 
 	if err := tmpl.Execute(w, params); err != nil {
-		s.log.Printf("error executing query template: %v", err)
+		logger.Errorf(s.log, "error executing query template: %v", err)
 	}
 }
 